@@ -0,0 +1,114 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/internal/flags"
+	"github.com/containerd/nydus-snapshotter/pkg/diagnose"
+)
+
+// check-image is a one-shot diagnostic for images not being lazily loaded. It uses
+// the nydusd binary and configuration of the snapshotter but does not touch its
+// states, so it is safe to run along with a running snapshotter.
+func checkImageCommand(args *flags.Args) *cli.Command {
+	return &cli.Command{
+		Name:      "check-image",
+		Usage:     "verify an image can be lazily loaded end to end with a throwaway nydusd",
+		ArgsUsage: "<image reference>",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "files",
+				Usage: "number of files to read from the mounted image",
+				Value: 5,
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "timeout of the whole check, nydusd is killed once it passes",
+				Value: time.Minute,
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the report in JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return cli.Exit("exactly one image reference is required", 2)
+			}
+
+			cfg, err := loadSnapshotterConfig(args)
+			if err != nil {
+				return err
+			}
+			if cfg.DaemonConfig.NydusdPath == "" {
+				return errors.New("nydusd binary is not found, specify it with --nydusd")
+			}
+			if cfg.DaemonConfig.FsDriver != config.FsDriverFusedev {
+				return errors.Errorf("check-image requires nydusd configuration of %s driver, specify it with --nydusd-config",
+					config.FsDriverFusedev)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), c.Duration("timeout"))
+			defer cancel()
+
+			report, err := diagnose.CheckImage(ctx, diagnose.Opt{
+				Ref:              c.Args().First(),
+				NydusdPath:       cfg.DaemonConfig.NydusdPath,
+				NydusdConfigPath: cfg.DaemonConfig.NydusdConfigPath,
+				Files:            c.Int("files"),
+				SkipSSLVerify:    cfg.RemoteConfig.SkipSSLVerify,
+			})
+			if err != nil {
+				return err
+			}
+
+			if c.Bool("json") {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				printCheckImageReport(report)
+			}
+
+			if !report.OK() {
+				return cli.Exit("", 1)
+			}
+
+			return nil
+		},
+	}
+}
+
+func printCheckImageReport(report *diagnose.Report) {
+	fmt.Printf("Checking image %s\n", report.Image)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, s := range report.Steps {
+		status, message := "OK", s.Detail
+		if s.Error != "" {
+			status, message = "FAIL", s.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, status, s.Duration, message)
+	}
+	w.Flush()
+}
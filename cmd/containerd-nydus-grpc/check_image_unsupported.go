@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+
+	"github.com/containerd/nydus-snapshotter/internal/flags"
+)
+
+func checkImageCommand(_ *flags.Args) *cli.Command {
+	return &cli.Command{
+		Name:  "check-image",
+		Usage: "verify an image can be lazily loaded end to end, only supported on Linux",
+		Action: func(_ *cli.Context) error {
+			return cli.Exit("check-image is only supported on Linux", 1)
+		},
+	}
+}
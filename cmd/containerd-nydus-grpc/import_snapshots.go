@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/containerd/nydus-snapshotter/internal/constant"
+	"github.com/containerd/nydus-snapshotter/internal/flags"
+	"github.com/containerd/nydus-snapshotter/pkg/importer"
+)
+
+// import-snapshots brings the images unpacked by the stargz or overlayfs
+// snapshotter over to the nydus snapshotter when a node switches to it, by
+// pulling their converted nydus images, which only downloads nydus metadata.
+// containerd and the nydus snapshotter must be running.
+func importSnapshotsCommand(args *flags.Args) *cli.Command {
+	return &cli.Command{
+		Name:  "import-snapshots",
+		Usage: "import images unpacked by another snapshotter whose converted nydus images exist",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "from",
+				Usage:    "snapshotter to import from, stargz or overlayfs",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "from-root",
+				Usage: "root directory of the snapshotter to import from, defaults to its default one",
+			},
+			&cli.StringFlag{
+				Name:  "containerd-address",
+				Usage: "address of containerd",
+				Value: constant.DefaultContainerdAddress,
+			},
+			&cli.StringFlag{
+				Name:  "snapshotter",
+				Usage: "name of the nydus snapshotter in containerd",
+				Value: "nydus",
+			},
+			&cli.StringFlag{
+				Name:  "tag-suffix",
+				Usage: "suffix appended to image tags to name their converted nydus images",
+				Value: "-nydus",
+			},
+			&cli.BoolFlag{
+				Name:  "retag",
+				Usage: "label the imported nydus images like the original images, which are left untouched",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "only print what would be imported",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the report in JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			cfg, err := loadSnapshotterConfig(args)
+			if err != nil {
+				return err
+			}
+
+			report, err := importer.Import(context.Background(), importer.Opt{
+				Source:      c.String("from"),
+				SourceRoot:  c.String("from-root"),
+				Address:     c.String("containerd-address"),
+				Snapshotter: c.String("snapshotter"),
+				TagSuffix:   c.String("tag-suffix"),
+				Retag:       c.Bool("retag"),
+				Insecure:    cfg.RemoteConfig.SkipSSLVerify,
+				DryRun:      c.Bool("dry-run"),
+			})
+			if err != nil {
+				return err
+			}
+
+			if c.Bool("json") {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(report)
+			}
+			printImportReport(report)
+
+			return nil
+		},
+	}
+}
+
+func printImportReport(report *importer.Report) {
+	fmt.Printf("Importing images unpacked by %s snapshotter in %s\n", report.Source, report.SourceRoot)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tIMAGE\tNYDUS IMAGE\tSTATUS\tMESSAGE")
+	for _, e := range report.Entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.Namespace, e.Image, e.NydusImage, e.Status, e.Message)
+	}
+	w.Flush()
+}
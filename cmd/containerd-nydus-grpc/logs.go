@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+
+	"github.com/containerd/nydus-snapshotter/internal/flags"
+	"github.com/containerd/nydus-snapshotter/pkg/client"
+)
+
+// logs prints the log of a daemon or the snapshotter through the system
+// controller, so operators don't have to locate log files on each node.
+func logsCommand(args *flags.Args) *cli.Command {
+	return &cli.Command{
+		Name:      "logs",
+		Usage:     "print the log of a daemon, or of the snapshotter if no daemon is given",
+		ArgsUsage: "[DAEMON_ID]",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:    "follow",
+				Aliases: []string{"f"},
+				Usage:   "keep printing lines appended to the log",
+			},
+			&cli.IntFlag{
+				Name:  "tail",
+				Usage: "only print the last lines, all lines if not positive",
+			},
+			&cli.StringFlag{
+				Name:  "level",
+				Usage: "only print lines of the level or more severe, e.g. warn",
+			},
+			&cli.StringFlag{
+				Name:  "instance",
+				Usage: "only print lines mentioning the RAFS instance of the snapshot",
+			},
+			&cli.StringFlag{
+				Name:  "address",
+				Usage: "address of the system controller, defaults to the configured one",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() > 1 {
+				return errors.New("at most one daemon ID is accepted")
+			}
+
+			address := c.String("address")
+			if address == "" {
+				cfg, err := loadSnapshotterConfig(args)
+				if err != nil {
+					return err
+				}
+				address = cfg.SystemControllerConfig.Address
+			}
+			sc, err := client.New(address)
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			logs, err := sc.Logs(ctx, client.LogsRequest{
+				DaemonID: c.Args().First(),
+				Follow:   c.Bool("follow"),
+				Tail:     c.Int("tail"),
+				Level:    c.String("level"),
+				Instance: c.String("instance"),
+			})
+			if err != nil {
+				return err
+			}
+			defer logs.Close()
+
+			if _, err := io.Copy(os.Stdout, logs); err != nil && ctx.Err() == nil {
+				return errors.Wrap(err, "print log")
+			}
+			return nil
+		},
+	}
+}
@@ -19,10 +19,16 @@ import (
 	"github.com/containerd/nydus-snapshotter/internal/flags"
 	"github.com/containerd/nydus-snapshotter/internal/logging"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/launcher"
 	"github.com/containerd/nydus-snapshotter/version"
 )
 
 func main() {
+	// Confine and execute nydusd if started by the snapshotter as a launcher.
+	if launcher.IsLauncher() {
+		launcher.Main()
+	}
+
 	flags := flags.NewFlags()
 	app := &cli.App{
 		Name:        "containerd-nydus-grpc",
@@ -30,6 +36,8 @@ func main() {
 		Version:     version.Version,
 		Flags:       flags.F,
 		HideVersion: true,
+		Commands: []*cli.Command{checkImageCommand(flags.Args), migrateRootCommand(flags.Args),
+			importSnapshotsCommand(flags.Args), logsCommand(flags.Args)},
 		Action: func(_ *cli.Context) error {
 			if flags.Args.PrintVersion {
 				fmt.Println("Version:    ", version.Version)
@@ -39,44 +47,12 @@ func main() {
 				return nil
 			}
 
-			snapshotterConfigPath := flags.Args.SnapshotterConfigPath
-			var defaultSnapshotterConfig config.SnapshotterConfig
-			var snapshotterConfig config.SnapshotterConfig
-
-			if err := defaultSnapshotterConfig.FillUpWithDefaults(); err != nil {
-				return errors.New("failed to generate nydus default configuration")
-			}
-
-			// Once snapshotter's configuration file is provided, parse it and let command line parameters override it.
-			if snapshotterConfigPath != "" {
-				if c, err := config.LoadSnapshotterConfig(snapshotterConfigPath); err == nil {
-					// Command line parameters override the snapshotter's configurations for backwards compatibility
-					if err := config.ParseParameters(flags.Args, c); err != nil {
-						return errors.Wrap(err, "failed to parse commandline options")
-					}
-					snapshotterConfig = *c
-				} else {
-					return errors.Wrapf(err, "failed to load snapshotter configuration from %q", snapshotterConfigPath)
-				}
-			} else {
-				if err := config.ParseParameters(flags.Args, &snapshotterConfig); err != nil {
-					return errors.Wrap(err, "failed to parse commandline options")
-				}
-			}
-
-			if err := config.MergeConfig(&snapshotterConfig, &defaultSnapshotterConfig); err != nil {
-				return errors.Wrap(err, "failed to merge configurations")
+			snapshotterConfig, err := loadSnapshotterConfig(flags.Args)
+			if err != nil {
+				return err
 			}
 
-			if err := config.ValidateConfig(&snapshotterConfig); err != nil {
-				return errors.Wrapf(err, "failed to validate configurations")
-			}
-
-			if err := config.ProcessConfigurations(&snapshotterConfig); err != nil {
-				return errors.Wrap(err, "failed to process configurations")
-			}
-
-			if err := config.SetUpEnvironment(&snapshotterConfig); err != nil {
+			if err := config.SetUpEnvironment(snapshotterConfig); err != nil {
 				return errors.Wrap(err, "failed to setup environment")
 			}
 
@@ -97,7 +73,7 @@ func main() {
 			log.L.Infof("Start nydus-snapshotter. Version: %s, PID: %d, FsDriver: %s, DaemonMode: %s",
 				version.Version, os.Getpid(), config.GetFsDriver(), snapshotterConfig.DaemonMode)
 
-			return Start(ctx, &snapshotterConfig)
+			return Start(ctx, snapshotterConfig)
 		},
 	}
 	if err := app.Run(os.Args); err != nil {
@@ -108,3 +84,46 @@ func main() {
 		}
 	}
 }
+
+// Load the snapshotter configuration file, let command line parameters override it
+// and fill up the defaults.
+func loadSnapshotterConfig(args *flags.Args) (*config.SnapshotterConfig, error) {
+	snapshotterConfigPath := args.SnapshotterConfigPath
+	var defaultSnapshotterConfig config.SnapshotterConfig
+	var snapshotterConfig config.SnapshotterConfig
+
+	if err := defaultSnapshotterConfig.FillUpWithDefaults(); err != nil {
+		return nil, errors.New("failed to generate nydus default configuration")
+	}
+
+	// Once snapshotter's configuration file is provided, parse it and let command line parameters override it.
+	if snapshotterConfigPath != "" {
+		if c, err := config.LoadSnapshotterConfig(snapshotterConfigPath); err == nil {
+			// Command line parameters override the snapshotter's configurations for backwards compatibility
+			if err := config.ParseParameters(args, c); err != nil {
+				return nil, errors.Wrap(err, "failed to parse commandline options")
+			}
+			snapshotterConfig = *c
+		} else {
+			return nil, errors.Wrapf(err, "failed to load snapshotter configuration from %q", snapshotterConfigPath)
+		}
+	} else {
+		if err := config.ParseParameters(args, &snapshotterConfig); err != nil {
+			return nil, errors.Wrap(err, "failed to parse commandline options")
+		}
+	}
+
+	if err := config.MergeConfig(&snapshotterConfig, &defaultSnapshotterConfig); err != nil {
+		return nil, errors.Wrap(err, "failed to merge configurations")
+	}
+
+	if err := config.ValidateConfig(&snapshotterConfig); err != nil {
+		return nil, errors.Wrapf(err, "failed to validate configurations")
+	}
+
+	if err := config.ProcessConfigurations(&snapshotterConfig); err != nil {
+		return nil, errors.Wrap(err, "failed to process configurations")
+	}
+
+	return &snapshotterConfig, nil
+}
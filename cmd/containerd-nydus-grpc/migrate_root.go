@@ -0,0 +1,112 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/containerd/nydus-snapshotter/internal/flags"
+	"github.com/containerd/nydus-snapshotter/pkg/migrate"
+)
+
+// migrate-root moves the root directory of the snapshotter to another path, e.g.
+// on a new disk, while the daemons and containers keep running. The snapshotter
+// has to be stopped during the migration and restarted on the new root after it.
+// Paths in use are bind mounted from the old root, run the command with
+// `--release` later to move them once they're no longer in use. The bind mounts
+// are established again when the snapshotter starts after reboot.
+func migrateRootCommand(args *flags.Args) *cli.Command {
+	return &cli.Command{
+		Name:  "migrate-root",
+		Usage: "migrate the root directory of the stopped snapshotter while daemons keep running",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "to",
+				Usage:    "new root directory, must be empty or not exist",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "release",
+				Usage: "move the paths no longer in use of an ongoing migration and drop their bind mounts",
+			},
+			&cli.BoolFlag{
+				Name:  "remove-source",
+				Usage: "remove the copied files from the old root directory",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "only print what would be copied and bind mounted",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the report in JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			ctx := context.Background()
+
+			var report *migrate.Report
+			if c.Bool("release") {
+				var err error
+				if report, err = migrate.Release(ctx, c.String("to")); err != nil {
+					return err
+				}
+			} else {
+				cfg, err := loadSnapshotterConfig(args)
+				if err != nil {
+					return err
+				}
+				report, err = migrate.Migrate(ctx, migrate.Opt{
+					From:         cfg.Root,
+					To:           c.String("to"),
+					RemoveSource: c.Bool("remove-source"),
+					DryRun:       c.Bool("dry-run"),
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			if c.Bool("json") {
+				encoder := json.NewEncoder(os.Stdout)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(report)
+			}
+			printMigrationReport(report)
+
+			return nil
+		},
+	}
+}
+
+func printMigrationReport(report *migrate.Report) {
+	fmt.Printf("Migrating %s to %s\n", report.From, report.To)
+	fmt.Printf("Copied %d files of %d bytes, rewrote %d records\n", report.CopiedFiles, report.CopiedBytes, report.Records)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, b := range report.Released {
+		fmt.Fprintf(w, "RELEASED\t%s\t%s\n", b.Source, b.Target)
+	}
+	for _, b := range report.Binds {
+		fmt.Fprintf(w, "BOUND\t%s\t%s\n", b.Source, b.Reason)
+	}
+	w.Flush()
+
+	if len(report.Binds) > 0 {
+		fmt.Println("Paths in use stay bound from the old root directory, run with --release later to move them")
+		fmt.Println("The old root directory must stay available until then, the snapshotter bind mounts them again after reboot")
+	}
+}
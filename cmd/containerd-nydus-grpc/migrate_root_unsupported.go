@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"github.com/urfave/cli/v2"
+
+	"github.com/containerd/nydus-snapshotter/internal/flags"
+)
+
+func migrateRootCommand(_ *flags.Args) *cli.Command {
+	return &cli.Command{
+		Name:  "migrate-root",
+		Usage: "migrate the root directory of the snapshotter, only supported on Linux",
+		Action: func(_ *cli.Context) error {
+			return cli.Exit("migrate-root is only supported on Linux", 1)
+		},
+	}
+}
@@ -17,8 +17,8 @@ import (
 
 	"github.com/containerd/nydus-snapshotter/config"
 	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/fallback"
 	"github.com/containerd/nydus-snapshotter/pkg/utils/signals"
-	"github.com/containerd/nydus-snapshotter/snapshot"
 
 	api "github.com/containerd/containerd/api/services/snapshots/v1"
 	"github.com/containerd/containerd/v2/contrib/snapshotservice"
@@ -30,7 +30,7 @@ import (
 func Start(ctx context.Context, cfg *config.SnapshotterConfig) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	rs, err := snapshot.NewSnapshotter(ctx, cfg)
+	rs, err := newSnapshotter(ctx, cfg)
 	if err != nil {
 		return errors.Wrap(err, "failed to initialize snapshotter")
 	}
@@ -110,3 +110,12 @@ func ensureSocketNotExists(listeningSocketPath string) error {
 	}
 	return nil
 }
+
+// Serve the fallback snapshotter for `reason` only if it is configured explicitly,
+// otherwise a node unable to run nydus fails to start.
+func newFallbackSnapshotter(cfg *config.SnapshotterConfig, reason error) (snapshots.Snapshotter, error) {
+	if !cfg.SnapshotsConfig.EnableFallback {
+		return nil, errors.Wrap(reason, "nydus is unsupported on the node, enable `snapshot.enable_fallback` to serve a fallback snapshotter")
+	}
+	return fallback.NewSnapshotter(reason), nil
+}
@@ -0,0 +1,37 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/v2/core/snapshots"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/capability"
+	"github.com/containerd/nydus-snapshotter/pkg/migrate"
+	"github.com/containerd/nydus-snapshotter/snapshot"
+)
+
+func newSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapshots.Snapshotter, error) {
+	// Still register with containerd if the kernel lacks features the driver requires
+	// and fallback is enabled, so that containerd gets a definite error rather than
+	// failing to connect.
+	if err := capability.Detect().Negotiate(cfg.DaemonConfig.FsDriver); err != nil {
+		return newFallbackSnapshotter(cfg, err)
+	}
+
+	// Bind mounts of an ongoing root migration are gone after reboot.
+	if err := migrate.RestoreBinds(ctx, cfg.Root); err != nil {
+		return nil, err
+	}
+
+	return snapshot.NewSnapshotter(ctx, cfg)
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package main
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/v2/core/snapshots"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/capability"
+)
+
+func newSnapshotter(_ context.Context, cfg *config.SnapshotterConfig) (snapshots.Snapshotter, error) {
+	return newFallbackSnapshotter(cfg, capability.Detect().Negotiate(cfg.DaemonConfig.FsDriver))
+}
@@ -9,6 +9,8 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 
 	"dario.cat/mergo"
 	"github.com/pelletier/go-toml"
@@ -40,6 +42,9 @@ const (
 	DaemonModeDedicated DaemonMode = DaemonMode(constant.DaemonModeDedicated)
 	// Share a global nydusd to serve all RAFS instances.
 	DaemonModeShared DaemonMode = DaemonMode(constant.DaemonModeShared)
+	// Spawn a nydusd for each pod sandbox to serve all RAFS instances of the pod,
+	// falls back to dedicated mode for snapshots not labeled with a sandbox ID.
+	DaemonModePod DaemonMode = DaemonMode(constant.DaemonModePod)
 	// Do not spawn nydusd for RAFS instances.
 	//
 	// For tarfs and rund, there's no need to create nydusd to serve RAFS instances,
@@ -59,6 +64,8 @@ func parseDaemonMode(m string) (DaemonMode, error) {
 		return DaemonModeShared, nil
 	case string(DaemonModeNone):
 		return DaemonModeNone, nil
+	case string(DaemonModePod):
+		return DaemonModePod, nil
 	default:
 		return DaemonModeInvalid, errors.Errorf("invalid daemon mode %q", m)
 	}
@@ -107,6 +114,11 @@ const (
 	FsDriverProxy    string = constant.FsDriverProxy
 )
 
+const (
+	IOEngineSync    string = constant.IOEngineSync
+	IOEngineIOUring string = constant.IOEngineIOUring
+)
+
 type Experimental struct {
 	EnableStargz         bool        `toml:"enable_stargz"`
 	EnableReferrerDetect bool        `toml:"enable_referrer_detect"`
@@ -119,9 +131,116 @@ type TarfsConfig struct {
 	MountTarfsOnHost  bool   `toml:"mount_tarfs_on_host"`
 	TarfsHint         bool   `toml:"tarfs_hint"`
 	MaxConcurrentProc int    `toml:"max_concurrent_proc"`
+	MaxLowerLayers    int    `toml:"max_lower_layers"` // OCI images with more layers are merged by tarfs
 	ExportMode        string `toml:"export_mode"`
 }
 
+// Decide which images are allowed to be lazily loaded, the others are fully
+// downloaded before their containers start. Images are matched by fully qualified
+// references like `docker.io/library/nginx:*`, a pattern ending with `/**` matches
+// all the repositories under it. Registries are matched by their hosts.
+type LazyLoadingConfig struct {
+	AllowedImages     []string `toml:"allowed_images"`
+	DeniedImages      []string `toml:"denied_images"`
+	AllowedRegistries []string `toml:"allowed_registries"`
+	DeniedRegistries  []string `toml:"denied_registries"`
+}
+
+// Enabled tells whether any image may be denied lazy loading.
+func (c *LazyLoadingConfig) Enabled() bool {
+	return len(c.AllowedImages) > 0 || len(c.DeniedImages) > 0 ||
+		len(c.AllowedRegistries) > 0 || len(c.DeniedRegistries) > 0
+}
+
+// Periodically compare the mount table with the records of daemons and RAFS
+// instances, and report the divergences by metrics.
+type MountCheckConfig struct {
+	Enable bool `toml:"enable"`
+	// Example format: 30s, 5m
+	Interval string `toml:"interval"`
+	// Mount again the EROFS mounts umounted by accident if running containers are
+	// still using them, running containers are queried from containerd.
+	AutoHeal          bool   `toml:"auto_heal"`
+	ContainerdAddress string `toml:"containerd_address"`
+}
+
+// Watch the FUSE connections of nydusd mounts in /sys/fs/fuse/connections for
+// aborted and congested ones, which are exported by metrics and events.
+type FuseConnCheckConfig struct {
+	Enable bool `toml:"enable"`
+	// Example format: 30s, 5m
+	Interval string `toml:"interval"`
+	// Restart daemons whose FUSE connections are aborted, so that containers started
+	// afterwards don't fail with "transport endpoint is not connected". Containers
+	// already running on the aborted mounts keep failing until they're restarted.
+	AutoRecover bool `toml:"auto_recover"`
+}
+
+// Pod daemons are destroyed once all of their RAFS instances are umounted. The
+// instances of sandboxes gone from containerd and no longer used by any overlay
+// mount are umounted periodically.
+type PodDaemonConfig struct {
+	// Example format: 30s, 5m
+	ReapInterval      string `toml:"reap_interval"`
+	ContainerdAddress string `toml:"containerd_address"`
+}
+
+// Refuse to prepare snapshots while the disk of the cache or snapshots directory
+// is full, i.e. the available space drops below the minimum or ENOSPC is hit.
+// Daemons are degraded, mounting no instance, and prefetching is paused until
+// space recovers.
+type DiskPressureConfig struct {
+	Enable bool `toml:"enable"`
+	// Example format: 1Gi
+	MinFreeSpace string `toml:"min_free_space"`
+	// Example format: 30s
+	CheckInterval string `toml:"check_interval"`
+	// Evict blob caches not used by any mounted instance when the disk is full
+	EvictUnusedCaches bool `toml:"evict_unused_caches"`
+}
+
+// Defer full image prefetch of RAFS instances to time windows or while the node
+// is idle, so warming caches doesn't compete with latency critical traffic. The
+// priority class of an instance is given by label
+// `containerd.io/snapshot/nydus-prefetch-priority`: `critical` ones are prefetched
+// right away, `normal` ones in the windows or while the node is idle, and `low`
+// ones in the windows while the node is idle.
+type PrefetchScheduleConfig struct {
+	Enable bool `toml:"enable"`
+	// Daily windows in local time, example format: 22:00-06:00
+	Windows []string `toml:"windows"`
+	// The node is idle when CPU usage in percentage and network receive rate are
+	// below the thresholds, zero or empty disables the condition.
+	IdleCPUPercent float64 `toml:"idle_cpu_percent"`
+	// Example format: 10Mi, per second
+	IdleNetworkRate string `toml:"idle_network_rate"`
+	// Example format: 1m
+	CheckInterval string `toml:"check_interval"`
+}
+
+// Workload classes with built-in read-ahead windows.
+const (
+	WorkloadClassDatabase = "database"
+	WorkloadClassBatch    = "batch"
+	WorkloadClassWeb      = "web"
+)
+
+// How much data nydusd reads from the cache or backend around a user IO request
+// and merges in one backend request. Small windows suit random reads of databases
+// while large ones suit sequential scans of batch jobs.
+type ReadAheadWindow struct {
+	AmplifyIO   int `toml:"amplify_io" json:"amplify_io"`
+	MergingSize int `toml:"merging_size" json:"merging_size"`
+}
+
+// Snapshots choose a workload class by the label `containerd.io/snapshot/nydus-workload-class`,
+// the read-ahead window of the class is rendered into the instance's nydusd configuration.
+type ReadAheadConfig struct {
+	// Class of snapshots without the label, nydusd configuration template is kept if empty.
+	DefaultClass string                     `toml:"default_class"`
+	Classes      map[string]ReadAheadWindow `toml:"classes"`
+}
+
 type CgroupConfig struct {
 	Enable      bool   `toml:"enable"`
 	MemoryLimit string `toml:"memory_limit"`
@@ -136,6 +255,27 @@ type DaemonConfig struct {
 	FsDriver         string `toml:"fs_driver"`
 	ThreadsNumber    int    `toml:"threads_number"`
 	LogRotationSize  int    `toml:"log_rotation_size"`
+	SupervisorDir    string `toml:"supervisor_dir"`
+	// Rewrite the nydusd configuration template in place if its schema is outdated,
+	// it's migrated in memory at every startup otherwise.
+	MigrateNydusdConfig bool `toml:"migrate_nydusd_config"`
+	// Environment variables in `KEY=VALUE` format set for nydusd processes.
+	Env []string `toml:"env"`
+	// Confine nydusd processes since they parse untrusted image data.
+	// Seccomp profile in OCI runtime-spec format, only syscall names are matched.
+	SeccompProfile  string `toml:"seccomp_profile"`
+	NoNewPrivileges bool   `toml:"no_new_privileges"`
+	// Name of an AppArmor profile already loaded into kernel.
+	AppArmorProfile string `toml:"apparmor_profile"`
+	// Don't let snapshots turn RAFS digest validation off by labels.
+	EnforceDigestValidate bool `toml:"enforce_digest_validate"`
+	// Perform FUSE and EROFS mounts in mount namespaces private to the snapshotter,
+	// with this many namespaces created in advance. Disabled if 0.
+	MountNamespacePoolSize int `toml:"mount_namespace_pool_size"`
+	// How nydusd performs backend and cache IO, "sync" or "io_uring", passed to nydusd
+	// by its configuration. Falls back to "sync" if io_uring is unavailable on the
+	// node or nydusd is older than v2.3.0, and once nydusd fails with io_uring.
+	IOEngine string `toml:"io_engine"`
 }
 
 type LoggingConfig struct {
@@ -162,6 +302,12 @@ type SnapshotConfig struct {
 	NydusOverlayFSPath   string `toml:"nydus_overlayfs_path"`
 	EnableKataVolume     bool   `toml:"enable_kata_volume"`
 	SyncRemove           bool   `toml:"sync_remove"`
+	// Image volumes are only published to host paths under it, publishing is
+	// refused if it's not set.
+	VolumeTargetRoot string `toml:"volume_target_root"`
+	// Serve a snapshotter refusing all snapshots rather than failing to start
+	// on platforms or kernels nydus does not support.
+	EnableFallback bool `toml:"enable_fallback"`
 }
 
 // Configure cache manager that manages the cache files lifecycle
@@ -171,6 +317,18 @@ type CacheManagerConfig struct {
 	// Example format: 24h, 120min
 	GCPeriod string `toml:"gc_period"`
 	CacheDir string `toml:"cache_dir"`
+	// Read back blob caches in background after the specified period to find
+	// corrupted ones, disabled if empty. Example format: 24h
+	ScrubPeriod string `toml:"scrub_period"`
+	// Bytes per second read by the scrubber.
+	ScrubRate int `toml:"scrub_rate"`
+	// Bytes of blob cache each image may use, only enforced on caches of unmounted
+	// images. Beyond it, the coldest whole blob caches of the image not used by any
+	// mounted image are removed, caches of mounted images are never evicted and may
+	// grow beyond it. No limit if empty. Example format: 50Gi
+	ImageQuota string `toml:"image_quota"`
+	// Check the per image quota after the specified period. Example format: 5m
+	QuotaCheckInterval string `toml:"quota_check_interval"`
 }
 
 // Configure how nydus-snapshotter receive auth information
@@ -196,7 +354,22 @@ type MirrorsConfig struct {
 }
 
 type MetricsConfig struct {
-	Address string `toml:"address"`
+	Address string            `toml:"address"`
+	TLS     EndpointTLSConfig `toml:"tls"`
+}
+
+// Secure the HTTP endpoints exposed on TCP. Endpoints on unix domain sockets
+// are protected by file permissions instead.
+type EndpointTLSConfig struct {
+	// Serve HTTPS rather than HTTP.
+	Enable bool `toml:"enable"`
+	// A self-signed certificate is generated and managed by the snapshotter
+	// if neither certificate nor key is provided.
+	CertFile string `toml:"cert_file"`
+	KeyFile  string `toml:"key_file"`
+	// File containing the bearer token which clients must provide, token
+	// authentication is disabled if empty.
+	TokenFile string `toml:"token_file"`
 }
 
 type DebugConfig struct {
@@ -205,9 +378,11 @@ type DebugConfig struct {
 }
 
 type SystemControllerConfig struct {
-	Enable      bool        `toml:"enable"`
-	Address     string      `toml:"address"`
-	DebugConfig DebugConfig `toml:"debug"`
+	Enable bool `toml:"enable"`
+	// Unix domain socket path, or `tcp://host:port` to expose on TCP.
+	Address     string            `toml:"address"`
+	DebugConfig DebugConfig       `toml:"debug"`
+	TLS         EndpointTLSConfig `toml:"tls"`
 }
 
 type SnapshotterConfig struct {
@@ -230,6 +405,13 @@ type SnapshotterConfig struct {
 	LoggingConfig          LoggingConfig          `toml:"log"`
 	CgroupConfig           CgroupConfig           `toml:"cgroup"`
 	Experimental           Experimental           `toml:"experimental"`
+	LazyLoadingConfig      LazyLoadingConfig      `toml:"lazy_loading"`
+	MountCheckConfig       MountCheckConfig       `toml:"mount_check"`
+	FuseConnCheckConfig    FuseConnCheckConfig    `toml:"fuse_connection_check"`
+	PodDaemonConfig        PodDaemonConfig        `toml:"pod_daemon"`
+	ReadAheadConfig        ReadAheadConfig        `toml:"read_ahead"`
+	DiskPressureConfig     DiskPressureConfig     `toml:"disk_pressure"`
+	PrefetchScheduleConfig PrefetchScheduleConfig `toml:"prefetch_schedule"`
 }
 
 func LoadSnapshotterConfig(path string) (*SnapshotterConfig, error) {
@@ -290,6 +472,37 @@ func ValidateConfig(c *SnapshotterConfig) error {
 		return errors.Errorf("nydusd worker thread number %d is too big, max 1024", c.DaemonConfig.ThreadsNumber)
 	}
 
+	if engine := c.DaemonConfig.IOEngine; engine != IOEngineSync && engine != IOEngineIOUring {
+		return errors.Errorf("invalid nydusd IO engine %q", engine)
+	}
+
+	// Only blob caches of fusedev driver tell when an image is fully downloaded.
+	if c.LazyLoadingConfig.Enabled() && (c.DaemonConfig.FsDriver != FsDriverFusedev || c.CacheManagerConfig.Disable) {
+		return errors.Wrapf(errdefs.ErrInvalidArgument,
+			"lazy loading policy requires filesystem driver %s with cache manager enabled", FsDriverFusedev)
+	}
+
+	if root := c.SnapshotsConfig.VolumeTargetRoot; root != "" && !filepath.IsAbs(root) {
+		return errors.Wrapf(errdefs.ErrInvalidArgument, "volume target root %q is not an absolute path", root)
+	}
+
+	if c.DaemonConfig.MountNamespacePoolSize < 0 {
+		return errors.Errorf("invalid mount namespace pool size %d", c.DaemonConfig.MountNamespacePoolSize)
+	}
+
+	for _, tlsConfig := range []EndpointTLSConfig{c.MetricsConfig.TLS, c.SystemControllerConfig.TLS} {
+		if (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+			return errors.Wrapf(errdefs.ErrInvalidArgument, "both TLS certificate and key must be provided")
+		}
+	}
+	if sc := c.SystemControllerConfig; sc.Enable && IsTCPAddress(sc.Address) && !sc.TLS.Enable && sc.TLS.TokenFile == "" {
+		return errors.Wrapf(errdefs.ErrInvalidArgument,
+			"system controller on TCP address %s requires TLS or token authentication", sc.Address)
+	}
+	if c.Experimental.EnableBackendSource && IsTCPAddress(c.SystemControllerConfig.Address) {
+		return errors.Wrapf(errdefs.ErrInvalidArgument, "backend source requires system controller listening on unix domain socket")
+	}
+
 	if c.RemoteConfig.AuthConfig.EnableCRIKeychain && c.RemoteConfig.AuthConfig.EnableKubeconfigKeychain {
 		return errors.Wrapf(errdefs.ErrInvalidArgument,
 			"\"enable_cri_keychain\" and \"enable_kubeconfig_keychain\" can't be set at the same time")
@@ -383,3 +596,15 @@ func ParseCgroupConfig(config CgroupConfig) (cgroup.Config, error) {
 		MemoryLimitInBytes: memoryLimitInBytes,
 	}, nil
 }
+
+const tcpAddressPrefix = "tcp://"
+
+// IsTCPAddress tells whether the server address is of form `tcp://host:port`.
+func IsTCPAddress(addr string) bool {
+	return strings.HasPrefix(addr, tcpAddressPrefix)
+}
+
+// TrimTCPAddress strips the scheme from `tcp://host:port`.
+func TrimTCPAddress(addr string) string {
+	return strings.TrimPrefix(addr, tcpAddressPrefix)
+}
@@ -48,6 +48,7 @@ func TestLoadSnapshotterTOMLConfig(t *testing.T) {
 			NydusdConfigPath: "/etc/nydus/nydusd-config.fusedev.json",
 			ThreadsNumber:    4,
 			LogRotationSize:  100,
+			IOEngine:         "sync",
 		},
 		SnapshotsConfig: SnapshotConfig{
 			EnableNydusOverlayFS: false,
@@ -200,6 +201,8 @@ func TestMergeConfig(t *testing.T) {
 	A.Equal(snapshotterConfig1.DaemonConfig.NydusdConfigPath, constant.DefaultNydusDaemonConfigPath)
 	A.Equal(snapshotterConfig1.DaemonConfig.RecoverPolicy, RecoverPolicyRestart.String())
 	A.Equal(snapshotterConfig1.CacheManagerConfig.GCPeriod, constant.DefaultGCPeriod)
+	A.Equal(snapshotterConfig1.CacheManagerConfig.QuotaCheckInterval, constant.DefaultCacheQuotaCheckInterval)
+	A.Contains(snapshotterConfig1.ReadAheadConfig.Classes, WorkloadClassDatabase)
 
 	var snapshotterConfig2 SnapshotterConfig
 	snapshotterConfig2.Root = "/snapshotter/root"
@@ -251,6 +254,26 @@ func TestProcessConfigurations(t *testing.T) {
 	err = ValidateConfig(&snapshotterConfig3)
 	A.NoError(err)
 
+	// The system controller can't be exposed on TCP without authentication.
+	snapshotterConfig3.SystemControllerConfig.Enable = true
+	snapshotterConfig3.SystemControllerConfig.Address = "tcp://0.0.0.0:8080"
+	A.Error(ValidateConfig(&snapshotterConfig3))
+	snapshotterConfig3.SystemControllerConfig.TLS.TokenFile = "/etc/nydus/token"
+	A.NoError(ValidateConfig(&snapshotterConfig3))
+	snapshotterConfig3.SystemControllerConfig.Address = ""
+	snapshotterConfig3.SystemControllerConfig.TLS.TokenFile = ""
+
+	// Images denied lazy loading can only be waited for by fusedev driver.
+	snapshotterConfig3.LazyLoadingConfig.DeniedImages = []string{"docker.io/library/*"}
+	A.NoError(ValidateConfig(&snapshotterConfig3))
+	snapshotterConfig3.CacheManagerConfig.Disable = true
+	A.Error(ValidateConfig(&snapshotterConfig3))
+	snapshotterConfig3.CacheManagerConfig.Disable = false
+	snapshotterConfig3.DaemonConfig.FsDriver = FsDriverFscache
+	A.Error(ValidateConfig(&snapshotterConfig3))
+	snapshotterConfig3.DaemonConfig.FsDriver = FsDriverFusedev
+	snapshotterConfig3.LazyLoadingConfig.DeniedImages = nil
+
 	err = ProcessConfigurations(&snapshotterConfig3)
 	A.NoError(err)
 }
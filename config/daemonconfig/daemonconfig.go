@@ -126,10 +126,7 @@ type DeviceConfig struct {
 // We don't have to persist configuration file for fscache since its configuration
 // is passed through HTTP API.
 func DumpConfigFile(c interface{}, path string) error {
-	if config.IsBackendSourceEnabled() {
-		c = serializeWithSecretFilter(c)
-	}
-	b, err := json.Marshal(c)
+	b, err := marshalConfig(c, config.IsBackendSourceEnabled())
 	if err != nil {
 		return errors.Wrapf(err, "marshal config")
 	}
@@ -138,10 +135,48 @@ func DumpConfigFile(c interface{}, path string) error {
 }
 
 func DumpConfigString(c interface{}) (string, error) {
-	b, err := json.Marshal(c)
+	b, err := marshalConfig(c, false)
 	return string(b), err
 }
 
+// DumpRedactedConfig serializes the configuration with secrets like registry
+// credentials stripped, so that it can be persisted or shown to operators.
+func DumpRedactedConfig(c interface{}) ([]byte, error) {
+	b, err := marshalConfig(c, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal config")
+	}
+	return b, nil
+}
+
+// Serialize the configuration with the template fields unknown to it.
+func marshalConfig(c interface{}, redact bool) ([]byte, error) {
+	var v interface{} = c
+	if redact {
+		v = serializeWithSecretFilter(c)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	e, ok := c.(interface{ extraFields() map[string]interface{} })
+	if !ok || len(e.extraFields()) == 0 {
+		return b, nil
+	}
+	extra := e.extraFields()
+	if redact {
+		extra = withoutSecretLike(extra)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	mergeMissing(m, extra)
+
+	return json.Marshal(m)
+}
+
 // Achieve a daemon configuration from template or snapshotter's configuration
 func SupplementDaemonConfig(c DaemonConfig, imageID, snapshotID string,
 	vpcRegistry bool, labels map[string]string, params map[string]string) error {
@@ -209,7 +244,7 @@ func serializeWithSecretFilter(obj interface{}) map[string]interface{} {
 			}
 		}
 
-		if secretTag == "true" {
+		if secretTag == "true" || jsonTags[0] == "-" {
 			continue
 		}
 
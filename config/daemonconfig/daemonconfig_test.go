@@ -153,3 +153,46 @@ func TestSerializeWithSecretFilter(t *testing.T) {
 	require.Equal(t, newCfg.Device.Backend.Config.Auth, "")
 	require.NotEqual(t, newCfg.Device.Backend.Config.Auth, cfg.Device.Backend.Config.Auth)
 }
+
+func TestFuseSupplementDigestValidate(t *testing.T) {
+	cfg := FuseDaemonConfig{Device: &DeviceConfig{}, DigestValidate: true}
+
+	cfg.Supplement("host", "repo", "1", map[string]string{})
+	require.True(t, cfg.DigestValidate)
+
+	cfg.Supplement("host", "repo", "1", map[string]string{DigestValidate: "false"})
+	require.False(t, cfg.DigestValidate)
+
+	cfg.Supplement("host", "repo", "1", map[string]string{DigestValidate: "true"})
+	require.True(t, cfg.DigestValidate)
+}
+
+func TestFuseSupplementReadAhead(t *testing.T) {
+	cfg := FuseDaemonConfig{Device: &DeviceConfig{}, FSPrefetch: FSPrefetch{MergingSize: 131072}}
+
+	cfg.Supplement("host", "repo", "1", map[string]string{})
+	require.Nil(t, cfg.AmplifyIo)
+	require.Equal(t, 131072, cfg.FSPrefetch.MergingSize)
+
+	cfg.Supplement("host", "repo", "1", map[string]string{AmplifyIO: "4194304", MergingSize: "1048576"})
+	require.Equal(t, 4194304, *cfg.AmplifyIo)
+	require.Equal(t, 1048576, cfg.FSPrefetch.MergingSize)
+}
+
+func TestFuseSupplementNoPrefetch(t *testing.T) {
+	cfg := FuseDaemonConfig{Device: &DeviceConfig{}, FSPrefetch: FSPrefetch{Enable: true}}
+
+	cfg.Supplement("host", "repo", "1", map[string]string{PrefetchAll: "true", NoPrefetch: "true"})
+	require.False(t, cfg.FSPrefetch.Enable)
+	require.False(t, cfg.FSPrefetch.PrefetchAll)
+}
+
+func TestFuseSupplementIOEngine(t *testing.T) {
+	cfg := FuseDaemonConfig{Device: &DeviceConfig{}}
+
+	cfg.Supplement("host", "repo", "1", map[string]string{})
+	require.Empty(t, cfg.IOEngine)
+
+	cfg.Supplement("host", "repo", "1", map[string]string{IOEngine: "io_uring"})
+	require.Equal(t, "io_uring", cfg.IOEngine)
+}
@@ -7,7 +7,6 @@
 package daemonconfig
 
 import (
-	"encoding/json"
 	"os"
 	"path"
 
@@ -21,6 +20,17 @@ import (
 const (
 	WorkDir   string = "workdir"
 	Bootstrap string = "bootstrap"
+	// Download all the data of image blobs rather than lazily loading them.
+	PrefetchAll string = "prefetch_all"
+	// Turn off prefetching of the template, e.g. when the disk is full.
+	NoPrefetch string = "no_prefetch"
+	// IO engine of the backend and cache, the nydusd default if absent.
+	IOEngine string = "io_engine"
+	// Turn RAFS digest validation "true" or "false", the template decides if absent.
+	DigestValidate string = "digest_validate"
+	// Read-ahead window of the instance in bytes, the template decides if absent.
+	AmplifyIO   string = "amplify_io"
+	MergingSize string = "merging_size"
 )
 
 type BlobPrefetchConfig struct {
@@ -47,7 +57,11 @@ type FscacheDaemonConfig struct {
 		} `json:"cache_config"`
 		BlobPrefetchConfig BlobPrefetchConfig `json:"prefetch_config"`
 		MetadataPath       string             `json:"metadata_path"`
+		IOEngine           string             `json:"io_engine,omitempty"`
 	} `json:"config"`
+	// Fields of the template unknown to the snapshotter, e.g. ones of newer nydusd,
+	// dumped as they are.
+	Extra map[string]interface{} `json:"-"`
 }
 
 // Load Fscache configuration template file
@@ -57,7 +71,7 @@ func LoadFscacheConfig(p string) (*FscacheDaemonConfig, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "read fscache configuration file %s", p)
 	}
-	if err = json.Unmarshal(b, &cfg); err != nil {
+	if cfg.Extra, err = loadTemplate(b, &cfg); err != nil {
 		return nil, errors.Wrapf(err, "unmarshal")
 	}
 
@@ -106,6 +120,24 @@ func (c *FscacheDaemonConfig) Supplement(host, repo, snapshotID string, params m
 	if bootstrap, ok := params[Bootstrap]; ok {
 		c.Config.MetadataPath = bootstrap
 	}
+
+	// Blob prefetch of fscache daemon fetches the whole blobs.
+	if params[PrefetchAll] == "true" {
+		c.Config.BlobPrefetchConfig.Enable = true
+	}
+	if params[NoPrefetch] == "true" {
+		c.Config.BlobPrefetchConfig.Enable = false
+	}
+	if v, ok := params[IOEngine]; ok {
+		c.Config.IOEngine = v
+	}
+
+	if _, ok := params[DigestValidate]; ok {
+		log.L.Warnf("RAFS digest validation can't be configured per instance for fscache driver, ignored")
+	}
+	if _, ok := params[AmplifyIO]; ok {
+		log.L.Warnf("Read-ahead window can't be configured per instance for fscache driver, ignored")
+	}
 }
 
 func (c *FscacheDaemonConfig) FillAuth(kc *auth.PassKeyChain) {
@@ -118,6 +150,10 @@ func (c *FscacheDaemonConfig) FillAuth(kc *auth.PassKeyChain) {
 	}
 }
 
+func (c *FscacheDaemonConfig) extraFields() map[string]interface{} {
+	return c.Extra
+}
+
 func (c *FscacheDaemonConfig) DumpString() (string, error) {
 	return DumpConfigString(c)
 }
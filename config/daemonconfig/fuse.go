@@ -7,9 +7,9 @@
 package daemonconfig
 
 import (
-	"encoding/json"
 	"os"
 	"path"
+	"strconv"
 
 	"github.com/pkg/errors"
 
@@ -30,7 +30,11 @@ type FuseDaemonConfig struct {
 	AmplifyIo       *int          `json:"amplify_io,omitempty"`
 	FSPrefetch      `json:"fs_prefetch,omitempty"`
 	// (experimental) The nydus daemon could cache more data to increase hit ratio when enabled the warmup feature.
-	Warmup uint64 `json:"warmup,omitempty"`
+	Warmup   uint64 `json:"warmup,omitempty"`
+	IOEngine string `json:"io_engine,omitempty"`
+	// Fields of the template unknown to the snapshotter, e.g. ones of newer nydusd,
+	// dumped as they are.
+	Extra map[string]interface{} `json:"-"`
 }
 
 // Control how to perform prefetch from file system layer
@@ -49,7 +53,7 @@ func LoadFuseConfig(p string) (*FuseDaemonConfig, error) {
 		return nil, errors.Wrapf(err, "read FUSE configuration file %s", p)
 	}
 	var cfg FuseDaemonConfig
-	if err := json.Unmarshal(b, &cfg); err != nil {
+	if cfg.Extra, err = loadTemplate(b, &cfg); err != nil {
 		return nil, errors.Wrapf(err, "unmarshal %s", p)
 	}
 
@@ -64,6 +68,32 @@ func (c *FuseDaemonConfig) Supplement(host, repo, _ string, params map[string]st
 	c.Device.Backend.Config.Host = host
 	c.Device.Backend.Config.Repo = repo
 	c.Device.Cache.Config.WorkDir = params[CacheDir]
+
+	if params[PrefetchAll] == "true" {
+		c.FSPrefetch.Enable = true
+		c.FSPrefetch.PrefetchAll = true
+	}
+	if params[NoPrefetch] == "true" {
+		c.FSPrefetch.Enable = false
+		c.FSPrefetch.PrefetchAll = false
+	}
+	if v, ok := params[IOEngine]; ok {
+		c.IOEngine = v
+	}
+
+	switch params[DigestValidate] {
+	case "true":
+		c.DigestValidate = true
+	case "false":
+		c.DigestValidate = false
+	}
+
+	if v, err := strconv.Atoi(params[AmplifyIO]); err == nil {
+		c.AmplifyIo = &v
+	}
+	if v, err := strconv.Atoi(params[MergingSize]); err == nil {
+		c.FSPrefetch.MergingSize = v
+	}
 }
 
 func (c *FuseDaemonConfig) FillAuth(kc *auth.PassKeyChain) {
@@ -91,6 +121,10 @@ func (c *FuseDaemonConfig) StorageBackend() (string, *BackendConfig) {
 	return c.Device.Backend.BackendType, &c.Device.Backend.Config
 }
 
+func (c *FuseDaemonConfig) extraFields() map[string]interface{} {
+	return c.Extra
+}
+
 func (c *FuseDaemonConfig) DumpString() (string, error) {
 	return DumpConfigString(c)
 }
@@ -0,0 +1,354 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+)
+
+// Schema version of nydusd configuration templates, recorded in templates by key
+// `template_version` once they're migrated. Templates without it are version 1.
+// The key is never passed to nydusd.
+const (
+	TemplateVersion    = 3
+	templateVersionKey = "template_version"
+)
+
+// Migrations of templates from each version to the next one, the first migrates
+// version 1 to 2.
+var migrations = []func(tmpl map[string]interface{}){
+	migrateMirrorList,
+	migrateDedup,
+}
+
+// Backend configuration of FUSE or fscache templates.
+func backendConfig(tmpl map[string]interface{}) map[string]interface{} {
+	lookup := func(m map[string]interface{}, keys ...string) map[string]interface{} {
+		for _, k := range keys {
+			next, ok := m[k].(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			m = next
+		}
+		return m
+	}
+	if backend := lookup(tmpl, "device", "backend", "config"); backend != nil {
+		return backend
+	}
+	return lookup(tmpl, "config", "backend_config")
+}
+
+// Version 1 configures a single registry mirror by object `mirror`, replaced by
+// list `mirrors` in version 2.
+func migrateMirrorList(tmpl map[string]interface{}) {
+	backend := backendConfig(tmpl)
+	if backend == nil {
+		return
+	}
+	mirror, ok := backend["mirror"]
+	if !ok {
+		return
+	}
+	delete(backend, "mirror")
+	if _, ok := backend["mirrors"]; ok {
+		return
+	}
+	if m, ok := mirror.(map[string]interface{}); ok && len(m) > 0 {
+		backend["mirrors"] = []interface{}{m}
+	}
+}
+
+// Cache configuration of FUSE or fscache templates.
+func cacheConfig(tmpl map[string]interface{}) map[string]interface{} {
+	if device, ok := tmpl["device"].(map[string]interface{}); ok {
+		if cache, ok := device["cache"].(map[string]interface{}); ok {
+			if c, ok := cache["config"].(map[string]interface{}); ok {
+				return c
+			}
+		}
+		return nil
+	}
+	if c, ok := tmpl["config"].(map[string]interface{}); ok {
+		if cache, ok := c["cache_config"].(map[string]interface{}); ok {
+			return cache
+		}
+	}
+	return nil
+}
+
+// Version 2 turns chunk deduplication on by fields `enable_dedup` and `dedup_work_dir`
+// of the cache configuration, replaced by object `dedup` with `enable` and `work_dir`
+// at the top level in version 3.
+func migrateDedup(tmpl map[string]interface{}) {
+	cache := cacheConfig(tmpl)
+	if cache == nil {
+		return
+	}
+	enable, hasEnable := cache["enable_dedup"]
+	workDir, hasWorkDir := cache["dedup_work_dir"]
+	if !hasEnable && !hasWorkDir {
+		return
+	}
+	delete(cache, "enable_dedup")
+	delete(cache, "dedup_work_dir")
+	if _, ok := tmpl["dedup"]; ok {
+		return
+	}
+	dedup := map[string]interface{}{}
+	if hasEnable {
+		dedup["enable"] = enable
+	}
+	if hasWorkDir {
+		dedup["work_dir"] = workDir
+	}
+	tmpl["dedup"] = dedup
+}
+
+func templateVersion(tmpl map[string]interface{}) (int, error) {
+	v, ok := tmpl[templateVersionKey]
+	if !ok {
+		return 1, nil
+	}
+	n, ok := v.(float64)
+	if !ok || n < 1 || n != float64(int(n)) {
+		return 0, errors.Errorf("invalid template version %v", v)
+	}
+	return int(n), nil
+}
+
+// Parse the template and migrate it to the current version. Returns the version
+// it was, templates of newer versions are left as they are.
+func migrateTemplate(content []byte) (map[string]interface{}, int, error) {
+	var tmpl map[string]interface{}
+	if err := json.Unmarshal(content, &tmpl); err != nil {
+		return nil, 0, err
+	}
+	version, err := templateVersion(tmpl)
+	if err != nil {
+		return nil, 0, err
+	}
+	for v := version; v < TemplateVersion; v++ {
+		migrations[v-1](tmpl)
+	}
+
+	return tmpl, version, nil
+}
+
+// Load the template, migrated to the current version, into cfg. Returns the
+// fields unknown to cfg, e.g. ones of newer nydusd, to keep them when dumping.
+func loadTemplate(content []byte, cfg interface{}) (map[string]interface{}, error) {
+	tmpl, version, err := migrateTemplate(content)
+	if err != nil {
+		return nil, err
+	}
+	if version > TemplateVersion {
+		log.L.Warnf("Configuration template version %d is newer than %d, unknown fields are kept as they are",
+			version, TemplateVersion)
+	}
+	delete(tmpl, templateVersionKey)
+
+	migrated, err := json.Marshal(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(migrated, cfg); err != nil {
+		return nil, err
+	}
+
+	return unknownFields(tmpl, reflect.TypeOf(cfg)), nil
+}
+
+// Fields of the JSON object not declared by the struct type, nested objects
+// included.
+func unknownFields(obj map[string]interface{}, t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	known := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		known[name] = f.Type
+	}
+
+	unknown := map[string]interface{}{}
+	for k, v := range obj {
+		ft, ok := known[k]
+		if !ok {
+			unknown[k] = v
+			continue
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			if fields := unknownFields(nested, ft); len(fields) > 0 {
+				unknown[k] = fields
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	return unknown
+}
+
+// Add the fields missing in dst from src, nested objects included.
+func mergeMissing(dst, src map[string]interface{}) {
+	for k, v := range src {
+		existing, ok := dst[k]
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		if d, ok := existing.(map[string]interface{}); ok {
+			if s, ok := v.(map[string]interface{}); ok {
+				mergeMissing(d, s)
+			}
+		}
+	}
+}
+
+// Unknown fields may be secrets of newer nydusd, which redacted configurations
+// shouldn't carry.
+func isSecretLike(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range []string{"auth", "token", "secret", "password"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutSecretLike(fields map[string]interface{}) map[string]interface{} {
+	filtered := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		if isSecretLike(k) {
+			continue
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			v = withoutSecretLike(nested)
+		}
+		filtered[k] = v
+	}
+	return filtered
+}
+
+// Flatten the JSON value into paths like `device.backend.config.mirrors`.
+func flatten(prefix string, v interface{}, out map[string]string) {
+	if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+		for k, nested := range m {
+			p := k
+			if prefix != "" {
+				p = prefix + "." + k
+			}
+			flatten(p, nested, out)
+		}
+		return
+	}
+	b, _ := json.Marshal(v)
+	out[prefix] = string(b)
+}
+
+// Changes between two versions of a template, one line per changed path, values
+// of secret like paths are hidden.
+func templateDiff(before, after map[string]interface{}) []string {
+	old, updated := map[string]string{}, map[string]string{}
+	flatten("", before, old)
+	flatten("", after, updated)
+
+	value := func(p, v string) string {
+		if isSecretLike(p) {
+			return "<redacted>"
+		}
+		return v
+	}
+	var diff []string
+	for p, v := range old {
+		if nv, ok := updated[p]; !ok {
+			diff = append(diff, fmt.Sprintf("- %s: %s", p, value(p, v)))
+		} else if nv != v {
+			diff = append(diff, fmt.Sprintf("~ %s: %s -> %s", p, value(p, v), value(p, nv)))
+		}
+	}
+	for p, v := range updated {
+		if _, ok := old[p]; !ok {
+			diff = append(diff, fmt.Sprintf("+ %s: %s", p, value(p, v)))
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return diff[i][2:] < diff[j][2:]
+	})
+
+	return diff
+}
+
+// MigrateTemplate migrates the nydusd configuration template at path in place to
+// the current schema version if any of its fields is outdated, keeping the
+// original one as `<path>.v<version>.bak`, and logs the changes. Templates are
+// migrated in memory when loaded anyway, so rewriting them is optional.
+func MigrateTemplate(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "read configuration template %s", path)
+	}
+	var before map[string]interface{}
+	if err := json.Unmarshal(content, &before); err != nil {
+		return errors.Wrapf(err, "unmarshal %s", path)
+	}
+	after, version, err := migrateTemplate(content)
+	if err != nil {
+		return errors.Wrapf(err, "migrate %s", path)
+	}
+	if version >= TemplateVersion || reflect.DeepEqual(before, after) {
+		return nil
+	}
+	after[templateVersionKey] = TemplateVersion
+
+	migrated, err := json.MarshalIndent(after, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal migrated template")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := os.WriteFile(backup, content, info.Mode().Perm()); err != nil {
+		return errors.Wrapf(err, "back up %s", path)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(migrated, '\n'), info.Mode().Perm()); err != nil {
+		return errors.Wrapf(err, "write migrated template %s", tmp)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "replace template %s", path)
+	}
+
+	log.L.Infof("Migrated configuration template %s from version %d to %d, backed up to %s:\n%s",
+		path, version, TemplateVersion, backup, strings.Join(templateDiff(before, after), "\n"))
+
+	return nil
+}
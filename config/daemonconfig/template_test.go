@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemonconfig
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const fuseTemplateV1 = `{
+  "device": {
+    "backend": {
+      "type": "registry",
+      "config": {
+        "scheme": "https",
+        "mirror": {"host": "http://127.0.0.1:65001", "ping_url": "http://127.0.0.1:65001/ping"},
+        "retry_policy": "exponential",
+        "access_token": "very-secret"
+      }
+    },
+    "cache": {"type": "blobcache", "config": {"work_dir": "/cache"}}
+  },
+  "mode": "direct",
+  "iouring": {"enable": true}
+}`
+
+func writeTemplate(t *testing.T, content string) string {
+	p := filepath.Join(t.TempDir(), "nydusd-config.json")
+	require.NoError(t, os.WriteFile(p, []byte(content), 0640))
+	return p
+}
+
+func TestMigrateTemplateMirrorList(t *testing.T) {
+	tmpl, version, err := migrateTemplate([]byte(fuseTemplateV1))
+	require.NoError(t, err)
+	require.Equal(t, 1, version)
+	backend := backendConfig(tmpl)
+	require.NotContains(t, backend, "mirror")
+	require.Equal(t, []interface{}{map[string]interface{}{
+		"host": "http://127.0.0.1:65001", "ping_url": "http://127.0.0.1:65001/ping"}}, backend["mirrors"])
+
+	tmpl, _, err = migrateTemplate([]byte(`{"config": {"backend_type": "registry",
+		"backend_config": {"mirror": {"host": "http://mirror"}, "mirrors": [{"host": "http://kept"}]}}}`))
+	require.NoError(t, err)
+	backend = backendConfig(tmpl)
+	require.NotContains(t, backend, "mirror")
+	require.Equal(t, []interface{}{map[string]interface{}{"host": "http://kept"}}, backend["mirrors"])
+
+	_, version, err = migrateTemplate([]byte(`{"template_version": 4, "mode": "direct"}`))
+	require.NoError(t, err)
+	require.Equal(t, 4, version)
+
+	_, _, err = migrateTemplate([]byte(`{"template_version": "2"}`))
+	require.Error(t, err)
+	_, _, err = migrateTemplate([]byte(`{"template_version": 0}`))
+	require.Error(t, err)
+}
+
+func TestMigrateTemplateDedup(t *testing.T) {
+	tmpl, version, err := migrateTemplate([]byte(`{"template_version": 2, "device": {"backend": {"type": "registry",
+		"config": {}}, "cache": {"type": "blobcache", "config": {"work_dir": "/cache", "enable_dedup": true,
+		"dedup_work_dir": "/cas"}}}, "mode": "direct"}`))
+	require.NoError(t, err)
+	require.Equal(t, 2, version)
+	require.Equal(t, map[string]interface{}{"work_dir": "/cache"}, cacheConfig(tmpl))
+	require.Equal(t, map[string]interface{}{"enable": true, "work_dir": "/cas"}, tmpl["dedup"])
+
+	tmpl, _, err = migrateTemplate([]byte(`{"type": "bootstrap", "config": {"cache_type": "fscache",
+		"cache_config": {"work_dir": "/cache", "enable_dedup": true}}, "dedup": {"enable": false}}`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"work_dir": "/cache"}, cacheConfig(tmpl))
+	require.Equal(t, map[string]interface{}{"enable": false}, tmpl["dedup"])
+
+	cfg, err := LoadFuseConfig(writeTemplate(t, `{"device": {"backend": {"type": "registry", "config": {}},
+		"cache": {"type": "blobcache", "config": {"enable_dedup": true}}}, "mode": "direct"}`))
+	require.NoError(t, err)
+	dumped, err := cfg.DumpString()
+	require.NoError(t, err)
+	require.Contains(t, dumped, `"dedup":{"enable":true}`)
+	require.NotContains(t, dumped, "enable_dedup")
+}
+
+func TestLoadTemplateKeepsUnknownFields(t *testing.T) {
+	cfg, err := LoadFuseConfig(writeTemplate(t, fuseTemplateV1))
+	require.NoError(t, err)
+	require.Len(t, cfg.Device.Backend.Config.Mirrors, 1)
+	require.Equal(t, "http://127.0.0.1:65001", cfg.Device.Backend.Config.Mirrors[0].Host)
+
+	dumped, err := cfg.DumpString()
+	require.NoError(t, err)
+	var m map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(dumped), &m))
+	require.NotContains(t, m, templateVersionKey)
+	require.Equal(t, map[string]interface{}{"enable": true}, m["iouring"])
+	backend := backendConfig(m)
+	require.Equal(t, "exponential", backend["retry_policy"])
+	require.Equal(t, "very-secret", backend["access_token"])
+	require.NotContains(t, backend, "mirror")
+
+	redacted, err := DumpRedactedConfig(cfg)
+	require.NoError(t, err)
+	m = nil
+	require.NoError(t, json.Unmarshal(redacted, &m))
+	backend = backendConfig(m)
+	require.Equal(t, "exponential", backend["retry_policy"])
+	require.NotContains(t, backend, "access_token")
+
+	fscache, err := LoadFscacheConfig(writeTemplate(t, `{"type": "bootstrap", "config": {"backend_type": "registry",
+		"backend_config": {"mirror": {"host": "http://mirror"}}, "cache_type": "fscache", "lazy_open": true}}`))
+	require.NoError(t, err)
+	require.Len(t, fscache.Config.BackendConfig.Mirrors, 1)
+	dumped, err = fscache.DumpString()
+	require.NoError(t, err)
+	require.Contains(t, dumped, `"lazy_open":true`)
+}
+
+func TestMigrateTemplateFile(t *testing.T) {
+	p := writeTemplate(t, fuseTemplateV1)
+	require.NoError(t, MigrateTemplate(p))
+
+	backup, err := os.ReadFile(p + ".v1.bak")
+	require.NoError(t, err)
+	require.Equal(t, fuseTemplateV1, string(backup))
+	info, err := os.Stat(p)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	content, err := os.ReadFile(p)
+	require.NoError(t, err)
+	tmpl, version, err := migrateTemplate(content)
+	require.NoError(t, err)
+	require.Equal(t, TemplateVersion, version)
+	require.Contains(t, backendConfig(tmpl), "mirrors")
+
+	// Up-to-date templates are left as they are.
+	require.NoError(t, MigrateTemplate(p))
+	again, err := os.ReadFile(p)
+	require.NoError(t, err)
+	require.Equal(t, content, again)
+
+	// So are templates with nothing to migrate.
+	p = writeTemplate(t, `{"device": {"backend": {"type": "registry", "config": {}}}, "mode": "direct"}`)
+	require.NoError(t, MigrateTemplate(p))
+	_, err = os.Stat(p + ".v1.bak")
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestTemplateDiff(t *testing.T) {
+	before := map[string]interface{}{"a": map[string]interface{}{"mirror": "x", "auth": "old"}, "b": 1.0}
+	after := map[string]interface{}{"a": map[string]interface{}{"mirrors": []interface{}{"x"}, "auth": "new"}, "b": 1.0}
+	require.Equal(t, []string{
+		"~ a.auth: <redacted> -> <redacted>",
+		"- a.mirror: \"x\"",
+		"+ a.mirrors: [\"x\"]",
+	}, templateDiff(before, after))
+}
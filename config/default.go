@@ -44,16 +44,76 @@ func (c *SnapshotterConfig) FillUpWithDefaults() error {
 	daemonConfig.RecoverPolicy = RecoverPolicyRestart.String()
 	daemonConfig.FsDriver = constant.DefaultFsDriver
 	daemonConfig.LogRotationSize = constant.DefaultDaemonRotateLogMaxSize
+	daemonConfig.IOEngine = constant.IOEngineSync
 
 	// cache configuration
 	cacheConfig := &c.CacheManagerConfig
 	if cacheConfig.GCPeriod == "" {
 		cacheConfig.GCPeriod = constant.DefaultGCPeriod
 	}
+	if cacheConfig.QuotaCheckInterval == "" {
+		cacheConfig.QuotaCheckInterval = constant.DefaultCacheQuotaCheckInterval
+	}
+
+	// mount check configuration
+	mountCheckConfig := &c.MountCheckConfig
+	if mountCheckConfig.Interval == "" {
+		mountCheckConfig.Interval = constant.DefaultMountCheckInterval
+	}
+	if mountCheckConfig.ContainerdAddress == "" {
+		mountCheckConfig.ContainerdAddress = constant.DefaultContainerdAddress
+	}
+
+	// FUSE connection check configuration
+	fuseConnCheckConfig := &c.FuseConnCheckConfig
+	if fuseConnCheckConfig.Interval == "" {
+		fuseConnCheckConfig.Interval = constant.DefaultFuseConnectionCheckInterval
+	}
+
+	// pod daemon configuration
+	podDaemonConfig := &c.PodDaemonConfig
+	if podDaemonConfig.ReapInterval == "" {
+		podDaemonConfig.ReapInterval = constant.DefaultPodDaemonReapInterval
+	}
+	if podDaemonConfig.ContainerdAddress == "" {
+		podDaemonConfig.ContainerdAddress = constant.DefaultContainerdAddress
+	}
+
+	// disk pressure configuration
+	diskPressureConfig := &c.DiskPressureConfig
+	if diskPressureConfig.MinFreeSpace == "" {
+		diskPressureConfig.MinFreeSpace = constant.DefaultDiskMinFreeSpace
+	}
+	if diskPressureConfig.CheckInterval == "" {
+		diskPressureConfig.CheckInterval = constant.DefaultDiskPressureCheckInterval
+	}
+
+	// prefetch schedule configuration
+	prefetchScheduleConfig := &c.PrefetchScheduleConfig
+	if prefetchScheduleConfig.CheckInterval == "" {
+		prefetchScheduleConfig.CheckInterval = constant.DefaultPrefetchScheduleCheckInterval
+	}
+
+	// read-ahead configuration
+	readAheadConfig := &c.ReadAheadConfig
+	if readAheadConfig.Classes == nil {
+		readAheadConfig.Classes = make(map[string]ReadAheadWindow)
+	}
+	for class, window := range defaultReadAheadWindows {
+		if _, ok := readAheadConfig.Classes[class]; !ok {
+			readAheadConfig.Classes[class] = window
+		}
+	}
 
 	return c.SetupNydusBinaryPaths()
 }
 
+var defaultReadAheadWindows = map[string]ReadAheadWindow{
+	WorkloadClassDatabase: {AmplifyIO: 128 << 10, MergingSize: 128 << 10},
+	WorkloadClassWeb:      {AmplifyIO: 1 << 20, MergingSize: 1 << 20},
+	WorkloadClassBatch:    {AmplifyIO: 4 << 20, MergingSize: 4 << 20},
+}
+
 func (c *SnapshotterConfig) SetupNydusBinaryPaths() error {
 	// resolve nydusd path
 	if path, err := exec.LookPath(constant.NydusdBinaryName); err == nil {
@@ -31,6 +31,7 @@ var (
 type GlobalConfig struct {
 	origin           *SnapshotterConfig
 	SnapshotsDir     string
+	VolumesDir       string
 	DaemonMode       DaemonMode
 	SocketRoot       string
 	ConfigRoot       string
@@ -52,6 +53,14 @@ func GetSnapshotsRootDir() string {
 	return globalConfig.SnapshotsDir
 }
 
+func GetVolumesRootDir() string {
+	return globalConfig.VolumesDir
+}
+
+func GetVolumeTargetRoot() string {
+	return globalConfig.origin.SnapshotsConfig.VolumeTargetRoot
+}
+
 func GetRootMountpoint() string {
 	return globalConfig.RootMountpoint
 }
@@ -171,6 +180,9 @@ func ProcessConfigurations(c *SnapshotterConfig) error {
 	if c.LoggingConfig.LogDir == "" {
 		c.LoggingConfig.LogDir = filepath.Join(c.Root, logging.DefaultLogDirName)
 	}
+	if c.DaemonConfig.SupervisorDir == "" {
+		c.DaemonConfig.SupervisorDir = filepath.Join(c.Root, "supervisor")
+	}
 	if c.CacheManagerConfig.CacheDir == "" {
 		c.CacheManagerConfig.CacheDir = filepath.Join(c.Root, "cache")
 	}
@@ -178,6 +190,7 @@ func ProcessConfigurations(c *SnapshotterConfig) error {
 	globalConfig.origin = c
 
 	globalConfig.SnapshotsDir = filepath.Join(c.Root, "snapshots")
+	globalConfig.VolumesDir = filepath.Join(c.Root, "volumes")
 	globalConfig.ConfigRoot = filepath.Join(c.Root, "config")
 	globalConfig.SocketRoot = filepath.Join(c.Root, "socket")
 	globalConfig.RootMountpoint = filepath.Join(c.Root, "mnt")
@@ -13,6 +13,7 @@ const (
 	DaemonModeDedicated string = "dedicated"
 	DaemonModeShared    string = "shared"
 	DaemonModeNone      string = "none"
+	DaemonModePod       string = "pod"
 	DaemonModeInvalid   string = ""
 )
 
@@ -29,6 +30,13 @@ const (
 	FsDriverProxy string = "proxy"
 )
 
+const (
+	// Nydusd performs backend and cache IO by blocking syscalls.
+	IOEngineSync string = "sync"
+	// Nydusd performs backend and cache IO by io_uring, requires Linux 5.1 or later.
+	IOEngineIOUring string = "io_uring"
+)
+
 const (
 	DefaultDaemonMode string = DaemonModeMultiple
 
@@ -37,6 +45,18 @@ const (
 	DefaultLogLevel string = "info"
 	DefaultGCPeriod string = "24h"
 
+	DefaultCacheQuotaCheckInterval string = "5m"
+
+	DefaultMountCheckInterval          string = "1m"
+	DefaultFuseConnectionCheckInterval string = "30s"
+	DefaultPodDaemonReapInterval       string = "1m"
+	DefaultContainerdAddress           string = "/run/containerd/containerd.sock"
+
+	DefaultDiskMinFreeSpace          string = "1Gi"
+	DefaultDiskPressureCheckInterval string = "30s"
+
+	DefaultPrefetchScheduleCheckInterval string = "1m"
+
 	DefaultNydusDaemonConfigPath string = "/etc/nydus/nydusd-config.json"
 	NydusdBinaryName             string = "nydusd"
 	NydusImageBinaryName         string = "nydus-image"
@@ -48,7 +48,7 @@ func SetUp(logLevel string, logToStdout bool, logDir string, logRotateArgs *Rota
 		if err := os.MkdirAll(logDir, 0755); err != nil {
 			return errors.Wrapf(err, "create log dir %s", logDir)
 		}
-		logFile := filepath.Join(logDir, defaultLogFileName)
+		logFile := LogFile(logDir)
 
 		lumberjackLogger := &lumberjack.Logger{
 			Filename:   logFile,
@@ -68,6 +68,11 @@ func SetUp(logLevel string, logToStdout bool, logDir string, logRotateArgs *Rota
 	return nil
 }
 
+// LogFile is where the snapshotter logs to in the log directory.
+func LogFile(logDir string) string {
+	return filepath.Join(logDir, defaultLogFileName)
+}
+
 func WithContext() context.Context {
 	return log.WithLogger(context.Background(), log.L)
 }
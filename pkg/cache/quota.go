@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+)
+
+// ImageCache is the set of blob caches used by an image.
+type ImageCache struct {
+	Image string
+	// Bytes of cache the image may use, no limit if not positive.
+	Quota int64
+	Blobs []string
+}
+
+// QuotaReport tells the cache usage of an image and the blobs evicted to bring it
+// under quota.
+type QuotaReport struct {
+	Image   string   `json:"image"`
+	Usage   int64    `json:"usage"`
+	Evicted []string `json:"evicted"`
+}
+
+type blobCacheInfo struct {
+	id     string
+	usage  int64
+	access time.Time
+}
+
+// BlobIDFromCacheFile returns the ID of the blob a cache file, e.g. one reported as
+// an underlying file by nydusd, belongs to.
+func BlobIDFromCacheFile(p string) string {
+	name := filepath.Base(p)
+	for _, suffix := range []string{dataFileSuffix, chunkMapFileSuffix, metaFileSuffix,
+		imageDiskFileSuffix, layerDiskFileSuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// EvictUnusedBlobCaches removes the blob caches not used by any mounted RAFS
+// instance to release disk space, e.g. when the disk is full. Returns IDs of
+// the evicted blobs.
+func (m *Manager) EvictUnusedBlobCaches(ctx context.Context, inUse map[string]bool) ([]string, error) {
+	entries, err := os.ReadDir(m.cacheDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read cache directory %s", m.cacheDir)
+	}
+
+	evicted := []string{}
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return evicted, ctx.Err()
+		}
+		// Only blobs cached by nydusd have chunk maps.
+		if !strings.HasSuffix(e.Name(), chunkMapFileSuffix) {
+			continue
+		}
+		blobID := strings.TrimSuffix(e.Name(), chunkMapFileSuffix)
+		if inUse[blobID] {
+			continue
+		}
+		if err := m.RemoveBlobCache(blobID); err != nil {
+			log.L.WithError(err).Warnf("Failed to evict blob cache %s", blobID)
+			continue
+		}
+		evicted = append(evicted, blobID)
+	}
+
+	return evicted, nil
+}
+
+func (m *Manager) blobCacheInfo(ctx context.Context, blobID string) (*blobCacheInfo, error) {
+	usage, err := m.CacheUsage(ctx, blobID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &blobCacheInfo{id: blobID, usage: usage.Size}
+	if stat, err := os.Stat(blobDataFile(m.cacheDir, blobID)); err == nil {
+		// The access time is not updated on filesystems mounted with noatime,
+		// fall back to the modification time then.
+		info.access = stat.ModTime()
+		if st, ok := stat.Sys().(*syscall.Stat_t); ok {
+			if atime := time.Unix(st.Atim.Unix()); atime.After(info.access) {
+				info.access = atime
+			}
+		}
+	}
+
+	return info, nil
+}
+
+// EnforceQuota evicts blob caches of the images exceeding their quotas, the least
+// recently accessed blobs first. Blobs in use by mounted RAFS instances are never
+// evicted, since nydusd reads their caches without further checks. Other blobs
+// are removed even if shared with other images, which fetch them again on demand.
+// Caches are evicted at blob granularity as nydusd doesn't record chunk accesses.
+func (m *Manager) EnforceQuota(ctx context.Context, images []ImageCache, inUse map[string]bool) ([]QuotaReport, error) {
+	reports := make([]QuotaReport, 0, len(images))
+	for _, img := range images {
+		report := QuotaReport{Image: img.Image, Evicted: []string{}}
+
+		var candidates []*blobCacheInfo
+		for _, id := range uniqueBlobs(img.Blobs) {
+			info, err := m.blobCacheInfo(ctx, id)
+			if err != nil {
+				return nil, errors.Wrapf(err, "get cache usage of blob %s", id)
+			}
+			report.Usage += info.usage
+			if !inUse[id] && info.usage > 0 {
+				candidates = append(candidates, info)
+			}
+		}
+
+		if img.Quota > 0 && report.Usage > img.Quota {
+			sort.Slice(candidates, func(i, j int) bool {
+				return candidates[i].access.Before(candidates[j].access)
+			})
+			for _, c := range candidates {
+				if report.Usage <= img.Quota {
+					break
+				}
+				if err := m.RemoveBlobCache(c.id); err != nil {
+					log.L.WithError(err).Warnf("Failed to evict blob cache %s of image %s", c.id, img.Image)
+					continue
+				}
+				report.Usage -= c.usage
+				report.Evicted = append(report.Evicted, c.id)
+			}
+			if report.Usage > img.Quota {
+				log.L.Warnf("Cache usage %d of image %s still exceeds quota %d, the rest is in use",
+					report.Usage, img.Image, img.Quota)
+			}
+		}
+
+		collector.NewImageCacheCollector(img.Image, report.Usage, len(report.Evicted)).Collect()
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func uniqueBlobs(blobs []string) []string {
+	seen := make(map[string]bool, len(blobs))
+	unique := make([]string, 0, len(blobs))
+	for _, id := range blobs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
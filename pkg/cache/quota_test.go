@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeBlobCache(t *testing.T, dir, blobID string, size int, access time.Time) {
+	writeChunkMap(t, filepath.Join(dir, blobID+chunkMapFileSuffix), chunkMapMagic, true)
+	p := filepath.Join(dir, blobID+dataFileSuffix)
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = 0xff
+	}
+	require.NoError(t, os.WriteFile(p, content, 0600))
+	require.NoError(t, os.Chtimes(p, access, access))
+}
+
+func TestBlobIDFromCacheFile(t *testing.T) {
+	require.Equal(t, "abc", BlobIDFromCacheFile("/var/lib/nydus/cache/abc.blob.data"))
+	require.Equal(t, "abc", BlobIDFromCacheFile("/var/lib/nydus/cache/abc.chunk_map"))
+	require.Equal(t, "abc", BlobIDFromCacheFile("abc"))
+}
+
+func TestEnforceQuota(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(Opt{CacheDir: dir})
+	require.NoError(t, err)
+
+	now := time.Now()
+	writeBlobCache(t, dir, "cold", 1<<20, now.Add(-2*time.Hour))
+	writeBlobCache(t, dir, "warm", 1<<20, now.Add(-time.Hour))
+	writeBlobCache(t, dir, "hot", 1<<20, now)
+	writeBlobCache(t, dir, "shared", 1<<20, now.Add(-3*time.Hour))
+	writeBlobCache(t, dir, "mounted", 1<<20, now.Add(-4*time.Hour))
+	writeBlobCache(t, dir, "other", 1<<20, now.Add(-3*time.Hour))
+
+	reports, err := m.EnforceQuota(context.Background(), []ImageCache{
+		{Image: "big", Quota: 5 << 19, Blobs: []string{"cold", "warm", "hot", "shared", "mounted", "hot"}},
+		{Image: "small", Blobs: []string{"shared", "other"}},
+	}, map[string]bool{"mounted": true})
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+
+	// The blob in use is kept though it's the coldest one, the shared one is not.
+	require.Equal(t, "big", reports[0].Image)
+	require.Equal(t, []string{"shared", "cold", "warm"}, reports[0].Evicted)
+	require.LessOrEqual(t, reports[0].Usage, int64(5<<19))
+	require.Empty(t, reports[1].Evicted)
+	require.Less(t, reports[1].Usage, int64(2<<20))
+
+	for _, id := range []string{"shared", "cold", "warm"} {
+		require.NoFileExists(t, filepath.Join(dir, id+chunkMapFileSuffix))
+		require.NoFileExists(t, filepath.Join(dir, id+dataFileSuffix))
+	}
+	for _, id := range []string{"hot", "mounted", "other"} {
+		require.FileExists(t, filepath.Join(dir, id+dataFileSuffix))
+	}
+}
+
+func TestEvictUnusedBlobCaches(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(Opt{CacheDir: dir})
+	require.NoError(t, err)
+
+	writeBlobCache(t, dir, "used", 1<<20, time.Now())
+	writeBlobCache(t, dir, "unused", 1<<20, time.Now())
+	// Tarfs blob without chunk map
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tarfs"), []byte("data"), 0600))
+
+	evicted, err := m.EvictUnusedBlobCaches(context.Background(), map[string]bool{"used": true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"unused"}, evicted)
+
+	require.FileExists(t, filepath.Join(dir, "used"+chunkMapFileSuffix))
+	require.NoFileExists(t, filepath.Join(dir, "unused"+chunkMapFileSuffix))
+	content, err := os.ReadFile(filepath.Join(dir, "tarfs"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), content)
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+	"lukechampine.com/blake3"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+const (
+	// Layout of RAFS v6 bootstraps, an EROFS super block followed by the RAFS
+	// extended super block locating the blob table and the chunk table.
+	rafsV6SuperBlockOffset  = 1024
+	rafsV6SuperBlockSize    = 128
+	rafsV6SuperBlockExtSize = 256
+	rafsV6Magic             = 0xE0F5_E1E2
+
+	rafsV6BlobEntrySize  = 256
+	rafsV6ChunkEntrySize = 80
+	rafsBlobIDLength     = 64
+
+	rafsDigestBlake3 = 0
+	rafsDigestSha256 = 1
+
+	rafsChunkFlagEncrypted = 0x4
+	rafsChunkFlagBatch     = 0x8
+
+	// Sanity limits of tables read into memory.
+	rafsMaxBlobTableSize  = 1 << 24
+	rafsMaxChunkTableSize = 1 << 31
+)
+
+// rafsChunk is a chunk recorded in RAFS metadata, whose uncompressed data is cached
+// by nydusd at its uncompressed offset in the cache data file.
+type rafsChunk struct {
+	index              uint32
+	digest             []byte
+	uncompressedOffset uint64
+	uncompressedSize   uint32
+}
+
+type rafsBlob struct {
+	digestAlgo uint32
+	// Indexed by the chunk index in blob, which is also the bit in the chunk map.
+	chunks map[uint32]rafsChunk
+}
+
+func (b *rafsBlob) newHash() (hash.Hash, error) {
+	switch b.digestAlgo {
+	case rafsDigestBlake3:
+		return blake3.New(32, nil), nil
+	case rafsDigestSha256:
+		return sha256.New(), nil
+	default:
+		return nil, errors.Errorf("unknown chunk digest algorithm %d", b.digestAlgo)
+	}
+}
+
+// Read the chunks of data blobs from a RAFS v6 bootstrap, indexed by blob ID. RAFS
+// v5 bootstraps keep chunks along with inodes and are not supported.
+func readRafsChunks(bootstrap string) (map[string]*rafsBlob, error) {
+	f, err := os.Open(bootstrap)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sb := make([]byte, rafsV6SuperBlockSize+rafsV6SuperBlockExtSize)
+	if _, err := f.ReadAt(sb, rafsV6SuperBlockOffset); err != nil {
+		return nil, errors.Wrapf(err, "read super block of %s", bootstrap)
+	}
+	if binary.LittleEndian.Uint32(sb) != rafsV6Magic {
+		return nil, errors.Wrapf(errdefs.ErrNotImplemented, "bootstrap %s is not RAFS v6", bootstrap)
+	}
+
+	ext := sb[rafsV6SuperBlockSize:]
+	blobTableOffset := binary.LittleEndian.Uint64(ext[8:])
+	blobTableSize := uint64(binary.LittleEndian.Uint32(ext[16:]))
+	chunkTableOffset := binary.LittleEndian.Uint64(ext[24:])
+	chunkTableSize := binary.LittleEndian.Uint64(ext[32:])
+	if blobTableSize > rafsMaxBlobTableSize || chunkTableSize > rafsMaxChunkTableSize {
+		return nil, errors.Errorf("bootstrap %s has too large tables", bootstrap)
+	}
+
+	blobTable, err := readTable(f, blobTableOffset, blobTableSize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read blob table of %s", bootstrap)
+	}
+	var ids []string
+	blobs := make(map[string]*rafsBlob)
+	for off := 0; off+rafsV6BlobEntrySize <= len(blobTable); off += rafsV6BlobEntrySize {
+		entry := blobTable[off : off+rafsV6BlobEntrySize]
+		id := string(bytes.TrimRight(entry[:rafsBlobIDLength], "\x00"))
+		ids = append(ids, id)
+		blobs[id] = &rafsBlob{
+			digestAlgo: binary.LittleEndian.Uint32(entry[rafsBlobIDLength+16:]),
+			chunks:     make(map[uint32]rafsChunk),
+		}
+	}
+
+	chunkTable, err := readTable(f, chunkTableOffset, chunkTableSize)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read chunk table of %s", bootstrap)
+	}
+	for off := 0; off+rafsV6ChunkEntrySize <= len(chunkTable); off += rafsV6ChunkEntrySize {
+		entry := chunkTable[off : off+rafsV6ChunkEntrySize]
+		blobIndex := binary.LittleEndian.Uint32(entry[32:])
+		flags := binary.LittleEndian.Uint32(entry[36:])
+		if int(blobIndex) >= len(ids) {
+			return nil, errors.Errorf("chunk of bootstrap %s refers to unknown blob %d", bootstrap, blobIndex)
+		}
+		// Data of encrypted and batched chunks is not cached as is.
+		if flags&(rafsChunkFlagEncrypted|rafsChunkFlagBatch) != 0 {
+			continue
+		}
+		c := rafsChunk{
+			digest:             append([]byte{}, entry[:32]...),
+			uncompressedSize:   binary.LittleEndian.Uint32(entry[44:]),
+			uncompressedOffset: binary.LittleEndian.Uint64(entry[56:]),
+			index:              binary.LittleEndian.Uint32(entry[72:]),
+		}
+		blobs[ids[blobIndex]].chunks[c.index] = c
+	}
+
+	return blobs, nil
+}
+
+// BootstrapBlobIDs returns IDs of the data blobs a RAFS v6 bootstrap refers to.
+func BootstrapBlobIDs(bootstrap string) ([]string, error) {
+	blobs, err := readRafsChunks(bootstrap)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(blobs))
+	for id := range blobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func readTable(f *os.File, offset, size uint64) ([]byte, error) {
+	table := make([]byte, size)
+	if size == 0 {
+		return table, nil
+	}
+	if _, err := f.ReadAt(table, int64(offset)); err != nil {
+		return nil, err
+	}
+	return table, nil
+}
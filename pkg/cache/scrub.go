@@ -0,0 +1,382 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+)
+
+const (
+	// Layout of the chunk map file persisted by nydusd, a header followed by a
+	// bitmap telling which chunks are ready in the cache data file.
+	chunkMapHeaderSize   = 4096
+	chunkMapMagic        = 0x424D_4150
+	chunkMapMagic2       = 0x434D_4150
+	chunkMapMagicAllRdy  = 0x4D4D_4150
+	chunkMapNotAllReady  = 0
+	chunkMapAllReadyOffs = 12
+
+	scrubBufferSize  = 1 << 20
+	DefaultScrubRate = 16 << 20
+)
+
+// ScrubReport summarizes a pass over the blob caches.
+type ScrubReport struct {
+	Blobs int   `json:"blobs"`
+	Bytes int64 `json:"bytes"`
+	// Blob caches having corrupted chunks or damaged chunk maps
+	Corrupted []string `json:"corrupted"`
+	// Blob caches whose corrupted chunks are invalidated
+	Invalidated       []string `json:"invalidated"`
+	InvalidatedChunks int      `json:"invalidated_chunks"`
+}
+
+type ScrubOpt struct {
+	CacheDir string
+	Period   time.Duration
+	// Bytes read per second, scrubbing yields to the workloads reading caches.
+	Rate int
+	// Bootstraps of the mounted RAFS instances, which record digests of chunks.
+	Bootstraps func() []string
+}
+
+// Scrubber reads blob caches in background to find the corrupted ones proactively,
+// e.g. on flaky local disks. Ready chunks are verified against their digests in
+// the RAFS v6 metadata of mounted instances, the corrupted ones are marked not
+// ready in the chunk map, so nydusd fetches them from the backend again and
+// rewrites the cache.
+//
+// Caches of blobs not referred by RAFS v6 metadata are only read back, failures
+// are reported but can't be narrowed down to chunks to invalidate. Chunks are
+// expected to be cached uncompressed, which is the default of nydusd.
+type Scrubber struct {
+	cacheDir   string
+	period     time.Duration
+	limiter    *rate.Limiter
+	bootstraps func() []string
+}
+
+func NewScrubber(opt ScrubOpt) *Scrubber {
+	r := opt.Rate
+	if r <= 0 {
+		r = DefaultScrubRate
+	}
+
+	return &Scrubber{
+		cacheDir:   opt.CacheDir,
+		period:     opt.Period,
+		limiter:    rate.NewLimiter(rate.Limit(r), scrubBufferSize),
+		bootstraps: opt.Bootstraps,
+	}
+}
+
+func (s *Scrubber) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Scrub(ctx); err != nil {
+				log.L.WithError(err).Warn("Failed to scrub blob caches")
+			}
+		}
+	}
+}
+
+// Collect chunks of blobs from the bootstraps, the unreadable ones are skipped.
+func (s *Scrubber) rafsBlobs() map[string]*rafsBlob {
+	blobs := make(map[string]*rafsBlob)
+	if s.bootstraps == nil {
+		return blobs
+	}
+
+	for _, bootstrap := range s.bootstraps() {
+		bs, err := readRafsChunks(bootstrap)
+		if err != nil {
+			log.L.WithError(err).Debugf("Skip chunks in bootstrap %s", bootstrap)
+			continue
+		}
+		for id, b := range bs {
+			if existing, ok := blobs[id]; ok {
+				for idx, c := range b.chunks {
+					existing.chunks[idx] = c
+				}
+				continue
+			}
+			blobs[id] = b
+		}
+	}
+
+	return blobs
+}
+
+func (s *Scrubber) Scrub(ctx context.Context) (*ScrubReport, error) {
+	entries, err := os.ReadDir(s.cacheDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read cache directory %s", s.cacheDir)
+	}
+
+	blobs := s.rafsBlobs()
+	report := &ScrubReport{}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), chunkMapFileSuffix) {
+			continue
+		}
+		blobID := strings.TrimSuffix(e.Name(), chunkMapFileSuffix)
+
+		var n int64
+		var corrupted []uint32
+		blob, ok := blobs[blobID]
+		if ok {
+			n, corrupted, err = s.verifyBlob(ctx, blobID, blob)
+		} else {
+			n, err = s.readBlob(ctx, blobID)
+		}
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Blobs++
+		report.Bytes += n
+		if err == nil && len(corrupted) == 0 {
+			collector.NewCacheScrubCollector(n, false, false).Collect()
+			continue
+		}
+
+		report.Corrupted = append(report.Corrupted, blobID)
+		if err != nil {
+			log.L.WithError(err).Warnf("Blob cache %s is corrupted", blobID)
+			collector.NewCacheScrubCollector(n, true, false).Collect()
+			continue
+		}
+
+		log.L.Warnf("Blob cache %s has %d corrupted chunks %v", blobID, len(corrupted), corrupted)
+		if err := invalidateChunks(s.cacheDir, blobID, corrupted); err != nil {
+			log.L.WithError(err).Errorf("Failed to invalidate chunks of blob cache %s", blobID)
+			collector.NewCacheScrubCollector(n, true, false).Collect()
+			continue
+		}
+		collector.NewCacheScrubCollector(n, true, true).Collect()
+		report.Invalidated = append(report.Invalidated, blobID)
+		report.InvalidatedChunks += len(corrupted)
+	}
+
+	log.L.Infof("Scrubbed %d blob caches, %d bytes, %d corrupted, %d chunks invalidated",
+		report.Blobs, report.Bytes, len(report.Corrupted), report.InvalidatedChunks)
+
+	return report, nil
+}
+
+func blobDataFile(cacheDir, blobID string) string {
+	// For backward compatibility
+	p := filepath.Join(cacheDir, blobID+dataFileSuffix)
+	if _, err := os.Stat(p); err == nil {
+		return p
+	}
+	return filepath.Join(cacheDir, blobID)
+}
+
+// Read the chunk map of a blob, it returns the bitmap following the header and
+// whether the all ready flag is set.
+func loadChunkMap(cacheDir, blobID string) ([]byte, bool, error) {
+	chunkMap := filepath.Join(cacheDir, blobID+chunkMapFileSuffix)
+	content, err := os.ReadFile(chunkMap)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(content) < chunkMapHeaderSize {
+		return nil, false, errors.Errorf("chunk map %s is truncated", chunkMap)
+	}
+	if magic := binary.LittleEndian.Uint32(content); magic != chunkMapMagic {
+		return nil, false, errors.Errorf("chunk map %s is damaged, invalid magic %#x", chunkMap, magic)
+	}
+
+	allReady := binary.LittleEndian.Uint32(content[8:]) == chunkMapMagic2 &&
+		binary.LittleEndian.Uint32(content[chunkMapAllReadyOffs:]) == chunkMapMagicAllRdy
+
+	return content[chunkMapHeaderSize:], allReady, nil
+}
+
+func chunkReady(bitmap []byte, index uint32) bool {
+	i := int(index >> 3)
+	return i < len(bitmap) && bitmap[i]&(1<<(index&7)) != 0
+}
+
+// Wait for the limiter to read n bytes, which may exceed its burst.
+func (s *Scrubber) wait(ctx context.Context, n int) error {
+	for n > 0 {
+		m := n
+		if m > s.limiter.Burst() {
+			m = s.limiter.Burst()
+		}
+		if err := s.limiter.WaitN(ctx, m); err != nil {
+			return err
+		}
+		n -= m
+	}
+	return nil
+}
+
+// Read the ready chunks of a blob back from the cache data file and verify their
+// digests. Chunks failed to be read are considered corrupted as well.
+func (s *Scrubber) verifyBlob(ctx context.Context, blobID string, blob *rafsBlob) (int64, []uint32, error) {
+	bitmap, allReady, err := loadChunkMap(s.cacheDir, blobID)
+	if err != nil {
+		return 0, nil, err
+	}
+	h, err := blob.newHash()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	data, err := os.Open(blobDataFile(s.cacheDir, blobID))
+	if err != nil {
+		// Nothing is cached yet.
+		if os.IsNotExist(err) {
+			return 0, nil, nil
+		}
+		return 0, nil, errors.Wrap(err, "open cache data")
+	}
+	defer data.Close()
+
+	indexes := make([]uint32, 0, len(blob.chunks))
+	for idx := range blob.chunks {
+		if allReady || chunkReady(bitmap, idx) {
+			indexes = append(indexes, idx)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+	var total int64
+	var corrupted []uint32
+	var buf []byte
+	for _, idx := range indexes {
+		c := blob.chunks[idx]
+		if err := s.wait(ctx, int(c.uncompressedSize)); err != nil {
+			return total, corrupted, err
+		}
+		if cap(buf) < int(c.uncompressedSize) {
+			buf = make([]byte, c.uncompressedSize)
+		}
+		buf = buf[:c.uncompressedSize]
+
+		n, err := data.ReadAt(buf, int64(c.uncompressedOffset))
+		total += int64(n)
+		if err != nil {
+			log.L.WithError(err).Debugf("Failed to read chunk %d of blob cache %s", idx, blobID)
+			corrupted = append(corrupted, idx)
+			continue
+		}
+
+		h.Reset()
+		h.Write(buf)
+		if !bytes.Equal(h.Sum(nil), c.digest) {
+			corrupted = append(corrupted, idx)
+		}
+	}
+
+	return total, corrupted, nil
+}
+
+// Check the chunk map and read the whole cache data file back, chunks not ready
+// are holes in the sparse data file and cheap to read.
+func (s *Scrubber) readBlob(ctx context.Context, blobID string) (int64, error) {
+	if _, _, err := loadChunkMap(s.cacheDir, blobID); err != nil {
+		return 0, err
+	}
+
+	data, err := os.Open(blobDataFile(s.cacheDir, blobID))
+	if err != nil {
+		// Nothing is cached yet.
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "open cache data")
+	}
+	defer data.Close()
+
+	var total int64
+	buf := make([]byte, scrubBufferSize)
+	for {
+		if err := s.limiter.WaitN(ctx, len(buf)); err != nil {
+			return total, err
+		}
+		n, err := data.Read(buf)
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, errors.Wrapf(err, "read cache data at offset %d", total)
+		}
+	}
+}
+
+// Mark the chunks not ready, nydusd opens the chunk map with shared mapping and
+// sees the change.
+func invalidateChunks(cacheDir, blobID string, indexes []uint32) error {
+	chunkMap := filepath.Join(cacheDir, blobID+chunkMapFileSuffix)
+	f, err := os.OpenFile(chunkMap, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if len(content) < chunkMapHeaderSize || binary.LittleEndian.Uint32(content) != chunkMapMagic {
+		return errors.Errorf("chunk map %s is damaged", chunkMap)
+	}
+
+	bitmap := content[chunkMapHeaderSize:]
+	allReady := binary.LittleEndian.Uint32(content[8:]) == chunkMapMagic2 &&
+		binary.LittleEndian.Uint32(content[chunkMapAllReadyOffs:]) == chunkMapMagicAllRdy
+	// The bitmap may not be maintained once all chunks are ready.
+	if allReady {
+		for i := range bitmap {
+			bitmap[i] = 0xff
+		}
+	}
+	for _, idx := range indexes {
+		if i := int(idx >> 3); i < len(bitmap) {
+			bitmap[i] &^= 1 << (idx & 7)
+		}
+	}
+
+	// Update the bitmap before the all ready flag, so the corrupted chunks are
+	// never considered ready by the bitmap alone.
+	if _, err := f.WriteAt(bitmap, chunkMapHeaderSize); err != nil {
+		return errors.Wrap(err, "update chunk map")
+	}
+	if allReady {
+		flag := make([]byte, 4)
+		binary.LittleEndian.PutUint32(flag, chunkMapNotAllReady)
+		if _, err := f.WriteAt(flag, chunkMapAllReadyOffs); err != nil {
+			return errors.Wrap(err, "reset all ready flag")
+		}
+	}
+
+	return f.Sync()
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"lukechampine.com/blake3"
+)
+
+func writeChunkMap(t *testing.T, path string, magic uint32, allReady bool) {
+	content := make([]byte, chunkMapHeaderSize+16)
+	binary.LittleEndian.PutUint32(content, magic)
+	binary.LittleEndian.PutUint32(content[8:], chunkMapMagic2)
+	if allReady {
+		binary.LittleEndian.PutUint32(content[chunkMapAllReadyOffs:], chunkMapMagicAllRdy)
+	}
+	for i := chunkMapHeaderSize; i < len(content); i++ {
+		content[i] = 0xff
+	}
+	require.NoError(t, os.WriteFile(path, content, 0600))
+}
+
+func TestScrub(t *testing.T) {
+	dir := t.TempDir()
+
+	writeChunkMap(t, filepath.Join(dir, "good"+chunkMapFileSuffix), chunkMapMagic, true)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "good"+dataFileSuffix), make([]byte, 3000), 0600))
+	// Legacy data file
+	writeChunkMap(t, filepath.Join(dir, "legacy"+chunkMapFileSuffix), chunkMapMagic, false)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "legacy"), make([]byte, 1000), 0600))
+	// Nothing cached yet
+	writeChunkMap(t, filepath.Join(dir, "empty"+chunkMapFileSuffix), chunkMapMagic, false)
+	// Truncated chunk map
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "truncated"+chunkMapFileSuffix), []byte{1, 2}, 0600))
+	// Unreadable data file
+	writeChunkMap(t, filepath.Join(dir, "broken"+chunkMapFileSuffix), chunkMapMagic, true)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "broken"+dataFileSuffix), 0700))
+
+	s := NewScrubber(ScrubOpt{CacheDir: dir})
+	report, err := s.Scrub(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 5, report.Blobs)
+	require.Equal(t, int64(4000), report.Bytes)
+	require.ElementsMatch(t, []string{"truncated", "broken"}, report.Corrupted)
+	// Corrupted chunks are unknown without RAFS metadata.
+	require.Empty(t, report.Invalidated)
+
+	content, err := os.ReadFile(filepath.Join(dir, "broken"+chunkMapFileSuffix))
+	require.NoError(t, err)
+	require.Equal(t, uint32(chunkMapMagicAllRdy), binary.LittleEndian.Uint32(content[chunkMapAllReadyOffs:]))
+}
+
+type testChunk struct {
+	data  []byte
+	index uint32
+	// Offset in the cache data file
+	offset uint64
+}
+
+// Write a RAFS v6 bootstrap having only the tables the scrubber reads.
+func writeBootstrap(t *testing.T, path string, blobs map[string]uint32, chunks map[string][]testChunk) {
+	ids := make([]string, 0, len(blobs))
+	for id := range blobs {
+		ids = append(ids, id)
+	}
+
+	blobTable := make([]byte, 0)
+	chunkTable := make([]byte, 0)
+	for i, id := range ids {
+		entry := make([]byte, rafsV6BlobEntrySize)
+		copy(entry, id)
+		binary.LittleEndian.PutUint32(entry[rafsBlobIDLength+16:], blobs[id])
+		blobTable = append(blobTable, entry...)
+
+		for _, c := range chunks[id] {
+			entry := make([]byte, rafsV6ChunkEntrySize)
+			if blobs[id] == rafsDigestSha256 {
+				d := sha256.Sum256(c.data)
+				copy(entry, d[:])
+			} else {
+				d := blake3.Sum256(c.data)
+				copy(entry, d[:])
+			}
+			binary.LittleEndian.PutUint32(entry[32:], uint32(i))
+			binary.LittleEndian.PutUint32(entry[44:], uint32(len(c.data)))
+			binary.LittleEndian.PutUint64(entry[56:], c.offset)
+			binary.LittleEndian.PutUint32(entry[72:], c.index)
+			chunkTable = append(chunkTable, entry...)
+		}
+	}
+
+	content := make([]byte, 4096)
+	binary.LittleEndian.PutUint32(content[rafsV6SuperBlockOffset:], rafsV6Magic)
+	ext := content[rafsV6SuperBlockOffset+rafsV6SuperBlockSize:]
+	binary.LittleEndian.PutUint64(ext[8:], uint64(len(content)))
+	binary.LittleEndian.PutUint32(ext[16:], uint32(len(blobTable)))
+	binary.LittleEndian.PutUint64(ext[24:], uint64(len(content)+len(blobTable)))
+	binary.LittleEndian.PutUint64(ext[32:], uint64(len(chunkTable)))
+	content = append(content, blobTable...)
+	content = append(content, chunkTable...)
+
+	require.NoError(t, os.WriteFile(path, content, 0600))
+}
+
+func TestScrubChunks(t *testing.T) {
+	dir := t.TempDir()
+	chunk := func(b byte, index uint32) testChunk {
+		data := make([]byte, 100)
+		for i := range data {
+			data[i] = b
+		}
+		return testChunk{data: data, index: index, offset: uint64(index) * 100}
+	}
+	chunks := map[string][]testChunk{
+		"sha256": {chunk('a', 0), chunk('b', 1), chunk('c', 2)},
+		"blake3": {chunk('x', 0), chunk('y', 1)},
+	}
+	bootstrap := filepath.Join(dir, "image.boot")
+	writeBootstrap(t, bootstrap, map[string]uint32{"sha256": rafsDigestSha256, "blake3": rafsDigestBlake3}, chunks)
+	ids, err := BootstrapBlobIDs(bootstrap)
+	require.NoError(t, err)
+	require.Equal(t, []string{"blake3", "sha256"}, ids)
+
+	writeData := func(id string, corrupted ...uint32) {
+		var data []byte
+		for _, c := range chunks[id] {
+			d := append([]byte{}, c.data...)
+			for _, idx := range corrupted {
+				if idx == c.index {
+					d[50] ^= 0xff
+				}
+			}
+			data = append(data, d...)
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, id+dataFileSuffix), data, 0600))
+	}
+
+	// Chunk 1 is corrupted, chunk 2 is not ready and not verified.
+	writeChunkMap(t, filepath.Join(dir, "sha256"+chunkMapFileSuffix), chunkMapMagic, false)
+	mapPath := filepath.Join(dir, "sha256"+chunkMapFileSuffix)
+	content, err := os.ReadFile(mapPath)
+	require.NoError(t, err)
+	content[chunkMapHeaderSize] = 0x03
+	require.NoError(t, os.WriteFile(mapPath, content, 0600))
+	writeData("sha256", 1, 2)
+
+	writeChunkMap(t, filepath.Join(dir, "blake3"+chunkMapFileSuffix), chunkMapMagic, true)
+	writeData("blake3", 0)
+
+	s := NewScrubber(ScrubOpt{CacheDir: dir, Bootstraps: func() []string {
+		return []string{bootstrap, filepath.Join(dir, "missing.boot")}
+	}})
+	report, err := s.Scrub(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Blobs)
+	require.Equal(t, int64(400), report.Bytes)
+	require.ElementsMatch(t, []string{"sha256", "blake3"}, report.Corrupted)
+	require.ElementsMatch(t, []string{"sha256", "blake3"}, report.Invalidated)
+	require.Equal(t, 2, report.InvalidatedChunks)
+
+	content, err = os.ReadFile(mapPath)
+	require.NoError(t, err)
+	require.Equal(t, byte(0x01), content[chunkMapHeaderSize])
+
+	content, err = os.ReadFile(filepath.Join(dir, "blake3"+chunkMapFileSuffix))
+	require.NoError(t, err)
+	require.Equal(t, uint32(chunkMapNotAllReady), binary.LittleEndian.Uint32(content[chunkMapAllReadyOffs:]))
+	require.Equal(t, byte(0xfe), content[chunkMapHeaderSize])
+	require.Equal(t, byte(0xff), content[chunkMapHeaderSize+1])
+
+	// Nothing is corrupted once invalidated chunks are fetched again.
+	writeData("sha256")
+	writeData("blake3")
+	report, err = s.Scrub(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, report.Corrupted)
+}
+
+func TestScrubCanceled(t *testing.T) {
+	dir := t.TempDir()
+	writeChunkMap(t, filepath.Join(dir, "blob"+chunkMapFileSuffix), chunkMapMagic, true)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "blob"+dataFileSuffix), make([]byte, 10), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewScrubber(ScrubOpt{CacheDir: dir}).Scrub(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"math/bits"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// BlobWarmth tells how much of a blob is cached.
+type BlobWarmth struct {
+	ID          string
+	CachedBytes int64
+	ReadyChunks uint64
+	// Chunks tracked by the chunk map, rounded up to a multiple of 8
+	TotalChunks uint64
+}
+
+// Count the chunks marked ready in the chunk map of a blob, every chunk is ready
+// if the all ready flag is set.
+func readChunkMap(cacheDir, blobID string) (uint64, uint64, error) {
+	bitmap, allReady, err := loadChunkMap(cacheDir, blobID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	total := uint64(len(bitmap)) * 8
+	if allReady {
+		return total, total, nil
+	}
+	var ready uint64
+	for _, b := range bitmap {
+		ready += uint64(bits.OnesCount8(b))
+	}
+
+	return ready, total, nil
+}
+
+// BlobWarmth reads the chunk map of a blob cached by nydusd to tell how much of
+// it is ready in the cache.
+func (m *Manager) BlobWarmth(ctx context.Context, blobID string) (*BlobWarmth, error) {
+	usage, err := m.CacheUsage(ctx, blobID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get cache usage of blob %s", blobID)
+	}
+
+	w := &BlobWarmth{ID: blobID, CachedBytes: usage.Size}
+	w.ReadyChunks, w.TotalChunks, err = readChunkMap(m.cacheDir, blobID)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "read chunk map of blob %s", blobID)
+	}
+
+	return w, nil
+}
+
+// BlobCached tells whether nydusd has cached all the chunks of a blob, which it
+// marks by the all ready flag of the chunk map.
+func (m *Manager) BlobCached(blobID string) (bool, error) {
+	content, err := os.ReadFile(filepath.Join(m.cacheDir, blobID+chunkMapFileSuffix))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if len(content) < chunkMapHeaderSize || binary.LittleEndian.Uint32(content) != chunkMapMagic {
+		return false, errors.Errorf("chunk map of blob %s is damaged", blobID)
+	}
+
+	return binary.LittleEndian.Uint32(content[8:]) == chunkMapMagic2 &&
+		binary.LittleEndian.Uint32(content[chunkMapAllReadyOffs:]) == chunkMapMagicAllRdy, nil
+}
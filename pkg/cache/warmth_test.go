@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobWarmth(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(Opt{CacheDir: dir})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	writeChunkMap(t, filepath.Join(dir, "ready"+chunkMapFileSuffix), chunkMapMagic, true)
+	w, err := m.BlobWarmth(ctx, "ready")
+	require.NoError(t, err)
+	require.Equal(t, uint64(128), w.TotalChunks)
+	require.Equal(t, uint64(128), w.ReadyChunks)
+
+	content := make([]byte, chunkMapHeaderSize+4)
+	binary.LittleEndian.PutUint32(content, chunkMapMagic)
+	copy(content[chunkMapHeaderSize:], []byte{0xff, 0x01, 0x00, 0x80})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "partial"+chunkMapFileSuffix), content, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "partial"+dataFileSuffix), make([]byte, 8192), 0600))
+	w, err = m.BlobWarmth(ctx, "partial")
+	require.NoError(t, err)
+	require.Equal(t, uint64(32), w.TotalChunks)
+	require.Equal(t, uint64(10), w.ReadyChunks)
+	require.Positive(t, w.CachedBytes)
+
+	// Blobs without chunk maps are not cached by nydusd.
+	w, err = m.BlobWarmth(ctx, "missing")
+	require.NoError(t, err)
+	require.Zero(t, w.TotalChunks)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken"+chunkMapFileSuffix), make([]byte, chunkMapHeaderSize), 0600))
+	_, err = m.BlobWarmth(ctx, "broken")
+	require.Error(t, err)
+}
+
+func TestBlobCached(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewManager(Opt{CacheDir: dir})
+	require.NoError(t, err)
+
+	writeChunkMap(t, filepath.Join(dir, "ready"+chunkMapFileSuffix), chunkMapMagic, true)
+	writeChunkMap(t, filepath.Join(dir, "partial"+chunkMapFileSuffix), chunkMapMagic, false)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken"+chunkMapFileSuffix), []byte("x"), 0600))
+
+	for blobID, expected := range map[string]bool{"ready": true, "partial": false, "missing": false} {
+		cached, err := m.BlobCached(blobID)
+		require.NoError(t, err)
+		require.Equal(t, expected, cached, blobID)
+	}
+	_, err = m.BlobCached("broken")
+	require.Error(t, err)
+}
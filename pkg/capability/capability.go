@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package capability detects what the platform and kernel are capable of, so the
+// snapshotter can tell whether the configured filesystem driver works on this host
+// before serving any request.
+package capability
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/semver"
+
+	"github.com/containerd/nydus-snapshotter/internal/constant"
+)
+
+var ErrUnsupported = errors.New("unsupported platform")
+
+// The earliest nydusd taking the IO engine from its configuration.
+const minIOEngineNydusdVersion = "v2.3.0"
+
+type Capabilities struct {
+	OS string `json:"os"`
+	// FUSE device is available, required by fusedev driver.
+	Fuse bool `json:"fuse"`
+	// Cachefiles device is available, required by fscache driver.
+	Fscache bool `json:"fscache"`
+	// EROFS filesystem is available, required by fscache and blockdev drivers.
+	Erofs bool `json:"erofs"`
+	// Overlay filesystem is available, required by all drivers assembling rootfs on host.
+	Overlay bool `json:"overlay"`
+	// io_uring is available, nydusd falls back to sync IO without it.
+	IOUring bool `json:"io_uring"`
+}
+
+// IOEngine tells the IO engine nydusd runs with when the engine is requested,
+// io_uring falls back to sync IO if unavailable.
+func (c *Capabilities) IOEngine(requested string) string {
+	if requested == constant.IOEngineIOUring && !c.IOUring {
+		return constant.IOEngineSync
+	}
+	return requested
+}
+
+// NydusdIOEngine tells the IO engine nydusd at `nydusdPath` runs with when the
+// engine is requested, older nydusd only performs sync IO.
+func (c *Capabilities) NydusdIOEngine(nydusdPath, requested string) string {
+	engine := c.IOEngine(requested)
+	if engine == constant.IOEngineSync {
+		return engine
+	}
+	out, err := exec.Command(nydusdPath, "--version").Output()
+	if err != nil || !ioEngineConfigurable(nydusdVersion(out)) {
+		return constant.IOEngineSync
+	}
+	return engine
+}
+
+// Parse the version from output of `nydusd --version`, e.g. "Version: v2.3.0".
+func nydusdVersion(out []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if version, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "Version:"); ok {
+			return strings.TrimSpace(version)
+		}
+	}
+	return ""
+}
+
+func ioEngineConfigurable(version string) bool {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return semver.IsValid(version) && semver.Compare(version, minIOEngineNydusdVersion) >= 0
+}
+
+// Negotiate checks whether the filesystem driver works with the capabilities, the
+// returned error wraps `ErrUnsupported` and tells what is missing.
+func (c *Capabilities) Negotiate(fsDriver string) error {
+	var missing []string
+	require := func(ok bool, name string) {
+		if !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	switch fsDriver {
+	case constant.FsDriverFusedev:
+		require(c.Fuse, "fuse")
+		require(c.Overlay, "overlay")
+	case constant.FsDriverFscache:
+		require(c.Fscache, "fscache")
+		require(c.Erofs, "erofs")
+		require(c.Overlay, "overlay")
+	case constant.FsDriverBlockdev:
+		require(c.Erofs, "erofs")
+		require(c.Overlay, "overlay")
+	case constant.FsDriverNodev:
+		require(c.Overlay, "overlay")
+	case constant.FsDriverProxy:
+		// Mounts are passed through to the runtime.
+	default:
+		return errors.Wrapf(ErrUnsupported, "unknown filesystem driver %s", fsDriver)
+	}
+
+	if len(missing) > 0 {
+		return errors.Wrapf(ErrUnsupported, "filesystem driver %s on %s requires %s",
+			fsDriver, c.OS, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package capability
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	"github.com/containerd/log"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	procRoot    = "/proc"
+	sysRoot     = "/sys"
+	devRoot     = "/dev"
+	modulesRoot = "/lib/modules"
+)
+
+func Detect() *Capabilities {
+	return &Capabilities{
+		OS:      runtime.GOOS,
+		Fuse:    deviceExists("fuse"),
+		Fscache: deviceExists("cachefiles"),
+		Erofs:   filesystemAvailable("erofs"),
+		Overlay: filesystemAvailable("overlay"),
+		IOUring: ioUringAvailable(),
+	}
+}
+
+func deviceExists(name string) bool {
+	info, err := os.Stat(filepath.Join(devRoot, name))
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// A filesystem is available if it is registered in kernel, or its module can be
+// loaded on the first mount. Assume available if it can't be told, since the
+// modules may be invisible in a container.
+func filesystemAvailable(fsType string) bool {
+	if content, err := os.ReadFile(filepath.Join(procRoot, "filesystems")); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) > 0 && fields[len(fields)-1] == fsType {
+				return true
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(sysRoot, "module", fsType)); err == nil {
+		return true
+	}
+
+	release, err := kernelRelease()
+	if err != nil {
+		return true
+	}
+
+	known := false
+	for _, index := range []string{"modules.builtin", "modules.dep"} {
+		content, err := os.ReadFile(filepath.Join(modulesRoot, release, index))
+		if err != nil {
+			continue
+		}
+		known = true
+		if bytes.Contains(content, []byte("/"+fsType+".ko")) {
+			return true
+		}
+	}
+
+	if !known {
+		log.L.Debugf("Can't tell if filesystem %s is available, assume it is", fsType)
+		return true
+	}
+
+	return false
+}
+
+// io_uring is available if a ring can be set up, the kernel may not support it or
+// disable it by sysctl `kernel.io_uring_disabled`.
+func ioUringAvailable() bool {
+	// Parameters of the ring are returned in struct io_uring_params.
+	var params [120]byte
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, 1, uintptr(unsafe.Pointer(&params[0])), 0)
+	if errno != 0 {
+		log.L.Debugf("io_uring is unavailable, %v", errno)
+		return false
+	}
+	unix.Close(int(fd))
+
+	return true
+}
+
+func kernelRelease() (string, error) {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return "", err
+	}
+
+	return unix.ByteSliceToString(uts.Release[:]), nil
+}
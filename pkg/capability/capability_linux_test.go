@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package capability
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilesystemAvailable(t *testing.T) {
+	root := t.TempDir()
+	procRoot = filepath.Join(root, "proc")
+	sysRoot = filepath.Join(root, "sys")
+	modulesRoot = filepath.Join(root, "modules")
+	defer func() {
+		procRoot, sysRoot, modulesRoot = "/proc", "/sys", "/lib/modules"
+	}()
+
+	// Unknown without any hints.
+	require.True(t, filesystemAvailable("erofs"))
+
+	require.NoError(t, os.MkdirAll(procRoot, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(procRoot, "filesystems"),
+		[]byte("nodev\tsysfs\nnodev\toverlay\n\text4\n"), 0644))
+	require.True(t, filesystemAvailable("overlay"))
+	require.True(t, filesystemAvailable("ext4"))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(sysRoot, "module", "fuse"), 0755))
+	require.True(t, filesystemAvailable("fuse"))
+
+	release, err := kernelRelease()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(modulesRoot, release), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(modulesRoot, release, "modules.dep"),
+		[]byte("kernel/fs/erofs/erofs.ko.zst: kernel/lib/lz4.ko\n"), 0644))
+	require.True(t, filesystemAvailable("erofs"))
+	require.False(t, filesystemAvailable("btrfs"))
+}
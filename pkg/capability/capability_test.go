@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package capability
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/internal/constant"
+)
+
+func TestNegotiate(t *testing.T) {
+	full := &Capabilities{OS: "linux", Fuse: true, Fscache: true, Erofs: true, Overlay: true}
+	for _, driver := range []string{constant.FsDriverFusedev, constant.FsDriverFscache,
+		constant.FsDriverBlockdev, constant.FsDriverNodev, constant.FsDriverProxy} {
+		require.NoError(t, full.Negotiate(driver), driver)
+	}
+
+	noFscache := &Capabilities{OS: "linux", Fuse: true, Overlay: true}
+	require.NoError(t, noFscache.Negotiate(constant.FsDriverFusedev))
+	err := noFscache.Negotiate(constant.FsDriverFscache)
+	require.ErrorIs(t, err, ErrUnsupported)
+	require.Contains(t, err.Error(), "requires fscache, erofs")
+
+	windows := &Capabilities{OS: "windows"}
+	require.ErrorIs(t, windows.Negotiate(constant.FsDriverFusedev), ErrUnsupported)
+	require.NoError(t, windows.Negotiate(constant.FsDriverProxy))
+
+	require.ErrorIs(t, full.Negotiate("unknown"), ErrUnsupported)
+}
+
+func TestIOEngine(t *testing.T) {
+	withIOUring := &Capabilities{OS: "linux", IOUring: true}
+	require.Equal(t, constant.IOEngineIOUring, withIOUring.IOEngine(constant.IOEngineIOUring))
+	require.Equal(t, constant.IOEngineSync, withIOUring.IOEngine(constant.IOEngineSync))
+
+	withoutIOUring := &Capabilities{OS: "linux"}
+	require.Equal(t, constant.IOEngineSync, withoutIOUring.IOEngine(constant.IOEngineIOUring))
+}
+
+func TestNydusdVersion(t *testing.T) {
+	out := []byte("Version: \tv2.3.1\nGit Commit: \t1234567\nBuild Time: \t2024-06-01T00:00:00Z\n")
+	require.Equal(t, "v2.3.1", nydusdVersion(out))
+	require.Equal(t, "", nydusdVersion([]byte("error: unexpected argument\n")))
+
+	require.True(t, ioEngineConfigurable("v2.3.1"))
+	require.True(t, ioEngineConfigurable("2.3.0"))
+	require.False(t, ioEngineConfigurable("v2.2.5"))
+	require.False(t, ioEngineConfigurable(""))
+}
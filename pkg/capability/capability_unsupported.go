@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package capability
+
+import (
+	"runtime"
+)
+
+// Nydus filesystems are only supported on Linux.
+func Detect() *Capabilities {
+	return &Capabilities{OS: runtime.GOOS}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package cgroup
+
+func createCgroup(_ string, _ Config) (DaemonCgroup, error) {
+	return nil, ErrCgroupNotSupported
+}
+
+func supported() bool {
+	return false
+}
+
+func displayMode() string {
+	return "unavailable"
+}
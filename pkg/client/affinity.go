@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package client
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"sort"
+)
+
+// GetCacheAffinity returns how warm the caches of the images mounted on the node are.
+func (c *Client) GetCacheAffinity(ctx context.Context) (*CacheAffinity, error) {
+	var summary CacheAffinity
+	if err := c.call(ctx, http.MethodGet, endpointCacheAffinity, nil, &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// Warmth of the image on the node, 0 if the image isn't cached.
+func (a *CacheAffinity) Warmth(digest string) float64 {
+	for _, img := range a.Images {
+		if img.Digest == digest {
+			return img.Warmth
+		}
+	}
+	return 0
+}
+
+// RendezvousWeight is the weight of the node for the image in rendezvous hashing,
+// a form of consistent hashing. Nodes with the highest weights of an image are
+// always the same ones whatever the other nodes are, and only the pods on a node
+// move when the node leaves.
+func RendezvousWeight(node, digest string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(node))
+	h.Write([]byte{0})
+	h.Write([]byte(digest))
+	return h.Sum64()
+}
+
+// RankNodes orders the nodes by cache affinity to the image, for a scheduler
+// extender to prefer the first ones. Nodes caching more of the image come first,
+// nodes equally warm, e.g. all cold for a new image, are ordered by rendezvous
+// hashing, so pods of an image keep landing on the same nodes and warm their
+// caches rather than spreading the image over the cluster.
+func RankNodes(digest string, summaries []CacheAffinity) []string {
+	type rank struct {
+		node   string
+		warmth float64
+		weight uint64
+	}
+	ranks := make([]rank, 0, len(summaries))
+	for i := range summaries {
+		s := &summaries[i]
+		ranks = append(ranks, rank{node: s.Node, warmth: s.Warmth(digest), weight: RendezvousWeight(s.Node, digest)})
+	}
+	sort.SliceStable(ranks, func(i, j int) bool {
+		if ranks[i].warmth != ranks[j].warmth {
+			return ranks[i].warmth > ranks[j].warmth
+		}
+		return ranks[i].weight > ranks[j].weight
+	})
+
+	nodes := make([]string, 0, len(ranks))
+	for _, r := range ranks {
+		nodes = append(nodes, r.node)
+	}
+	return nodes
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankNodes(t *testing.T) {
+	const digest = "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270"
+	summaries := []CacheAffinity{
+		{Node: "node-a", Images: []ImageWarmth{{Digest: digest, Warmth: 0.2}}},
+		{Node: "node-b"},
+		{Node: "node-c", Images: []ImageWarmth{{Digest: digest, Warmth: 0.9}}},
+		{Node: "node-d"},
+		{Node: "node-e", Images: []ImageWarmth{{Digest: "sha256:other", Warmth: 1}}},
+	}
+
+	nodes := RankNodes(digest, summaries)
+	require.Len(t, nodes, 5)
+	require.Equal(t, []string{"node-c", "node-a"}, nodes[:2])
+
+	// Cold nodes are ordered by rendezvous hashing regardless of the others.
+	cold := nodes[2:]
+	for i := 1; i < len(cold); i++ {
+		require.Greater(t, RendezvousWeight(cold[i-1], digest), RendezvousWeight(cold[i], digest))
+	}
+	// Removing a node doesn't reorder the others.
+	require.Equal(t, []string{"node-c", "node-a", cold[0], cold[2]},
+		RankNodes(digest, without(summaries, cold[1])))
+}
+
+func without(summaries []CacheAffinity, node string) []CacheAffinity {
+	var left []CacheAffinity
+	for _, s := range summaries {
+		if s.Node != node {
+			left = append(left, s)
+		}
+	}
+	return left
+}
@@ -0,0 +1,364 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package client is the Go SDK of the snapshotter's system controller API, for
+// agents and operators managing nydusd daemons and image volumes on the node.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/containerd/nydus-snapshotter/pkg/events"
+)
+
+const (
+	tcpAddressPrefix = "tcp://"
+
+	endpointDaemons        = "/api/v1/daemons"
+	endpointDaemonsUpgrade = "/api/v1/daemons/upgrade"
+	endpointBackend        = "/api/v1/daemons/%s/backend"
+	endpointPrefetch       = "/api/v1/prefetch"
+	endpointMetrics        = "/api/v1/metrics"
+	endpointEvents         = "/api/v1/events"
+	endpointLogs           = "/api/v1/logs"
+	endpointDaemonLogs     = "/api/v1/daemons/%s/logs"
+	endpointVolumes        = "/api/v1/volumes"
+	endpointVolume         = "/api/v1/volumes/%s"
+	endpointReadAhead      = "/api/v1/readahead"
+	endpointConfigHistory  = "/api/v1/daemons/%s/config_history"
+	endpointDryRunPrepare  = "/api/v1/snapshots/dry_run"
+	endpointCacheAffinity  = "/api/v1/cache/affinity"
+)
+
+// Error is returned when the API responds with an unexpected status.
+type Error struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+}
+
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+	tlsConfig  *tls.Config
+}
+
+type Opt func(c *Client)
+
+// WithTLSConfig connects to the TCP address with TLS.
+func WithTLSConfig(cfg *tls.Config) Opt {
+	return func(c *Client) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithToken authenticates requests with the bearer token.
+func WithToken(token string) Opt {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New creates a client of the system controller listening on address, either a
+// unix domain socket path or `tcp://host:port`.
+func New(address string, opts ...Opt) (*Client, error) {
+	if address == "" {
+		return nil, errors.New("empty address")
+	}
+
+	c := &Client{}
+	for _, o := range opts {
+		o(c)
+	}
+
+	transport := &http.Transport{}
+	if strings.HasPrefix(address, tcpAddressPrefix) {
+		scheme := "http"
+		if c.tlsConfig != nil {
+			scheme = "https"
+			transport.TLSClientConfig = c.tlsConfig
+		}
+		c.baseURL = scheme + "://" + strings.TrimPrefix(address, tcpAddressPrefix)
+	} else {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", address)
+		}
+		c.baseURL = "http://unix"
+	}
+	c.httpClient = &http.Client{Transport: transport}
+
+	return c, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "marshal request")
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create request %s %s", method, path)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request %s %s", method, path)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		content, _ := io.ReadAll(resp.Body)
+		if err := json.Unmarshal(content, apiErr); err != nil {
+			apiErr.Message = strings.TrimSpace(string(content))
+		}
+		return nil, errors.Wrapf(apiErr, "request %s %s", method, path)
+	}
+
+	return resp, nil
+}
+
+// Send the request and decode the response into result if not nil.
+func (c *Client) call(ctx context.Context, method, path string, body, result interface{}) error {
+	resp, err := c.do(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return errors.Wrapf(err, "decode response of %s %s", method, path)
+	}
+
+	return nil
+}
+
+func (c *Client) ListDaemons(ctx context.Context) ([]DaemonInfo, error) {
+	var daemons []DaemonInfo
+	if err := c.call(ctx, http.MethodGet, endpointDaemons, nil, &daemons); err != nil {
+		return nil, err
+	}
+	return daemons, nil
+}
+
+func (c *Client) GetBackend(ctx context.Context, daemonID string) (*Backend, error) {
+	var backend Backend
+	if err := c.call(ctx, http.MethodGet, fmt.Sprintf(endpointBackend, url.PathEscape(daemonID)), nil, &backend); err != nil {
+		return nil, err
+	}
+	return &backend, nil
+}
+
+// UpgradeDaemon live upgrades all the nydusd daemons to a new binary.
+func (c *Client) UpgradeDaemon(ctx context.Context, req UpgradeRequest) error {
+	return c.call(ctx, http.MethodPut, endpointDaemonsUpgrade, &req, nil)
+}
+
+// Warmup sets files to be prefetched when the images are mounted.
+func (c *Client) Warmup(ctx context.Context, reqs []WarmupRequest) error {
+	return c.call(ctx, http.MethodPut, endpointPrefetch, reqs, nil)
+}
+
+// GetMetrics returns the snapshotter's metric families indexed by their names.
+func (c *Client) GetMetrics(ctx context.Context) (map[string]*dto.MetricFamily, error) {
+	resp, err := c.do(ctx, http.MethodGet, endpointMetrics, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse metrics")
+	}
+
+	return families, nil
+}
+
+// Events streams lifecycle events of daemons and instances published after the
+// call. Both channels are closed when the stream ends, an error is sent unless
+// the context is canceled.
+func (c *Client) Events(ctx context.Context) (<-chan events.Event, <-chan error) {
+	evCh := make(chan events.Event)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(errCh)
+		defer close(evCh)
+
+		resp, err := c.do(ctx, http.MethodGet, endpointEvents, nil)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		defer resp.Body.Close()
+
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var ev events.Event
+			if err := decoder.Decode(&ev); err != nil {
+				if ctx.Err() == nil {
+					errCh <- errors.Wrap(err, "decode event")
+				}
+				return
+			}
+			select {
+			case evCh <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return evCh, errCh
+}
+
+// Logs streams the log of a daemon, or of the snapshotter if the daemon ID is
+// empty, as plain text lines. The caller must close the returned reader, which
+// keeps delivering lines appended to the log when following it until the
+// context is canceled.
+func (c *Client) Logs(ctx context.Context, req LogsRequest) (io.ReadCloser, error) {
+	path := endpointLogs
+	if req.DaemonID != "" {
+		path = fmt.Sprintf(endpointDaemonLogs, url.PathEscape(req.DaemonID))
+	}
+	query := url.Values{}
+	if req.Follow {
+		query.Set("follow", "true")
+	}
+	if req.Tail > 0 {
+		query.Set("tail", strconv.Itoa(req.Tail))
+	}
+	if req.Level != "" {
+		query.Set("level", req.Level)
+	}
+	if req.Instance != "" {
+		query.Set("instance", req.Instance)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *Client) ListVolumes(ctx context.Context) ([]Volume, error) {
+	var volumes []Volume
+	if err := c.call(ctx, http.MethodGet, endpointVolumes, nil, &volumes); err != nil {
+		return nil, err
+	}
+	return volumes, nil
+}
+
+func (c *Client) GetVolume(ctx context.Context, id string) (*Volume, error) {
+	var v Volume
+	if err := c.call(ctx, http.MethodGet, fmt.Sprintf(endpointVolume, url.PathEscape(id)), nil, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (c *Client) MountVolume(ctx context.Context, req MountVolumeRequest) (*Volume, error) {
+	var v Volume
+	if err := c.call(ctx, http.MethodPost, endpointVolumes, &req, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// UmountVolume unpublishes the volume from target, or from all of its targets if
+// target is empty.
+func (c *Client) UmountVolume(ctx context.Context, id, target string) error {
+	path := fmt.Sprintf(endpointVolume, url.PathEscape(id))
+	if target != "" {
+		path += "?" + url.Values{"target": []string{target}}.Encode()
+	}
+	return c.call(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// ListReadAheadWindows returns the read-ahead windows indexed by workload classes.
+func (c *Client) ListReadAheadWindows(ctx context.Context) (map[string]ReadAheadWindow, error) {
+	windows := map[string]ReadAheadWindow{}
+	if err := c.call(ctx, http.MethodGet, endpointReadAhead, nil, &windows); err != nil {
+		return nil, err
+	}
+	return windows, nil
+}
+
+// SetReadAheadWindow adds or updates the read-ahead window of a workload class,
+// which applies to instances mounted afterwards.
+func (c *Client) SetReadAheadWindow(ctx context.Context, req ReadAheadRequest) error {
+	return c.call(ctx, http.MethodPut, endpointReadAhead, &req, nil)
+}
+
+// GetConfigHistory returns the configurations rendered for a daemon and its RAFS
+// instances, oldest first. If `at` is not zero, only the configurations in
+// effect at that time are returned.
+func (c *Client) GetConfigHistory(ctx context.Context, daemonID string, at time.Time) ([]ConfigRecord, error) {
+	path := fmt.Sprintf(endpointConfigHistory, url.PathEscape(daemonID))
+	if !at.IsZero() {
+		path += "?" + url.Values{"at": []string{at.Format(time.RFC3339)}}.Encode()
+	}
+
+	var records []ConfigRecord
+	if err := c.call(ctx, http.MethodGet, path, nil, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// DryRunPrepare tells how a snapshot of the image with the labels would be
+// prepared and whether the prerequisites are met, without side effects.
+func (c *Client) DryRunPrepare(ctx context.Context, req DryRunPrepareRequest) (*MountPlan, error) {
+	var plan MountPlan
+	if err := c.call(ctx, http.MethodPost, endpointDryRunPrepare, &req, &plan); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
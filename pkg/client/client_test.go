@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/pkg/events"
+	"github.com/containerd/nydus-snapshotter/pkg/system"
+)
+
+func newTestClient(t *testing.T) *Client {
+	sock := filepath.Join(t.TempDir(), "system.sock")
+	sc, err := system.NewSystemController(nil, nil, sock)
+	require.NoError(t, err)
+	go func() {
+		_ = sc.Run()
+	}()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(sock)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	c, err := New(sock)
+	require.NoError(t, err)
+	return c
+}
+
+func TestClient(t *testing.T) {
+	c := newTestClient(t)
+	ctx := context.Background()
+
+	daemons, err := c.ListDaemons(ctx)
+	require.NoError(t, err)
+	require.Empty(t, daemons)
+
+	_, err = c.GetBackend(ctx, "unknown")
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	_, err = c.Logs(ctx, LogsRequest{DaemonID: "unknown", Follow: true})
+	require.True(t, errors.As(err, &apiErr))
+	require.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+
+	require.NoError(t, c.Warmup(ctx, []WarmupRequest{{Image: "docker.io/library/busybox:nydus", Prefetch: "/bin"}}))
+
+	families, err := c.GetMetrics(ctx)
+	require.NoError(t, err)
+	require.Contains(t, families, "snapshotter_cache_scrub_bytes")
+}
+
+func TestClientEvents(t *testing.T) {
+	c := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	evCh, errCh := c.Events(ctx)
+	// Keep publishing until the stream is subscribed.
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				events.Bus.Publish(events.InstanceMounted, "d1", "10")
+			}
+		}
+	}()
+	defer close(stop)
+
+	select {
+	case ev := <-evCh:
+		require.Equal(t, events.InstanceMounted, ev.Type)
+		require.Equal(t, "d1", ev.DaemonID)
+		require.Equal(t, "10", ev.SnapshotID)
+	case err := <-errCh:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+
+	cancel()
+	for range evCh {
+	}
+	require.NoError(t, <-errCh)
+}
+
+func TestNewTCP(t *testing.T) {
+	c, err := New("tcp://127.0.0.1:8080", WithToken("secret"))
+	require.NoError(t, err)
+	require.Equal(t, "http://127.0.0.1:8080", c.baseURL)
+	require.Equal(t, "secret", c.token)
+
+	_, err = New("")
+	require.Error(t, err)
+}
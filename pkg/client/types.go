@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DaemonInfo describes a running nydusd and the RAFS instances it serves.
+type DaemonInfo struct {
+	ID                    string  `json:"id"`
+	Pid                   int     `json:"pid"`
+	APISock               string  `json:"api_socket"`
+	SupervisorPath        string  `json:"supervisor_path"`
+	Reference             int     `json:"reference"`
+	HostMountpoint        string  `json:"mountpoint"`
+	StartupCPUUtilization float64 `json:"startup_cpu_utilization"`
+	MemoryRSS             float64 `json:"memory_rss_kb"`
+	ReadData              float32 `json:"read_data_kb"`
+	// Reconnected on recovery but not queried yet
+	Unverified bool `json:"unverified"`
+	// The disk is full
+	Degraded bool `json:"degraded"`
+	// How nydusd performs backend and cache IO
+	IOEngine string `json:"io_engine"`
+
+	Instances map[string]InstanceInfo `json:"instances"`
+}
+
+type InstanceInfo struct {
+	SnapshotID  string `json:"snapshot_id"`
+	SnapshotDir string `json:"snapshot_dir"`
+	Mountpoint  string `json:"mountpoint"`
+	ImageID     string `json:"image_id"`
+}
+
+// Backend is the storage backend a daemon fetches image data from.
+type Backend struct {
+	Type   string      `json:"type"`
+	Config interface{} `json:"config"`
+}
+
+// UpgradeRequest asks to live upgrade nydusd to the binary at NydusdPath, whose
+// version must match Version. Policy is either "rolling" or "immediate".
+type UpgradeRequest struct {
+	NydusdPath string `json:"nydusd_path"`
+	Version    string `json:"version"`
+	Policy     string `json:"policy"`
+}
+
+// WarmupRequest lists files of an image to be prefetched by the nydusd started
+// for the image next time, in the format of nydusd's `--prefetch-files`.
+type WarmupRequest struct {
+	Image    string `json:"image"`
+	Prefetch string `json:"prefetch"`
+}
+
+// Volume is a nydus image mounted read-only outside of any container rootfs.
+type Volume struct {
+	ID         string   `json:"id"`
+	ImageRef   string   `json:"image_ref"`
+	DaemonID   string   `json:"daemon_id"`
+	FsDriver   string   `json:"fs_driver"`
+	Mountpoint string   `json:"mountpoint"`
+	Targets    []string `json:"targets"`
+	Reference  int      `json:"reference"`
+}
+
+// Target must be under `volume_target_root` of the snapshotter configuration.
+type MountVolumeRequest struct {
+	ID     string            `json:"id"`
+	Image  string            `json:"image"`
+	Target string            `json:"target"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ReadAheadWindow is how much data nydusd reads around a user IO request and merges
+// in one backend request, in bytes.
+type ReadAheadWindow struct {
+	AmplifyIO   int `json:"amplify_io"`
+	MergingSize int `json:"merging_size"`
+}
+
+type ReadAheadRequest struct {
+	Class string `json:"class"`
+	ReadAheadWindow
+}
+
+// ConfigRecord is a version of configuration rendered for a daemon, or for a RAFS
+// instance if SnapshotID is not empty, with secrets stripped.
+type ConfigRecord struct {
+	Seq        uint64          `json:"seq"`
+	DaemonID   string          `json:"daemon_id"`
+	SnapshotID string          `json:"snapshot_id,omitempty"`
+	Operation  string          `json:"operation"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Config     json.RawMessage `json:"config"`
+}
+
+type DryRunPrepareRequest struct {
+	Ref       string            `json:"ref,omitempty"`
+	SandboxID string            `json:"sandbox_id,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Prerequisite of mounting a RAFS instance, with the reason if not met.
+type Prerequisite struct {
+	Name    string `json:"name"`
+	Met     bool   `json:"met"`
+	Message string `json:"message,omitempty"`
+}
+
+// MountPlan tells how the snapshotter would mount a RAFS instance for an image,
+// which daemon would serve it and with what configuration, secrets stripped.
+type MountPlan struct {
+	ImageRef          string          `json:"image_ref"`
+	FsDriver          string          `json:"fs_driver"`
+	DaemonMode        string          `json:"daemon_mode,omitempty"`
+	SandboxID         string          `json:"sandbox_id,omitempty"`
+	DaemonID          string          `json:"daemon_id,omitempty"`
+	NewDaemon         bool            `json:"new_daemon"`
+	Config            json.RawMessage `json:"config,omitempty"`
+	LazyLoading       bool            `json:"lazy_loading"`
+	LazyLoadingReason string          `json:"lazy_loading_reason,omitempty"`
+	Prerequisites     []Prerequisite  `json:"prerequisites"`
+	Ready             bool            `json:"ready"`
+}
+
+type LogsRequest struct {
+	// The daemon whose log to stream, the snapshotter's own log if empty
+	DaemonID string
+	// Keep streaming lines appended to the log
+	Follow bool
+	// Start from the last lines, all lines if not positive
+	Tail int
+	// Only lines of the level or more severe, e.g. `warn`
+	Level string
+	// Only lines mentioning the RAFS instance of the snapshot
+	Instance string
+}
+
+// ImageWarmth tells how much data of an image is cached on a node.
+type ImageWarmth struct {
+	// Manifest digest of the image, or its reference if the digest is unknown
+	Digest      string   `json:"digest"`
+	References  []string `json:"references"`
+	Blobs       int      `json:"blobs"`
+	CachedBytes int64    `json:"cached_bytes"`
+	ReadyChunks uint64   `json:"ready_chunks"`
+	TotalChunks uint64   `json:"total_chunks"`
+	// Ratio of the chunks ready in cache, from 0 for cold to 1 for fully cached
+	Warmth float64 `json:"warmth"`
+}
+
+// CacheAffinity summarizes the warm caches of images on a node.
+type CacheAffinity struct {
+	Node        string        `json:"node"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	Images      []ImageWarmth `json:"images"`
+}
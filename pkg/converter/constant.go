@@ -10,6 +10,10 @@ const (
 	ManifestOSFeatureNydus   = "nydus.remoteimage.v1"
 	MediaTypeNydusBlob       = "application/vnd.oci.image.layer.nydus.blob.v1"
 	BootstrapFileNameInLayer = "image/image.boot"
+	// Artifact type of referrer artifacts carrying nydus images of their subject,
+	// preferred when discovered through the OCI referrers API. It's never set on
+	// image manifests, not to change the digests of converted images.
+	ManifestArtifactTypeNydus = "application/vnd.nydus.image.manifest.v1+json"
 
 	ManifestNydusCache = "containerd.io/snapshot/nydus-cache"
 
@@ -117,7 +117,8 @@ type MergeOption struct {
 	// an OCI image. For example, in Harbor we can cascade to show nydus
 	// images linked to an OCI image, deleting the OCI image can also delete
 	// the corresponding nydus images. At runtime, nydus snapshotter can also
-	// automatically upgrade an OCI image run to nydus image.
+	// automatically upgrade an OCI image run to nydus image, which is found
+	// among the image manifests referring to the OCI manifest.
 	WithReferrer bool
 	// Backend uploads blobs generated by nydus-image builder to a backend storage.
 	Backend Backend
@@ -13,19 +13,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/fs"
 	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"time"
 
 	"github.com/pkg/errors"
 
-	"github.com/containerd/log"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
-	"github.com/containerd/nydus-snapshotter/pkg/metrics/tool"
-	"github.com/containerd/nydus-snapshotter/pkg/utils/retry"
 )
 
 const (
@@ -168,37 +163,6 @@ func buildTransport(sock string) http.RoundTripper {
 	}
 }
 
-func WaitUntilSocketExisted(sock string, pid int) error {
-	return retry.Do(func() (err error) {
-		var st fs.FileInfo
-		if st, err = os.Stat(sock); err != nil {
-			return
-		}
-
-		if st.Mode()&os.ModeSocket == 0 {
-			return errors.Errorf("file %s is not socket file", sock)
-		}
-
-		return nil
-	},
-		retry.Attempts(100), // totally wait for 10 seconds, should be enough
-		retry.LastErrorOnly(true),
-		retry.Delay(100*time.Millisecond),
-		retry.OnlyRetryIf(func(error) bool {
-			zombie, err := tool.IsZombieProcess(pid)
-			if err != nil {
-				return false
-			}
-			// Stop retry if nydus daemon process is already in Zombie state.
-			if zombie {
-				log.L.Errorf("Process %d has been a zombie", pid)
-				return true
-			}
-			return false
-		}),
-	)
-}
-
 func NewNydusClient(sock string) (NydusdClient, error) {
 	transport := buildTransport(sock)
 	return &nydusdClient{
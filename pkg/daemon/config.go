@@ -99,6 +99,13 @@ func WithNydusdThreadNum(nydusdThreadNum int) NewDaemonOpt {
 	}
 }
 
+func WithIOEngine(ioEngine string) NewDaemonOpt {
+	return func(d *Daemon) error {
+		d.States.IOEngine = ioEngine
+		return nil
+	}
+}
+
 func WithFsDriver(fsDriver string) NewDaemonOpt {
 	return func(d *Daemon) error {
 		d.States.FsDriver = fsDriver
@@ -106,6 +113,13 @@ func WithFsDriver(fsDriver string) NewDaemonOpt {
 	}
 }
 
+func WithSandboxID(sandboxID string) NewDaemonOpt {
+	return func(d *Daemon) error {
+		d.States.SandboxID = sandboxID
+		return nil
+	}
+}
+
 func WithDaemonMode(daemonMode config.DaemonMode) NewDaemonOpt {
 	return func(d *Daemon) error {
 		d.States.DaemonMode = daemonMode
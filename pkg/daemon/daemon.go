@@ -24,9 +24,10 @@ import (
 	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+	"github.com/containerd/nydus-snapshotter/pkg/mountns"
 	"github.com/containerd/nydus-snapshotter/pkg/rafs"
 	"github.com/containerd/nydus-snapshotter/pkg/supervisor"
-	"github.com/containerd/nydus-snapshotter/pkg/utils/erofs"
 	"github.com/containerd/nydus-snapshotter/pkg/utils/mount"
 	"github.com/containerd/nydus-snapshotter/pkg/utils/retry"
 )
@@ -55,6 +56,10 @@ type ConfigState struct {
 	ThreadNum       int
 	// Where the configuration file resides, all rafs instances share the same configuration template
 	ConfigDir string
+	// The pod sandbox served by a pod daemon
+	SandboxID string
+	// How nydusd performs backend and cache IO, empty for sync IO
+	IOEngine string
 }
 
 // TODO: Record queried nydusd state
@@ -85,6 +90,14 @@ type Daemon struct {
 	ref int32
 	// Cache the nydusd daemon state to avoid frequently querying nydusd by API.
 	state types.DaemonState
+	// A daemon reconnected on recovery is not queried by API until its first
+	// operation, so recovery doesn't dial hundreds of daemons one by one.
+	unverified bool
+	// The disk is full, nydusd may fail to cache data
+	degraded bool
+	// Mount namespace nydusd lives in and the mounts are performed in, nil if
+	// it's the snapshotter's.
+	mountNS *mountns.Namespace
 }
 
 func (d *Daemon) Lock() {
@@ -115,6 +128,14 @@ func (d *Daemon) GetRef() int32 {
 	return atomic.LoadInt32(&d.ref)
 }
 
+// IOEngine tells how nydusd performs backend and cache IO.
+func (d *Daemon) IOEngine() string {
+	if d.States.IOEngine == "" {
+		return config.IOEngineSync
+	}
+	return d.States.IOEngine
+}
+
 func (d *Daemon) HostMountpoint() (mnt string) {
 	mnt = d.States.Mountpoint
 	return
@@ -183,6 +204,53 @@ func (d *Daemon) State() types.DaemonState {
 	return d.state
 }
 
+// MarkUnverified defers querying the daemon until the first operation on it.
+func (d *Daemon) MarkUnverified() {
+	d.Lock()
+	defer d.Unlock()
+	d.unverified = true
+	d.state = types.DaemonStateUnknown
+}
+
+// Unverified tells whether the daemon has been reconnected but not queried yet,
+// its cached state is unknown then.
+func (d *Daemon) Unverified() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.unverified
+}
+
+// Query the state of an unverified daemon through the newly built client.
+func (d *Daemon) verify(c NydusdClient) error {
+	info, err := c.GetDaemonInfo()
+	if err != nil {
+		return errors.Wrapf(err, "verify daemon %s", d.ID())
+	}
+
+	d.Lock()
+	d.state = info.DaemonState()
+	d.Version = info.DaemonVersion()
+	d.unverified = false
+	collector.NewDaemonInfoCollector(&d.Version, d.IOEngine(), 1).Collect()
+	d.Unlock()
+
+	log.L.Infof("Verified daemon %s, state %s", d.ID(), d.State())
+
+	return nil
+}
+
+func (d *Daemon) SetDegraded(degraded bool) {
+	d.Lock()
+	defer d.Unlock()
+	d.degraded = degraded
+}
+
+func (d *Daemon) Degraded() bool {
+	d.Lock()
+	defer d.Unlock()
+	return d.degraded
+}
+
 // Reset the cached nydusd working status
 func (d *Daemon) ResetState() {
 	d.Lock()
@@ -215,155 +283,49 @@ func (d *Daemon) WaitUntilState(expected types.DaemonState) error {
 	)
 }
 
+// A shared daemon serves multiple RAFS instances mounted through its API, which
+// includes the daemons serving pod sandboxes.
 func (d *Daemon) IsSharedDaemon() bool {
 	if d.States.DaemonMode != "" {
-		return d.States.DaemonMode == config.DaemonModeShared
+		return d.States.DaemonMode == config.DaemonModeShared || d.States.DaemonMode == config.DaemonModePod
 	}
 
 	return d.HostMountpoint() == config.GetRootMountpoint()
 }
 
-func (d *Daemon) SharedMount(rafs *rafs.Rafs) error {
-	defer d.SendStates()
-
-	switch d.States.FsDriver {
-	case config.FsDriverFscache:
-		if err := d.sharedErofsMount(rafs); err != nil {
-			return errors.Wrapf(err, "mount erofs")
-		}
-		return nil
-	case config.FsDriverFusedev:
-		return d.sharedFusedevMount(rafs)
-	default:
-		return errors.Errorf("unsupported fs driver %s", d.States.FsDriver)
-	}
+func (d *Daemon) IsPodDaemon() bool {
+	return d.States.DaemonMode == config.DaemonModePod
 }
 
-func (d *Daemon) sharedFusedevMount(rafs *rafs.Rafs) error {
-	client, err := d.GetClient()
-	if err != nil {
-		return errors.Wrapf(err, "mount instance %s", rafs.SnapshotID)
-	}
+func (d *Daemon) SharedMount(rafs *rafs.Rafs) error {
+	defer d.SendStates()
 
-	bootstrap, err := rafs.BootstrapFile()
+	driver, err := GetFsDriver(d.States.FsDriver)
 	if err != nil {
 		return err
 	}
 
-	c, err := daemonconfig.NewDaemonConfig(d.States.FsDriver, d.ConfigFile(rafs.SnapshotID))
-	if err != nil {
-		return errors.Wrapf(err, "Failed to reload instance configuration %s",
-			d.ConfigFile(rafs.SnapshotID))
-	}
-
-	cfg, err := c.DumpString()
-	if err != nil {
-		return errors.Wrap(err, "dump instance configuration")
-	}
-
-	err = client.Mount(rafs.RelaMountpoint(), bootstrap, cfg)
-	if err != nil {
-		return errors.Wrapf(err, "mount rafs instance")
-	}
-
-	return nil
+	return driver.SharedMount(d, rafs)
 }
 
-func (d *Daemon) sharedErofsMount(ra *rafs.Rafs) error {
-	client, err := d.GetClient()
-	if err != nil {
-		return errors.Wrapf(err, "bind blob %s", d.ID())
-	}
-
-	// TODO: Why fs cache needing this work dir?
-	if err := os.MkdirAll(ra.FscacheWorkDir(), 0755); err != nil {
-		return errors.Wrapf(err, "failed to create fscache work dir %s", ra.FscacheWorkDir())
-	}
-
-	c, err := daemonconfig.NewDaemonConfig(d.States.FsDriver, d.ConfigFile(ra.SnapshotID))
-	if err != nil {
-		log.L.Errorf("Failed to reload daemon configuration %s, %s", d.ConfigFile(ra.SnapshotID), err)
-		return err
-	}
+func (d *Daemon) SharedUmount(rafs *rafs.Rafs) error {
+	defer d.SendStates()
 
-	cfgStr, err := c.DumpString()
+	driver, err := GetFsDriver(d.States.FsDriver)
 	if err != nil {
 		return err
 	}
 
-	if err := client.BindBlob(cfgStr); err != nil {
-		return errors.Wrapf(err, "request to bind fscache blob")
-	}
-
-	mountPoint := ra.GetMountpoint()
-	if err := os.MkdirAll(mountPoint, 0755); err != nil {
-		return errors.Wrapf(err, "create mountpoint %s", mountPoint)
-	}
-
-	fscacheID := erofs.FscacheID(ra.SnapshotID)
-
-	cfg := c.(*daemonconfig.FscacheDaemonConfig)
-	ra.AddAnnotation(rafs.AnnoFsCacheDomainID, cfg.DomainID)
-	ra.AddAnnotation(rafs.AnnoFsCacheID, fscacheID)
-
-	if err := erofs.Mount(cfg.DomainID, fscacheID, mountPoint); err != nil {
-		if !errdefs.IsErofsMounted(err) {
-			return errors.Wrapf(err, "mount erofs to %s", mountPoint)
-		}
-		// When snapshotter exits (either normally or abnormally), it will not have a
-		// chance to umount erofs mountpoint, so if snapshotter resumes running and mount
-		// again (by a new request to create container), it will need to ignore the mount
-		// error `device or resource busy`.
-		log.L.Warnf("erofs mountpoint %s has been mounted", mountPoint)
-	}
-
-	return nil
+	return driver.SharedUmount(d, rafs)
 }
 
-func (d *Daemon) SharedUmount(rafs *rafs.Rafs) error {
-	defer d.SendStates()
-
-	switch d.States.FsDriver {
-	case config.FsDriverFscache:
-		if err := d.sharedErofsUmount(rafs); err != nil {
-			return errors.Wrapf(err, "failed to erofs mount")
-		}
-		return nil
-	case config.FsDriverFusedev:
-		c, err := d.GetClient()
-		if err != nil {
-			return errors.Wrapf(err, "umount instance %s", rafs.SnapshotID)
-		}
-		return c.Umount(rafs.RelaMountpoint())
-	default:
-		return errors.Errorf("unsupported fs driver %s", d.States.FsDriver)
-	}
-}
-
-func (d *Daemon) sharedErofsUmount(ra *rafs.Rafs) error {
-	c, err := d.GetClient()
+func (d *Daemon) Remount(rafs *rafs.Rafs) error {
+	driver, err := GetFsDriver(d.States.FsDriver)
 	if err != nil {
-		return errors.Wrapf(err, "unbind blob %s", d.ID())
-	}
-	domainID := ra.Annotations[rafs.AnnoFsCacheDomainID]
-	fscacheID := ra.Annotations[rafs.AnnoFsCacheID]
-
-	if err := c.UnbindBlob(domainID, fscacheID); err != nil {
-		return errors.Wrapf(err, "request to unbind fscache blob, domain %s, fscache %s", domainID, fscacheID)
-	}
-
-	mountpoint := ra.GetMountpoint()
-	if err := erofs.Umount(mountpoint); err != nil {
-		return errors.Wrapf(err, "umount erofs %s mountpoint, %s", err, mountpoint)
-	}
-
-	// delete fscache bootstrap cache file
-	// erofs generate fscache cache file for bootstrap with fscacheID
-	if err := c.UnbindBlob("", fscacheID); err != nil {
-		log.L.Warnf("delete bootstrap %s err %s", fscacheID, err)
+		return err
 	}
 
-	return nil
+	return driver.Remount(d, rafs)
 }
 
 func (d *Daemon) UmountRafsInstance(r *rafs.Rafs) error {
@@ -516,6 +478,14 @@ func (d *Daemon) GetClient() (NydusdClient, error) {
 		d.client = client
 	}
 
+	if d.Unverified() {
+		if err := d.verify(d.client); err != nil {
+			// Wait for the socket again next time in case nydusd is being restarted.
+			d.client = nil
+			return nil, err
+		}
+	}
+
 	return d.client, nil
 }
 
@@ -560,9 +530,10 @@ func (d *Daemon) Wait() error {
 		// nydus-snapshotter, p.Wait() will return err, so here should exclude this case
 		if _, err = p.Wait(); err != nil && !errors.Is(err, syscall.ECHILD) {
 			log.L.Errorf("failed to process wait, %v", err)
-		} else if d.HostMountpoint() != "" && config.GetFsDriver() == config.FsDriverFusedev {
+		} else if d.HostMountpoint() != "" && config.GetFsDriver() == config.FsDriverFusedev && d.mountNS == nil {
 			// No need to umount if the nydusd never performs mount. In other word, it does not
-			// associate with a host mountpoint.
+			// associate with a host mountpoint. The clone exposed from the mount namespace
+			// is left for failover and detached on destroying the daemon.
 			if err := mount.WaitUntilUnmounted(d.HostMountpoint()); err != nil {
 				log.L.WithError(err).Errorf("umount %s", d.HostMountpoint())
 			}
@@ -574,19 +545,10 @@ func (d *Daemon) Wait() error {
 
 // When daemon dies, clean up its vestige before start a new one.
 func (d *Daemon) ClearVestige() {
-	mounter := mount.Mounter{}
-	if d.States.FsDriver == config.FsDriverFscache {
-		instances := d.RafsCache.List()
-		for _, i := range instances {
-			if err := mounter.Umount(i.GetMountpoint()); err != nil {
-				log.L.Warnf("Can't umount %s, %v", d.States.Mountpoint, err)
-			}
-		}
+	if driver, err := GetFsDriver(d.States.FsDriver); err != nil {
+		log.L.WithError(err).Warnf("Can't clear vestige mounts of daemon %s", d.ID())
 	} else {
-		log.L.Infof("Unmounting %s when clear vestige", d.HostMountpoint())
-		if err := mounter.Umount(d.HostMountpoint()); err != nil {
-			log.L.Warnf("Can't umount %s, %v", d.States.Mountpoint, err)
-		}
+		driver.ClearVestige(d)
 	}
 
 	// Nydusd judges if it should enter failover phrase by checking
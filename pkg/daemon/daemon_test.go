@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+)
+
+func TestPodDaemon(t *testing.T) {
+	d, err := NewDaemon(WithDaemonMode(config.DaemonModePod), WithSandboxID("sandbox"))
+	require.NoError(t, err)
+	require.True(t, d.IsPodDaemon())
+	// Instances are mounted through the API like the shared daemon.
+	require.True(t, d.IsSharedDaemon())
+	require.Equal(t, "sandbox", d.States.SandboxID)
+
+	d, err = NewDaemon(WithDaemonMode(config.DaemonModeShared))
+	require.NoError(t, err)
+	require.False(t, d.IsPodDaemon())
+	require.True(t, d.IsSharedDaemon())
+
+	d, err = NewDaemon()
+	require.NoError(t, err)
+	require.False(t, d.IsPodDaemon())
+	require.False(t, d.IsSharedDaemon())
+}
+
+func TestUnverifiedDaemon(t *testing.T) {
+	sock, clean := prepareNydusServer(t)
+	defer clean()
+
+	d, err := NewDaemon()
+	require.NoError(t, err)
+	d.States.APISocket = sock
+	d.MarkUnverified()
+	require.True(t, d.Unverified())
+	require.Equal(t, types.DaemonStateUnknown, d.State())
+
+	// The first operation verifies the daemon.
+	_, err = d.GetClient()
+	require.NoError(t, err)
+	require.False(t, d.Unverified())
+	require.Equal(t, types.DaemonStateRunning, d.State())
+	require.Equal(t, BTI.PackageVer, d.Version.PackageVer)
+}
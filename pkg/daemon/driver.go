@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemon
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+// FsDriver does the filesystem driver specific work of a nydusd daemon. Drivers
+// register themselves by name, so a new driver can be compiled in without touching
+// the daemon core.
+type FsDriver interface {
+	// Mount a RAFS instance through the shared daemon.
+	SharedMount(d *Daemon, r *rafs.Rafs) error
+	// Umount a RAFS instance mounted through the shared daemon.
+	SharedUmount(d *Daemon, r *rafs.Rafs) error
+	// Mount again a RAFS instance whose mount is gone while the daemon is still
+	// serving it, e.g. after an accidental manual umount.
+	Remount(d *Daemon, r *rafs.Rafs) error
+	// Clean up mounts left by a dead daemon before starting a new one.
+	ClearVestige(d *Daemon)
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]FsDriver)
+)
+
+// RegisterFsDriver makes a filesystem driver available by the name. It is supposed
+// to be called in `init()` and panics if the name is registered twice.
+func RegisterFsDriver(name string, driver FsDriver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if driver == nil {
+		panic("register nil filesystem driver " + name)
+	}
+	if _, ok := drivers[name]; ok {
+		panic("register filesystem driver twice " + name)
+	}
+
+	drivers[name] = driver
+}
+
+func GetFsDriver(name string) (FsDriver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	driver, ok := drivers[name]
+	if !ok {
+		return nil, errors.Wrapf(errdefs.ErrNotImplemented, "unsupported fs driver %s", name)
+	}
+
+	return driver, nil
+}
+
+// FsDrivers returns names of the registered filesystem drivers.
+func FsDrivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemon
+
+import (
+	"os"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/erofs"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/mount"
+)
+
+func init() {
+	RegisterFsDriver(config.FsDriverFscache, &fscacheDriver{})
+}
+
+// The shared nydusd binds blobs to fscache and each RAFS instance is an EROFS
+// mount in kernel.
+type fscacheDriver struct{}
+
+func (fscacheDriver) SharedMount(d *Daemon, ra *rafs.Rafs) error {
+	client, err := d.GetClient()
+	if err != nil {
+		return errors.Wrapf(err, "bind blob %s", d.ID())
+	}
+
+	// TODO: Why fs cache needing this work dir?
+	if err := os.MkdirAll(ra.FscacheWorkDir(), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create fscache work dir %s", ra.FscacheWorkDir())
+	}
+
+	c, err := daemonconfig.NewDaemonConfig(d.States.FsDriver, d.ConfigFile(ra.SnapshotID))
+	if err != nil {
+		log.L.Errorf("Failed to reload daemon configuration %s, %s", d.ConfigFile(ra.SnapshotID), err)
+		return err
+	}
+
+	cfgStr, err := c.DumpString()
+	if err != nil {
+		return err
+	}
+
+	if err := client.BindBlob(cfgStr); err != nil {
+		return errors.Wrapf(err, "request to bind fscache blob")
+	}
+
+	mountPoint := ra.GetMountpoint()
+	if err := os.MkdirAll(mountPoint, 0755); err != nil {
+		return errors.Wrapf(err, "create mountpoint %s", mountPoint)
+	}
+
+	fscacheID := erofs.FscacheID(ra.SnapshotID)
+
+	cfg := c.(*daemonconfig.FscacheDaemonConfig)
+	ra.AddAnnotation(rafs.AnnoFsCacheDomainID, cfg.DomainID)
+	ra.AddAnnotation(rafs.AnnoFsCacheID, fscacheID)
+
+	if err := d.namespacedMount(mountPoint, func() error {
+		return erofs.Mount(cfg.DomainID, fscacheID, mountPoint)
+	}); err != nil {
+		if !errdefs.IsErofsMounted(err) {
+			return errors.Wrapf(err, "mount erofs to %s", mountPoint)
+		}
+		// When snapshotter exits (either normally or abnormally), it will not have a
+		// chance to umount erofs mountpoint, so if snapshotter resumes running and mount
+		// again (by a new request to create container), it will need to ignore the mount
+		// error `device or resource busy`.
+		log.L.Warnf("erofs mountpoint %s has been mounted", mountPoint)
+	}
+
+	return nil
+}
+
+func (fscacheDriver) SharedUmount(d *Daemon, ra *rafs.Rafs) error {
+	c, err := d.GetClient()
+	if err != nil {
+		return errors.Wrapf(err, "unbind blob %s", d.ID())
+	}
+	domainID := ra.Annotations[rafs.AnnoFsCacheDomainID]
+	fscacheID := ra.Annotations[rafs.AnnoFsCacheID]
+
+	if err := c.UnbindBlob(domainID, fscacheID); err != nil {
+		return errors.Wrapf(err, "request to unbind fscache blob, domain %s, fscache %s", domainID, fscacheID)
+	}
+
+	mountpoint := ra.GetMountpoint()
+	if err := d.namespacedUmount(mountpoint, func() error {
+		return erofs.Umount(mountpoint)
+	}); err != nil {
+		return errors.Wrapf(err, "umount erofs %s mountpoint, %s", err, mountpoint)
+	}
+
+	// delete fscache bootstrap cache file
+	// erofs generate fscache cache file for bootstrap with fscacheID
+	if err := c.UnbindBlob("", fscacheID); err != nil {
+		log.L.Warnf("delete bootstrap %s err %s", fscacheID, err)
+	}
+
+	return nil
+}
+
+// Blobs are still bound to fscache, mounting EROFS again is enough.
+func (fscacheDriver) Remount(d *Daemon, ra *rafs.Rafs) error {
+	domainID := ra.Annotations[rafs.AnnoFsCacheDomainID]
+	fscacheID := ra.Annotations[rafs.AnnoFsCacheID]
+	if fscacheID == "" {
+		return errors.Errorf("instance %s is not bound to fscache", ra.SnapshotID)
+	}
+
+	if err := d.namespacedMount(ra.GetMountpoint(), func() error {
+		return erofs.Mount(domainID, fscacheID, ra.GetMountpoint())
+	}); err != nil && !errdefs.IsErofsMounted(err) {
+		return errors.Wrapf(err, "mount erofs to %s", ra.GetMountpoint())
+	}
+
+	return nil
+}
+
+func (fscacheDriver) ClearVestige(d *Daemon) {
+	mounter := mount.Mounter{}
+	instances := d.RafsCache.List()
+	for _, i := range instances {
+		mnt := i.GetMountpoint()
+		if err := d.namespacedUmount(mnt, func() error { return mounter.Umount(mnt) }); err != nil {
+			log.L.Warnf("Can't umount %s, %v", d.States.Mountpoint, err)
+		}
+	}
+}
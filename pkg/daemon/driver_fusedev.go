@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemon
+
+import (
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/mount"
+)
+
+func init() {
+	RegisterFsDriver(config.FsDriverFusedev, &fusedevDriver{})
+}
+
+// The shared nydusd serves all RAFS instances as sub-directories of its FUSE mountpoint.
+type fusedevDriver struct{}
+
+func (fusedevDriver) SharedMount(d *Daemon, r *rafs.Rafs) error {
+	client, err := d.GetClient()
+	if err != nil {
+		return errors.Wrapf(err, "mount instance %s", r.SnapshotID)
+	}
+
+	bootstrap, err := r.BootstrapFile()
+	if err != nil {
+		return err
+	}
+
+	c, err := daemonconfig.NewDaemonConfig(d.States.FsDriver, d.ConfigFile(r.SnapshotID))
+	if err != nil {
+		return errors.Wrapf(err, "Failed to reload instance configuration %s",
+			d.ConfigFile(r.SnapshotID))
+	}
+
+	cfg, err := c.DumpString()
+	if err != nil {
+		return errors.Wrap(err, "dump instance configuration")
+	}
+
+	err = client.Mount(r.RelaMountpoint(), bootstrap, cfg)
+	if err != nil {
+		return errors.Wrapf(err, "mount rafs instance")
+	}
+
+	return nil
+}
+
+func (fusedevDriver) SharedUmount(d *Daemon, r *rafs.Rafs) error {
+	c, err := d.GetClient()
+	if err != nil {
+		return errors.Wrapf(err, "umount instance %s", r.SnapshotID)
+	}
+
+	return c.Umount(r.RelaMountpoint())
+}
+
+// The FUSE session is gone along with the mount, nydusd has to be restarted.
+func (fusedevDriver) Remount(_ *Daemon, r *rafs.Rafs) error {
+	return errors.Wrapf(errdefs.ErrNotImplemented, "remount FUSE instance %s", r.SnapshotID)
+}
+
+func (fusedevDriver) ClearVestige(d *Daemon) {
+	mounter := mount.Mounter{}
+	log.L.Infof("Unmounting %s when clear vestige", d.HostMountpoint())
+	mnt := d.HostMountpoint()
+	if err := d.namespacedUmount(mnt, func() error { return mounter.Umount(mnt) }); err != nil {
+		log.L.Warnf("Can't umount %s, %v", d.States.Mountpoint, err)
+	}
+}
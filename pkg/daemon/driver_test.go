@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+type fakeFsDriver struct {
+	mounted []string
+}
+
+func (f *fakeFsDriver) SharedMount(_ *Daemon, r *rafs.Rafs) error {
+	f.mounted = append(f.mounted, r.SnapshotID)
+	return nil
+}
+
+func (f *fakeFsDriver) SharedUmount(_ *Daemon, _ *rafs.Rafs) error {
+	return nil
+}
+
+func (f *fakeFsDriver) Remount(_ *Daemon, _ *rafs.Rafs) error {
+	return nil
+}
+
+func (f *fakeFsDriver) ClearVestige(_ *Daemon) {}
+
+func TestFsDriverRegistry(t *testing.T) {
+	require.Subset(t, FsDrivers(), []string{config.FsDriverFscache, config.FsDriverFusedev})
+
+	_, err := GetFsDriver("experimental")
+	require.ErrorIs(t, err, errdefs.ErrNotImplemented)
+
+	driver := &fakeFsDriver{}
+	RegisterFsDriver("experimental", driver)
+	defer func() {
+		driversMu.Lock()
+		delete(drivers, "experimental")
+		driversMu.Unlock()
+	}()
+
+	require.Panics(t, func() { RegisterFsDriver("experimental", driver) })
+
+	d, err := NewDaemon(WithFsDriver("experimental"))
+	require.NoError(t, err)
+	require.NoError(t, d.SharedMount(&rafs.Rafs{SnapshotID: "1"}))
+	require.Equal(t, []string{"1"}, driver.mounted)
+}
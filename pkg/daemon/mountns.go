@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemon
+
+import (
+	"github.com/containerd/log"
+	"github.com/moby/sys/mountinfo"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/mountns"
+)
+
+func (d *Daemon) SetMountNamespace(ns *mountns.Namespace) {
+	d.Lock()
+	defer d.Unlock()
+	d.mountNS = ns
+}
+
+func (d *Daemon) MountNamespace() *mountns.Namespace {
+	d.Lock()
+	defer d.Unlock()
+	return d.mountNS
+}
+
+// ReleaseMountNamespace detaches the FUSE mount exposed to the host and returns
+// the mount namespace of a destroyed daemon for reuse.
+func (d *Daemon) ReleaseMountNamespace() *mountns.Namespace {
+	d.Lock()
+	ns := d.mountNS
+	d.mountNS = nil
+	d.Unlock()
+
+	if ns != nil && d.States.FsDriver == config.FsDriverFusedev && d.HostMountpoint() != "" {
+		if err := mountns.Detach(d.HostMountpoint()); err != nil {
+			log.L.WithError(err).Warnf("Failed to detach mount of daemon %s", d.ID())
+		}
+	}
+
+	return ns
+}
+
+// ExposeMount attaches the FUSE mount performed by nydusd in its mount namespace
+// to the host mountpoint, unless it is already attached.
+func (d *Daemon) ExposeMount() error {
+	ns := d.MountNamespace()
+	mnt := d.HostMountpoint()
+	if ns == nil || d.States.FsDriver != config.FsDriverFusedev || mnt == "" {
+		return nil
+	}
+
+	mounted, err := mountinfo.Mounted(mnt)
+	if err != nil {
+		return errors.Wrapf(err, "check mountpoint %s", mnt)
+	}
+	if mounted {
+		return nil
+	}
+
+	if err := ns.Expose(mnt, mnt); err != nil {
+		return errors.Wrapf(err, "expose mount of daemon %s", d.ID())
+	}
+
+	return nil
+}
+
+// Mount in the mount namespace of the daemon and expose the mount to the host.
+func (d *Daemon) namespacedMount(mountpoint string, mount func() error) error {
+	ns := d.MountNamespace()
+	if ns == nil {
+		return mount()
+	}
+
+	if err := ns.Do(mount); err != nil {
+		return err
+	}
+
+	return ns.Expose(mountpoint, mountpoint)
+}
+
+// Detach the exposed mount from the host before umounting it in the mount
+// namespace of the daemon, so host processes can't keep the mount busy.
+func (d *Daemon) namespacedUmount(mountpoint string, umount func() error) error {
+	ns := d.MountNamespace()
+	if ns == nil {
+		return umount()
+	}
+
+	if err := mountns.Detach(mountpoint); err != nil {
+		return err
+	}
+
+	return ns.Do(umount)
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/tool"
+)
+
+const (
+	// Nydusd should be listening on its API socket in this time after started.
+	socketWaitTimeout = 10 * time.Second
+	// Polling with backoff covers file events missed, e.g. when the socket
+	// directory does not exist yet to be watched.
+	minSocketPollInterval = 10 * time.Millisecond
+	maxSocketPollInterval = 500 * time.Millisecond
+	socketDialTimeout     = time.Second
+)
+
+// Pid of the process listening on the connected unix socket.
+func socketPeerPid(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, credErr
+	}
+
+	return int(cred.Pid), nil
+}
+
+// Check the socket accepts connections and is listened on by process `pid`,
+// rather than being residual from a dead nydusd. The owner is not checked if
+// pid is not positive.
+func checkSocket(sock string, pid int) error {
+	st, err := os.Stat(sock)
+	if err != nil {
+		return err
+	}
+	if st.Mode()&os.ModeSocket == 0 {
+		return errors.Errorf("file %s is not socket file", sock)
+	}
+
+	conn, err := net.DialTimeout("unix", sock, socketDialTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "connect socket %s", sock)
+	}
+	defer conn.Close()
+
+	if pid <= 0 {
+		return nil
+	}
+	peer, err := socketPeerPid(conn.(*net.UnixConn))
+	if err != nil {
+		return errors.Wrapf(err, "get owner of socket %s", sock)
+	}
+	if peer != pid {
+		return errors.Errorf("socket %s is listened on by process %d rather than %d", sock, peer, pid)
+	}
+
+	return nil
+}
+
+func processExited(pid int) bool {
+	zombie, err := tool.IsZombieProcess(pid)
+	// The process is gone if its state can't be read.
+	return err != nil || zombie
+}
+
+// WaitUntilSocketExisted waits until nydusd process `pid` listens on the API
+// socket, or the process exits.
+func WaitUntilSocketExisted(sock string, pid int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), socketWaitTimeout)
+	defer cancel()
+
+	return WaitUntilSocketReady(ctx, sock, pid)
+}
+
+// WaitUntilSocketReady waits until nydusd process `pid` listens on the API
+// socket, the process exits or the context is done. The socket directory is
+// watched to find the socket once it's created, with polling as a fallback.
+func WaitUntilSocketReady(ctx context.Context, sock string, pid int) error {
+	sock = filepath.Clean(sock)
+
+	var events <-chan fsnotify.Event
+	var watchErrors <-chan error
+	if watcher, err := fsnotify.NewWatcher(); err == nil {
+		defer watcher.Close()
+		if err := watcher.Add(filepath.Dir(sock)); err == nil {
+			events, watchErrors = watcher.Events, watcher.Errors
+		} else {
+			log.L.WithError(err).Debugf("Failed to watch directory of socket %s", sock)
+		}
+	}
+
+	delay := minSocketPollInterval
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case <-ctx.Done():
+			if lastErr == nil {
+				lastErr = ctx.Err()
+			}
+			return errors.Wrapf(lastErr, "wait for socket %s of process %d", sock, pid)
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if filepath.Clean(ev.Name) != sock || !ev.Has(fsnotify.Create) {
+				continue
+			}
+		case err, ok := <-watchErrors:
+			if !ok {
+				watchErrors = nil
+			} else {
+				log.L.WithError(err).Debugf("Failed to watch socket %s", sock)
+			}
+			continue
+		case <-timer.C:
+			delay *= 2
+			if delay > maxSocketPollInterval {
+				delay = maxSocketPollInterval
+			}
+			timer.Reset(delay)
+		}
+
+		if lastErr = checkSocket(sock, pid); lastErr == nil {
+			return nil
+		}
+		if pid > 0 && processExited(pid) {
+			return errors.Wrapf(lastErr, "process %d exited", pid)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package daemon
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitUntilSocketReady(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "api.sock")
+
+	// The socket is created after waiting.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		l, err := net.Listen("unix", sock)
+		if err == nil {
+			t.Cleanup(func() { l.Close() })
+		}
+	}()
+	start := time.Now()
+	require.NoError(t, WaitUntilSocketExisted(sock, os.Getpid()))
+	require.Less(t, time.Since(start), 2*time.Second)
+
+	// A residual socket nobody listens on is never ready.
+	stale := filepath.Join(dir, "stale.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: stale, Net: "unix"})
+	require.NoError(t, err)
+	l.SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	err = WaitUntilSocketReady(ctx, stale, 0)
+	require.ErrorContains(t, err, "connect socket")
+
+	// The socket is listened on by another process.
+	require.Error(t, checkSocket(sock, os.Getppid()))
+}
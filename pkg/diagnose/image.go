@@ -0,0 +1,432 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package diagnose checks end to end whether an image can be lazily loaded on
+// this host, without involving containerd or the running snapshotter.
+package diagnose
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/containerd/log"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon/command"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	"github.com/containerd/nydus-snapshotter/pkg/layout"
+	"github.com/containerd/nydus-snapshotter/pkg/remote"
+	"github.com/containerd/nydus-snapshotter/pkg/remote/remotes"
+)
+
+const (
+	StepResolve  = "resolve"
+	StepMetadata = "metadata"
+	StepBackend  = "backend"
+	StepDaemon   = "daemon"
+	StepRead     = "read"
+	StepTeardown = "teardown"
+
+	bootstrapNameInLayer = "image/image.boot"
+	// Read at most this many bytes from each sampled file.
+	maxReadSize = 1 << 20
+
+	daemonReadyTimeout = 10 * time.Second
+	terminateTimeout   = 3 * time.Second
+)
+
+type Opt struct {
+	Ref              string
+	NydusdPath       string
+	NydusdConfigPath string
+	// How many regular files to read from the mounted image.
+	Files         int
+	SkipSSLVerify bool
+	// Parent of the throwaway working directory.
+	TempDir string
+}
+
+type Step struct {
+	Name     string `json:"name"`
+	Duration string `json:"duration"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Image string `json:"image"`
+	Steps []Step `json:"steps"`
+}
+
+func (r *Report) OK() bool {
+	for _, s := range r.Steps {
+		if s.Error != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) run(name string, fn func() (string, error)) bool {
+	start := time.Now()
+	detail, err := fn()
+	step := Step{Name: name, Duration: time.Since(start).String(), Detail: detail}
+	if err != nil {
+		step.Error = err.Error()
+	}
+	r.Steps = append(r.Steps, step)
+	return err == nil
+}
+
+type checker struct {
+	opt        Opt
+	workDir    string
+	bootstrap  string
+	mountpoint string
+	apiSock    string
+	remote     *remote.Remote
+	fetcher    remotes.Fetcher
+	manifest   *ocispec.Manifest
+	cmd        *exec.Cmd
+}
+
+// CheckImage resolves the image, validates its nydus metadata, checks the blobs are
+// reachable, mounts it with a throwaway nydusd and reads a few files from it. All the
+// resources are torn down before returning. Failures of the checking steps are
+// recorded in the report rather than returned. All the checking steps are bounded
+// by the deadline of `ctx`, nydusd is killed once it passes.
+func CheckImage(ctx context.Context, opt Opt) (*Report, error) {
+	workDir, err := os.MkdirTemp(opt.TempDir, "nydus-check-image-")
+	if err != nil {
+		return nil, errors.Wrap(err, "create working directory")
+	}
+
+	c := &checker{
+		opt:        opt,
+		workDir:    workDir,
+		bootstrap:  filepath.Join(workDir, "image.boot"),
+		mountpoint: filepath.Join(workDir, "mnt"),
+		apiSock:    filepath.Join(workDir, "api.sock"),
+	}
+	report := &Report{Image: opt.Ref}
+
+	steps := []struct {
+		name string
+		fn   func() (string, error)
+	}{
+		{StepResolve, func() (string, error) { return c.resolve(ctx) }},
+		{StepMetadata, func() (string, error) { return c.fetchMetadata(ctx) }},
+		{StepBackend, func() (string, error) { return c.checkBackend(ctx) }},
+		{StepDaemon, func() (string, error) { return c.startDaemon(ctx) }},
+		{StepRead, func() (string, error) { return c.readFilesUntil(ctx) }},
+	}
+	// Each step relies on the previous ones.
+	for _, s := range steps {
+		if !report.run(s.name, s.fn) {
+			break
+		}
+	}
+
+	report.run(StepTeardown, c.teardown)
+
+	return report, nil
+}
+
+func (c *checker) resolve(ctx context.Context) (string, error) {
+	keyChain, err := auth.GetKeyChainByRef(c.opt.Ref, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "get key chain")
+	}
+	c.remote = remote.New(keyChain, c.opt.SkipSSLVerify)
+
+	handle := func() (string, error) {
+		resolver := c.remote.Resolve(ctx, c.opt.Ref)
+		name, desc, err := resolver.Resolve(ctx, c.opt.Ref)
+		if err != nil {
+			return "", errors.Wrapf(err, "resolve reference %s", c.opt.Ref)
+		}
+		c.fetcher, err = resolver.Fetcher(ctx, name)
+		if err != nil {
+			return "", errors.Wrap(err, "get fetcher")
+		}
+		c.manifest, err = remote.FetchManifest(ctx, c.fetcher, desc)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s resolved to %s with %d layers", name, desc.Digest, len(c.manifest.Layers)), nil
+	}
+
+	detail, err := handle()
+	if err != nil && c.remote.RetryWithPlainHTTP(c.opt.Ref, err) {
+		return handle()
+	}
+
+	return detail, err
+}
+
+func (c *checker) fetchMetadata(ctx context.Context) (string, error) {
+	var metaLayer *ocispec.Descriptor
+	for idx := len(c.manifest.Layers) - 1; idx >= 0; idx-- {
+		if label.IsNydusMetaLayer(c.manifest.Layers[idx].Annotations) {
+			metaLayer = &c.manifest.Layers[idx]
+			break
+		}
+	}
+	if metaLayer == nil {
+		return "", errors.New("no nydus metadata layer, it is not a nydus image or not for this platform")
+	}
+
+	rc, err := c.fetcher.Fetch(ctx, *metaLayer)
+	if err != nil {
+		return "", errors.Wrapf(err, "fetch metadata layer %s", metaLayer.Digest)
+	}
+	defer rc.Close()
+
+	if err := remote.Unpack(rc, bootstrapNameInLayer, c.bootstrap); err != nil {
+		return "", errors.Wrap(err, "unpack bootstrap from metadata layer")
+	}
+
+	f, err := os.Open(c.bootstrap)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	header := make([]byte, 4096)
+	n, err := io.ReadFull(f, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", errors.Wrap(err, "read bootstrap")
+	}
+	version, err := layout.DetectFsVersion(header[:n])
+	if err != nil {
+		return "", errors.Wrap(err, "detect RAFS version")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("RAFS %s bootstrap of %d bytes from layer %s", version, info.Size(), metaLayer.Digest), nil
+}
+
+// Check each nydus blob can be fetched from the registry.
+func (c *checker) checkBackend(ctx context.Context) (string, error) {
+	var blobs int
+	var slowest time.Duration
+	for _, desc := range c.manifest.Layers {
+		if !label.IsNydusDataLayer(desc.Annotations) {
+			continue
+		}
+		blobs++
+
+		start := time.Now()
+		rc, err := c.fetcher.Fetch(ctx, desc)
+		if err != nil {
+			return "", errors.Wrapf(err, "fetch blob %s", desc.Digest)
+		}
+		_, err = rc.Read(make([]byte, 1))
+		rc.Close()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", errors.Wrapf(err, "read blob %s", desc.Digest)
+		}
+		if elapsed := time.Since(start); elapsed > slowest {
+			slowest = elapsed
+		}
+	}
+
+	return fmt.Sprintf("%d blobs reachable, slowest responded in %s", blobs, slowest), nil
+}
+
+func (c *checker) startDaemon(ctx context.Context) (string, error) {
+	cfg, err := daemonconfig.NewDaemonConfig(config.FsDriverFusedev, c.opt.NydusdConfigPath)
+	if err != nil {
+		return "", errors.Wrapf(err, "load nydusd configuration %s", c.opt.NydusdConfigPath)
+	}
+	params := map[string]string{daemonconfig.CacheDir: filepath.Join(c.workDir, "cache")}
+	if err := daemonconfig.SupplementDaemonConfig(cfg, c.opt.Ref, "check-image", false, nil, params); err != nil {
+		return "", errors.Wrap(err, "supplement nydusd configuration")
+	}
+	configFile := filepath.Join(c.workDir, "nydusd.json")
+	if err := cfg.DumpFile(configFile); err != nil {
+		return "", errors.Wrap(err, "dump nydusd configuration")
+	}
+
+	if err := os.MkdirAll(c.mountpoint, 0755); err != nil {
+		return "", err
+	}
+
+	args, err := command.BuildCommand([]command.Opt{
+		command.WithMode("fuse"),
+		command.WithConfig(configFile),
+		command.WithBootstrap(c.bootstrap),
+		command.WithMountpoint(c.mountpoint),
+		command.WithAPISock(c.apiSock),
+		command.WithLogLevel("info"),
+		command.WithLogFile(filepath.Join(c.workDir, "nydusd.log")),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Nydusd is killed once the deadline passes.
+	c.cmd = exec.CommandContext(ctx, c.opt.NydusdPath, args...)
+	if err := c.cmd.Start(); err != nil {
+		return "", errors.Wrapf(err, "start %s", c.opt.NydusdPath)
+	}
+
+	readyCtx, cancel := context.WithTimeout(ctx, daemonReadyTimeout)
+	defer cancel()
+
+	if err := daemon.WaitUntilSocketReady(readyCtx, c.apiSock, c.cmd.Process.Pid); err != nil {
+		return "", errors.Wrapf(err, "wait for nydusd API socket, see %s", c.daemonLog())
+	}
+
+	client, err := daemon.NewNydusClient(c.apiSock)
+	if err != nil {
+		return "", err
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		info, err := client.GetDaemonInfo()
+		if err == nil && info.DaemonState() == types.DaemonStateRunning {
+			return fmt.Sprintf("nydusd %s (pid %d) mounted image at %s", info.Version.PackageVer, c.cmd.Process.Pid, c.mountpoint), nil
+		}
+		select {
+		case <-readyCtx.Done():
+			return "", errors.Wrapf(readyCtx.Err(), "wait for nydusd running, see %s", c.daemonLog())
+		case <-ticker.C:
+		}
+	}
+}
+
+// The log is removed along with the working directory, so dump its tail for reference.
+func (c *checker) daemonLog() string {
+	content, err := os.ReadFile(filepath.Join(c.workDir, "nydusd.log"))
+	if err != nil {
+		return "no nydusd log"
+	}
+	if len(content) > 2048 {
+		content = content[len(content)-2048:]
+	}
+	return "nydusd log:\n" + string(content)
+}
+
+// Reads from the FUSE mount can't be interrupted, e.g. when nydusd hangs on a broken
+// storage backend, so nydusd is killed once the deadline passes to abort them.
+func (c *checker) readFilesUntil(ctx context.Context) (string, error) {
+	type result struct {
+		detail string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		detail, err := c.readFiles()
+		done <- result{detail: detail, err: err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.detail, r.err
+	case <-ctx.Done():
+		log.L.Warnf("Kill nydusd %d as reading files does not finish in time", c.cmd.Process.Pid)
+		_ = c.cmd.Process.Kill()
+		<-done
+		return "", errors.Wrapf(ctx.Err(), "read files, see %s", c.daemonLog())
+	}
+}
+
+// Read a few regular files from the mounted image to make nydusd fetch data on demand.
+func (c *checker) readFiles() (string, error) {
+	var files int
+	var bytes int64
+	errStop := errors.New("enough files")
+
+	err := filepath.WalkDir(c.mountpoint, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		n, err := io.CopyN(io.Discard, f, maxReadSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return errors.Wrapf(err, "read %s", path)
+		}
+		bytes += n
+		files++
+
+		if files >= c.opt.Files {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return "", err
+	}
+
+	if files == 0 {
+		return "", errors.New("no regular file found in the image")
+	}
+
+	return fmt.Sprintf("read %d bytes from %d files", bytes, files), nil
+}
+
+func (c *checker) teardown() (string, error) {
+	var errs []error
+
+	if c.cmd != nil {
+		if err := unix.Unmount(c.mountpoint, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) {
+			errs = append(errs, errors.Wrapf(err, "umount %s", c.mountpoint))
+		}
+
+		exited := make(chan struct{})
+		go func() {
+			_ = c.cmd.Wait()
+			close(exited)
+		}()
+		_ = c.cmd.Process.Signal(syscall.SIGTERM)
+		select {
+		case <-exited:
+		case <-time.After(terminateTimeout):
+			log.L.Warnf("Kill nydusd %d which does not exit in time", c.cmd.Process.Pid)
+			_ = c.cmd.Process.Kill()
+			<-exited
+		}
+	}
+
+	if err := os.RemoveAll(c.workDir); err != nil {
+		errs = append(errs, errors.Wrapf(err, "remove %s", c.workDir))
+	}
+
+	if len(errs) > 0 {
+		return "", errs[0]
+	}
+
+	return "removed " + c.workDir, nil
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package diagnose
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckImageInvalidReference(t *testing.T) {
+	tempDir := t.TempDir()
+
+	report, err := CheckImage(context.Background(), Opt{Ref: "INVALID::REF", TempDir: tempDir, Files: 1})
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+
+	require.Len(t, report.Steps, 2)
+	assert.Equal(t, StepResolve, report.Steps[0].Name)
+	assert.NotEmpty(t, report.Steps[0].Error)
+	assert.Equal(t, StepTeardown, report.Steps[1].Name)
+	assert.Empty(t, report.Steps[1].Error)
+
+	// The working directory is cleaned up.
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestReadFiles(t *testing.T) {
+	mountpoint := t.TempDir()
+	c := &checker{opt: Opt{Files: 2}, mountpoint: mountpoint}
+
+	_, err := c.readFiles()
+	assert.Error(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(mountpoint, "etc"), 0755))
+	for _, name := range []string{"a", "etc/b", "etc/c"} {
+		require.NoError(t, os.WriteFile(filepath.Join(mountpoint, name), []byte("nydus"), 0644))
+	}
+
+	detail, err := c.readFiles()
+	require.NoError(t, err)
+	assert.Equal(t, "read 10 bytes from 2 files", detail)
+}
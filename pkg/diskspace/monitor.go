@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package diskspace detects the directories of the snapshotter running out of
+// space, so that the snapshotter can apply backpressure instead of letting nydusd
+// and mounts fail unpredictably.
+package diskspace
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+)
+
+type Opt struct {
+	// Directories to watch, e.g. the cache directory and the snapshots directory.
+	Dirs []string
+	// A directory is full when its available bytes drop below this.
+	MinFreeBytes uint64
+	Interval     time.Duration
+	// Called when the disk becomes full and when space recovers.
+	OnFull      func(ctx context.Context)
+	OnRecovered func(ctx context.Context)
+}
+
+type Monitor struct {
+	opt Opt
+
+	mu   sync.Mutex
+	full bool
+	// ENOSPC reported since the last check
+	reported bool
+}
+
+// Available bytes of the filesystem where the directory resides.
+var availableBytes = func(dir string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
+
+func NewMonitor(opt Opt) *Monitor {
+	return &Monitor{opt: opt}
+}
+
+// Full tells whether the disk is considered full.
+func (m *Monitor) Full() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.full
+}
+
+// ReportError marks the disk full if err is caused by ENOSPC, until a later check
+// finds enough space. Returns whether the error is ENOSPC.
+func (m *Monitor) ReportError(ctx context.Context, err error) bool {
+	if !errors.Is(err, syscall.ENOSPC) {
+		return false
+	}
+
+	m.mu.Lock()
+	m.reported = true
+	m.mu.Unlock()
+
+	log.G(ctx).WithError(err).Warn("No space left on device")
+	m.setFull(ctx, true)
+
+	return true
+}
+
+// Check the available space of the directories and update the disk state.
+func (m *Monitor) Check(ctx context.Context) {
+	full := false
+	for _, dir := range m.opt.Dirs {
+		avail, err := availableBytes(dir)
+		if err != nil {
+			log.G(ctx).WithError(err).Warnf("Failed to get available space of %s", dir)
+			continue
+		}
+		if avail < m.opt.MinFreeBytes {
+			log.G(ctx).Warnf("Available space %d of %s is below %d", avail, dir, m.opt.MinFreeBytes)
+			full = true
+		}
+	}
+
+	// An ENOSPC reported since the last check keeps the disk full for one more
+	// interval, since the available space may be above the threshold while not
+	// enough for the failed write.
+	m.mu.Lock()
+	reported := m.reported
+	m.reported = false
+	m.mu.Unlock()
+
+	m.setFull(ctx, full || reported)
+}
+
+func (m *Monitor) setFull(ctx context.Context, full bool) {
+	m.mu.Lock()
+	changed := m.full != full
+	m.full = full
+	m.mu.Unlock()
+
+	if !changed {
+		return
+	}
+
+	collector.NewDiskFullCollector(full).Collect()
+	if full {
+		log.G(ctx).Warn("Disk is full, refuse to prepare snapshots until space recovers")
+		if m.opt.OnFull != nil {
+			m.opt.OnFull(ctx)
+		}
+	} else {
+		log.G(ctx).Info("Disk space recovered")
+		if m.opt.OnRecovered != nil {
+			m.opt.OnRecovered(ctx)
+		}
+	}
+}
+
+func (m *Monitor) Run(ctx context.Context) {
+	m.Check(ctx)
+
+	ticker := time.NewTicker(m.opt.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check(ctx)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package diskspace
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitor(t *testing.T) {
+	avail := map[string]uint64{"/cache": 10 << 30, "/snapshots": 10 << 30}
+	availableBytes = func(dir string) (uint64, error) {
+		return avail[dir], nil
+	}
+
+	var fulls, recoveries int
+	m := NewMonitor(Opt{
+		Dirs:         []string{"/cache", "/snapshots"},
+		MinFreeBytes: 1 << 30,
+		OnFull:       func(context.Context) { fulls++ },
+		OnRecovered:  func(context.Context) { recoveries++ },
+	})
+	ctx := context.Background()
+
+	m.Check(ctx)
+	require.False(t, m.Full())
+
+	avail["/cache"] = 100 << 20
+	m.Check(ctx)
+	require.True(t, m.Full())
+	m.Check(ctx)
+	require.Equal(t, 1, fulls)
+
+	avail["/cache"] = 2 << 30
+	m.Check(ctx)
+	require.False(t, m.Full())
+	require.Equal(t, 1, recoveries)
+
+	// ENOSPC keeps the disk full until the next check.
+	require.False(t, m.ReportError(ctx, errors.New("other")))
+	require.True(t, m.ReportError(ctx, errors.Wrap(&os.PathError{Op: "mkdir", Path: "/snapshots/1", Err: syscall.ENOSPC}, "prepare")))
+	require.True(t, m.Full())
+	require.Equal(t, 2, fulls)
+	m.Check(ctx)
+	require.True(t, m.Full())
+	m.Check(ctx)
+	require.False(t, m.Full())
+	require.Equal(t, 2, recoveries)
+}
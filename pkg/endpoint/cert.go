@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package endpoint
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	certFileName = "server.crt"
+	keyFileName  = "server.key"
+
+	certValidity = 365 * 24 * time.Hour
+	// Renew the managed certificate in advance so that clients never see an expired one.
+	certRenewBefore = 7 * 24 * time.Hour
+)
+
+// managedCertificate is a self-signed certificate generated and renewed by the
+// snapshotter. It is persisted so that clients can pin it across restarts.
+type managedCertificate struct {
+	mu       sync.Mutex
+	certFile string
+	keyFile  string
+	hosts    []string
+	cert     *tls.Certificate
+}
+
+func newManagedCertificate(dir string, hosts []string) (*managedCertificate, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "create certificate directory %s", dir)
+	}
+
+	m := &managedCertificate{
+		certFile: filepath.Join(dir, certFileName),
+		keyFile:  filepath.Join(dir, keyFileName),
+		hosts:    hosts,
+	}
+
+	if _, err := m.get(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Load the persisted certificate, or generate a new one if it is missing or about to expire.
+func (m *managedCertificate) get() (*tls.Certificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cert == nil {
+		if cert, err := loadCertificate(m.certFile, m.keyFile); err == nil {
+			m.cert = cert
+		} else if !os.IsNotExist(errors.Cause(err)) {
+			log.L.WithError(err).Warnf("Regenerate invalid certificate %s", m.certFile)
+		}
+	}
+
+	if m.cert != nil && time.Now().Add(certRenewBefore).Before(m.cert.Leaf.NotAfter) {
+		return m.cert, nil
+	}
+
+	if err := generateCertificate(m.certFile, m.keyFile, m.hosts); err != nil {
+		return nil, err
+	}
+	cert, err := loadCertificate(m.certFile, m.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	log.L.Infof("Generated self-signed certificate %s valid until %s", m.certFile, cert.Leaf.NotAfter)
+	m.cert = cert
+
+	return m.cert, nil
+}
+
+func (m *managedCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.get()
+}
+
+func loadCertificate(certFile, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse certificate %s", certFile)
+		}
+		cert.Leaf = leaf
+	}
+
+	return &cert, nil
+}
+
+func generateCertificate(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return errors.Wrap(err, "generate private key")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return errors.Wrap(err, "generate serial number")
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Nydus Snapshotter"}, CommonName: "nydus-snapshotter"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(certValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return errors.Wrap(err, "create certificate")
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return errors.Wrap(err, "marshal private key")
+	}
+
+	if err := writePEM(keyFile, "EC PRIVATE KEY", keyDer, 0600); err != nil {
+		return err
+	}
+
+	return writePEM(certFile, "CERTIFICATE", der, 0644)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	content := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(tmp, content, perm); err != nil {
+		return errors.Wrapf(err, "write %s", tmp)
+	}
+
+	return errors.Wrapf(os.Rename(tmp, path), "rename %s", tmp)
+}
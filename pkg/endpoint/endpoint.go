@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package endpoint secures the HTTP endpoints exposed on TCP, like metrics and
+// system controller, with TLS and bearer token authentication.
+package endpoint
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+type Security struct {
+	tlsConfig *tls.Config
+	token     string
+}
+
+// NewSecurity loads the certificate and token to secure the endpoint listening on addr.
+// The snapshotter-managed certificate is kept in certDir.
+func NewSecurity(cfg config.EndpointTLSConfig, certDir, addr string) (*Security, error) {
+	var s Security
+
+	if cfg.Enable {
+		s.tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		if cfg.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+			if err != nil {
+				return nil, errors.Wrapf(err, "load certificate %s", cfg.CertFile)
+			}
+			s.tlsConfig.Certificates = []tls.Certificate{cert}
+		} else {
+			m, err := newManagedCertificate(certDir, certificateHosts(addr))
+			if err != nil {
+				return nil, errors.Wrap(err, "prepare managed certificate")
+			}
+			s.tlsConfig.GetCertificate = m.GetCertificate
+		}
+	}
+
+	if cfg.TokenFile != "" {
+		token, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "read token file %s", cfg.TokenFile)
+		}
+		s.token = strings.TrimSpace(string(token))
+		if s.token == "" {
+			return nil, errors.Errorf("empty token in file %s", cfg.TokenFile)
+		}
+	}
+
+	return &s, nil
+}
+
+// Secured tells whether the endpoint is served over TLS or requires a token.
+func (s *Security) Secured() bool {
+	return s != nil && (s.tlsConfig != nil || s.token != "")
+}
+
+// The managed certificate is valid for the listening host and the local host.
+func certificateHosts(addr string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil {
+		hosts = append(hosts, hostname)
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsUnspecified() {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// Listen on the TCP address, TLS is served if enabled.
+func (s *Security) Listen(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if s != nil && s.tlsConfig != nil {
+		return tls.NewListener(l, s.tlsConfig), nil
+	}
+
+	return l, nil
+}
+
+// Handler rejects the requests without the expected bearer token if token
+// authentication is enabled.
+func (s *Security) Handler(next http.Handler) http.Handler {
+	if s == nil || s.token == "" {
+		return next
+	}
+
+	expected := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="nydus-snapshotter"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package endpoint
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func TestManagedCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := newManagedCertificate(dir, []string{"localhost", "127.0.0.1"})
+	require.NoError(t, err)
+	cert, err := m.get()
+	require.NoError(t, err)
+	assert.Contains(t, cert.Leaf.DNSNames, "localhost")
+	assert.Len(t, cert.Leaf.IPAddresses, 1)
+
+	info, err := os.Stat(filepath.Join(dir, keyFileName))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// The persisted certificate is reused after restart.
+	m2, err := newManagedCertificate(dir, []string{"localhost"})
+	require.NoError(t, err)
+	cert2, err := m2.get()
+	require.NoError(t, err)
+	assert.Equal(t, cert.Leaf.SerialNumber, cert2.Leaf.SerialNumber)
+}
+
+func TestSecurity(t *testing.T) {
+	var s *Security
+	h := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	assert.NotNil(t, s.Handler(h))
+	assert.False(t, s.Secured())
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+
+	certDir := t.TempDir()
+	s, err := NewSecurity(config.EndpointTLSConfig{}, certDir, "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.False(t, s.Secured())
+
+	s, err = NewSecurity(config.EndpointTLSConfig{Enable: true, TokenFile: tokenFile}, certDir, "127.0.0.1:0")
+	require.NoError(t, err)
+	assert.True(t, s.Secured())
+
+	l, err := s.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	server := &http.Server{Handler: s.Handler(h)}
+	go func() { _ = server.Serve(l) }()
+	defer server.Close()
+
+	pem, err := os.ReadFile(filepath.Join(certDir, certFileName))
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	require.True(t, pool.AppendCertsFromPEM(pem))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+
+	url := "https://" + l.Addr().String()
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	s.Handler(h).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte(" "), 0600))
+	_, err = NewSecurity(config.EndpointTLSConfig{TokenFile: tokenFile}, certDir, "")
+	require.Error(t, err)
+}
@@ -22,6 +22,9 @@ var (
 	ErrUnavailable     = errors.New("unavailable")
 	ErrNotImplemented  = errors.New("not implemented") // represents not supported and unimplemented
 	ErrDeviceBusy      = errors.New("device busy")     // represents not supported and unimplemented
+	// Returned while the disk is full, it's unavailable to containerd so the
+	// request is retried later.
+	ErrDiskFull = errors.Wrap(errdefs.ErrUnavailable, "disk full")
 )
 
 // IsAlreadyExists returns true if the error is due to already exists
@@ -34,6 +37,11 @@ func IsNotFound(err error) bool {
 	return errors.Is(err, ErrNotFound)
 }
 
+// IsDiskFull returns true if the error is due to the disk being full
+func IsDiskFull(err error) bool {
+	return errors.Is(err, ErrDiskFull)
+}
+
 // IsConnectionClosed returns true if error is due to connection closed
 // this is used when snapshotter closed by sig term
 func IsConnectionClosed(err error) bool {
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package events broadcasts lifecycle events of nydusd daemons and RAFS instances
+// to subscribers like the system controller.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	DaemonStarted    Type = "DAEMON_STARTED"
+	DaemonDied       Type = "DAEMON_DIED"
+	DaemonDestroyed  Type = "DAEMON_DESTROYED"
+	InstanceMounted  Type = "INSTANCE_MOUNTED"
+	InstanceUmounted Type = "INSTANCE_UMOUNTED"
+	// The disk is full and the daemon is degraded, or space recovers.
+	DaemonDegraded  Type = "DAEMON_DEGRADED"
+	DaemonRecovered Type = "DAEMON_RECOVERED"
+	// The RAFS instance served its first successful read, the container is
+	// likely ready to exec.
+	InstanceReady Type = "INSTANCE_READY"
+	// The FUSE connection of a daemon is aborted or congested, or recovers.
+	FuseConnectionAborted   Type = "FUSE_CONNECTION_ABORTED"
+	FuseConnectionCongested Type = "FUSE_CONNECTION_CONGESTED"
+	FuseConnectionRecovered Type = "FUSE_CONNECTION_RECOVERED"
+)
+
+// Events are dropped for subscribers not keeping up.
+const subscriberBufferSize = 128
+
+type Event struct {
+	Type       Type      `json:"type"`
+	DaemonID   string    `json:"daemon_id,omitempty"`
+	SnapshotID string    `json:"snapshot_id,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	// Elapsed time since the snapshot was prepared, for INSTANCE_READY events.
+	Elapsed time.Duration `json:"elapsed,omitempty"`
+}
+
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+// Bus is where the snapshotter publishes its events.
+var Bus = NewBroker()
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[chan Event]struct{})}
+}
+
+func (b *Broker) Publish(typ Type, daemonID, snapshotID string) {
+	b.publish(Event{Type: typ, DaemonID: daemonID, SnapshotID: snapshotID, Timestamp: time.Now()})
+}
+
+// PublishElapsed publishes an event along with the time elapsed since the
+// snapshot was prepared.
+func (b *Broker) PublishElapsed(typ Type, daemonID, snapshotID string, elapsed time.Duration) {
+	b.publish(Event{Type: typ, DaemonID: daemonID, SnapshotID: snapshotID, Timestamp: time.Now(), Elapsed: elapsed})
+}
+
+func (b *Broker) publish(ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving events published afterwards, which is
+// closed when the context is done.
+func (b *Broker) Subscribe(ctx context.Context) <-chan Event {
+	ch := make(chan Event, subscriberBufferSize)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		close(ch)
+		b.mu.Unlock()
+	}()
+
+	return ch
+}
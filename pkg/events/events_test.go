@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	// Nobody is listening.
+	b.Publish(DaemonStarted, "d0", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := b.Subscribe(ctx)
+
+	b.Publish(DaemonStarted, "d1", "")
+	b.Publish(InstanceMounted, "d1", "10")
+
+	ev := <-ch
+	require.Equal(t, DaemonStarted, ev.Type)
+	require.Equal(t, "d1", ev.DaemonID)
+	ev = <-ch
+	require.Equal(t, InstanceMounted, ev.Type)
+	require.Equal(t, "10", ev.SnapshotID)
+	require.False(t, ev.Timestamp.IsZero())
+
+	cancel()
+	for range ch {
+	}
+
+	// Slow subscribers don't block publishing.
+	slow := b.Subscribe(context.Background())
+	for i := 0; i < subscriberBufferSize+10; i++ {
+		b.Publish(DaemonDied, "d1", "")
+	}
+	require.Len(t, slow, subscriberBufferSize)
+}
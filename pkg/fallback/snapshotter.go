@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package fallback provides a snapshotter served on platforms or kernels nydus
+// does not support if it's enabled explicitly. It still registers with containerd
+// so that the configuration can be shared by mixed clusters, but refuses to create
+// any snapshot with a well-defined error telling containerd to use the default
+// snapshotter.
+package fallback
+
+import (
+	"context"
+
+	"github.com/containerd/containerd/v2/core/mount"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+)
+
+// ErrFallback is returned by requests creating snapshots. It wraps `ErrNotImplemented`,
+// which reaches containerd as gRPC code `Unimplemented`.
+var ErrFallback = errors.Wrap(errdefs.ErrNotImplemented, "nydus snapshotter is unavailable, fall back to the default snapshotter")
+
+type snapshotter struct {
+	reason error
+}
+
+// NewSnapshotter returns a snapshotter having no snapshots, `reason` tells why nydus
+// is unavailable.
+func NewSnapshotter(reason error) snapshots.Snapshotter {
+	log.L.WithError(reason).Error("NYDUS IS UNAVAILABLE, serving fallback snapshotter, all snapshots should be prepared by the default snapshotter")
+	return &snapshotter{reason: reason}
+}
+
+func (s *snapshotter) fallback(ctx context.Context, key string) error {
+	log.G(ctx).WithError(s.reason).Warnf("Refuse to create snapshot %s by fallback snapshotter", key)
+	return errors.Wrap(ErrFallback, s.reason.Error())
+}
+
+func (s *snapshotter) Stat(_ context.Context, key string) (snapshots.Info, error) {
+	return snapshots.Info{}, errors.Wrapf(errdefs.ErrNotFound, "snapshot %s", key)
+}
+
+func (s *snapshotter) Update(_ context.Context, info snapshots.Info, _ ...string) (snapshots.Info, error) {
+	return snapshots.Info{}, errors.Wrapf(errdefs.ErrNotFound, "snapshot %s", info.Name)
+}
+
+func (s *snapshotter) Usage(_ context.Context, key string) (snapshots.Usage, error) {
+	return snapshots.Usage{}, errors.Wrapf(errdefs.ErrNotFound, "snapshot %s", key)
+}
+
+func (s *snapshotter) Mounts(_ context.Context, key string) ([]mount.Mount, error) {
+	return nil, errors.Wrapf(errdefs.ErrNotFound, "snapshot %s", key)
+}
+
+func (s *snapshotter) Prepare(ctx context.Context, key, _ string, _ ...snapshots.Opt) ([]mount.Mount, error) {
+	return nil, s.fallback(ctx, key)
+}
+
+func (s *snapshotter) View(ctx context.Context, key, _ string, _ ...snapshots.Opt) ([]mount.Mount, error) {
+	return nil, s.fallback(ctx, key)
+}
+
+func (s *snapshotter) Commit(_ context.Context, _, key string, _ ...snapshots.Opt) error {
+	return errors.Wrapf(errdefs.ErrNotFound, "snapshot %s", key)
+}
+
+func (s *snapshotter) Remove(_ context.Context, key string) error {
+	return errors.Wrapf(errdefs.ErrNotFound, "snapshot %s", key)
+}
+
+func (s *snapshotter) Walk(_ context.Context, _ snapshots.WalkFunc, _ ...string) error {
+	return nil
+}
+
+func (s *snapshotter) Close() error {
+	return nil
+}
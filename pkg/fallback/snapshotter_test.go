@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package fallback
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/errdefs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotter(t *testing.T) {
+	ctx := context.Background()
+	sn := NewSnapshotter(errors.New("filesystem driver fusedev on windows requires fuse"))
+
+	_, err := sn.Prepare(ctx, "key", "")
+	require.ErrorIs(t, err, ErrFallback)
+	require.True(t, errdefs.IsNotImplemented(err))
+	require.Contains(t, err.Error(), "requires fuse")
+
+	_, err = sn.View(ctx, "key", "")
+	require.ErrorIs(t, err, ErrFallback)
+
+	_, err = sn.Stat(ctx, "key")
+	require.True(t, errdefs.IsNotFound(err))
+	require.True(t, errdefs.IsNotFound(sn.Remove(ctx, "key")))
+	require.NoError(t, sn.Walk(ctx, nil))
+	require.NoError(t, sn.Close())
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/containerd/log"
+
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+// ImageWarmth tells how much data of an image is cached on the node.
+type ImageWarmth struct {
+	// Manifest digest of the image, or its reference if the digest is unknown
+	Digest     string   `json:"digest"`
+	References []string `json:"references"`
+	Blobs      int      `json:"blobs"`
+	// Bytes of blob caches on disk
+	CachedBytes int64  `json:"cached_bytes"`
+	ReadyChunks uint64 `json:"ready_chunks"`
+	TotalChunks uint64 `json:"total_chunks"`
+	// Ratio of the chunks ready in cache, from 0 for cold to 1 for fully cached
+	Warmth float64 `json:"warmth"`
+}
+
+// CacheAffinity summarizes the warm caches of images on the node, for schedulers
+// to place pods on nodes already caching the data of their images.
+type CacheAffinity struct {
+	Node        string        `json:"node"`
+	GeneratedAt time.Time     `json:"generated_at"`
+	Images      []ImageWarmth `json:"images"`
+}
+
+func imageDigest(r *racache.Rafs) string {
+	if d, ok := r.Annotations[label.CRIManifestDigest]; ok {
+		return d
+	}
+	return r.ImageID
+}
+
+// CacheAffinity tells how warm the caches of the images mounted by FUSE are,
+// the warmest images first. Blobs shared by images count for each of them.
+func (fs *Filesystem) CacheAffinity(ctx context.Context) *CacheAffinity {
+	summary := &CacheAffinity{GeneratedAt: time.Now().UTC(), Images: []ImageWarmth{}}
+	summary.Node, _ = os.Hostname()
+	if fs.cacheMgr == nil {
+		return summary
+	}
+
+	type image struct {
+		refs  map[string]bool
+		blobs map[string]bool
+	}
+	images := map[string]*image{}
+	fs.walkInstanceBlobs(ctx, func(r *racache.Rafs, blobs []string) {
+		digest := imageDigest(r)
+		img, ok := images[digest]
+		if !ok {
+			img = &image{refs: map[string]bool{}, blobs: map[string]bool{}}
+			images[digest] = img
+		}
+		img.refs[r.ImageID] = true
+		for _, id := range blobs {
+			img.blobs[id] = true
+		}
+	})
+
+	for digest, img := range images {
+		w := ImageWarmth{Digest: digest, References: []string{}}
+		for ref := range img.refs {
+			w.References = append(w.References, ref)
+		}
+		sort.Strings(w.References)
+		for id := range img.blobs {
+			blob, err := fs.cacheMgr.BlobWarmth(ctx, id)
+			if err != nil {
+				log.G(ctx).WithError(err).Warnf("Failed to get warmth of blob cache %s", id)
+				continue
+			}
+			w.Blobs++
+			w.CachedBytes += blob.CachedBytes
+			w.ReadyChunks += blob.ReadyChunks
+			w.TotalChunks += blob.TotalChunks
+		}
+		if w.TotalChunks > 0 {
+			w.Warmth = float64(w.ReadyChunks) / float64(w.TotalChunks)
+		}
+		summary.Images = append(summary.Images, w)
+	}
+	sort.Slice(summary.Images, func(i, j int) bool {
+		a, b := summary.Images[i], summary.Images[j]
+		if a.Warmth != b.Warmth {
+			return a.Warmth > b.Warmth
+		}
+		return a.Digest < b.Digest
+	})
+
+	return summary
+}
@@ -8,8 +8,11 @@
 package filesystem
 
 import (
+	"github.com/containerd/nydus-snapshotter/config"
 	"github.com/containerd/nydus-snapshotter/pkg/cache"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
 	"github.com/containerd/nydus-snapshotter/pkg/manager"
+	"github.com/containerd/nydus-snapshotter/pkg/prefetch"
 	"github.com/containerd/nydus-snapshotter/pkg/referrer"
 	"github.com/containerd/nydus-snapshotter/pkg/signature"
 	"github.com/containerd/nydus-snapshotter/pkg/stargz"
@@ -84,6 +87,48 @@ func WithRootMountpoint(mountpoint string) NewFSOpt {
 	}
 }
 
+func WithEnforceDigestValidate(enforce bool) NewFSOpt {
+	return func(fs *Filesystem) error {
+		fs.enforceDigestValidate = enforce
+		return nil
+	}
+}
+
+func WithCacheQuota(quota int64) NewFSOpt {
+	return func(fs *Filesystem) error {
+		fs.cacheQuota = quota
+		return nil
+	}
+}
+
+func WithReadAhead(cfg config.ReadAheadConfig) NewFSOpt {
+	return func(fs *Filesystem) error {
+		for class, w := range cfg.Classes {
+			if err := validateReadAheadWindow(class, w); err != nil {
+				return err
+			}
+		}
+		if _, ok := cfg.Classes[cfg.DefaultClass]; cfg.DefaultClass != "" && !ok {
+			return errors.Wrapf(errdefs.ErrInvalidArgument, "unknown default workload class %q", cfg.DefaultClass)
+		}
+
+		fs.readAhead.defaultClass = cfg.DefaultClass
+		fs.readAhead.windows = make(map[string]config.ReadAheadWindow, len(cfg.Classes))
+		for class, w := range cfg.Classes {
+			fs.readAhead.windows[class] = w
+		}
+		return nil
+	}
+}
+
+// Defer full image prefetch of RAFS instances to the schedule.
+func WithPrefetchScheduler(s *prefetch.Scheduler) NewFSOpt {
+	return func(fs *Filesystem) error {
+		fs.prefetchScheduler = s
+		return nil
+	}
+}
+
 func WithEnableStargz(enable bool) NewFSOpt {
 	return func(fs *Filesystem) error {
 		if enable {
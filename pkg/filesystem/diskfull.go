@@ -0,0 +1,66 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+
+	"github.com/containerd/log"
+
+	"github.com/containerd/nydus-snapshotter/pkg/events"
+	"github.com/containerd/nydus-snapshotter/pkg/prefetch"
+)
+
+func (fs *Filesystem) setDegraded(degraded bool) {
+	typ := events.DaemonRecovered
+	if degraded {
+		typ = events.DaemonDegraded
+	}
+
+	for _, fsManager := range fs.enabledManagers {
+		for _, d := range fsManager.ListDaemons() {
+			if d.Degraded() != degraded {
+				d.SetDegraded(degraded)
+				events.Bus.Publish(typ, d.ID(), "")
+			}
+		}
+	}
+}
+
+// EnterDiskPressure degrades all daemons when the disk is full, no instance is
+// mounted until space recovers. Prefetching is paused, which only fills the cache
+// further: prefetch lists are not handed out, full image prefetch is not triggered
+// and instances are mounted with prefetch off. Prefetch already running in nydusd
+// can't be stopped. Blob caches not used by any mounted instance are evicted too
+// if evictCaches is true, nothing is evicted if the caches in use are unknown.
+func (fs *Filesystem) EnterDiskPressure(ctx context.Context, evictCaches bool) {
+	fs.diskPressure.Store(true)
+	fs.setDegraded(true)
+	prefetch.Pm.SetPaused(true)
+
+	if !evictCaches || fs.cacheMgr == nil {
+		return
+	}
+
+	inUse, err := fs.blobsInUse()
+	if err != nil {
+		log.G(ctx).WithError(err).Warn("Failed to find blob caches in use, evict nothing")
+		return
+	}
+	evicted, err := fs.cacheMgr.EvictUnusedBlobCaches(ctx, inUse)
+	if err != nil {
+		log.G(ctx).WithError(err).Warn("Failed to evict unused blob caches")
+	}
+	log.G(ctx).Infof("Evicted %d unused blob caches on disk full", len(evicted))
+}
+
+// LeaveDiskPressure restores the daemons and prefetching once space recovers.
+func (fs *Filesystem) LeaveDiskPressure(_ context.Context) {
+	fs.diskPressure.Store(false)
+	fs.setDegraded(false)
+	prefetch.Pm.SetPaused(false)
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/prefetch"
+)
+
+func TestDiskPressure(t *testing.T) {
+	var cfg config.SnapshotterConfig
+	require.NoError(t, cfg.FillUpWithDefaults())
+	cfg.Root = t.TempDir()
+	require.NoError(t, config.ProcessConfigurations(&cfg))
+
+	var fs Filesystem
+	ctx := context.Background()
+	require.NoError(t, prefetch.Pm.SetPrefetchFiles([]byte(`[{"image": "image1", "prefetch": "/bin"}]`)))
+	defer prefetch.Pm.DeleteFromPrefetchMap("image1")
+
+	fs.EnterDiskPressure(ctx, true)
+	require.True(t, prefetch.Pm.Paused())
+	require.Empty(t, prefetch.Pm.GetPrefetchInfo("image1"))
+	// Instances served by nydusd are not mounted.
+	err := fs.Mount(ctx, "disk-full", map[string]string{}, nil)
+	require.ErrorIs(t, err, errdefs.ErrDiskFull)
+
+	// Prefetch lists are kept while paused.
+	fs.LeaveDiskPressure(ctx)
+	require.False(t, prefetch.Pm.Paused())
+	require.Equal(t, "/bin", prefetch.Pm.GetPrefetchInfo("image1"))
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path"
+	"syscall"
+
+	"github.com/containerd/containerd/v2/core/snapshots/storage"
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+	"github.com/containerd/nydus-snapshotter/pkg/events"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	"github.com/containerd/nydus-snapshotter/pkg/manager"
+	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+type mountRequest struct {
+	fsManager       *manager.Manager
+	rafs            *racache.Rafs
+	snapshot        *storage.Snapshot
+	labels          map[string]string
+	useSharedDaemon bool
+	sandboxID       string
+	// Daemon serving the instance, set by drivers backed by nydusd.
+	daemon *daemon.Daemon
+}
+
+// mountDriver mounts and umounts RAFS instances in the way of a filesystem driver.
+type mountDriver interface {
+	mount(ctx context.Context, fs *Filesystem, req *mountRequest) error
+	umount(fs *Filesystem, rafs *racache.Rafs) error
+	waitUntilReady(fs *Filesystem, rafs *racache.Rafs) error
+}
+
+// Drivers not backed by nydusd, the ones registered by `daemon.RegisterFsDriver`
+// are all served by nydusd daemons.
+var mountDrivers = map[string]mountDriver{
+	config.FsDriverBlockdev: tarfsDriver{},
+	config.FsDriverNodev:    nodevDriver{},
+	config.FsDriverProxy:    proxyDriver{},
+}
+
+func getMountDriver(fsDriver string) (mountDriver, error) {
+	if d, ok := mountDrivers[fsDriver]; ok {
+		return d, nil
+	}
+	if _, err := daemon.GetFsDriver(fsDriver); err != nil {
+		return nil, err
+	}
+	return daemonDriver{}, nil
+}
+
+func isDaemonDriver(fsDriver string) bool {
+	d, err := getMountDriver(fsDriver)
+	if err != nil {
+		return false
+	}
+	_, ok := d.(daemonDriver)
+	return ok
+}
+
+// Instances are served by nydusd daemons, see `daemon.FsDriver` for the driver
+// specific work of the daemons.
+type daemonDriver struct{}
+
+func (daemonDriver) mount(_ context.Context, fs *Filesystem, req *mountRequest) error {
+	d, err := fs.attachDaemon(req.fsManager, req.useSharedDaemon, req.sandboxID, req.rafs, req.labels)
+	if err != nil {
+		return err
+	}
+	req.daemon = d
+
+	if err := fs.mountRemote(req.fsManager, req.useSharedDaemon, d, req.rafs); err != nil {
+		// Instances of shared daemons are configured with the IO engine by mounting.
+		if d.IsSharedDaemon() {
+			req.fsManager.FallBackIOEngine(d)
+		}
+		return errors.Wrapf(err, "mount file system by daemon %s, snapshot %s", d.ID(), req.rafs.SnapshotID)
+	}
+
+	return nil
+}
+
+func (daemonDriver) umount(fs *Filesystem, rafs *racache.Rafs) error {
+	snapshotID := rafs.SnapshotID
+	fsManager, err := fs.getManager(rafs.GetFsDriver())
+	if err != nil {
+		return errors.Wrapf(err, "get manager for filesystem instance %s", rafs.DaemonID)
+	}
+
+	daemon, err := fs.getDaemonByRafs(rafs)
+	if err != nil {
+		log.L.Debugf("snapshot %s has no associated nydusd", snapshotID)
+		return errors.Wrapf(err, "get daemon with ID %s for snapshot %s", rafs.DaemonID, snapshotID)
+	}
+
+	umountErr := daemon.UmountRafsInstance(rafs)
+	// Keep the instance when the mountpoint is still busy, so umount can be retried.
+	if errors.Is(umountErr, syscall.EBUSY) {
+		return errors.Wrapf(umountErr, "umount instance %s", snapshotID)
+	}
+
+	daemon.RemoveRafsInstance(snapshotID)
+	if err := fsManager.RemoveRafsInstance(snapshotID); err != nil {
+		return errors.Wrapf(err, "remove snapshot %s", snapshotID)
+	}
+	if umountErr != nil {
+		return errors.Wrapf(umountErr, "umount instance %s", snapshotID)
+	}
+	events.Bus.Publish(events.InstanceUmounted, daemon.ID(), snapshotID)
+	fsManager.RetireConfig(daemon, snapshotID, manager.ConfigOpUmount)
+	// Once daemon's reference reaches 0, destroy the whole daemon
+	if daemon.GetRef() == 0 {
+		if err := fsManager.DestroyDaemon(daemon); err != nil {
+			return errors.Wrapf(err, "destroy daemon %s", daemon.ID())
+		}
+		if daemon.IsPodDaemon() {
+			if err := os.Remove(daemon.HostMountpoint()); err != nil && !os.IsNotExist(err) {
+				log.L.WithError(err).Warnf("remove mountpoint of pod daemon %s", daemon.ID())
+			}
+		}
+	}
+
+	return nil
+}
+
+func (daemonDriver) waitUntilReady(fs *Filesystem, rafs *racache.Rafs) error {
+	d, err := fs.getDaemonByRafs(rafs)
+	if err != nil {
+		return errors.Wrapf(err, "snapshot id %s daemon id %s", rafs.SnapshotID, rafs.DaemonID)
+	}
+
+	if err := d.WaitUntilState(types.DaemonStateRunning); err != nil {
+		return err
+	}
+	if err := d.ExposeMount(); err != nil {
+		return err
+	}
+
+	log.L.Debugf("Nydus remote snapshot %s is ready", rafs.SnapshotID)
+
+	return nil
+}
+
+// OCI layers converted to tarfs are mounted as EROFS by loop devices.
+type tarfsDriver struct{}
+
+func (tarfsDriver) mount(_ context.Context, fs *Filesystem, req *mountRequest) error {
+	snapshotID := req.rafs.SnapshotID
+	if err := fs.tarfsMgr.MountTarErofs(snapshotID, req.snapshot, req.labels, req.rafs); err != nil {
+		return errors.Wrapf(err, "mount tarfs for snapshot %s", snapshotID)
+	}
+	return nil
+}
+
+func (tarfsDriver) umount(fs *Filesystem, rafs *racache.Rafs) error {
+	snapshotID := rafs.SnapshotID
+	fsManager, err := fs.getManager(rafs.GetFsDriver())
+	if err != nil {
+		return errors.Wrapf(err, "get manager for filesystem instance %s", rafs.DaemonID)
+	}
+
+	if err := fs.tarfsMgr.UmountTarErofs(snapshotID); err != nil {
+		return errors.Wrapf(err, "umount tar erofs on snapshot %s", snapshotID)
+	}
+	if err := fsManager.RemoveRafsInstance(snapshotID); err != nil {
+		return errors.Wrapf(err, "remove snapshot %s", snapshotID)
+	}
+	events.Bus.Publish(events.InstanceUmounted, "", snapshotID)
+
+	return nil
+}
+
+func (tarfsDriver) waitUntilReady(_ *Filesystem, _ *racache.Rafs) error {
+	return nil
+}
+
+// Nothing is mounted, the runtime handles images by itself.
+type nodevDriver struct{}
+
+func (nodevDriver) mount(_ context.Context, _ *Filesystem, _ *mountRequest) error {
+	return nil
+}
+
+func (nodevDriver) umount(_ *Filesystem, _ *racache.Rafs) error {
+	return nil
+}
+
+func (nodevDriver) waitUntilReady(_ *Filesystem, _ *racache.Rafs) error {
+	return nil
+}
+
+// Images are mounted by the runtime through a proxy, which is told by annotations.
+type proxyDriver struct{}
+
+func (proxyDriver) mount(_ context.Context, _ *Filesystem, req *mountRequest) error {
+	if label.IsNydusProxyMode(req.labels) {
+		if v, ok := req.labels[label.CRILayerDigest]; ok {
+			req.rafs.AddAnnotation(label.CRILayerDigest, v)
+		}
+		req.rafs.AddAnnotation(label.NydusProxyMode, "true")
+		req.rafs.SetMountpoint(path.Join(req.rafs.GetSnapshotDir(), "fs"))
+	}
+	return nil
+}
+
+func (proxyDriver) umount(_ *Filesystem, _ *racache.Rafs) error {
+	return nil
+}
+
+func (proxyDriver) waitUntilReady(_ *Filesystem, _ *racache.Rafs) error {
+	return nil
+}
@@ -0,0 +1,34 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+func TestGetMountDriver(t *testing.T) {
+	for _, name := range []string{config.FsDriverFusedev, config.FsDriverFscache} {
+		d, err := getMountDriver(name)
+		require.NoError(t, err)
+		require.IsType(t, daemonDriver{}, d)
+		require.True(t, isDaemonDriver(name))
+	}
+
+	d, err := getMountDriver(config.FsDriverBlockdev)
+	require.NoError(t, err)
+	require.IsType(t, tarfsDriver{}, d)
+	require.False(t, isDaemonDriver(config.FsDriverNodev))
+	require.False(t, isDaemonDriver(config.FsDriverProxy))
+
+	_, err = getMountDriver("unknown")
+	require.ErrorIs(t, err, errdefs.ErrNotImplemented)
+}
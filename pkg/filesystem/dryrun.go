@@ -0,0 +1,143 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+
+	snpkg "github.com/containerd/containerd/v2/pkg/snapshotters"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+// Placeholder ID of the snapshot planned to be mounted.
+const dryRunSnapshotID = "dry-run"
+
+// Prerequisite of mounting a RAFS instance.
+type Prerequisite struct {
+	Name    string `json:"name"`
+	Met     bool   `json:"met"`
+	Message string `json:"message,omitempty"`
+}
+
+// MountPlan tells how a RAFS instance would be mounted for a snapshot.
+type MountPlan struct {
+	ImageRef   string `json:"image_ref"`
+	FsDriver   string `json:"fs_driver"`
+	DaemonMode string `json:"daemon_mode,omitempty"`
+	SandboxID  string `json:"sandbox_id,omitempty"`
+	// The running daemon to serve the instance, empty if a new one is started.
+	DaemonID  string `json:"daemon_id,omitempty"`
+	NewDaemon bool   `json:"new_daemon"`
+	// Nydusd configuration rendered for the instance with secrets redacted.
+	Config json.RawMessage `json:"config,omitempty"`
+	// Whether the image is lazily loaded rather than downloaded as a whole.
+	LazyLoading       bool           `json:"lazy_loading"`
+	LazyLoadingReason string         `json:"lazy_loading_reason,omitempty"`
+	Prerequisites     []Prerequisite `json:"prerequisites"`
+	// All the prerequisites are met.
+	Ready bool `json:"ready"`
+}
+
+func (p *MountPlan) check(name string, err error) bool {
+	pr := Prerequisite{Name: name, Met: err == nil}
+	if err != nil {
+		pr.Message = err.Error()
+		p.Ready = false
+	}
+	p.Prerequisites = append(p.Prerequisites, pr)
+	return err == nil
+}
+
+// PlanMount works out how `Mount()` would mount a RAFS instance for a snapshot
+// with the labels, without starting daemons or touching any states. It's for
+// debugging the label plumbing and configurations. In pod daemon mode, the sandbox
+// of the container is given by `WithSandboxID`.
+func (fs *Filesystem) PlanMount(ctx context.Context, labels map[string]string) *MountPlan {
+	plan := MountPlan{FsDriver: config.GetFsDriver(), LazyLoading: true, Ready: true}
+	if label.IsTarfsDataLayer(labels) {
+		plan.FsDriver = config.FsDriverBlockdev
+	}
+	fsDriver := plan.FsDriver
+	useDaemon := fsDriver == config.FsDriverFscache || fsDriver == config.FsDriverFusedev
+
+	imageRef, ok := labels[snpkg.TargetRefLabel]
+	if !ok {
+		imageRef, ok = labels["containerd.io/snapshot/remote/stargz.reference"]
+	}
+	plan.ImageRef = imageRef
+	if !ok {
+		plan.check("image reference", errors.Errorf("label %s is missing", snpkg.TargetRefLabel))
+	} else {
+		plan.check("image reference", nil)
+	}
+
+	fsManager, err := fs.getManager(fsDriver)
+	if !plan.check("filesystem driver", err) || !useDaemon {
+		if fsDriver == config.FsDriverBlockdev {
+			plan.check("tarfs", enabledErr(fs.TarfsEnabled(), "tarfs is not enabled"))
+		}
+		return &plan
+	}
+
+	plan.SandboxID = podSandboxID(ctx, fsDriver)
+	switch {
+	case plan.SandboxID != "":
+		plan.DaemonMode = string(config.DaemonModePod)
+		if !volumeIDRegexp.MatchString(plan.SandboxID) {
+			plan.check("sandbox", errors.Wrapf(errdefs.ErrInvalidArgument, "invalid sandbox id %q", plan.SandboxID))
+			break
+		}
+		plan.NewDaemon = true
+		for _, d := range fsManager.ListDaemons() {
+			if d.IsPodDaemon() && d.States.SandboxID == plan.SandboxID {
+				plan.DaemonID, plan.NewDaemon = d.ID(), false
+			}
+		}
+	case fsDriver == config.FsDriverFscache || config.GetDaemonMode() == config.DaemonModeShared:
+		plan.DaemonMode = string(config.DaemonModeShared)
+		if d, err := fs.getSharedDaemon(fsDriver); plan.check("shared daemon", err) {
+			plan.DaemonID = d.ID()
+		}
+	default:
+		plan.DaemonMode = string(config.DaemonModeDedicated)
+		plan.NewDaemon = true
+	}
+
+	if plan.NewDaemon {
+		_, err := exec.LookPath(fsManager.NydusdBinaryPath)
+		plan.check("nydusd binary", err)
+	}
+
+	if !ok {
+		return &plan
+	}
+	snapshotDir := filepath.Join(config.GetSnapshotsRootDir(), dryRunSnapshotID)
+	bootstrap := filepath.Join(snapshotDir, "fs", "image", "image.boot")
+	cfg, err := fs.renderConfig(fsManager, imageRef, dryRunSnapshotID, bootstrap, filepath.Join(snapshotDir, "fs"),
+		fsManager.IOEngine(), labels)
+	if plan.check("configuration", err) {
+		plan.Config, err = daemonconfig.DumpRedactedConfig(cfg)
+		plan.check("configuration", err)
+	}
+
+	return &plan
+}
+
+func enabledErr(enabled bool, msg string) error {
+	if enabled {
+		return nil
+	}
+	return errors.New(msg)
+}
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"testing"
+
+	snpkg "github.com/containerd/containerd/v2/pkg/snapshotters"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+func TestPlanMount(t *testing.T) {
+	var cfg config.SnapshotterConfig
+	require.NoError(t, cfg.FillUpWithDefaults())
+	cfg.Root = t.TempDir()
+	require.NoError(t, config.ProcessConfigurations(&cfg))
+
+	fs := &Filesystem{}
+
+	plan := fs.PlanMount(context.Background(), map[string]string{})
+	require.False(t, plan.Ready)
+	require.Equal(t, "image reference", plan.Prerequisites[0].Name)
+	require.False(t, plan.Prerequisites[0].Met)
+	require.Empty(t, plan.Config)
+
+	plan = fs.PlanMount(context.Background(), map[string]string{
+		snpkg.TargetRefLabel:  "docker.io/library/busybox:latest",
+		label.NydusTarfsLayer: "true",
+	})
+	require.False(t, plan.Ready)
+	require.Equal(t, config.FsDriverBlockdev, plan.FsDriver)
+	require.Equal(t, "docker.io/library/busybox:latest", plan.ImageRef)
+	require.True(t, plan.Prerequisites[0].Met)
+	require.Equal(t, "filesystem driver", plan.Prerequisites[1].Name)
+	require.False(t, plan.Prerequisites[1].Met)
+	require.Equal(t, "tarfs", plan.Prerequisites[2].Name)
+	require.False(t, plan.Prerequisites[2].Met)
+	require.Empty(t, plan.DaemonMode)
+}
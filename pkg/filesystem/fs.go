@@ -14,12 +14,18 @@ import (
 	"context"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	snpkg "github.com/containerd/containerd/v2/pkg/snapshotters"
 	"github.com/mohae/deepcopy"
 	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/containerd/containerd/v2/core/snapshots"
 	"github.com/containerd/containerd/v2/core/snapshots/storage"
@@ -31,8 +37,10 @@ import (
 	"github.com/containerd/nydus-snapshotter/pkg/daemon"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/events"
 	"github.com/containerd/nydus-snapshotter/pkg/label"
 	"github.com/containerd/nydus-snapshotter/pkg/manager"
+	"github.com/containerd/nydus-snapshotter/pkg/prefetch"
 	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
 	"github.com/containerd/nydus-snapshotter/pkg/referrer"
 	"github.com/containerd/nydus-snapshotter/pkg/signature"
@@ -40,6 +48,9 @@ import (
 	"github.com/containerd/nydus-snapshotter/pkg/tarfs"
 )
 
+// How often blob caches are checked while waiting for images to be fully cached.
+const fullyCachedPollInterval = time.Second
+
 type Filesystem struct {
 	fusedevSharedDaemon  *daemon.Daemon
 	fscacheSharedDaemon  *daemon.Daemon
@@ -51,6 +62,22 @@ type Filesystem struct {
 	verifier             *signature.Verifier
 	nydusImageBinaryPath string
 	rootMountpoint       string
+	// Snapshots are not allowed to turn digest validation off
+	enforceDigestValidate bool
+	// Default bytes of blob cache each image may use, no limit if zero
+	cacheQuota int64
+	readAhead  readAheadClasses
+	// Decide when full image prefetch runs, right after mounting if nil
+	prefetchScheduler *prefetch.Scheduler
+	// Serialize mounting and umounting of image volumes
+	volumeMu sync.Mutex
+	// Deduplicate creating daemons for pod sandboxes, keyed by sandbox ID
+	podDaemons singleflight.Group
+	// No instance is mounted while daemons are degraded by disk pressure
+	diskPressure atomic.Bool
+	// Protect readyWatchers, indexed by daemon ID
+	readyMu       sync.Mutex
+	readyWatchers map[string]*readyWatcher
 }
 
 // NewFileSystem initialize Filesystem instance
@@ -78,14 +105,14 @@ func NewFileSystem(ctx context.Context, opt ...NewFSOpt) (*Filesystem, error) {
 	for _, daemon := range liveDaemons {
 		if daemon.States.FsDriver == config.FsDriverFscache {
 			hasFscacheSharedDaemon = true
-		} else if daemon.States.FsDriver == config.FsDriverFusedev && daemon.IsSharedDaemon() {
+		} else if daemon.States.FsDriver == config.FsDriverFusedev && daemon.IsSharedDaemon() && !daemon.IsPodDaemon() {
 			hasFusedevSharedDaemon = true
 		}
 	}
 	for _, daemon := range recoveringDaemons {
 		if daemon.States.FsDriver == config.FsDriverFscache {
 			hasFscacheSharedDaemon = true
-		} else if daemon.States.FsDriver == config.FsDriverFusedev && daemon.IsSharedDaemon() {
+		} else if daemon.States.FsDriver == config.FsDriverFusedev && daemon.IsSharedDaemon() && !daemon.IsPodDaemon() {
 			hasFusedevSharedDaemon = true
 		}
 	}
@@ -136,6 +163,9 @@ func NewFileSystem(ctx context.Context, opt ...NewFSOpt) (*Filesystem, error) {
 			if err := d.WaitUntilState(types.DaemonStateRunning); err != nil {
 				return errors.Wrapf(err, "wait for daemon %s", d.ID())
 			}
+			if err := d.ExposeMount(); err != nil {
+				return err
+			}
 			if err := d.RecoverRafsInstances(); err != nil {
 				return errors.Wrapf(err, "recover mounts for daemon %s", d.ID())
 			}
@@ -151,6 +181,8 @@ func NewFileSystem(ctx context.Context, opt ...NewFSOpt) (*Filesystem, error) {
 		fs.TryRetainSharedDaemon(d)
 	}
 
+	fs.recoverVolumes()
+
 	return &fs, nil
 }
 
@@ -207,39 +239,105 @@ func (fs *Filesystem) WaitUntilReady(snapshotID string) error {
 		return errors.Wrapf(errdefs.ErrNotFound, "no instance %s", snapshotID)
 	}
 
-	if rafs.GetFsDriver() == config.FsDriverFscache || rafs.GetFsDriver() == config.FsDriverFusedev {
-		d, err := fs.getDaemonByRafs(rafs)
-		if err != nil {
-			return errors.Wrapf(err, "snapshot id %s daemon id %s", snapshotID, rafs.DaemonID)
-		}
+	driver, err := getMountDriver(rafs.GetFsDriver())
+	if err != nil {
+		return errors.Wrapf(err, "wait for instance %s", snapshotID)
+	}
 
-		if err := d.WaitUntilState(types.DaemonStateRunning); err != nil {
-			return err
-		}
+	return driver.waitUntilReady(fs, rafs)
+}
 
-		log.L.Debugf("Nydus remote snapshot %s is ready", snapshotID)
+// Data blobs of the image served by the RAFS instance, recorded at mounting.
+func imageBlobIDs(r *racache.Rafs) ([]string, bool) {
+	v, ok := r.Annotations[label.NydusImageBlobIDs]
+	if !ok {
+		return nil, false
+	}
+	if v == "" {
+		return []string{}, true
 	}
+	return strings.Split(v, ","), true
+}
 
-	return nil
+// WaitUntilFullyCached waits until all the data blobs of the image served by the RAFS
+// instance are cached by nydusd, for images which must not be lazily loaded.
+func (fs *Filesystem) WaitUntilFullyCached(ctx context.Context, snapshotID string) error {
+	rafs := racache.RafsGlobalCache.Get(snapshotID)
+	if rafs == nil {
+		return errors.Wrapf(errdefs.ErrNotFound, "no instance %s", snapshotID)
+	}
+	// Blob caches of fscache are managed by the kernel, they can't be inspected.
+	if rafs.GetFsDriver() != config.FsDriverFusedev || fs.cacheMgr == nil {
+		return errors.Wrapf(errdefs.ErrNotImplemented,
+			"wait for blobs of instance %s cached with filesystem driver %s", snapshotID, rafs.GetFsDriver())
+	}
+	blobs, ok := imageBlobIDs(rafs)
+	if !ok {
+		return errors.Errorf("unknown blobs of instance %s", snapshotID)
+	}
+
+	ticker := time.NewTicker(fullyCachedPollInterval)
+	defer ticker.Stop()
+	for {
+		pending := blobs[:0:0]
+		for _, id := range blobs {
+			cached, err := fs.cacheMgr.BlobCached(id)
+			if err != nil {
+				return errors.Wrapf(err, "check cache of blob %s", id)
+			}
+			if !cached {
+				pending = append(pending, id)
+			}
+		}
+		if blobs = pending; len(blobs) == 0 {
+			log.G(ctx).Infof("All the blobs of instance %s are cached", snapshotID)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "wait for %d blobs of instance %s cached", len(blobs), snapshotID)
+		case <-ticker.C:
+		}
+	}
 }
 
 // Mount will be called when containerd snapshotter prepare remote snapshotter
 // this method will fork nydus daemon and manage it in the internal store, and indexed by snapshotID
 // It must set up all necessary resources during Mount procedure and revoke any step if necessary.
+// In pod daemon mode, instances of the sandbox given by `WithSandboxID` are indexed by
+// `PodInstanceID` instead.
 func (fs *Filesystem) Mount(ctx context.Context, snapshotID string, labels map[string]string, s *storage.Snapshot) (err error) {
-	rafs := racache.RafsGlobalCache.Get(snapshotID)
+	start := prepareStart(ctx)
+	fsDriver := config.GetFsDriver()
+	if label.IsTarfsDataLayer(labels) {
+		fsDriver = config.FsDriverBlockdev
+	}
+	sandboxID := podSandboxID(ctx, fsDriver)
+	instanceID := PodInstanceID(sandboxID, snapshotID)
+
+	rafs := racache.RafsGlobalCache.Get(instanceID)
 	if rafs != nil {
 		// Instance already exists, how could this happen? Can containerd handle this case?
 		return nil
 	}
-
-	fsDriver := config.GetFsDriver()
-	if label.IsTarfsDataLayer(labels) {
-		fsDriver = config.FsDriverBlockdev
+	if fs.diskPressure.Load() && isDaemonDriver(fsDriver) {
+		return errors.Wrapf(errdefs.ErrDiskFull, "mount instance %s", instanceID)
 	}
+
 	isSharedFusedev := fsDriver == config.FsDriverFusedev && config.GetDaemonMode() == config.DaemonModeShared
 	useSharedDaemon := fsDriver == config.FsDriverFscache || isSharedFusedev
 
+	var rafsOpts []racache.NewRafsOpt
+	if sandboxID != "" {
+		if !volumeIDRegexp.MatchString(sandboxID) {
+			return errors.Wrapf(errdefs.ErrInvalidArgument, "invalid sandbox id %q", sandboxID)
+		}
+		useSharedDaemon = true
+		// Instances of the sandbox work in the snapshot directory holding the bootstrap.
+		rafsOpts = append(rafsOpts, racache.WithSnapshotDir(path.Join(config.GetSnapshotsRootDir(), snapshotID)))
+	}
+
 	var imageID string
 	imageID, ok := labels[snpkg.TargetRefLabel]
 	if !ok {
@@ -252,14 +350,21 @@ func (fs *Filesystem) Mount(ctx context.Context, snapshotID string, labels map[s
 		}
 	}
 
-	rafs, err = racache.NewRafs(snapshotID, imageID, fsDriver)
+	rafs, err = racache.NewRafs(instanceID, imageID, fsDriver, rafsOpts...)
 	if err != nil {
-		return errors.Wrapf(err, "create rafs instance %s", snapshotID)
+		return errors.Wrapf(err, "create rafs instance %s", instanceID)
+	}
+	// Identify the image by digest in cache affinity summaries.
+	if v, ok := labels[label.CRIManifestDigest]; ok {
+		rafs.AddAnnotation(label.CRIManifestDigest, v)
+	}
+	if v, ok := labels[label.NydusImageBlobIDs]; ok {
+		rafs.AddAnnotation(label.NydusImageBlobIDs, v)
 	}
 
 	defer func() {
 		if err != nil {
-			racache.RafsGlobalCache.Remove(snapshotID)
+			racache.RafsGlobalCache.Remove(instanceID)
 		}
 	}()
 
@@ -267,117 +372,45 @@ func (fs *Filesystem) Mount(ctx context.Context, snapshotID string, labels map[s
 	if err != nil {
 		return errors.Wrapf(err, "get filesystem manager for snapshot %s", snapshotID)
 	}
+	driver, err := getMountDriver(fsDriver)
+	if err != nil {
+		return errors.Wrapf(err, "get filesystem driver for snapshot %s", snapshotID)
+	}
 
-	var d *daemon.Daemon
-	if fsDriver == config.FsDriverFscache || fsDriver == config.FsDriverFusedev {
-		bootstrap, err := rafs.BootstrapFile()
-		if err != nil {
-			return errors.Wrapf(err, "find bootstrap file snapshot %s", snapshotID)
-		}
-
-		if useSharedDaemon {
-			d, err = fs.getSharedDaemon(fsDriver)
-			if err != nil {
-				return err
-			}
-		} else {
-			mp, err := fs.decideDaemonMountpoint(fsDriver, false, rafs)
-			if err != nil {
-				return err
-			}
-			d, err = fs.createDaemon(fsManager, config.DaemonModeDedicated, mp, 0)
-			// if daemon already exists for snapshotID, just return
-			if err != nil && !errdefs.IsAlreadyExists(err) {
-				return err
-			}
-		}
-
-		// Nydusd uses cache manager's directory to store blob caches. So cache
-		// manager knows where to find those blobs.
-		cacheDir := fs.cacheMgr.CacheDir()
-		// Fscache driver stores blob cache bitmap and blob header files here
-		workDir := rafs.FscacheWorkDir()
-		params := map[string]string{
-			daemonconfig.Bootstrap: bootstrap,
-			daemonconfig.WorkDir:   workDir,
-			daemonconfig.CacheDir:  cacheDir,
-		}
-		cfg := deepcopy.Copy(*fsManager.DaemonConfig).(daemonconfig.DaemonConfig)
-		err = daemonconfig.SupplementDaemonConfig(cfg, imageID, snapshotID, false, labels, params)
-		if err != nil {
-			return errors.Wrap(err, "supplement configuration")
-		}
-
-		// TODO: How to manage rafs configurations on-disk? separated json config file or DB record?
-		// In order to recover erofs mount, the configuration file has to be persisted.
-		var configSubDir string
-		if useSharedDaemon {
-			configSubDir = snapshotID
-		} else {
-			// Associate daemon config object when creating a new daemon object to avoid
-			// reading disk file again and again.
-			// For shared daemon, each rafs instance has its own configuration, so we don't
-			// attach a config interface to daemon in this case.
-			d.Config = cfg
-		}
-
-		err = cfg.DumpFile(d.ConfigFile(configSubDir))
-		if err != nil {
-			if errors.Is(err, errdefs.ErrAlreadyExists) {
-				log.L.Debugf("Configuration file %s already exits", d.ConfigFile(configSubDir))
-			} else {
-				return errors.Wrap(err, "dump daemon configuration file")
-			}
-		}
-
-		d.AddRafsInstance(rafs)
-
-		// if publicKey is not empty we should verify bootstrap file of image
-		err = fs.verifier.Verify(labels, bootstrap)
-		if err != nil {
-			return errors.Wrapf(err, "verify signature of daemon %s", d.ID())
-		}
+	// Full image prefetch deferred by the schedule is performed by reading files
+	// through the mountpoint later, rather than by nydusd right after mounting.
+	deferPrefetch := isDaemonDriver(fsDriver) && fs.prefetchScheduler.Defer(labels)
+	if deferPrefetch {
+		labels = withoutLabel(labels, label.NydusPrefetchAll)
 	}
 
-	switch fsDriver {
-	case config.FsDriverFscache:
-		err = fs.mountRemote(fsManager, useSharedDaemon, d, rafs)
-		if err != nil {
-			err = errors.Wrapf(err, "mount file system by daemon %s, snapshot %s", d.ID(), snapshotID)
-		}
-	case config.FsDriverFusedev:
-		err = fs.mountRemote(fsManager, useSharedDaemon, d, rafs)
-		if err != nil {
-			err = errors.Wrapf(err, "mount file system by daemon %s, snapshot %s", d.ID(), snapshotID)
-		}
-	case config.FsDriverBlockdev:
-		err = fs.tarfsMgr.MountTarErofs(snapshotID, s, labels, rafs)
-		if err != nil {
-			err = errors.Wrapf(err, "mount tarfs for snapshot %s", snapshotID)
-		}
-	case config.FsDriverNodev:
-		// Nothing to do
-	case config.FsDriverProxy:
-		if label.IsNydusProxyMode(labels) {
-			if v, ok := labels[label.CRILayerDigest]; ok {
-				rafs.AddAnnotation(label.CRILayerDigest, v)
-			}
-			rafs.AddAnnotation(label.NydusProxyMode, "true")
-			rafs.SetMountpoint(path.Join(rafs.GetSnapshotDir(), "fs"))
-		}
-	default:
-		err = errors.Errorf("unknown filesystem driver %s for snapshot %s", fsDriver, snapshotID)
+	req := &mountRequest{
+		fsManager:       fsManager,
+		rafs:            rafs,
+		snapshot:        s,
+		labels:          labels,
+		useSharedDaemon: useSharedDaemon,
+		sandboxID:       sandboxID,
 	}
+	err = driver.mount(ctx, fs, req)
 
 	// Persist it after associate instance after all the states are calculated.
 	if err == nil {
 		if err := fsManager.AddRafsInstance(rafs); err != nil {
-			return errors.Wrapf(err, "create instance %s", snapshotID)
+			return errors.Wrapf(err, "create instance %s", instanceID)
+		}
+		events.Bus.Publish(events.InstanceMounted, rafs.DaemonID, instanceID)
+		if deferPrefetch {
+			fs.prefetchScheduler.Enqueue(instanceID, rafs.GetMountpoint(), labels)
+		}
+		// Nydusd metrics of instances are only available with FUSE.
+		if fsDriver == config.FsDriverFusedev {
+			fs.watchFirstRead(req.daemon, rafs, start, time.Now())
 		}
 	}
 
 	if err != nil {
-		_ = fs.Umount(ctx, snapshotID)
+		_ = fs.Umount(ctx, instanceID)
 		return err
 	}
 
@@ -385,56 +418,35 @@ func (fs *Filesystem) Mount(ctx context.Context, snapshotID string, labels map[s
 }
 
 func (fs *Filesystem) Umount(_ context.Context, snapshotID string) error {
+	fs.prefetchScheduler.Remove(snapshotID)
+
 	rafs := racache.RafsGlobalCache.Get(snapshotID)
 	if rafs == nil {
 		log.L.Debugf("no RAFS filesystem instance associated with snapshot %s", snapshotID)
 		return nil
 	}
 
-	fsDriver := rafs.GetFsDriver()
-	if fsDriver == config.FsDriverNodev {
-		return nil
-	}
-	fsManager, err := fs.getManager(fsDriver)
+	driver, err := getMountDriver(rafs.GetFsDriver())
 	if err != nil {
-		return errors.Wrapf(err, "get manager for filesystem instance %s", rafs.DaemonID)
+		return errors.Wrapf(err, "umount instance %s", snapshotID)
 	}
 
-	switch fsDriver {
-	case config.FsDriverFscache, config.FsDriverFusedev:
-		daemon, err := fs.getDaemonByRafs(rafs)
-		if err != nil {
-			log.L.Debugf("snapshot %s has no associated nydusd", snapshotID)
-			return errors.Wrapf(err, "get daemon with ID %s for snapshot %s", rafs.DaemonID, snapshotID)
-		}
+	return driver.umount(fs, rafs)
+}
 
-		daemon.RemoveRafsInstance(snapshotID)
-		if err := fsManager.RemoveRafsInstance(snapshotID); err != nil {
-			return errors.Wrapf(err, "remove snapshot %s", snapshotID)
-		}
-		if err := daemon.UmountRafsInstance(rafs); err != nil {
-			return errors.Wrapf(err, "umount instance %s", snapshotID)
-		}
-		// Once daemon's reference reaches 0, destroy the whole daemon
-		if daemon.GetRef() == 0 {
-			if err := fsManager.DestroyDaemon(daemon); err != nil {
-				return errors.Wrapf(err, "destroy daemon %s", daemon.ID())
-			}
-		}
-	case config.FsDriverBlockdev:
-		if err := fs.tarfsMgr.UmountTarErofs(snapshotID); err != nil {
-			return errors.Wrapf(err, "umount tar erofs on snapshot %s", snapshotID)
-		}
-		if err := fsManager.RemoveRafsInstance(snapshotID); err != nil {
-			return errors.Wrapf(err, "remove snapshot %s", snapshotID)
-		}
-	case config.FsDriverNodev, config.FsDriverProxy:
-		// Nothing to do
-	default:
-		return errors.Errorf("unknown filesystem driver %s for snapshot %s", fsDriver, snapshotID)
+// Remount a RAFS instance whose mount is gone while its daemon is still alive.
+func (fs *Filesystem) Remount(_ context.Context, snapshotID string) error {
+	rafs := racache.RafsGlobalCache.Get(snapshotID)
+	if rafs == nil {
+		return errors.Wrapf(errdefs.ErrNotFound, "no RAFS filesystem instance associated with snapshot %s", snapshotID)
 	}
 
-	return nil
+	daemon, err := fs.getDaemonByRafs(rafs)
+	if err != nil {
+		return errors.Wrapf(err, "get daemon with ID %s for snapshot %s", rafs.DaemonID, snapshotID)
+	}
+
+	return daemon.Remount(rafs)
 }
 
 // How much space the layer/blob cache filesystem is occupying
@@ -480,6 +492,12 @@ func (fs *Filesystem) RemoveCache(blobDigest string) error {
 // Try to stop all the running daemons if they are not referenced by any snapshots
 // Clean up resources along with the daemons.
 func (fs *Filesystem) Teardown(ctx context.Context) error {
+	for _, v := range fs.ListVolumes() {
+		if err := fs.UmountVolume(ctx, v.ID, ""); err != nil {
+			log.L.Errorf("Failed to umount volume %s, %s", v.ID, err)
+		}
+	}
+
 	for _, fsManager := range fs.enabledManagers {
 		if fsManager.FsDriver == config.FsDriverFscache || fsManager.FsDriver == config.FsDriverFusedev {
 			for _, d := range fsManager.ListDaemons() {
@@ -515,6 +533,153 @@ func (fs *Filesystem) BootstrapFile(id string) (string, error) {
 	return rafs.BootstrapFile()
 }
 
+// Decide RAFS digest validation of a snapshot from its label value.
+func (fs *Filesystem) digestValidate(value string) (bool, error) {
+	validate, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.Wrapf(errdefs.ErrInvalidArgument, "label %s=%q", label.NydusDigestValidate, value)
+	}
+	if !validate && fs.enforceDigestValidate {
+		return false, errors.Wrapf(errdefs.ErrInvalidArgument,
+			"digest validation is enforced, can't turn it off by label %s", label.NydusDigestValidate)
+	}
+
+	return validate, nil
+}
+
+// attachDaemon finds or creates the nydusd daemon serving the RAFS instance, dumps
+// the instance's configuration file and associates the instance with the daemon.
+func (fs *Filesystem) attachDaemon(fsManager *manager.Manager, useSharedDaemon bool, sandboxID string,
+	rafs *racache.Rafs, labels map[string]string) (*daemon.Daemon, error) {
+	fsDriver := fsManager.FsDriver
+	snapshotID := rafs.SnapshotID
+
+	bootstrap, err := rafs.BootstrapFile()
+	if err != nil {
+		return nil, errors.Wrapf(err, "find bootstrap file snapshot %s", snapshotID)
+	}
+
+	var d *daemon.Daemon
+	if sandboxID != "" {
+		d, err = fs.getPodDaemon(fsManager, sandboxID)
+		if err != nil {
+			return nil, err
+		}
+	} else if useSharedDaemon {
+		d, err = fs.getSharedDaemon(fsDriver)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		mp, err := fs.decideDaemonMountpoint(fsDriver, false, rafs)
+		if err != nil {
+			return nil, err
+		}
+		d, err = fs.createDaemon(fsManager, config.DaemonModeDedicated, mp, 0)
+		// if daemon already exists for snapshotID, just return
+		if err != nil && !errdefs.IsAlreadyExists(err) {
+			return nil, err
+		}
+	}
+
+	cfg, err := fs.renderConfig(fsManager, rafs.ImageID, snapshotID, bootstrap, rafs.FscacheWorkDir(), d.IOEngine(), labels)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := labels[label.NydusCacheQuota]; ok && fsDriver == config.FsDriverFusedev {
+		rafs.AddAnnotation(label.NydusCacheQuota, v)
+	}
+
+	// TODO: How to manage rafs configurations on-disk? separated json config file or DB record?
+	// In order to recover erofs mount, the configuration file has to be persisted.
+	var configSubDir string
+	if useSharedDaemon {
+		configSubDir = snapshotID
+	} else {
+		// Associate daemon config object when creating a new daemon object to avoid
+		// reading disk file again and again.
+		// For shared daemon, each rafs instance has its own configuration, so we don't
+		// attach a config interface to daemon in this case.
+		d.Config = cfg
+	}
+
+	err = cfg.DumpFile(d.ConfigFile(configSubDir))
+	if err != nil {
+		if errors.Is(err, errdefs.ErrAlreadyExists) {
+			log.L.Debugf("Configuration file %s already exits", d.ConfigFile(configSubDir))
+		} else {
+			return nil, errors.Wrap(err, "dump daemon configuration file")
+		}
+	}
+	fsManager.RecordConfig(d, snapshotID, manager.ConfigOpMount, cfg)
+
+	d.AddRafsInstance(rafs)
+
+	// if publicKey is not empty we should verify bootstrap file of image
+	err = fs.verifier.Verify(labels, bootstrap)
+	if err != nil {
+		return nil, errors.Wrapf(err, "verify signature of daemon %s", d.ID())
+	}
+
+	return d, nil
+}
+
+// Copy of the labels without the key.
+func withoutLabel(labels map[string]string, key string) map[string]string {
+	copied := make(map[string]string, len(labels))
+	for k, v := range labels {
+		if k != key {
+			copied[k] = v
+		}
+	}
+	return copied
+}
+
+// Render the nydusd configuration of a RAFS instance from the template and the
+// snapshot labels.
+func (fs *Filesystem) renderConfig(fsManager *manager.Manager, imageID, snapshotID, bootstrap, workDir, ioEngine string,
+	labels map[string]string) (daemonconfig.DaemonConfig, error) {
+	// Nydusd uses cache manager's directory to store blob caches. So cache
+	// manager knows where to find those blobs.
+	cacheDir := fs.cacheMgr.CacheDir()
+	// Fscache driver stores blob cache bitmap and blob header files in work directory.
+	params := map[string]string{
+		daemonconfig.Bootstrap: bootstrap,
+		daemonconfig.WorkDir:   workDir,
+		daemonconfig.CacheDir:  cacheDir,
+	}
+	// Nydusd performs sync IO by default, don't bother older nydusd.
+	if ioEngine != config.IOEngineSync {
+		params[daemonconfig.IOEngine] = ioEngine
+	}
+	if prefetch.Pm.Paused() {
+		params[daemonconfig.NoPrefetch] = "true"
+	} else if labels[label.NydusPrefetchAll] == "true" {
+		params[daemonconfig.PrefetchAll] = "true"
+	}
+	if v, ok := labels[label.NydusDigestValidate]; ok {
+		validate, err := fs.digestValidate(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "snapshot %s", snapshotID)
+		}
+		params[daemonconfig.DigestValidate] = strconv.FormatBool(validate)
+	}
+	if err := fs.readAheadParams(labels, params); err != nil {
+		return nil, errors.Wrapf(err, "snapshot %s", snapshotID)
+	}
+	if v, ok := labels[label.NydusCacheQuota]; ok && fsManager.FsDriver == config.FsDriverFusedev {
+		if _, err := ParseCacheQuota(v); err != nil {
+			return nil, errors.Wrapf(err, "snapshot %s", snapshotID)
+		}
+	}
+	cfg := deepcopy.Copy(*fsManager.DaemonConfig).(daemonconfig.DaemonConfig)
+	if err := daemonconfig.SupplementDaemonConfig(cfg, imageID, snapshotID, false, labels, params); err != nil {
+		return nil, errors.Wrap(err, "supplement configuration")
+	}
+
+	return cfg, nil
+}
+
 // daemon mountpoint to rafs mountpoint
 // calculate rafs mountpoint for snapshots mount slice.
 func (fs *Filesystem) mountRemote(fsManager *manager.Manager, useSharedDaemon bool,
@@ -600,6 +765,7 @@ func (fs *Filesystem) initSharedDaemon(fsManager *manager.Manager) (err error) {
 	if err != nil && !errors.Is(err, errdefs.ErrAlreadyExists) {
 		return errors.Wrapf(err, "dump configuration file %s", d.ConfigFile(""))
 	}
+	fsManager.RecordConfig(d, "", manager.ConfigOpStart, d.Config)
 
 	if err := fsManager.StartDaemon(d); err != nil {
 		return errors.Wrap(err, "start shared daemon")
@@ -612,7 +778,7 @@ func (fs *Filesystem) initSharedDaemon(fsManager *manager.Manager) (err error) {
 
 // createDaemon create new nydus daemon by snapshotID and imageID
 func (fs *Filesystem) createDaemon(fsManager *manager.Manager, daemonMode config.DaemonMode,
-	mountpoint string, ref int32) (d *daemon.Daemon, err error) {
+	mountpoint string, ref int32, extraOpts ...daemon.NewDaemonOpt) (d *daemon.Daemon, err error) {
 	opts := []daemon.NewDaemonOpt{
 		daemon.WithRef(ref),
 		daemon.WithSocketDir(config.GetSocketRoot()),
@@ -622,6 +788,7 @@ func (fs *Filesystem) createDaemon(fsManager *manager.Manager, daemonMode config
 		daemon.WithLogRotationSize(config.GetDaemonLogRotationSize()),
 		daemon.WithLogToStdout(config.GetLogToStdout()),
 		daemon.WithNydusdThreadNum(config.GetDaemonThreadsNumber()),
+		daemon.WithIOEngine(fsManager.IOEngine()),
 		daemon.WithFsDriver(fsManager.FsDriver),
 		daemon.WithDaemonMode(daemonMode),
 	}
@@ -630,6 +797,7 @@ func (fs *Filesystem) createDaemon(fsManager *manager.Manager, daemonMode config
 	if mountpoint != "" {
 		opts = append(opts, daemon.WithMountpoint(mountpoint))
 	}
+	opts = append(opts, extraOpts...)
 
 	d, err = daemon.NewDaemon(opts...)
 	if err != nil {
@@ -0,0 +1,38 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+func TestDigestValidate(t *testing.T) {
+	fs := &Filesystem{}
+
+	validate, err := fs.digestValidate("true")
+	require.NoError(t, err)
+	require.True(t, validate)
+
+	validate, err = fs.digestValidate("false")
+	require.NoError(t, err)
+	require.False(t, validate)
+
+	_, err = fs.digestValidate("maybe")
+	require.ErrorIs(t, err, errdefs.ErrInvalidArgument)
+
+	fs.enforceDigestValidate = true
+	validate, err = fs.digestValidate("true")
+	require.NoError(t, err)
+	require.True(t, validate)
+
+	_, err = fs.digestValidate("false")
+	require.ErrorIs(t, err, errdefs.ErrInvalidArgument)
+}
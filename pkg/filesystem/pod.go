@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/moby/sys/mountinfo"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/manager"
+)
+
+const podInstancePrefix = "pod-"
+
+type sandboxIDKey struct{}
+
+// WithSandboxID tells the pod sandbox of the container whose snapshot is being
+// mounted, the sandbox is known by containerd rather than snapshot labels.
+func WithSandboxID(ctx context.Context, sandboxID string) context.Context {
+	return context.WithValue(ctx, sandboxIDKey{}, sandboxID)
+}
+
+// Returns the sandbox whose pod daemon should serve the snapshot, or empty if
+// the snapshot is not served by a pod daemon.
+func podSandboxID(ctx context.Context, fsDriver string) string {
+	if fsDriver != config.FsDriverFusedev || config.GetDaemonMode() != config.DaemonModePod {
+		return ""
+	}
+	sandboxID, _ := ctx.Value(sandboxIDKey{}).(string)
+
+	return sandboxID
+}
+
+// PodInstanceID returns the ID of the RAFS instance serving the snapshot for the
+// sandbox. Snapshots are shared by images rather than pods, so each sandbox using
+// the snapshot has its own instance.
+func PodInstanceID(sandboxID, snapshotID string) string {
+	if sandboxID == "" {
+		return snapshotID
+	}
+	return podInstancePrefix + sandboxID + "-" + snapshotID
+}
+
+// List overlay mounts to find out whether RAFS instances are still in use.
+var listOverlayMounts = func() ([]*mountinfo.Info, error) {
+	return mountinfo.GetMounts(mountinfo.FSTypeFilter("overlay"))
+}
+
+// Get the nydusd serving the sandbox, start one if the sandbox has none yet.
+// Sandboxes start their daemons independently.
+func (fs *Filesystem) getPodDaemon(fsManager *manager.Manager, sandboxID string) (*daemon.Daemon, error) {
+	d, err, _ := fs.podDaemons.Do(sandboxID, func() (interface{}, error) {
+		return fs.startPodDaemon(fsManager, sandboxID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return d.(*daemon.Daemon), nil
+}
+
+func (fs *Filesystem) startPodDaemon(fsManager *manager.Manager, sandboxID string) (d *daemon.Daemon, err error) {
+	for _, existing := range fsManager.ListDaemons() {
+		if existing.IsPodDaemon() && existing.States.SandboxID == sandboxID {
+			return existing, nil
+		}
+	}
+
+	mp := path.Join(fs.rootMountpoint, "pods", sandboxID)
+	if err := os.MkdirAll(mp, 0755); err != nil {
+		return nil, errors.Wrapf(err, "create directory %s", mp)
+	}
+
+	d, err = fs.createDaemon(fsManager, config.DaemonModePod, mp, 0, daemon.WithSandboxID(sandboxID))
+	if err != nil {
+		return nil, errors.Wrapf(err, "create daemon for sandbox %s", sandboxID)
+	}
+
+	defer func() {
+		if err != nil {
+			if err := fsManager.DeleteDaemon(d); err != nil {
+				log.L.WithError(err).Errorf("Failed to delete daemon %s", d.ID())
+			}
+		}
+	}()
+
+	// The configuration file is reloaded when recovering the nydusd, while each
+	// RAFS instance is mounted with its own configuration.
+	d.Config = *fsManager.DaemonConfig
+	err = d.Config.DumpFile(d.ConfigFile(""))
+	if err != nil && !errors.Is(err, errdefs.ErrAlreadyExists) {
+		return nil, errors.Wrapf(err, "dump configuration file %s", d.ConfigFile(""))
+	}
+	fsManager.RecordConfig(d, "", manager.ConfigOpStart, d.Config)
+
+	if err := fsManager.StartDaemon(d); err != nil {
+		return nil, errors.Wrapf(err, "start daemon for sandbox %s", sandboxID)
+	}
+	if err := d.WaitUntilState(types.DaemonStateRunning); err != nil {
+		return nil, errors.Wrapf(err, "wait for daemon %s", d.ID())
+	}
+	if err := d.ExposeMount(); err != nil {
+		return nil, err
+	}
+
+	log.L.Infof("Started daemon %s for sandbox %s", d.ID(), sandboxID)
+
+	return d, nil
+}
+
+// ReapPodDaemons umounts RAFS instances of the pod daemons whose sandboxes are gone,
+// the daemons are destroyed along with their last instances. Instances still used by
+// overlay mounts, e.g. of containers not cleaned up yet, are kept.
+func (fs *Filesystem) ReapPodDaemons(ctx context.Context, sandboxes map[string]bool) error {
+	fsManager, ok := fs.enabledManagers[config.FsDriverFusedev]
+	if !ok {
+		return nil
+	}
+
+	mounts, err := listOverlayMounts()
+	if err != nil {
+		return errors.Wrap(err, "list overlay mounts")
+	}
+
+	for _, d := range fsManager.ListDaemons() {
+		if !d.IsPodDaemon() || sandboxes[d.States.SandboxID] {
+			continue
+		}
+
+		for _, r := range d.RafsCache.List() {
+			if instanceInUse(mounts, r.GetMountpoint()) {
+				log.L.Debugf("Instance %s of gone sandbox %s is still in use", r.SnapshotID, d.States.SandboxID)
+				continue
+			}
+			log.L.Infof("Umount instance %s of gone sandbox %s", r.SnapshotID, d.States.SandboxID)
+			if err := fs.Umount(ctx, r.SnapshotID); err != nil {
+				log.L.WithError(err).Warnf("Failed to umount instance %s", r.SnapshotID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RunPodDaemonReaper reaps pod daemons periodically, `sandboxes` returns IDs of
+// the sandboxes known by containerd.
+func (fs *Filesystem) RunPodDaemonReaper(ctx context.Context, interval time.Duration,
+	sandboxes func(ctx context.Context) (map[string]bool, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ids, err := sandboxes(ctx)
+			if err != nil {
+				log.L.WithError(err).Warn("Failed to list sandboxes")
+				continue
+			}
+			if err := fs.ReapPodDaemons(ctx, ids); err != nil {
+				log.L.WithError(err).Warn("Failed to reap pod daemons")
+			}
+		}
+	}
+}
+
+func instanceInUse(mounts []*mountinfo.Info, mountpoint string) bool {
+	for _, m := range mounts {
+		for _, opt := range strings.Split(m.VFSOptions, ",") {
+			k, v, ok := strings.Cut(opt, "=")
+			if !ok || k != "lowerdir" {
+				continue
+			}
+			for _, dir := range strings.Split(v, ":") {
+				if dir == mountpoint || strings.HasPrefix(dir, mountpoint+"/") {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
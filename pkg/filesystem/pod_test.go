@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moby/sys/mountinfo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func TestInstanceInUse(t *testing.T) {
+	mounts := []*mountinfo.Info{
+		{FSType: "overlay", VFSOptions: "rw,lowerdir=/mnt/pods/p1/10:/snapshots/9/fs,upperdir=/snapshots/11/fs,workdir=/snapshots/11/work"},
+		{FSType: "overlay", VFSOptions: "rw,lowerdir=/mnt/pods/p2/20/rootfs,upperdir=/snapshots/21/fs"},
+	}
+
+	assert.True(t, instanceInUse(mounts, "/mnt/pods/p1/10"))
+	assert.True(t, instanceInUse(mounts, "/mnt/pods/p2/20"))
+	assert.False(t, instanceInUse(mounts, "/mnt/pods/p1/1"))
+	assert.False(t, instanceInUse(mounts, "/snapshots/11/fs"))
+	assert.False(t, instanceInUse(nil, "/mnt/pods/p1/10"))
+}
+
+func TestPodSandboxID(t *testing.T) {
+	var cfg config.SnapshotterConfig
+	require.NoError(t, cfg.FillUpWithDefaults())
+	cfg.Root = t.TempDir()
+	cfg.DaemonMode = string(config.DaemonModePod)
+	require.NoError(t, config.ProcessConfigurations(&cfg))
+
+	ctx := WithSandboxID(context.Background(), "p1")
+	assert.Equal(t, "p1", podSandboxID(ctx, config.FsDriverFusedev))
+	assert.Empty(t, podSandboxID(ctx, config.FsDriverBlockdev))
+	assert.Empty(t, podSandboxID(context.Background(), config.FsDriverFusedev))
+
+	// Each sandbox has its own instance of the snapshot.
+	assert.Equal(t, "10", PodInstanceID("", "10"))
+	assert.NotEqual(t, PodInstanceID("p1", "10"), PodInstanceID("p2", "10"))
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/cache"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/parser"
+)
+
+// ParseCacheQuota parses a cache quota like `10Gi` into bytes.
+func ParseCacheQuota(value string) (int64, error) {
+	quota, err := parser.MemoryConfigToBytes(value, 0)
+	if err != nil || quota <= 0 {
+		return 0, errors.Wrapf(errdefs.ErrInvalidArgument, "invalid cache quota %q", value)
+	}
+	return quota, nil
+}
+
+// Call fn with the blob caches used by each RAFS instance served by FUSE, from
+// the cache metrics of nydusd.
+func (fs *Filesystem) walkInstanceBlobs(ctx context.Context, fn func(r *racache.Rafs, blobs []string)) {
+	fsManager, ok := fs.enabledManagers[config.FsDriverFusedev]
+	if !ok {
+		return
+	}
+
+	for _, d := range fsManager.ListDaemons() {
+		if d.State() != types.DaemonStateRunning && !d.Unverified() {
+			continue
+		}
+
+		for _, r := range d.RafsCache.List() {
+			var sid string
+			if d.IsSharedDaemon() {
+				sid = r.SnapshotID
+			}
+			m, err := d.GetCacheMetrics(sid)
+			if err != nil {
+				log.G(ctx).WithError(err).Warnf("Failed to get cache metrics of instance %s", r.SnapshotID)
+				continue
+			}
+
+			blobs := make([]string, 0, len(m.UnderlyingFiles))
+			for _, f := range m.UnderlyingFiles {
+				blobs = append(blobs, cache.BlobIDFromCacheFile(f))
+			}
+			fn(r, blobs)
+		}
+	}
+}
+
+// Blob caches used by the mounted RAFS instances, from the blobs recorded at
+// mounting and the ones their bootstraps refer to. Caches of these blobs are read
+// by nydusd without further checks and must not be evicted. Fails if the blobs
+// of any instance served by nydusd are unknown.
+func (fs *Filesystem) blobsInUse() (map[string]bool, error) {
+	inUse := map[string]bool{}
+	for _, r := range racache.RafsGlobalCache.List() {
+		// Tarfs layers are not cached by nydusd.
+		if r.GetFsDriver() == config.FsDriverBlockdev {
+			continue
+		}
+
+		blobs, known := imageBlobIDs(r)
+		bootstrap, err := r.BootstrapFile()
+		if err == nil {
+			var refs []string
+			if refs, err = cache.BootstrapBlobIDs(bootstrap); err == nil {
+				blobs, known = append(blobs, refs...), true
+			}
+		}
+		if !known {
+			return nil, errors.Wrapf(err, "find blobs of instance %s", r.SnapshotID)
+		}
+		for _, id := range blobs {
+			inUse[id] = true
+		}
+	}
+
+	return inUse, nil
+}
+
+// EnforceCacheQuota evicts blob caches of the images using more cache than their
+// quotas, the default one or the one set by label on the image. The quotas are only
+// enforced on caches of unmounted images: blobs in use by mounted instances are kept
+// so mounted images may exceed their quotas, and nothing is evicted if these blobs
+// can't be found out.
+func (fs *Filesystem) EnforceCacheQuota(ctx context.Context, images []cache.ImageCache) ([]cache.QuotaReport, error) {
+	if fs.cacheMgr == nil {
+		return nil, nil
+	}
+
+	inUse, err := fs.blobsInUse()
+	if err != nil {
+		return nil, errors.Wrap(err, "find blobs in use")
+	}
+	for i := range images {
+		if images[i].Quota <= 0 {
+			images[i].Quota = fs.cacheQuota
+		}
+	}
+
+	return fs.cacheMgr.EnforceQuota(ctx, images, inUse)
+}
+
+// RunCacheQuotaEnforcer enforces the cache quotas periodically, `images` returns
+// the images pulled, whether mounted or not, with the blobs they consist of.
+func (fs *Filesystem) RunCacheQuotaEnforcer(ctx context.Context, interval time.Duration,
+	images func(ctx context.Context) ([]cache.ImageCache, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			list, err := images(ctx)
+			if err != nil {
+				log.L.WithError(err).Warn("Failed to list images for cache quota")
+				continue
+			}
+			if _, err := fs.EnforceCacheQuota(ctx, list); err != nil {
+				log.L.WithError(err).Warn("Failed to enforce cache quota")
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+func TestParseCacheQuota(t *testing.T) {
+	quota, err := ParseCacheQuota("50Gi")
+	require.NoError(t, err)
+	require.Equal(t, int64(50<<30), quota)
+
+	quota, err = ParseCacheQuota("1048576")
+	require.NoError(t, err)
+	require.Equal(t, int64(1<<20), quota)
+
+	for _, v := range []string{"10%", "0", "abc", "10Xi"} {
+		_, err = ParseCacheQuota(v)
+		require.ErrorIs(t, err, errdefs.ErrInvalidArgument, v)
+	}
+}
+
+func TestBlobsInUse(t *testing.T) {
+	var cfg config.SnapshotterConfig
+	require.NoError(t, cfg.FillUpWithDefaults())
+	cfg.Root = t.TempDir()
+	require.NoError(t, config.ProcessConfigurations(&cfg))
+
+	fs := &Filesystem{}
+	r, err := racache.NewRafs("quota-1", "image", config.FsDriverFusedev)
+	require.NoError(t, err)
+	defer racache.RafsGlobalCache.Remove(r.SnapshotID)
+	r.AddAnnotation(label.NydusImageBlobIDs, "b1,b2")
+
+	inUse, err := fs.blobsInUse()
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"b1": true, "b2": true}, inUse)
+
+	// Nothing can be evicted if blobs of any instance are unknown.
+	unknown, err := racache.NewRafs("quota-2", "image", config.FsDriverFusedev)
+	require.NoError(t, err)
+	defer racache.RafsGlobalCache.Remove(unknown.SnapshotID)
+	_, err = fs.blobsInUse()
+	require.Error(t, err)
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+// Read-ahead windows of workload classes, adjustable at runtime.
+type readAheadClasses struct {
+	mu           sync.RWMutex
+	defaultClass string
+	windows      map[string]config.ReadAheadWindow
+}
+
+func validateReadAheadWindow(class string, w config.ReadAheadWindow) error {
+	if class == "" {
+		return errors.Wrap(errdefs.ErrInvalidArgument, "empty workload class")
+	}
+	if w.AmplifyIO < 0 || w.MergingSize < 0 {
+		return errors.Wrapf(errdefs.ErrInvalidArgument, "negative read-ahead window of workload class %s", class)
+	}
+	return nil
+}
+
+// ReadAheadWindows returns the read-ahead windows indexed by workload classes.
+func (fs *Filesystem) ReadAheadWindows() map[string]config.ReadAheadWindow {
+	fs.readAhead.mu.RLock()
+	defer fs.readAhead.mu.RUnlock()
+
+	windows := make(map[string]config.ReadAheadWindow, len(fs.readAhead.windows))
+	for class, w := range fs.readAhead.windows {
+		windows[class] = w
+	}
+	return windows
+}
+
+// SetReadAheadWindow adds or updates the read-ahead window of a workload class. It
+// takes effect on RAFS instances mounted afterwards, since nydusd can't change
+// the configuration of a mounted instance.
+func (fs *Filesystem) SetReadAheadWindow(class string, w config.ReadAheadWindow) error {
+	if err := validateReadAheadWindow(class, w); err != nil {
+		return err
+	}
+
+	fs.readAhead.mu.Lock()
+	defer fs.readAhead.mu.Unlock()
+	if fs.readAhead.windows == nil {
+		fs.readAhead.windows = make(map[string]config.ReadAheadWindow)
+	}
+	fs.readAhead.windows[class] = w
+
+	return nil
+}
+
+// Render the read-ahead window of the snapshot's workload class into the nydusd
+// configuration parameters.
+func (fs *Filesystem) readAheadParams(labels map[string]string, params map[string]string) error {
+	fs.readAhead.mu.RLock()
+	defer fs.readAhead.mu.RUnlock()
+
+	class, ok := labels[label.NydusWorkloadClass]
+	if !ok {
+		class = fs.readAhead.defaultClass
+	}
+	if class == "" {
+		return nil
+	}
+
+	w, ok := fs.readAhead.windows[class]
+	if !ok {
+		return errors.Wrapf(errdefs.ErrInvalidArgument, "unknown workload class %q", class)
+	}
+	params[daemonconfig.AmplifyIO] = strconv.Itoa(w.AmplifyIO)
+	params[daemonconfig.MergingSize] = strconv.Itoa(w.MergingSize)
+
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+func TestReadAheadParams(t *testing.T) {
+	var fs Filesystem
+	require.NoError(t, WithReadAhead(config.ReadAheadConfig{
+		DefaultClass: config.WorkloadClassWeb,
+		Classes: map[string]config.ReadAheadWindow{
+			config.WorkloadClassWeb:      {AmplifyIO: 1 << 20, MergingSize: 1 << 20},
+			config.WorkloadClassDatabase: {AmplifyIO: 128 << 10, MergingSize: 128 << 10},
+		},
+	})(&fs))
+
+	params := map[string]string{}
+	require.NoError(t, fs.readAheadParams(map[string]string{}, params))
+	require.Equal(t, "1048576", params[daemonconfig.AmplifyIO])
+
+	params = map[string]string{}
+	require.NoError(t, fs.readAheadParams(map[string]string{label.NydusWorkloadClass: config.WorkloadClassDatabase}, params))
+	require.Equal(t, "131072", params[daemonconfig.AmplifyIO])
+	require.Equal(t, "131072", params[daemonconfig.MergingSize])
+
+	err := fs.readAheadParams(map[string]string{label.NydusWorkloadClass: "unknown"}, map[string]string{})
+	require.ErrorIs(t, err, errdefs.ErrInvalidArgument)
+
+	// Adjusted at runtime
+	require.NoError(t, fs.SetReadAheadWindow("ml", config.ReadAheadWindow{AmplifyIO: 8 << 20}))
+	params = map[string]string{}
+	require.NoError(t, fs.readAheadParams(map[string]string{label.NydusWorkloadClass: "ml"}, params))
+	require.Equal(t, "8388608", params[daemonconfig.AmplifyIO])
+	require.Len(t, fs.ReadAheadWindows(), 3)
+
+	require.ErrorIs(t, fs.SetReadAheadWindow("ml", config.ReadAheadWindow{AmplifyIO: -1}), errdefs.ErrInvalidArgument)
+	require.ErrorIs(t, fs.SetReadAheadWindow("", config.ReadAheadWindow{}), errdefs.ErrInvalidArgument)
+}
+
+func TestReadAheadDefaultClass(t *testing.T) {
+	var fs Filesystem
+	err := WithReadAhead(config.ReadAheadConfig{DefaultClass: "unknown"})(&fs)
+	require.ErrorIs(t, err, errdefs.ErrInvalidArgument)
+
+	// The template is kept without any class.
+	require.NoError(t, WithReadAhead(config.ReadAheadConfig{})(&fs))
+	params := map[string]string{}
+	require.NoError(t, fs.readAheadParams(map[string]string{}, params))
+	require.Empty(t, params)
+}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/log"
+
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/events"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+const (
+	readyPollInterval = 200 * time.Millisecond
+	// Give up instances not read for this long, e.g. those of images pulled in
+	// advance rather than for starting containers.
+	readyWatchTimeout = 10 * time.Minute
+)
+
+type readyWatch struct {
+	rafs           *racache.Rafs
+	start, mounted time.Time
+}
+
+// Instances of a daemon waiting for their first reads, polled together by a
+// goroutine living as long as any instance is waiting.
+type readyWatcher struct {
+	daemon *daemon.Daemon
+	// Indexed by snapshot ID
+	pending map[string]*readyWatch
+}
+
+type prepareStartKey struct{}
+
+// WithPrepareStart tells when the snapshot being mounted was asked to prepare.
+func WithPrepareStart(ctx context.Context, start time.Time) context.Context {
+	return context.WithValue(ctx, prepareStartKey{}, start)
+}
+
+func prepareStart(ctx context.Context) time.Time {
+	if start, ok := ctx.Value(prepareStartKey{}).(time.Time); ok {
+		return start
+	}
+	return time.Now()
+}
+
+// Watch the file system metrics of a mounted RAFS instance until it serves the
+// first successful read, then publish the time taken since its snapshot was
+// prepared, split into the snapshotter and nydusd mounting the instance and
+// nydusd fetching data from the registry to serve the read.
+func (fs *Filesystem) watchFirstRead(d *daemon.Daemon, rafs *racache.Rafs, start, mounted time.Time) {
+	fs.readyMu.Lock()
+	defer fs.readyMu.Unlock()
+
+	if fs.readyWatchers == nil {
+		fs.readyWatchers = map[string]*readyWatcher{}
+	}
+	w, ok := fs.readyWatchers[d.ID()]
+	if !ok {
+		w = &readyWatcher{daemon: d, pending: map[string]*readyWatch{}}
+		fs.readyWatchers[d.ID()] = w
+		go fs.pollFirstReads(w)
+	}
+	w.pending[rafs.SnapshotID] = &readyWatch{rafs: rafs, start: start, mounted: mounted}
+}
+
+func (fs *Filesystem) pollFirstReads(w *readyWatcher) {
+	ticker := time.NewTicker(readyPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		fs.readyMu.Lock()
+		watches := make([]*readyWatch, 0, len(w.pending))
+		for _, rw := range w.pending {
+			watches = append(watches, rw)
+		}
+		fs.readyMu.Unlock()
+
+		var done []*readyWatch
+		for _, rw := range watches {
+			if pollFirstRead(w.daemon, rw) {
+				done = append(done, rw)
+			}
+		}
+
+		fs.readyMu.Lock()
+		for _, rw := range done {
+			// Not remounted meanwhile
+			if w.pending[rw.rafs.SnapshotID] == rw {
+				delete(w.pending, rw.rafs.SnapshotID)
+			}
+		}
+		if len(w.pending) == 0 {
+			delete(fs.readyWatchers, w.daemon.ID())
+			fs.readyMu.Unlock()
+			return
+		}
+		fs.readyMu.Unlock()
+	}
+}
+
+// Poll an instance for its first read, return true if no longer to poll it.
+func pollFirstRead(d *daemon.Daemon, rw *readyWatch) bool {
+	rafs := rw.rafs
+	// Umounted or remounted meanwhile
+	if racache.RafsGlobalCache.Get(rafs.SnapshotID) != rafs {
+		return true
+	}
+	if time.Since(rw.mounted) > readyWatchTimeout {
+		return true
+	}
+
+	var sid string
+	if d.IsSharedDaemon() {
+		sid = rafs.SnapshotID
+	}
+	m, err := d.GetFsMetrics(sid)
+	if err != nil {
+		log.L.WithError(err).Debugf("Failed to get file system metrics of instance %s", rafs.SnapshotID)
+		return false
+	}
+	if m.DataRead == 0 {
+		return false
+	}
+
+	// The read is served between the last two polls.
+	ready := time.Now()
+	collector.NewInstanceReadyCollector(rw.mounted.Sub(rw.start), ready.Sub(rw.mounted)).Collect()
+	events.Bus.PublishElapsed(events.InstanceReady, d.ID(), rafs.SnapshotID, ready.Sub(rw.start))
+	log.L.Debugf("Instance %s served the first read %s after prepared", rafs.SnapshotID, ready.Sub(rw.start))
+
+	return true
+}
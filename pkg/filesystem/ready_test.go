@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+	"github.com/containerd/nydus-snapshotter/pkg/events"
+	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+func TestWatchFirstRead(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	var polls atomic.Int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") != "/10" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		m := types.FsMetrics{}
+		// Read after polled twice
+		if polls.Add(1) > 2 {
+			m.DataRead = 4096
+		}
+		_ = json.NewEncoder(w).Encode(&m)
+	}))
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	d := &daemon.Daemon{States: daemon.ConfigState{ID: "d1", APISocket: sock, DaemonMode: config.DaemonModeShared}}
+	rafs, err := racache.NewRafs("10", "image", config.FsDriverFusedev, racache.WithSnapshotDir(t.TempDir()))
+	require.NoError(t, err)
+	defer racache.RafsGlobalCache.Remove("10")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := events.Bus.Subscribe(ctx)
+
+	start := time.Now()
+	ctx = WithPrepareStart(ctx, start.Add(-time.Second))
+	var fs Filesystem
+	fs.watchFirstRead(d, rafs, prepareStart(ctx), start)
+
+	var ev events.Event
+	select {
+	case ev = <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatal("instance is not ready")
+	}
+	require.Equal(t, events.InstanceReady, ev.Type)
+	require.Equal(t, "10", ev.SnapshotID)
+	require.GreaterOrEqual(t, ev.Elapsed, time.Second)
+	require.Equal(t, int32(3), polls.Load())
+
+	// The poller of the daemon exits with no instance waiting.
+	require.Eventually(t, func() bool {
+		fs.readyMu.Lock()
+		defer fs.readyMu.Unlock()
+		return len(fs.readyWatchers) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
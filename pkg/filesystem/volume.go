@@ -0,0 +1,467 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/containerd/log"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
+	"github.com/containerd/nydus-snapshotter/pkg/remote"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/mount"
+)
+
+const (
+	// RAFS instances backing image volumes share the instance namespace with
+	// snapshots, the prefix keeps them apart from snapshot IDs.
+	volumeInstancePrefix = "volume-"
+	bootstrapNameInLayer = "image/image.boot"
+)
+
+var volumeIDRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,127}$`)
+
+// Volume is a nydus image mounted read-only outside of any container rootfs,
+// e.g. models or datasets requested by a CSI driver or a device plugin.
+// It is backed by a RAFS instance whose lifecycle is independent of containerd
+// snapshots. Each host path the volume is published to holds a reference, the
+// RAFS instance is umounted once the last reference is dropped.
+type Volume struct {
+	ID         string   `json:"id"`
+	ImageRef   string   `json:"image_ref"`
+	DaemonID   string   `json:"daemon_id"`
+	FsDriver   string   `json:"fs_driver"`
+	Mountpoint string   `json:"mountpoint"`
+	Targets    []string `json:"targets"`
+	Reference  int      `json:"reference"`
+}
+
+func volumeInstanceID(id string) string {
+	return volumeInstancePrefix + id
+}
+
+func newVolume(r *racache.Rafs) *Volume {
+	targets := volumeTargets(r)
+	return &Volume{
+		ID:         r.Annotations[label.NydusVolume],
+		ImageRef:   r.ImageID,
+		DaemonID:   r.DaemonID,
+		FsDriver:   r.GetFsDriver(),
+		Mountpoint: r.GetMountpoint(),
+		Targets:    targets,
+		Reference:  len(targets),
+	}
+}
+
+func volumeTargets(r *racache.Rafs) []string {
+	targets := []string{}
+	if v, ok := r.Annotations[label.NydusVolumeTargets]; ok {
+		if err := json.Unmarshal([]byte(v), &targets); err != nil {
+			log.L.WithError(err).Warnf("invalid targets of volume instance %s", r.SnapshotID)
+		}
+	}
+	return targets
+}
+
+// MountVolume mounts image `imageRef` as volume `id` and publishes it to host path `target`
+// read-only. Mounting an existing volume to another target only adds a reference to it.
+func (fs *Filesystem) MountVolume(ctx context.Context, id, imageRef, target string, labels map[string]string) (v *Volume, err error) {
+	if !volumeIDRegexp.MatchString(id) {
+		return nil, errors.Wrapf(errdefs.ErrInvalidArgument, "invalid volume id %q", id)
+	}
+	if imageRef == "" {
+		return nil, errors.Wrapf(errdefs.ErrInvalidArgument, "no image reference for volume %s", id)
+	}
+	target, err = resolveVolumeTarget(config.GetVolumeTargetRoot(), target)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.volumeMu.Lock()
+	defer fs.volumeMu.Unlock()
+
+	defer func() {
+		if err != nil {
+			collector.NewVolumeEventCollector(collector.VolumeEventFailure).Collect()
+		}
+		fs.collectVolumeMetrics()
+	}()
+
+	rafs := racache.RafsGlobalCache.Get(volumeInstanceID(id))
+	if rafs == nil {
+		rafs, err = fs.mountVolumeInstance(ctx, id, imageRef, labels)
+		if err != nil {
+			return nil, errors.Wrapf(err, "mount volume %s", id)
+		}
+		collector.NewVolumeEventCollector(collector.VolumeEventMount).Collect()
+	} else if rafs.ImageID != imageRef {
+		return nil, errors.Wrapf(errdefs.ErrAlreadyExists, "volume %s is backed by image %s", id, rafs.ImageID)
+	}
+
+	targets := volumeTargets(rafs)
+	if slices.Contains(targets, target) {
+		return newVolume(rafs), nil
+	}
+
+	if err := publishVolume(rafs.GetMountpoint(), target); err != nil {
+		if len(targets) == 0 {
+			if err := fs.umountVolumeInstance(ctx, rafs); err != nil {
+				log.L.WithError(err).Warnf("umount unpublished volume %s", id)
+			}
+		}
+		return nil, errors.Wrapf(err, "publish volume %s", id)
+	}
+
+	if err := fs.updateVolumeTargets(rafs, append(targets, target)); err != nil {
+		if err := unpublishVolume(target); err != nil {
+			log.L.WithError(err).Warnf("unpublish volume %s from %s", id, target)
+		}
+		return nil, err
+	}
+	collector.NewVolumeEventCollector(collector.VolumeEventPublish).Collect()
+
+	log.L.Infof("Published volume %s of image %s to %s", id, imageRef, target)
+
+	return newVolume(rafs), nil
+}
+
+// UmountVolume unpublishes volume `id` from host path `target`, or from all of its targets
+// if `target` is empty. The volume is umounted when no target is left.
+func (fs *Filesystem) UmountVolume(ctx context.Context, id, target string) (err error) {
+	fs.volumeMu.Lock()
+	defer fs.volumeMu.Unlock()
+
+	defer func() {
+		if err != nil {
+			collector.NewVolumeEventCollector(collector.VolumeEventFailure).Collect()
+		}
+		fs.collectVolumeMetrics()
+	}()
+
+	rafs := racache.RafsGlobalCache.Get(volumeInstanceID(id))
+	if rafs == nil || !label.IsNydusVolume(rafs.Annotations) {
+		return errors.Wrapf(errdefs.ErrNotFound, "volume %s", id)
+	}
+
+	if target != "" {
+		// Targets are recorded resolved.
+		if resolved, err := resolveVolumeTarget(config.GetVolumeTargetRoot(), target); err == nil {
+			target = resolved
+		} else {
+			target = filepath.Clean(target)
+		}
+	}
+
+	targets := volumeTargets(rafs)
+	remaining := make([]string, 0, len(targets))
+	for idx, t := range targets {
+		if target != "" && t != target {
+			remaining = append(remaining, t)
+			continue
+		}
+		if err := unpublishVolume(t); err != nil {
+			// Keep the targets which are still published.
+			remaining = append(remaining, targets[idx:]...)
+			if err := fs.updateVolumeTargets(rafs, remaining); err != nil {
+				log.L.WithError(err).Warnf("update targets of volume %s", id)
+			}
+			return errors.Wrapf(err, "unpublish volume %s", id)
+		}
+		collector.NewVolumeEventCollector(collector.VolumeEventUnpublish).Collect()
+		log.L.Infof("Unpublished volume %s from %s", id, t)
+	}
+
+	if target != "" && len(remaining) == len(targets) {
+		return errors.Wrapf(errdefs.ErrNotFound, "volume %s is not published to %s", id, target)
+	}
+
+	if len(remaining) > 0 {
+		return fs.updateVolumeTargets(rafs, remaining)
+	}
+
+	if err := fs.umountVolumeInstance(ctx, rafs); err != nil {
+		return errors.Wrapf(err, "umount volume %s", id)
+	}
+	collector.NewVolumeEventCollector(collector.VolumeEventUmount).Collect()
+
+	return nil
+}
+
+func (fs *Filesystem) GetVolume(id string) (*Volume, error) {
+	rafs := racache.RafsGlobalCache.Get(volumeInstanceID(id))
+	if rafs == nil || !label.IsNydusVolume(rafs.Annotations) {
+		return nil, errors.Wrapf(errdefs.ErrNotFound, "volume %s", id)
+	}
+	return newVolume(rafs), nil
+}
+
+func (fs *Filesystem) ListVolumes() []*Volume {
+	volumes := []*Volume{}
+	for _, r := range racache.RafsGlobalCache.List() {
+		if label.IsNydusVolume(r.Annotations) {
+			volumes = append(volumes, newVolume(r))
+		}
+	}
+	slices.SortFunc(volumes, func(a, b *Volume) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return volumes
+}
+
+// Publish the volumes again if their targets were lost, e.g. the nydusd daemon serving
+// them was restarted and remounted the RAFS instances.
+func (fs *Filesystem) recoverVolumes() {
+	for _, v := range fs.ListVolumes() {
+		for _, t := range v.Targets {
+			if mounted, err := mount.IsMountpoint(t); err == nil && mounted {
+				continue
+			}
+			// The target might still hold a stale mount of an aborted FUSE connection.
+			_ = unix.Unmount(t, unix.MNT_DETACH)
+			if err := publishVolume(v.Mountpoint, t); err != nil {
+				log.L.WithError(err).Errorf("republish volume %s to %s", v.ID, t)
+			}
+		}
+	}
+	fs.collectVolumeMetrics()
+}
+
+func (fs *Filesystem) collectVolumeMetrics() {
+	volumes := fs.ListVolumes()
+	targets := 0
+	for _, v := range volumes {
+		targets += len(v.Targets)
+	}
+	(&collector.VolumeCountCollector{Volumes: len(volumes), Targets: targets}).Collect()
+}
+
+func (fs *Filesystem) mountVolumeInstance(ctx context.Context, id, imageRef string, labels map[string]string) (rafs *racache.Rafs, err error) {
+	fsDriver := config.GetFsDriver()
+	if fsDriver != config.FsDriverFscache && fsDriver != config.FsDriverFusedev {
+		return nil, errors.Wrapf(errdefs.ErrNotImplemented, "image volume with filesystem driver %s", fsDriver)
+	}
+	useSharedDaemon := fsDriver == config.FsDriverFscache || config.GetDaemonMode() == config.DaemonModeShared
+
+	fsManager, err := fs.getManager(fsDriver)
+	if err != nil {
+		return nil, err
+	}
+
+	instanceID := volumeInstanceID(id)
+	volumeDir := filepath.Join(config.GetVolumesRootDir(), id)
+	rafs, err = racache.NewRafs(instanceID, imageRef, fsDriver, racache.WithSnapshotDir(volumeDir))
+	if err != nil {
+		return nil, errors.Wrapf(err, "create rafs instance %s", instanceID)
+	}
+	rafs.AddAnnotation(label.NydusVolume, id)
+
+	defer func() {
+		if err != nil {
+			if err := fs.Umount(ctx, instanceID); err != nil {
+				log.L.WithError(err).Warnf("umount volume instance %s", instanceID)
+			}
+			racache.RafsGlobalCache.Remove(instanceID)
+			if err := os.RemoveAll(volumeDir); err != nil {
+				log.L.WithError(err).Warnf("remove volume directory %s", volumeDir)
+			}
+		}
+	}()
+
+	bootstrap := filepath.Join(rafs.FscacheWorkDir(), bootstrapNameInLayer)
+	if err = fetchBootstrap(ctx, imageRef, labels, bootstrap); err != nil {
+		return nil, errors.Wrapf(err, "fetch bootstrap of image %s", imageRef)
+	}
+
+	d, err := fs.attachDaemon(fsManager, useSharedDaemon, "", rafs, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = fs.mountRemote(fsManager, useSharedDaemon, d, rafs); err != nil {
+		return nil, errors.Wrapf(err, "mount file system by daemon %s, volume %s", d.ID(), id)
+	}
+
+	if err = fsManager.AddRafsInstance(rafs); err != nil {
+		return nil, errors.Wrapf(err, "create instance %s", instanceID)
+	}
+
+	return rafs, nil
+}
+
+func (fs *Filesystem) umountVolumeInstance(ctx context.Context, rafs *racache.Rafs) error {
+	if err := fs.Umount(ctx, rafs.SnapshotID); err != nil {
+		return err
+	}
+	racache.RafsGlobalCache.Remove(rafs.SnapshotID)
+
+	return os.RemoveAll(rafs.GetSnapshotDir())
+}
+
+func (fs *Filesystem) updateVolumeTargets(rafs *racache.Rafs, targets []string) error {
+	fsManager, err := fs.getManager(rafs.GetFsDriver())
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(targets)
+	if err != nil {
+		return errors.Wrap(err, "marshal volume targets")
+	}
+	rafs.AddAnnotation(label.NydusVolumeTargets, string(encoded))
+
+	if err := fsManager.UpdateRafsInstance(rafs); err != nil {
+		return errors.Wrapf(err, "update instance %s", rafs.SnapshotID)
+	}
+
+	return nil
+}
+
+// Check the volume target is a path under the target root even after following symlinks,
+// returns the target with symlinks resolved. The target doesn't have to exist yet.
+func resolveVolumeTarget(root, target string) (string, error) {
+	if root == "" {
+		return "", errors.Wrap(errdefs.ErrInvalidArgument, "no volume target root is configured")
+	}
+	if !filepath.IsAbs(target) {
+		return "", errors.Wrapf(errdefs.ErrInvalidArgument, "volume target %q is not an absolute path", target)
+	}
+	if slices.Contains(strings.Split(target, string(filepath.Separator)), "..") {
+		return "", errors.Wrapf(errdefs.ErrInvalidArgument, "volume target %q contains \"..\"", target)
+	}
+
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", errors.Wrap(err, "resolve volume target root")
+	}
+
+	// Resolve the longest existing prefix of the target, the rest is created by publishing.
+	existing, rest := filepath.Clean(target), ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			target = filepath.Join(resolved, rest)
+			break
+		}
+		if !os.IsNotExist(err) || existing == "/" {
+			return "", errors.Wrapf(err, "resolve volume target %s", target)
+		}
+		existing, rest = filepath.Dir(existing), filepath.Join(filepath.Base(existing), rest)
+	}
+
+	if rel, err := filepath.Rel(root, target); err != nil || rel == "." || rel == ".." ||
+		strings.HasPrefix(rel, "../") {
+		return "", errors.Wrapf(errdefs.ErrInvalidArgument, "volume target %s is not under %s", target, root)
+	}
+
+	return target, nil
+}
+
+// Bind mount the volume to the target and make the bind mount read-only, which only
+// takes effect by remounting.
+func publishVolume(source, target string) error {
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return errors.Wrapf(err, "create volume target %s", target)
+	}
+	// A symlink replacing a directory while creating the target redirects the mount.
+	if resolved, err := filepath.EvalSymlinks(target); err != nil || resolved != target {
+		return errors.Wrapf(errdefs.ErrInvalidArgument, "volume target %s is redirected by symlink", target)
+	}
+	if err := unix.Mount(source, target, "", unix.MS_BIND, ""); err != nil {
+		return errors.Wrapf(err, "bind mount %s to %s", source, target)
+	}
+	if err := unix.Mount("", target, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+		_ = unix.Unmount(target, unix.MNT_DETACH)
+		return errors.Wrapf(err, "remount %s read-only", target)
+	}
+	return nil
+}
+
+func unpublishVolume(target string) error {
+	if err := unix.Unmount(target, 0); err != nil {
+		// Not mounted or already removed
+		if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOENT) {
+			return nil
+		}
+		return errors.Wrapf(err, "umount %s", target)
+	}
+	return nil
+}
+
+// fetchBootstrap resolves the image manifest matching the host platform and unpacks
+// the bootstrap from the nydus metadata layer to the specified path.
+func fetchBootstrap(ctx context.Context, ref string, labels map[string]string, bootstrap string) error {
+	keyChain, err := auth.GetKeyChainByRef(ref, labels)
+	if err != nil {
+		return errors.Wrap(err, "get key chain")
+	}
+	r := remote.New(keyChain, config.GetSkipSSLVerify())
+
+	handle := func() error {
+		resolver := r.Resolve(ctx, ref)
+		name, desc, err := resolver.Resolve(ctx, ref)
+		if err != nil {
+			return errors.Wrapf(err, "resolve reference %s", ref)
+		}
+		fetcher, err := resolver.Fetcher(ctx, name)
+		if err != nil {
+			return errors.Wrap(err, "get fetcher")
+		}
+
+		manifest, err := remote.FetchManifest(ctx, fetcher, desc)
+		if err != nil {
+			return err
+		}
+
+		var metaLayer *ocispec.Descriptor
+		for idx := len(manifest.Layers) - 1; idx >= 0; idx-- {
+			if label.IsNydusMetaLayer(manifest.Layers[idx].Annotations) {
+				metaLayer = &manifest.Layers[idx]
+				break
+			}
+		}
+		if metaLayer == nil {
+			return errors.Wrapf(errdefs.ErrNotFound, "no nydus metadata layer in image %s", ref)
+		}
+
+		rc, err := fetcher.Fetch(ctx, *metaLayer)
+		if err != nil {
+			return errors.Wrap(err, "fetch nydus metadata")
+		}
+		defer rc.Close()
+
+		if err := os.MkdirAll(filepath.Dir(bootstrap), 0755); err != nil {
+			return errors.Wrapf(err, "create directory for %s", bootstrap)
+		}
+		if err := remote.Unpack(rc, bootstrapNameInLayer, bootstrap); err != nil {
+			os.Remove(bootstrap)
+			return errors.Wrap(err, "unpack bootstrap from layer")
+		}
+
+		return nil
+	}
+
+	err = handle()
+	if err != nil && r.RetryWithPlainHTTP(ref, err) {
+		return handle()
+	}
+
+	return err
+}
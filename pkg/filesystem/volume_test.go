@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	racache "github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+func TestVolumeID(t *testing.T) {
+	assert.True(t, volumeIDRegexp.MatchString("dataset-1"))
+	assert.True(t, volumeIDRegexp.MatchString("pvc-0f8a.model_v2"))
+	assert.False(t, volumeIDRegexp.MatchString(""))
+	assert.False(t, volumeIDRegexp.MatchString("../escape"))
+	assert.False(t, volumeIDRegexp.MatchString("a/b"))
+	assert.Equal(t, "volume-dataset-1", volumeInstanceID("dataset-1"))
+}
+
+func TestNewVolume(t *testing.T) {
+	r := &racache.Rafs{
+		ImageID:     "docker.io/library/dataset:nydus",
+		DaemonID:    "d1",
+		FsDriver:    "fusedev",
+		SnapshotID:  volumeInstanceID("dataset-1"),
+		Mountpoint:  "/var/lib/nydus/mnt/volume-dataset-1",
+		Annotations: map[string]string{label.NydusVolume: "dataset-1"},
+	}
+
+	v := newVolume(r)
+	assert.Equal(t, "dataset-1", v.ID)
+	assert.Equal(t, 0, v.Reference)
+	assert.Equal(t, []string{}, v.Targets)
+
+	r.Annotations[label.NydusVolumeTargets] = `["/pods/a/volume","/pods/b/volume"]`
+	v = newVolume(r)
+	assert.Equal(t, 2, v.Reference)
+	assert.Equal(t, []string{"/pods/a/volume", "/pods/b/volume"}, v.Targets)
+	assert.Equal(t, "/var/lib/nydus/mnt/volume-dataset-1", v.Mountpoint)
+}
+
+func TestResolveVolumeTarget(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "pods", "a"), 0755))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "pods", "escape")))
+	require.NoError(t, os.Symlink(filepath.Join(root, "pods", "a"), filepath.Join(root, "pods", "alias")))
+
+	target, err := resolveVolumeTarget(root, filepath.Join(root, "pods", "a", "volume"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "pods", "a", "volume"), target)
+
+	target, err = resolveVolumeTarget(root, filepath.Join(root, "pods", "alias", "new", "volume"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "pods", "a", "new", "volume"), target)
+
+	for _, target := range []string{
+		"",
+		"pods/a/volume",
+		root,
+		outside,
+		"/etc",
+		filepath.Join(root, "pods", "..", "..", "etc"),
+		filepath.Join(root, "pods", "escape", "volume"),
+		root + "/pods/../pods/a/volume",
+	} {
+		_, err := resolveVolumeTarget(root, target)
+		assert.Error(t, err, target)
+	}
+
+	_, err = resolveVolumeTarget("", filepath.Join(root, "pods", "a"))
+	assert.Error(t, err)
+}
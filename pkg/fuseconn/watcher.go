@@ -0,0 +1,265 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package fuseconn watches the FUSE connections of nydusd mounts through the
+// fusectl filesystem, to find connections aborted, where every access fails with
+// "transport endpoint is not connected", or congested by requests nydusd doesn't
+// handle in time.
+package fuseconn
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/moby/sys/mountinfo"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/nydus-snapshotter/pkg/events"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+)
+
+const (
+	StateOK        = "ok"
+	StateCongested = "congested"
+	StateAborted   = "aborted"
+)
+
+// Where the fusectl filesystem is mounted, connections are named by the device
+// minors of their mounts.
+const connectionsDir = "/sys/fs/fuse/connections"
+
+// Accessing a mountpoint hangs if nydusd doesn't reply, the connection is
+// considered congested then.
+const probeTimeout = 5 * time.Second
+
+// Target is a FUSE mount of a daemon.
+type Target struct {
+	DaemonID   string
+	Mountpoint string
+	// IDs of the snapshots whose RAFS instances are served through the mount
+	Instances []string
+}
+
+// Connection is the state of the FUSE connection of a mount.
+type Connection struct {
+	ID         uint32   `json:"id"`
+	DaemonID   string   `json:"daemon_id"`
+	Mountpoint string   `json:"mountpoint"`
+	Instances  []string `json:"instances"`
+	State      string   `json:"state"`
+	// Requests waiting for replies of nydusd
+	Waiting int `json:"waiting"`
+}
+
+type Opt struct {
+	Interval time.Duration
+	// Returns the FUSE mounts to watch.
+	Targets func() []Target
+	// Called when the connection of a daemon gets aborted.
+	OnAborted func(ctx context.Context, daemonID string)
+}
+
+type Watcher struct {
+	opt Opt
+
+	mu sync.Mutex
+	// Connection states indexed by mountpoints
+	states map[string]string
+	// Mountpoints being accessed, which may hang
+	probing map[string]bool
+}
+
+// Device minor of the FUSE mount at the mountpoint, which names its connection.
+var lookupConnection = func(mountpoint string) (uint32, bool, error) {
+	mounts, err := mountinfo.GetMounts(mountinfo.SingleEntryFilter(mountpoint))
+	if err != nil {
+		return 0, false, err
+	}
+	if len(mounts) == 0 {
+		return 0, false, nil
+	}
+	return uint32(mounts[0].Minor), true, nil
+}
+
+func readInt(p string) (int, error) {
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+// Requests waiting for replies and the congestion threshold of a connection.
+var readConnection = func(id uint32) (int, int, error) {
+	dir := filepath.Join(connectionsDir, strconv.FormatUint(uint64(id), 10))
+	waiting, err := readInt(filepath.Join(dir, "waiting"))
+	if err != nil {
+		return 0, 0, err
+	}
+	threshold, err := readInt(filepath.Join(dir, "congestion_threshold"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return waiting, threshold, nil
+}
+
+// Access the mountpoint through the FUSE connection. Unlike stat, which may be
+// answered by cached attributes, statfs always sends a request to nydusd.
+var probeMountpoint = func(mountpoint string) error {
+	var st unix.Statfs_t
+	return unix.Statfs(mountpoint, &st)
+}
+
+func NewWatcher(opt Opt) *Watcher {
+	return &Watcher{
+		opt:     opt,
+		states:  make(map[string]string),
+		probing: make(map[string]bool),
+	}
+}
+
+// Access the mountpoint in the background, at most one access to a mountpoint is
+// in flight in case it hangs. Returns whether the access completes in time.
+func (w *Watcher) probe(mountpoint string) (bool, error) {
+	w.mu.Lock()
+	if w.probing[mountpoint] {
+		w.mu.Unlock()
+		return false, nil
+	}
+	w.probing[mountpoint] = true
+	w.mu.Unlock()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- probeMountpoint(mountpoint)
+		w.mu.Lock()
+		delete(w.probing, mountpoint)
+		w.mu.Unlock()
+	}()
+
+	select {
+	case err := <-errCh:
+		return true, err
+	case <-time.After(probeTimeout):
+		return false, nil
+	}
+}
+
+func (w *Watcher) check(t Target) (*Connection, error) {
+	id, mounted, err := lookupConnection(t.Mountpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "look up mount %s", t.Mountpoint)
+	}
+	if !mounted {
+		// Missing mounts are found by the mount checker.
+		return nil, nil
+	}
+
+	conn := &Connection{ID: id, DaemonID: t.DaemonID, Mountpoint: t.Mountpoint, Instances: t.Instances, State: StateOK}
+	threshold := 0
+	if conn.Waiting, threshold, err = readConnection(id); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "read FUSE connection %d", id)
+	}
+
+	done, err := w.probe(t.Mountpoint)
+	switch {
+	case errors.Is(err, unix.ENOTCONN):
+		conn.State = StateAborted
+	case !done || (threshold > 0 && conn.Waiting >= threshold):
+		conn.State = StateCongested
+	}
+
+	return conn, nil
+}
+
+// Check the FUSE connections of the mounts and report the state changes.
+func (w *Watcher) Check(ctx context.Context) []Connection {
+	conns := []Connection{}
+	seen := make(map[string]bool)
+	for _, t := range w.opt.Targets() {
+		conn, err := w.check(t)
+		if err != nil {
+			log.G(ctx).WithError(err).Warnf("Failed to check FUSE connection of daemon %s", t.DaemonID)
+			continue
+		}
+		if conn == nil {
+			continue
+		}
+		seen[conn.Mountpoint] = true
+		conns = append(conns, *conn)
+		w.update(ctx, conn)
+	}
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Mountpoint < conns[j].Mountpoint
+	})
+
+	w.mu.Lock()
+	for mountpoint := range w.states {
+		if !seen[mountpoint] {
+			delete(w.states, mountpoint)
+		}
+	}
+	w.mu.Unlock()
+
+	states := make([]collector.FuseConnectionState, 0, len(conns))
+	for _, conn := range conns {
+		states = append(states, collector.FuseConnectionState{DaemonID: conn.DaemonID, State: conn.State, Waiting: conn.Waiting})
+	}
+	collector.NewFuseConnectionCollector(states).Collect()
+
+	return conns
+}
+
+func (w *Watcher) update(ctx context.Context, conn *Connection) {
+	w.mu.Lock()
+	prev, ok := w.states[conn.Mountpoint]
+	w.states[conn.Mountpoint] = conn.State
+	w.mu.Unlock()
+
+	if prev == conn.State || (!ok && conn.State == StateOK) {
+		return
+	}
+
+	logger := log.G(ctx).WithField("daemon", conn.DaemonID).WithField("mountpoint", conn.Mountpoint).
+		WithField("connection", conn.ID).WithField("instances", conn.Instances)
+	switch conn.State {
+	case StateAborted:
+		logger.Warn("FUSE connection is aborted")
+		collector.NewFuseConnectionAbortCollector().Collect()
+		events.Bus.Publish(events.FuseConnectionAborted, conn.DaemonID, "")
+		if w.opt.OnAborted != nil {
+			w.opt.OnAborted(ctx, conn.DaemonID)
+		}
+	case StateCongested:
+		logger.Warnf("FUSE connection is congested with %d requests waiting", conn.Waiting)
+		events.Bus.Publish(events.FuseConnectionCongested, conn.DaemonID, "")
+	default:
+		logger.Info("FUSE connection recovered")
+		events.Bus.Publish(events.FuseConnectionRecovered, conn.DaemonID, "")
+	}
+}
+
+func (w *Watcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.opt.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package fuseconn
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/nydus-snapshotter/pkg/events"
+)
+
+func TestWatcher(t *testing.T) {
+	waiting := map[uint32]int{}
+	aborted := map[string]bool{}
+	lookupConnection = func(mountpoint string) (uint32, bool, error) {
+		switch mountpoint {
+		case "/mnt/d1":
+			return 41, true, nil
+		case "/mnt/d2":
+			return 42, true, nil
+		}
+		return 0, false, nil
+	}
+	readConnection = func(id uint32) (int, int, error) {
+		return waiting[id], 12, nil
+	}
+	probeMountpoint = func(mountpoint string) error {
+		if aborted[mountpoint] {
+			return unix.ENOTCONN
+		}
+		return nil
+	}
+
+	var recovered []string
+	w := NewWatcher(Opt{
+		Targets: func() []Target {
+			return []Target{
+				{DaemonID: "d1", Mountpoint: "/mnt/d1", Instances: []string{"10"}},
+				{DaemonID: "d2", Mountpoint: "/mnt/d2"},
+				{DaemonID: "d3", Mountpoint: "/mnt/d3"},
+			}
+		},
+		OnAborted: func(_ context.Context, daemonID string) {
+			recovered = append(recovered, daemonID)
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := events.Bus.Subscribe(ctx)
+
+	conns := w.Check(ctx)
+	require.Len(t, conns, 2)
+	require.Equal(t, Connection{ID: 41, DaemonID: "d1", Mountpoint: "/mnt/d1", Instances: []string{"10"}, State: StateOK}, conns[0])
+	require.Equal(t, StateOK, conns[1].State)
+	require.Empty(t, ch)
+
+	waiting[42] = 20
+	aborted["/mnt/d1"] = true
+	conns = w.Check(ctx)
+	require.Equal(t, StateAborted, conns[0].State)
+	require.Equal(t, StateCongested, conns[1].State)
+	require.Equal(t, 20, conns[1].Waiting)
+	require.Equal(t, []string{"d1"}, recovered)
+	ev := <-ch
+	require.Equal(t, events.FuseConnectionAborted, ev.Type)
+	require.Equal(t, "d1", ev.DaemonID)
+	ev = <-ch
+	require.Equal(t, events.FuseConnectionCongested, ev.Type)
+	require.Equal(t, "d2", ev.DaemonID)
+
+	// Reported once until the state changes.
+	w.Check(ctx)
+	require.Equal(t, []string{"d1"}, recovered)
+	require.Empty(t, ch)
+
+	aborted["/mnt/d1"] = false
+	waiting[42] = 0
+	w.Check(ctx)
+	ev = <-ch
+	require.Equal(t, events.FuseConnectionRecovered, ev.Type)
+	ev = <-ch
+	require.Equal(t, events.FuseConnectionRecovered, ev.Type)
+}
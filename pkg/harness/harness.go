@@ -0,0 +1,427 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package harness runs the daemon manager stack against fake nydusd processes in
+// a temporary root directory, so flows like mounting, failover, recovery and GC
+// can be tested deterministically without kernels, registries or nydusd. Only
+// FUSE daemons are supported since fscache requires EROFS in kernel.
+//
+// The fake nydusd is the test binary spawned again, so tests using the harness
+// must call `harness.Main()` first in `TestMain()`. The harness sets up the global
+// configuration, tests using it can't run in parallel.
+package harness
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/cache"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/events"
+	"github.com/containerd/nydus-snapshotter/pkg/launcher"
+	"github.com/containerd/nydus-snapshotter/pkg/manager"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+	"github.com/containerd/nydus-snapshotter/pkg/store"
+)
+
+const (
+	// How long `WaitFor()` waits for a condition, generous for slow CI hosts.
+	waitTimeout  = 10 * time.Second
+	waitInterval = 50 * time.Millisecond
+)
+
+const daemonConfigTemplate = `{
+  "device": {
+    "backend": {"type": "localfs", "config": {"dir": "%s"}},
+    "cache": {"type": "blobcache", "config": {"work_dir": "%s"}}
+  },
+  "mode": "direct"
+}`
+
+type Opt func(h *Harness)
+
+// How the manager recovers dead daemons, none by default.
+func WithRecoverPolicy(p config.DaemonRecoverPolicy) Opt {
+	return func(h *Harness) {
+		h.recoverPolicy = p
+	}
+}
+
+// Harness is a snapshotter root directory with the manager and the daemons in it.
+type Harness struct {
+	Root         string
+	Database     *store.Database
+	Manager      *manager.Manager
+	CacheManager *cache.Manager
+
+	t             testing.TB
+	recoverPolicy config.DaemonRecoverPolicy
+	template      daemonconfig.DaemonConfig
+}
+
+// New sets up the snapshotter root directory and the manager, all daemons are
+// terminated when the test finishes.
+func New(t testing.TB, opts ...Opt) *Harness {
+	t.Helper()
+
+	h := &Harness{Root: t.TempDir(), t: t, recoverPolicy: config.RecoverPolicyNone}
+	for _, o := range opts {
+		o(h)
+	}
+
+	if err := h.setUp(); err != nil {
+		t.Fatalf("set up harness: %v", err)
+	}
+	t.Cleanup(h.tearDown)
+
+	return h
+}
+
+func (h *Harness) setUp() error {
+	var cfg config.SnapshotterConfig
+	if err := cfg.FillUpWithDefaults(); err != nil {
+		return err
+	}
+	cfg.Root = h.Root
+	cfg.DaemonConfig.FsDriver = config.FsDriverFusedev
+	cfg.DaemonConfig.RecoverPolicy = h.recoverPolicy.String()
+	cfg.SystemControllerConfig.DebugConfig.ProfileDuration = 0
+	if err := config.ProcessConfigurations(&cfg); err != nil {
+		return errors.Wrap(err, "process configurations")
+	}
+
+	templatePath := filepath.Join(h.Root, "nydusd-config.json")
+	template := fmt.Sprintf(daemonConfigTemplate, filepath.Join(h.Root, "blobs"), cfg.CacheManagerConfig.CacheDir)
+	if err := os.WriteFile(templatePath, []byte(template), 0644); err != nil {
+		return err
+	}
+	var err error
+	if h.template, err = daemonconfig.NewDaemonConfig(config.FsDriverFusedev, templatePath); err != nil {
+		return errors.Wrap(err, "load daemon configuration template")
+	}
+
+	if h.Database, err = store.NewDatabase(h.Root); err != nil {
+		return errors.Wrap(err, "create database")
+	}
+	if h.CacheManager, err = cache.NewManager(cache.Opt{
+		CacheDir: cfg.CacheManagerConfig.CacheDir,
+		Database: h.Database,
+	}); err != nil {
+		return errors.Wrap(err, "create cache manager")
+	}
+	h.Manager, err = h.newManager()
+
+	return err
+}
+
+func (h *Harness) newManager() (*manager.Manager, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "locate test binary")
+	}
+
+	return manager.NewManager(manager.Opt{
+		CacheDir:         h.CacheManager.CacheDir(),
+		DaemonConfig:     &h.template,
+		Database:         h.Database,
+		FsDriver:         config.FsDriverFusedev,
+		NydusdBinaryPath: self,
+		RecoverPolicy:    h.recoverPolicy,
+		RootDir:          h.Root,
+		Launcher:         launcher.Config{Env: []string{fakeNydusdEnv + "=1"}},
+	})
+}
+
+func (h *Harness) tearDown() {
+	h.Stop()
+	for _, d := range h.Manager.ListDaemons() {
+		if err := d.Terminate(); err != nil {
+			h.t.Logf("terminate daemon %s: %v", d.ID(), err)
+		}
+		if err := d.Wait(); err != nil {
+			h.t.Logf("wait for daemon %s: %v", d.ID(), err)
+		}
+	}
+	if err := h.Database.Close(); err != nil {
+		h.t.Logf("close database: %v", err)
+	}
+}
+
+func (h *Harness) newDaemon(mode config.DaemonMode, mountpoint string) (*daemon.Daemon, error) {
+	if err := os.MkdirAll(mountpoint, 0755); err != nil {
+		return nil, err
+	}
+	d, err := daemon.NewDaemon(
+		daemon.WithSocketDir(config.GetSocketRoot()),
+		daemon.WithConfigDir(config.GetConfigRoot()),
+		daemon.WithLogDir(config.GetLogDir()),
+		daemon.WithLogLevel(config.GetLogLevel()),
+		daemon.WithFsDriver(config.FsDriverFusedev),
+		daemon.WithDaemonMode(mode),
+		daemon.WithMountpoint(mountpoint),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.Manager.AddDaemon(d); err != nil {
+		return nil, err
+	}
+	if h.Manager.SupervisorSet != nil {
+		if d.Supervisor = h.Manager.SupervisorSet.NewSupervisor(d.ID()); d.Supervisor == nil {
+			return nil, errors.Errorf("create supervisor for daemon %s", d.ID())
+		}
+	}
+
+	d.Config = h.template
+	if err := d.Config.DumpFile(d.ConfigFile("")); err != nil {
+		return nil, errors.Wrapf(err, "dump configuration of daemon %s", d.ID())
+	}
+
+	return d, nil
+}
+
+// Prepare the bootstrap and configuration of a RAFS instance served by the daemon.
+func (h *Harness) newInstance(d *daemon.Daemon, snapshotID, imageID string) (*rafs.Rafs, error) {
+	r, err := rafs.NewRafs(snapshotID, imageID, config.FsDriverFusedev)
+	if err != nil {
+		return nil, err
+	}
+	bootstrap := filepath.Join(r.GetSnapshotDir(), "fs", "image", "image.boot")
+	if err := os.MkdirAll(filepath.Dir(bootstrap), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(bootstrap, []byte(snapshotID), 0644); err != nil {
+		return nil, err
+	}
+	if err := h.template.DumpFile(d.ConfigFile(snapshotID)); err != nil {
+		return nil, errors.Wrapf(err, "dump configuration of instance %s", snapshotID)
+	}
+	r.DaemonID = d.ID()
+
+	return r, nil
+}
+
+// Start the daemon and wait until the manager watches it, otherwise its death
+// goes unnoticed.
+func (h *Harness) startDaemon(d *daemon.Daemon) error {
+	ctx, cancel := context.WithTimeout(context.Background(), waitTimeout)
+	defer cancel()
+	evs := events.Bus.Subscribe(ctx)
+
+	if err := h.Manager.StartDaemon(d); err != nil {
+		return errors.Wrapf(err, "start daemon %s", d.ID())
+	}
+	for ev := range evs {
+		if ev.Type == events.DaemonStarted && ev.DaemonID == d.ID() {
+			return nil
+		}
+	}
+	return errors.Errorf("daemon %s isn't started in %s", d.ID(), waitTimeout)
+}
+
+// StartSharedDaemon starts a daemon serving RAFS instances mounted by API.
+func (h *Harness) StartSharedDaemon() (*daemon.Daemon, error) {
+	d, err := h.newDaemon(config.DaemonModeShared, config.GetRootMountpoint())
+	if err != nil {
+		return nil, err
+	}
+	if err := h.startDaemon(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// StartDedicatedDaemon starts a daemon serving the RAFS instance of the snapshot
+// only.
+func (h *Harness) StartDedicatedDaemon(snapshotID, imageID string) (*daemon.Daemon, *rafs.Rafs, error) {
+	d, err := h.newDaemon(config.DaemonModeDedicated,
+		path.Join(config.GetSnapshotsRootDir(), snapshotID, "mnt"))
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := h.newInstance(d, snapshotID, imageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.SetMountpoint(d.HostMountpoint())
+	d.AddRafsInstance(r)
+	if err := h.startDaemon(d); err != nil {
+		return nil, nil, err
+	}
+	if err := h.Manager.AddRafsInstance(r); err != nil {
+		return nil, nil, err
+	}
+
+	return d, r, nil
+}
+
+// Mount mounts the RAFS instance of the snapshot by the shared daemon.
+func (h *Harness) Mount(d *daemon.Daemon, snapshotID, imageID string) (*rafs.Rafs, error) {
+	r, err := h.newInstance(d, snapshotID, imageID)
+	if err != nil {
+		return nil, err
+	}
+	r.SetMountpoint(path.Join(d.HostMountpoint(), snapshotID))
+	if err := d.SharedMount(r); err != nil {
+		rafs.RafsGlobalCache.Remove(snapshotID)
+		return nil, errors.Wrapf(err, "mount instance %s", snapshotID)
+	}
+	d.AddRafsInstance(r)
+	if err := h.Manager.AddRafsInstance(r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Umount umounts the RAFS instance, and destroys its daemon once the daemon
+// serves no instance.
+func (h *Harness) Umount(r *rafs.Rafs) error {
+	d := h.Manager.GetByDaemonID(r.DaemonID)
+	if d == nil {
+		return errors.Errorf("no daemon %s of instance %s", r.DaemonID, r.SnapshotID)
+	}
+	if err := d.UmountRafsInstance(r); err != nil {
+		return err
+	}
+	d.RemoveRafsInstance(r.SnapshotID)
+	if err := h.Manager.RemoveRafsInstance(r.SnapshotID); err != nil {
+		return err
+	}
+	rafs.RafsGlobalCache.Remove(r.SnapshotID)
+
+	if d.GetRef() == 0 {
+		return h.Manager.DestroyDaemon(d)
+	}
+	return nil
+}
+
+// Kill kills the nydusd of the daemon as if it crashed.
+func (h *Harness) Kill(d *daemon.Daemon) error {
+	d.Lock()
+	pid := d.Pid()
+	d.Unlock()
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
+
+// Stop stops the manager watching the daemons, as if the snapshotter exited and
+// left the daemons running.
+func (h *Harness) Stop() {
+	for _, d := range h.Manager.ListDaemons() {
+		_ = h.Manager.UnsubscribeDaemonEvent(d)
+	}
+}
+
+// Restart restarts the snapshotter, a new manager recovers the daemons and
+// instances from the database. Returns the daemons found dead and alive.
+func (h *Harness) Restart(ctx context.Context) (map[string]*daemon.Daemon, map[string]*daemon.Daemon, error) {
+	h.Stop()
+
+	m, err := h.newManager()
+	if err != nil {
+		return nil, nil, err
+	}
+	h.Manager = m
+
+	recovering := make(map[string]*daemon.Daemon)
+	live := make(map[string]*daemon.Daemon)
+	if err := m.Recover(ctx, &recovering, &live); err != nil {
+		return nil, nil, err
+	}
+
+	return recovering, live, nil
+}
+
+// WaitFor waits until the condition holds, flows like failover and restart go on
+// in background.
+func (h *Harness) WaitFor(cond func() bool) error {
+	deadline := time.Now().Add(waitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return errors.Errorf("condition isn't met in %s", waitTimeout)
+		}
+		time.Sleep(waitInterval)
+	}
+	return nil
+}
+
+// WriteBlobCache writes cache files of the blob as nydusd does.
+func (h *Harness) WriteBlobCache(blobID string, size int) error {
+	files := map[string][]byte{
+		blobID + ".blob.data": make([]byte, size),
+		blobID + ".chunk_map": make([]byte, 4096),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(h.CacheManager.CacheDir(), name), content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Harness) fakeRequest(d *daemon.Daemon, method, endpoint string, query url.Values, v interface{}) error {
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", d.GetAPISock())
+			},
+		},
+	}
+	u := "http://unix" + endpoint
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return errors.Errorf("fake nydusd of daemon %s replies %s", d.ID(), resp.Status)
+	}
+	if v != nil {
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+	return nil
+}
+
+// FakeState tells what the fake nydusd of the daemon is serving.
+func (h *Harness) FakeState(d *daemon.Daemon) (*FakeState, error) {
+	var s FakeState
+	if err := h.fakeRequest(d, http.MethodGet, endpointFakeState, nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// InjectFailures makes the fake nydusd of the daemon fail the next requests to
+// the endpoint, e.g. `/api/v1/mount`.
+func (h *Harness) InjectFailures(d *daemon.Daemon, endpoint string, count int) error {
+	query := url.Values{}
+	query.Set("endpoint", endpoint)
+	query.Set("count", fmt.Sprint(count))
+	return h.fakeRequest(d, http.MethodPut, endpointFakeFailures, query, nil)
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package harness
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/tool"
+)
+
+func TestMain(m *testing.M) {
+	Main()
+	os.Exit(m.Run())
+}
+
+// Started again by the manager after being killed.
+func respawned(h *Harness, d *daemon.Daemon) func() bool {
+	s, err := h.FakeState(d)
+	if err != nil {
+		return func() bool { return false }
+	}
+	return func() bool {
+		n, err := h.FakeState(d)
+		return err == nil && n.Pid != s.Pid
+	}
+}
+
+// The process has exited, its API socket closes a bit earlier.
+func exited(d *daemon.Daemon) func() bool {
+	d.Lock()
+	pid := d.Pid()
+	d.Unlock()
+	return func() bool {
+		zombie, err := tool.IsZombieProcess(pid)
+		return err != nil || zombie
+	}
+}
+
+func mounted(h *Harness, d *daemon.Daemon, mountpoints ...string) func() bool {
+	return func() bool {
+		s, err := h.FakeState(d)
+		if err != nil || s.State != "RUNNING" || len(s.Mounts) != len(mountpoints) {
+			return false
+		}
+		for _, m := range mountpoints {
+			if _, ok := s.Mounts[m]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func TestSharedMount(t *testing.T) {
+	h := New(t)
+	d, err := h.StartSharedDaemon()
+	require.NoError(t, err)
+
+	r1, err := h.Mount(d, "1", "docker.io/library/busybox:latest")
+	require.NoError(t, err)
+	r2, err := h.Mount(d, "2", "docker.io/library/alpine:latest")
+	require.NoError(t, err)
+	require.True(t, mounted(h, d, "/1", "/2")())
+	require.Equal(t, int32(2), d.GetRef())
+
+	require.NoError(t, h.InjectFailures(d, "/api/v1/mount", 1))
+	_, err = h.Mount(d, "3", "docker.io/library/alpine:latest")
+	require.Error(t, err)
+	require.True(t, mounted(h, d, "/1", "/2")())
+
+	require.NoError(t, h.Umount(r1))
+	require.True(t, mounted(h, d, "/2")())
+	require.NotNil(t, h.Manager.GetByDaemonID(d.ID()))
+
+	require.NoError(t, h.Umount(r2))
+	require.Nil(t, h.Manager.GetByDaemonID(d.ID()))
+	_, err = os.Stat(d.GetAPISock())
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestDedicatedDaemon(t *testing.T) {
+	h := New(t)
+	d, r, err := h.StartDedicatedDaemon("1", "docker.io/library/busybox:latest")
+	require.NoError(t, err)
+	require.True(t, mounted(h, d, "/")())
+
+	require.NoError(t, h.Umount(r))
+	require.Nil(t, h.Manager.GetByDaemonID(d.ID()))
+	_, err = os.Stat(filepath.Dir(d.ConfigFile("")))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRestartPolicy(t *testing.T) {
+	h := New(t, WithRecoverPolicy(config.RecoverPolicyRestart))
+	d, err := h.StartSharedDaemon()
+	require.NoError(t, err)
+	_, err = h.Mount(d, "1", "docker.io/library/busybox:latest")
+	require.NoError(t, err)
+
+	restarted := respawned(h, d)
+	require.NoError(t, h.Kill(d))
+	require.NoError(t, h.WaitFor(func() bool { return restarted() && mounted(h, d, "/1")() }))
+
+	s, err := h.FakeState(d)
+	require.NoError(t, err)
+	require.False(t, s.Upgrade)
+}
+
+func TestFailoverPolicy(t *testing.T) {
+	h := New(t, WithRecoverPolicy(config.RecoverPolicyFailover))
+	d, err := h.StartSharedDaemon()
+	require.NoError(t, err)
+	_, err = h.Mount(d, "1", "docker.io/library/busybox:latest")
+	require.NoError(t, err)
+	require.NoError(t, h.WaitFor(func() bool {
+		s, err := h.FakeState(d)
+		return err == nil && s.StatesSent > 0
+	}))
+
+	restarted := respawned(h, d)
+	require.NoError(t, h.Kill(d))
+	require.NoError(t, h.WaitFor(func() bool { return restarted() && mounted(h, d, "/1")() }))
+
+	s, err := h.FakeState(d)
+	require.NoError(t, err)
+	require.True(t, s.Upgrade)
+	require.Positive(t, s.StatesTakeOver)
+}
+
+func TestRecover(t *testing.T) {
+	h := New(t)
+	alive, err := h.StartSharedDaemon()
+	require.NoError(t, err)
+	_, err = h.Mount(alive, "1", "docker.io/library/busybox:latest")
+	require.NoError(t, err)
+	dead, _, err := h.StartDedicatedDaemon("2", "docker.io/library/alpine:latest")
+	require.NoError(t, err)
+
+	h.Stop()
+	require.NoError(t, h.Kill(dead))
+	require.NoError(t, h.WaitFor(exited(dead)))
+
+	recovering, live, err := h.Restart(context.Background())
+	require.NoError(t, err)
+	require.Contains(t, recovering, dead.ID())
+	require.Contains(t, live, alive.ID())
+
+	d := h.Manager.GetByDaemonID(alive.ID())
+	require.NotNil(t, d)
+	require.NotNil(t, d.RafsCache.Get("1"))
+	require.True(t, mounted(h, d, "/1")())
+}
+
+func TestGarbageCollection(t *testing.T) {
+	h := New(t)
+	d, err := h.StartSharedDaemon()
+	require.NoError(t, err)
+	r, err := h.Mount(d, "1", "docker.io/library/busybox:latest")
+	require.NoError(t, err)
+
+	blobID := "5c8af6a9d0bbd3b3f0e4ec4e9f3c7b0e39d0c8a5ab6ce0d4e3a4ff0b0a1c1d2e"
+	require.NoError(t, h.WriteBlobCache(blobID, 1<<20))
+	usage, err := h.CacheManager.CacheUsage(context.Background(), blobID)
+	require.NoError(t, err)
+	require.Positive(t, usage.Size)
+
+	require.NoError(t, h.Umount(r))
+	for _, dir := range []string{d.States.ConfigDir, d.States.LogDir} {
+		_, err = os.Stat(dir)
+		require.True(t, os.IsNotExist(err), dir)
+	}
+
+	require.NoError(t, h.CacheManager.RemoveBlobCache(blobID))
+	entries, err := os.ReadDir(h.CacheManager.CacheDir())
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
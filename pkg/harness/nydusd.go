@@ -0,0 +1,434 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package harness
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+)
+
+const (
+	// The test binary is spawned as a fake nydusd if it's set.
+	fakeNydusdEnv = "_NYDUS_FAKE_NYDUSD"
+
+	// Endpoints of the fake nydusd only, for tests to inspect it and inject failures.
+	endpointFakeState    = "/fake/v1/state"
+	endpointFakeFailures = "/fake/v1/failures"
+
+	fakeNydusdVersion = "fake"
+)
+
+// FakeState is what a fake nydusd is serving.
+type FakeState struct {
+	ID    string            `json:"id"`
+	Pid   int               `json:"pid"`
+	State types.DaemonState `json:"state"`
+	// Filesystem instances by their mountpoints relative to the FUSE mountpoint,
+	// `/` for the instance of a dedicated daemon, to their bootstrap files.
+	Mounts map[string]string `json:"mounts"`
+	// Started to take over the states of a dead or old nydusd
+	Upgrade bool `json:"upgrade"`
+	// Times the states are sent to or taken over from the supervisor
+	StatesSent     int `json:"states_sent"`
+	StatesTakeOver int `json:"states_taken_over"`
+}
+
+// Main runs the process as a fake nydusd and exits if the test binary is spawned
+// as one, tests using the harness must call it first in `TestMain()`.
+func Main() {
+	if os.Getenv(fakeNydusdEnv) == "" {
+		return
+	}
+
+	if err := runFakeNydusd(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "fake nydusd: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+type fakeNydusd struct {
+	mu         sync.Mutex
+	state      FakeState
+	supervisor string
+	// Remaining failures injected to endpoints
+	failures map[string]int
+	exit     chan struct{}
+	exitOnce sync.Once
+}
+
+// Parse the nydusd command line, e.g. `fuse --apisock <sock> --upgrade`.
+func parseArgs(args []string) (string, map[string]string, error) {
+	var mode string
+	params := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			if mode != "" {
+				return "", nil, errors.Errorf("unexpected argument %s", arg)
+			}
+			mode = arg
+			continue
+		}
+		name := strings.TrimPrefix(arg, "--")
+		if name == "upgrade" {
+			params[name] = "true"
+			continue
+		}
+		if i+1 >= len(args) {
+			return "", nil, errors.Errorf("no value of parameter %s", arg)
+		}
+		params[name] = args[i+1]
+		i++
+	}
+
+	return mode, params, nil
+}
+
+func runFakeNydusd(args []string) error {
+	mode, params, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+	if mode != "fuse" {
+		return errors.Errorf("unsupported mode %q", mode)
+	}
+	sock := params["apisock"]
+	if sock == "" {
+		return errors.New("no API socket")
+	}
+
+	f := &fakeNydusd{
+		state: FakeState{
+			ID:      params["id"],
+			Pid:     os.Getpid(),
+			State:   types.DaemonStateRunning,
+			Mounts:  map[string]string{},
+			Upgrade: params["upgrade"] == "true" || (params["supervisor"] != "" && staleSocket(sock)),
+		},
+		supervisor: params["supervisor"],
+		failures:   map[string]int{},
+		exit:       make(chan struct{}),
+	}
+	// A new nydusd serves right away, while an upgrading or failing over one waits
+	// for taking over.
+	if f.state.Upgrade {
+		f.state.State = types.DaemonStateInit
+	} else if bootstrap := params["bootstrap"]; bootstrap != "" {
+		f.state.Mounts["/"] = bootstrap
+	}
+
+	// The socket is residual if the old nydusd died.
+	if err := os.Remove(sock); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "remove socket %s", sock)
+	}
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		return errors.Wrapf(err, "listen on %s", sock)
+	}
+	defer os.Remove(sock)
+
+	server := &http.Server{Handler: f.router()}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case <-signals:
+	case <-f.exit:
+	}
+
+	// Let the exit request be replied. The connection of the liveness monitor
+	// never goes idle, so close it anyway after a while.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return server.Close()
+	}
+	return nil
+}
+
+// Nydusd fails over if the socket of the dead one is left.
+func staleSocket(sock string) bool {
+	if _, err := os.Stat(sock); err != nil {
+		return false
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return true
+	}
+	conn.Close()
+	return false
+}
+
+func (f *fakeNydusd) router() http.Handler {
+	routes := map[string]map[string]func(r *http.Request) (interface{}, error){
+		"/api/v1/daemon": {
+			http.MethodGet: f.daemonInfo,
+		},
+		"/api/v1/mount": {
+			http.MethodPost:   f.mount,
+			http.MethodDelete: f.umount,
+		},
+		"/api/v1/metrics": {
+			http.MethodGet: func(*http.Request) (interface{}, error) { return &types.FsMetrics{}, nil },
+		},
+		"/api/v1/metrics/blobcache": {
+			http.MethodGet: func(*http.Request) (interface{}, error) { return &types.CacheMetrics{}, nil },
+		},
+		"/api/v1/metrics/inflight": {
+			http.MethodGet: func(*http.Request) (interface{}, error) { return nil, nil },
+		},
+		"/api/v1/daemon/fuse/sendfd": {
+			http.MethodPut: f.sendStates,
+		},
+		"/api/v1/daemon/fuse/takeover": {
+			http.MethodPut: f.takeOver,
+		},
+		"/api/v1/daemon/start": {
+			http.MethodPut: f.start,
+		},
+		"/api/v1/daemon/exit": {
+			http.MethodPut: func(*http.Request) (interface{}, error) {
+				f.exitOnce.Do(func() { close(f.exit) })
+				return nil, nil
+			},
+		},
+		endpointFakeState: {
+			http.MethodGet: func(*http.Request) (interface{}, error) { return f.snapshot(), nil },
+		},
+		endpointFakeFailures: {
+			http.MethodPut: f.injectFailures,
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := routes[r.URL.Path][r.Method]
+		if !ok {
+			writeError(w, http.StatusNotFound, errors.Errorf("no handler of %s %s", r.Method, r.URL.Path))
+			return
+		}
+		if f.shouldFail(r.URL.Path) {
+			writeError(w, http.StatusInternalServerError, errors.Errorf("injected failure of %s", r.URL.Path))
+			return
+		}
+
+		resp, err := handler(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if resp == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	})
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&types.ErrorMessage{Code: http.StatusText(status), Message: err.Error()})
+}
+
+func (f *fakeNydusd) shouldFail(endpoint string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures[endpoint] <= 0 {
+		return false
+	}
+	f.failures[endpoint]--
+	return true
+}
+
+func (f *fakeNydusd) snapshot() *FakeState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.state
+	s.Mounts = make(map[string]string, len(f.state.Mounts))
+	for mp, bootstrap := range f.state.Mounts {
+		s.Mounts[mp] = bootstrap
+	}
+	return &s
+}
+
+func (f *fakeNydusd) daemonInfo(*http.Request) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &types.DaemonInfo{
+		ID:      f.state.ID,
+		Version: types.BuildTimeInfo{PackageVer: fakeNydusdVersion},
+		State:   f.state.State,
+	}, nil
+}
+
+func (f *fakeNydusd) mount(r *http.Request) (interface{}, error) {
+	var req types.MountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, errors.Wrap(err, "decode mount request")
+	}
+	mp := r.URL.Query().Get("mountpoint")
+	if mp == "" || req.Source == "" {
+		return nil, errors.New("no mountpoint or bootstrap")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.state.Mounts[mp]; ok {
+		return nil, errors.Errorf("%s is already mounted", mp)
+	}
+	f.state.Mounts[mp] = req.Source
+	return nil, nil
+}
+
+func (f *fakeNydusd) umount(r *http.Request) (interface{}, error) {
+	mp := r.URL.Query().Get("mountpoint")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.state.Mounts[mp]; !ok {
+		return nil, errors.Errorf("%s is not mounted", mp)
+	}
+	delete(f.state.Mounts, mp)
+	return nil, nil
+}
+
+// Send the mounts to the supervisor along with a file descriptor standing for
+// the FUSE session, as nydusd does.
+func (f *fakeNydusd) sendStates(*http.Request) (interface{}, error) {
+	if f.supervisor == "" {
+		return nil, errors.New("no supervisor")
+	}
+	s := f.snapshot()
+	data, err := json.Marshal(s.Mounts)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	conn, err := net.Dial("unix", f.supervisor)
+	if err != nil {
+		return nil, errors.Wrapf(err, "connect to supervisor %s", f.supervisor)
+	}
+	defer conn.Close()
+	if _, _, err := conn.(*net.UnixConn).WriteMsgUnix(data, unix.UnixRights(int(session.Fd())), nil); err != nil {
+		return nil, errors.Wrap(err, "send states")
+	}
+
+	f.mu.Lock()
+	f.state.StatesSent++
+	f.mu.Unlock()
+
+	return nil, nil
+}
+
+// Restore the mounts from the states kept by the supervisor.
+func (f *fakeNydusd) takeOver(*http.Request) (interface{}, error) {
+	if f.supervisor == "" {
+		return nil, errors.New("no supervisor")
+	}
+	conn, err := net.Dial("unix", f.supervisor)
+	if err != nil {
+		return nil, errors.Wrapf(err, "connect to supervisor %s", f.supervisor)
+	}
+	defer conn.Close()
+
+	var data []byte
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, unix.CmsgSpace(4))
+	for {
+		n, oobn, _, _, err := conn.(*net.UnixConn).ReadMsgUnix(buf, oob)
+		if oobn > 0 {
+			closeRights(oob[:oobn])
+		}
+		data = append(data, buf[:n]...)
+		if err == io.EOF || (err == nil && n == 0) {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "receive states")
+		}
+	}
+
+	mounts := map[string]string{}
+	if err := json.Unmarshal(data, &mounts); err != nil {
+		return nil, errors.Wrap(err, "decode states")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state.State != types.DaemonStateInit {
+		return nil, errors.Errorf("take over in state %s", f.state.State)
+	}
+	f.state.Mounts = mounts
+	f.state.State = types.DaemonStateReady
+	f.state.StatesTakeOver++
+	return nil, nil
+}
+
+func closeRights(oob []byte) {
+	scms, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return
+	}
+	for i := range scms {
+		fds, err := unix.ParseUnixRights(&scms[i])
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			unix.Close(fd)
+		}
+	}
+}
+
+func (f *fakeNydusd) start(*http.Request) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.state.State == types.DaemonStateRunning {
+		return nil, errors.New("already running")
+	}
+	f.state.State = types.DaemonStateRunning
+	return nil, nil
+}
+
+func (f *fakeNydusd) injectFailures(r *http.Request) (interface{}, error) {
+	endpoint := r.URL.Query().Get("endpoint")
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if endpoint == "" || err != nil {
+		return nil, errors.New("invalid failure injection")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[endpoint] = count
+	return nil, nil
+}
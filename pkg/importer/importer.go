@@ -0,0 +1,327 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package importer brings images already unpacked by other snapshotters on the
+// node over to the nydus snapshotter, so switching the snapshotter of a cluster
+// doesn't pull every image again in full.
+//
+// The committed snapshots recorded by the stargz or overlayfs snapshotter tell
+// which images on the node are unpacked. For each of them having a converted
+// nydus image, the nydus image is pulled through containerd into the nydus
+// snapshotter, which only downloads the nydus metadata layer and records the
+// data layers as remote snapshots. The original images are left untouched,
+// optionally the nydus images are labeled like them, e.g. for CRI to manage them.
+package importer
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
+	snpkg "github.com/containerd/containerd/v2/pkg/snapshotters"
+	"github.com/containerd/log"
+	distribution "github.com/distribution/reference"
+	"github.com/opencontainers/image-spec/identity"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	"github.com/containerd/nydus-snapshotter/pkg/remote"
+)
+
+const (
+	SourceStargz    = "stargz"
+	SourceOverlayfs = "overlayfs"
+)
+
+// Root directories of the source snapshotters in their default setup.
+var defaultRoots = map[string]string{
+	SourceStargz:    "/var/lib/containerd-stargz-grpc/snapshotter",
+	SourceOverlayfs: "/var/lib/containerd/io.containerd.snapshotter.v1.overlayfs",
+}
+
+const (
+	StatusImported = "imported"
+	StatusRetagged = "retagged"
+	// The nydus image would be imported, only reported in dry run.
+	StatusImportable = "importable"
+	StatusSkipped    = "skipped"
+	StatusFailed     = "failed"
+)
+
+type Opt struct {
+	// The snapshotter to import images from, `stargz` or `overlayfs`, also its name
+	// in containerd to list its snapshots while it's running.
+	Source string
+	// Root directory of the source snapshotter, the default one of the source if empty.
+	SourceRoot string
+	// Address of containerd
+	Address string
+	// Name of the nydus snapshotter in containerd
+	Snapshotter string
+	// The converted nydus image of an image is named by appending the suffix to its tag.
+	TagSuffix string
+	// Label the imported nydus images like the original images, whose names and
+	// targets are left untouched.
+	Retag bool
+	// Skip TLS verification when accessing registries.
+	Insecure bool
+	// Only report what would be imported.
+	DryRun bool
+}
+
+// Entry is the import result of an image unpacked by the source snapshotter.
+type Entry struct {
+	Namespace  string `json:"namespace"`
+	Image      string `json:"image"`
+	NydusImage string `json:"nydus_image,omitempty"`
+	Status     string `json:"status"`
+	Message    string `json:"message,omitempty"`
+}
+
+type Report struct {
+	Source     string  `json:"source"`
+	SourceRoot string  `json:"source_root"`
+	Entries    []Entry `json:"entries"`
+}
+
+func validate(opt *Opt) error {
+	root, ok := defaultRoots[opt.Source]
+	if !ok {
+		return errors.Wrapf(errdefs.ErrInvalidArgument, "unsupported source snapshotter %q", opt.Source)
+	}
+	if opt.SourceRoot == "" {
+		opt.SourceRoot = root
+	}
+	if opt.Address == "" || opt.Snapshotter == "" || opt.TagSuffix == "" {
+		return errors.Wrap(errdefs.ErrInvalidArgument, "empty containerd address, snapshotter or tag suffix")
+	}
+	return nil
+}
+
+// Name of the converted nydus image of image `ref`.
+func nydusImageName(ref, suffix string) (string, error) {
+	named, err := distribution.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "parse reference %s", ref)
+	}
+	tagged, ok := named.(distribution.Tagged)
+	if !ok {
+		return "", errors.Wrapf(errdefs.ErrInvalidArgument, "image %s is not tagged", ref)
+	}
+	if strings.HasSuffix(tagged.Tag(), suffix) {
+		return "", errors.Wrapf(errdefs.ErrInvalidArgument, "image %s is a nydus image", ref)
+	}
+	nydusNamed, err := distribution.WithTag(distribution.TrimNamed(named), tagged.Tag()+suffix)
+	if err != nil {
+		return "", errors.Wrapf(err, "name nydus image of %s", ref)
+	}
+
+	return nydusNamed.String(), nil
+}
+
+// Whether image `ref` in the registry is a nydus image for the host platform.
+func isNydusImage(ctx context.Context, ref string, insecure bool) (bool, error) {
+	keyChain, err := auth.GetKeyChainByRef(ref, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "get key chain")
+	}
+	r := remote.New(keyChain, insecure)
+
+	check := func() (bool, error) {
+		resolver := r.Resolve(ctx, ref)
+		name, desc, err := resolver.Resolve(ctx, ref)
+		if err != nil {
+			return false, errors.Wrapf(err, "resolve reference %s", ref)
+		}
+		fetcher, err := resolver.Fetcher(ctx, name)
+		if err != nil {
+			return false, errors.Wrap(err, "get fetcher")
+		}
+		manifest, err := remote.FetchManifest(ctx, fetcher, desc)
+		if err != nil {
+			return false, err
+		}
+		n := len(manifest.Layers)
+		return n > 0 && label.IsNydusMetaLayer(manifest.Layers[n-1].Annotations), nil
+	}
+
+	ok, err := check()
+	if err != nil && r.RetryWithPlainHTTP(ref, err) {
+		return check()
+	}
+
+	return ok, err
+}
+
+// Resolver of containerd pulling images with the credentials the snapshotter uses.
+func newResolver(ref string, insecure bool) (remotes.Resolver, error) {
+	keyChain, err := auth.GetKeyChainByRef(ref, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "get key chain")
+	}
+	credFunc := func(string) (string, string, error) {
+		if keyChain == nil {
+			return "", "", nil
+		}
+		return keyChain.Username, keyChain.Password, nil
+	}
+	httpClient := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+	}}
+
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: docker.ConfigureDefaultRegistries(
+			docker.WithAuthorizer(docker.NewDockerAuthorizer(
+				docker.WithAuthClient(httpClient),
+				docker.WithAuthCreds(credFunc),
+			)),
+			docker.WithClient(httpClient),
+		),
+	}), nil
+}
+
+type importer struct {
+	opt Opt
+	c   *client.Client
+}
+
+func (im *importer) importImage(ctx context.Context, img client.Image, chains map[string]bool) *Entry {
+	diffIDs, err := img.RootFS(ctx)
+	if err != nil {
+		log.G(ctx).WithError(err).Debugf("get rootfs of image %s", img.Name())
+		return nil
+	}
+	if len(diffIDs) == 0 || !chains[identity.ChainID(diffIDs).String()] {
+		// Not unpacked by the source snapshotter
+		return nil
+	}
+
+	entry := &Entry{Image: img.Name()}
+	fail := func(status string, err error) *Entry {
+		entry.Status, entry.Message = status, err.Error()
+		return entry
+	}
+
+	entry.NydusImage, err = nydusImageName(img.Name(), im.opt.TagSuffix)
+	if err != nil {
+		return fail(StatusSkipped, err)
+	}
+	if existing, err := im.c.GetImage(ctx, entry.NydusImage); err == nil {
+		if unpacked, _ := existing.IsUnpacked(ctx, im.opt.Snapshotter); unpacked {
+			entry.Status, entry.Message = StatusSkipped, "nydus image is imported already"
+			return entry
+		}
+	}
+	ok, err := isNydusImage(ctx, entry.NydusImage, im.opt.Insecure)
+	if err != nil {
+		return fail(StatusSkipped, errors.Wrap(err, "check converted nydus image"))
+	}
+	if !ok {
+		entry.Status, entry.Message = StatusSkipped, "no converted nydus image"
+		return entry
+	}
+
+	if im.opt.DryRun {
+		entry.Status = StatusImportable
+		return entry
+	}
+
+	resolver, err := newResolver(entry.NydusImage, im.opt.Insecure)
+	if err != nil {
+		return fail(StatusFailed, err)
+	}
+	nydusImg, err := im.c.Pull(ctx, entry.NydusImage,
+		client.WithPullUnpack,
+		client.WithPullSnapshotter(im.opt.Snapshotter),
+		client.WithResolver(resolver),
+		client.WithImageHandlerWrapper(snpkg.AppendInfoHandlerWrapper(entry.NydusImage)),
+	)
+	if err != nil {
+		return fail(StatusFailed, errors.Wrapf(err, "pull %s", entry.NydusImage))
+	}
+	entry.Status = StatusImported
+
+	if im.opt.Retag {
+		record := nydusImg.Metadata()
+		if record.Labels == nil {
+			record.Labels = map[string]string{}
+		}
+		for k, v := range img.Labels() {
+			if _, ok := record.Labels[k]; !ok {
+				record.Labels[k] = v
+			}
+		}
+		if _, err := im.c.ImageService().Update(ctx, record, "labels"); err != nil {
+			return fail(StatusFailed, errors.Wrapf(err, "label %s like %s", entry.NydusImage, img.Name()))
+		}
+		entry.Status = StatusRetagged
+	}
+
+	return entry
+}
+
+// Import the nydus images converted from the images unpacked by the source
+// snapshotter. The source snapshotter may keep running, while containerd and the
+// nydus snapshotter must be running.
+func Import(ctx context.Context, opt Opt) (*Report, error) {
+	if err := validate(&opt); err != nil {
+		return nil, err
+	}
+
+	c, err := client.New(opt.Address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "connect to containerd %s", opt.Address)
+	}
+	defer c.Close()
+
+	chains, err := readCommittedChains(ctx, opt.SourceRoot)
+	if errors.Is(err, bolt.ErrTimeout) {
+		// containerd serves the snapshots of the running source snapshotter.
+		log.G(ctx).Infof("Metadata store of %s is locked, list snapshots through containerd", opt.Source)
+		chains, err = listCommittedChains(ctx, c, opt.Source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	im := importer{opt: opt, c: c}
+	report := &Report{Source: opt.Source, SourceRoot: opt.SourceRoot, Entries: []Entry{}}
+	nss := make([]string, 0, len(chains))
+	for ns := range chains {
+		nss = append(nss, ns)
+	}
+	sort.Strings(nss)
+
+	for _, ns := range nss {
+		ctx := namespaces.WithNamespace(ctx, ns)
+		imgs, err := c.ListImages(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list images in namespace %s", ns)
+		}
+		for _, img := range imgs {
+			entry := im.importImage(ctx, img, chains[ns])
+			if entry == nil {
+				continue
+			}
+			entry.Namespace = ns
+			log.G(ctx).WithField("status", entry.Status).WithField("message", entry.Message).
+				Infof("Import image %s", entry.Image)
+			report.Entries = append(report.Entries, *entry)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package importer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/core/snapshots/storage"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+func TestNydusImageName(t *testing.T) {
+	name, err := nydusImageName("docker.io/library/nginx:1.25", "-nydus")
+	require.NoError(t, err)
+	require.Equal(t, "docker.io/library/nginx:1.25-nydus", name)
+
+	name, err = nydusImageName("nginx:latest", "-nydus")
+	require.NoError(t, err)
+	require.Equal(t, "docker.io/library/nginx:latest-nydus", name)
+
+	_, err = nydusImageName("docker.io/library/nginx:1.25-nydus", "-nydus")
+	require.ErrorIs(t, err, errdefs.ErrInvalidArgument)
+
+	_, err = nydusImageName("docker.io/library/nginx@sha256:4c0fdaa8b6341bfdeca5f18f7837462c80cff90527ee35ef185571e1c327beac", "-nydus")
+	require.ErrorIs(t, err, errdefs.ErrInvalidArgument)
+}
+
+func TestReadCommittedChains(t *testing.T) {
+	root := t.TempDir()
+	ms, err := storage.NewMetaStore(filepath.Join(root, metaStoreFile))
+	require.NoError(t, err)
+
+	ctx, txn, err := ms.TransactionContext(context.Background(), true)
+	require.NoError(t, err)
+	_, err = storage.CreateSnapshot(ctx, snapshots.KindActive, "default/1/extract-1 sha256:c1", "")
+	require.NoError(t, err)
+	_, err = storage.CommitActive(ctx, "default/1/extract-1 sha256:c1", "default/2/sha256:c1", snapshots.Usage{})
+	require.NoError(t, err)
+	_, err = storage.CreateSnapshot(ctx, snapshots.KindActive, "k8s.io/3/extract-3 sha256:c2", "")
+	require.NoError(t, err)
+	_, err = storage.CommitActive(ctx, "k8s.io/3/extract-3 sha256:c2", "k8s.io/4/sha256:c2", snapshots.Usage{})
+	require.NoError(t, err)
+	_, err = storage.CreateSnapshot(ctx, snapshots.KindActive, "k8s.io/5/container", "k8s.io/4/sha256:c2")
+	require.NoError(t, err)
+	require.NoError(t, txn.Commit())
+
+	// The running source snapshotter locks its metadata store.
+	_, err = readCommittedChains(context.Background(), root)
+	require.ErrorIs(t, err, bolt.ErrTimeout)
+	require.NoError(t, ms.Close())
+
+	chains, err := readCommittedChains(context.Background(), root)
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string]bool{
+		"default": {"sha256:c1": true},
+		"k8s.io":  {"sha256:c2": true},
+	}, chains)
+}
@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/core/snapshots"
+	"github.com/containerd/containerd/v2/core/snapshots/storage"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Both stargz and overlayfs snapshotters keep their snapshot records in the
+// metadata store of containerd's snapshotter storage.
+const metaStoreFile = "metadata.db"
+
+// A running source snapshotter locks its metadata store exclusively.
+const metaStoreLockTimeout = time.Second
+
+// Copy a consistent snapshot of the metadata store aside, as the containerd
+// storage opens it for writing.
+func copyMetaStore(root, dir string) (string, error) {
+	db, err := bolt.Open(filepath.Join(root, metaStoreFile), 0600,
+		&bolt.Options{ReadOnly: true, Timeout: metaStoreLockTimeout})
+	if err != nil {
+		return "", errors.Wrapf(err, "open metadata store in %s", root)
+	}
+	defer db.Close()
+
+	p := filepath.Join(dir, metaStoreFile)
+	err = db.View(func(tx *bolt.Tx) error {
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return errors.Wrap(err, "create copy of metadata store")
+		}
+		defer f.Close()
+		if _, err := tx.WriteTo(f); err != nil {
+			return errors.Wrap(err, "copy metadata store")
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return p, nil
+}
+
+// List the chain IDs of committed snapshots of the running source snapshotter
+// through containerd, indexed by containerd namespaces.
+func listCommittedChains(ctx context.Context, c *client.Client, snapshotter string) (map[string]map[string]bool, error) {
+	nss, err := c.NamespaceService().List(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list namespaces")
+	}
+
+	chains := map[string]map[string]bool{}
+	for _, ns := range nss {
+		ctx := namespaces.WithNamespace(ctx, ns)
+		err := c.SnapshotService(snapshotter).Walk(ctx, func(_ context.Context, info snapshots.Info) error {
+			if info.Kind != snapshots.KindCommitted {
+				return nil
+			}
+			if chains[ns] == nil {
+				chains[ns] = map[string]bool{}
+			}
+			chains[ns][info.Name] = true
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "walk snapshots of %s in namespace %s", snapshotter, ns)
+		}
+	}
+
+	return chains, nil
+}
+
+// Read the chain IDs of committed snapshots of the stopped source snapshotter,
+// indexed by containerd namespaces.
+func readCommittedChains(ctx context.Context, root string) (map[string]map[string]bool, error) {
+	dir, err := os.MkdirTemp("", "nydus-import-")
+	if err != nil {
+		return nil, errors.Wrap(err, "create temporary directory")
+	}
+	defer os.RemoveAll(dir)
+
+	p, err := copyMetaStore(root, dir)
+	if err != nil {
+		return nil, err
+	}
+	ms, err := storage.NewMetaStore(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "open metadata store")
+	}
+	defer ms.Close()
+
+	ctx, t, err := ms.TransactionContext(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = t.Rollback()
+	}()
+
+	chains := map[string]map[string]bool{}
+	err = storage.WalkInfo(ctx, func(_ context.Context, info snapshots.Info) error {
+		if info.Kind != snapshots.KindCommitted {
+			return nil
+		}
+		// containerd names snapshots in snapshotters as `<namespace>/<id>/<key>`,
+		// committed snapshots are keyed by their chain IDs.
+		parts := strings.SplitN(info.Name, "/", 3)
+		if len(parts) != 3 {
+			return nil
+		}
+		ns, chainID := parts[0], parts[2]
+		if chains[ns] == nil {
+			chains[ns] = map[string]bool{}
+		}
+		chains[ns][chainID] = true
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "walk snapshots")
+	}
+
+	return chains, nil
+}
@@ -48,6 +48,30 @@ const (
 	NydusProxyMode = "containerd.io/snapshot/nydus-proxy-mode"
 	// A bool flag to enable integrity verification of meta data blob
 	NydusSignature = "containerd.io/snapshot/nydus-signature"
+	// The volume ID of a RAFS instance mounted as a read-only image volume outside
+	// of container rootfs, set by the snapshotter.
+	NydusVolume = "containerd.io/snapshot/nydus-volume"
+	// JSON encoded host paths the image volume is published to, set by the snapshotter.
+	NydusVolumeTargets = "containerd.io/snapshot/nydus-volume-targets"
+	// A bool flag to let nydusd download all the image data in background rather than
+	// lazily loading it, set by the snapshotter for images denied lazy loading.
+	NydusPrefetchAll = "containerd.io/snapshot/nydus-prefetch-all"
+	// Comma separated IDs of the data blobs of the image, collected from the nydus data
+	// layers under the snapshot, set by the snapshotter.
+	NydusImageBlobIDs = "containerd.io/snapshot/nydus-image-blob-ids"
+	// Priority class of the full image prefetch, `critical`, `normal` or `low`,
+	// which decides when it runs if prefetch scheduling is enabled.
+	NydusPrefetchPriority = "containerd.io/snapshot/nydus-prefetch-priority"
+	// A bool flag to turn RAFS digest validation of the snapshot on or off, overriding
+	// the nydusd configuration template. Validation costs CPU on reading data.
+	NydusDigestValidate = "containerd.io/snapshot/nydus-digest-validate"
+	// Bytes of blob cache the image may use, overriding the default per image quota,
+	// e.g. `50Gi`. The coldest blob caches of the image not used by mounted images are
+	// evicted beyond the quota, caches of a mounted image may grow beyond it.
+	NydusCacheQuota = "containerd.io/snapshot/nydus-cache-quota"
+	// The workload class of the snapshot, e.g. `database`, `web` or `batch`, deciding
+	// the read-ahead window of its RAFS instance.
+	NydusWorkloadClass = "containerd.io/snapshot/nydus-workload-class"
 
 	// A bool flag to mark the blob as a estargz data blob, set by the snapshotter.
 	StargzLayer = "containerd.io/snapshot/stargz"
@@ -82,6 +106,11 @@ func IsNydusProxyMode(labels map[string]string) bool {
 	return ok
 }
 
+func IsNydusVolume(labels map[string]string) bool {
+	_, ok := labels[NydusVolume]
+	return ok
+}
+
 func HasTarfsHint(labels map[string]string) bool {
 	_, ok := labels[TarfsHint]
 	return ok
@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package launcher spawns nydusd processes. Nydusd parses untrusted image data, so
+// it can be confined by seccomp, no-new-privileges and AppArmor. These have to be
+// applied by the process itself right before executing nydusd, so the snapshotter
+// binary re-executes itself as a launcher to do that.
+package launcher
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// The launcher is recognized by its `argv[0]`.
+	launcherName = "nydusd-launcher"
+	configEnv    = "_NYDUSD_LAUNCHER_CONFIG"
+)
+
+type Config struct {
+	// Environment variables in `KEY=VALUE` format appended to the snapshotter's.
+	Env []string `json:"env,omitempty"`
+	// Path to a seccomp profile in OCI runtime-spec format.
+	SeccompProfile  string `json:"seccomp_profile,omitempty"`
+	NoNewPrivileges bool   `json:"no_new_privileges,omitempty"`
+	// Name of a loaded AppArmor profile to transition to.
+	AppArmorProfile string `json:"apparmor_profile,omitempty"`
+}
+
+func (c *Config) confined() bool {
+	return c.SeccompProfile != "" || c.NoNewPrivileges || c.AppArmorProfile != ""
+}
+
+// Validate checks the confinement is supported and the seccomp profile compiles,
+// so misconfiguration is reported before any nydusd is spawned.
+func (c *Config) Validate() error {
+	if !c.confined() {
+		return nil
+	}
+
+	return validate(c)
+}
+
+// Command builds the command to spawn nydusd. Nydusd is executed directly unless
+// it needs confinement.
+func (c *Config) Command(nydusdPath string, args ...string) (*exec.Cmd, error) {
+	env := append(os.Environ(), c.Env...)
+
+	if !c.confined() {
+		cmd := exec.Command(nydusdPath, args...)
+		cmd.Env = env
+		return cmd, nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "locate snapshotter executable")
+	}
+
+	content, err := json.Marshal(c)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal launcher configuration")
+	}
+
+	cmd := exec.Command(self, append([]string{nydusdPath}, args...)...)
+	cmd.Args[0] = launcherName
+	cmd.Env = append(env, configEnv+"="+string(content))
+
+	return cmd, nil
+}
+
+// IsLauncher tells whether the current process is started as a launcher, in which
+// case `Main()` should be called before anything else.
+func IsLauncher() bool {
+	return len(os.Args) > 0 && os.Args[0] == launcherName
+}
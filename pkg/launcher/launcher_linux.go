@@ -0,0 +1,110 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package launcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+func validate(c *Config) error {
+	if c.SeccompProfile != "" {
+		if _, err := loadSeccompProfile(c.SeccompProfile); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Main confines the launcher and executes nydusd in place, it never returns.
+func Main() {
+	// Confinements below apply to the calling thread and are inherited through execve.
+	runtime.LockOSThread()
+
+	if err := launch(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", launcherName, err)
+		os.Exit(1)
+	}
+}
+
+func launch() error {
+	if len(os.Args) < 2 {
+		return errors.New("nydusd path is not provided")
+	}
+
+	var cfg Config
+	if err := json.Unmarshal([]byte(os.Getenv(configEnv)), &cfg); err != nil {
+		return errors.Wrap(err, "unmarshal launcher configuration")
+	}
+
+	env := make([]string, 0, len(os.Environ()))
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, configEnv+"=") {
+			env = append(env, e)
+		}
+	}
+
+	var filter []bpf.RawInstruction
+	if cfg.SeccompProfile != "" {
+		var err error
+		if filter, err = loadSeccompProfile(cfg.SeccompProfile); err != nil {
+			return err
+		}
+	}
+
+	if cfg.AppArmorProfile != "" {
+		if err := setAppArmorExecProfile(cfg.AppArmorProfile); err != nil {
+			return err
+		}
+	}
+
+	if cfg.NoNewPrivileges {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return errors.Wrap(err, "set no new privileges")
+		}
+	}
+
+	// Load seccomp filter at last, the profile must allow execve.
+	if filter != nil {
+		prog := unix.SockFprog{
+			Len:    uint16(len(filter)),
+			Filter: (*unix.SockFilter)(unsafe.Pointer(&filter[0])),
+		}
+		if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+			return errors.Wrap(err, "load seccomp filter")
+		}
+	}
+
+	nydusdPath := os.Args[1]
+	return unix.Exec(nydusdPath, os.Args[1:], env)
+}
+
+// The profile is switched to on the next execve of the thread.
+func setAppArmorExecProfile(profile string) error {
+	path := "/proc/thread-self/attr/apparmor/exec"
+	if _, err := os.Stat(path); err != nil {
+		path = "/proc/thread-self/attr/exec"
+	}
+
+	if err := os.WriteFile(path, []byte("exec "+profile), 0); err != nil {
+		return errors.Wrapf(err, "set AppArmor profile %s", profile)
+	}
+
+	return nil
+}
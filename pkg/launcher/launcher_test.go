@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package launcher
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommand(t *testing.T) {
+	cfg := Config{Env: []string{"RUST_LOG=debug"}}
+	cmd, err := cfg.Command("/usr/bin/nydusd", "fuse", "--apisock", "/run/api.sock")
+	require.NoError(t, err)
+	require.Equal(t, "/usr/bin/nydusd", cmd.Path)
+	require.Equal(t, []string{"/usr/bin/nydusd", "fuse", "--apisock", "/run/api.sock"}, cmd.Args)
+	require.Contains(t, cmd.Env, "RUST_LOG=debug")
+
+	cfg.NoNewPrivileges = true
+	cfg.AppArmorProfile = "nydusd"
+	cmd, err = cfg.Command("/usr/bin/nydusd", "fuse")
+	require.NoError(t, err)
+	require.Equal(t, []string{launcherName, "/usr/bin/nydusd", "fuse"}, cmd.Args)
+	require.Contains(t, cmd.Env, "RUST_LOG=debug")
+
+	var env string
+	for _, e := range cmd.Env {
+		if strings.HasPrefix(e, configEnv+"=") {
+			env = strings.TrimPrefix(e, configEnv+"=")
+		}
+	}
+	var passed Config
+	require.NoError(t, json.Unmarshal([]byte(env), &passed))
+	require.Equal(t, cfg, passed)
+}
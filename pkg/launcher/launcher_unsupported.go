@@ -0,0 +1,28 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package launcher
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+func validate(_ *Config) error {
+	return errors.Wrap(errdefs.ErrNotImplemented, "confine nydusd")
+}
+
+func Main() {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", launcherName, validate(nil))
+	os.Exit(1)
+}
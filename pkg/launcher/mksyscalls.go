@@ -0,0 +1,82 @@
+//go:build ignore
+// +build ignore
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Generate the syscall tables matching seccomp profiles by names from the syscall
+// numbers of golang.org/x/sys/unix in go.mod.
+//
+// Usage: go run mksyscalls.go <goarch> <audit arch>
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var sysnumRegexp = regexp.MustCompile(`^\s*(SYS_[A-Z0-9_]+)\s*=\s*\d+`)
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: go run mksyscalls.go <goarch> <audit arch>")
+		os.Exit(1)
+	}
+	goarch, auditArch := os.Args[1], os.Args[2]
+
+	if err := generate(goarch, auditArch); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func generate(goarch, auditArch string) error {
+	out, err := exec.Command("go", "list", "-m", "-f", "{{.Dir}}", "golang.org/x/sys").Output()
+	if err != nil {
+		return fmt.Errorf("locate golang.org/x/sys: %w", err)
+	}
+	source := fmt.Sprintf("zsysnum_linux_%s.go", goarch)
+	f, err := os.Open(filepath.Join(strings.TrimSpace(string(out)), "unix", source))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated from golang.org/x/sys/unix %s. DO NOT EDIT.\n\n", source)
+	fmt.Fprintf(&buf, "//go:build linux && %s\n// +build linux,%s\n\n", goarch, goarch)
+	fmt.Fprintf(&buf, "package launcher\n\nimport \"golang.org/x/sys/unix\"\n\n")
+	fmt.Fprintf(&buf, "const auditArch = unix.%s\n\n", auditArch)
+	fmt.Fprintf(&buf, "var syscallNumbers = map[string]uint32{\n")
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := sysnumRegexp.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(m[1], "SYS_"))
+		fmt.Fprintf(&buf, "%q: unix.%s,\n", name, m[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fmt.Sprintf("zsyscalls_linux_%s.go", goarch), code, 0644)
+}
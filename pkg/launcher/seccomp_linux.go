@@ -0,0 +1,134 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package launcher
+
+import (
+	"encoding/json"
+	"os"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Offsets of fields in `struct seccomp_data`
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	// Syscalls of x32 ABI have this bit set in their numbers.
+	x32SyscallBit = 0x40000000
+)
+
+//go:generate go run mksyscalls.go amd64 AUDIT_ARCH_X86_64
+//go:generate go run mksyscalls.go arm64 AUDIT_ARCH_AARCH64
+
+func loadSeccompProfile(path string) ([]bpf.RawInstruction, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read seccomp profile %s", path)
+	}
+
+	var profile specs.LinuxSeccomp
+	if err := json.Unmarshal(content, &profile); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal seccomp profile %s", path)
+	}
+
+	filter, err := compileSeccomp(&profile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "compile seccomp profile %s", path)
+	}
+
+	return filter, nil
+}
+
+func seccompAction(action specs.LinuxSeccompAction, errnoRet *uint) (uint32, error) {
+	switch action {
+	case specs.ActAllow:
+		return unix.SECCOMP_RET_ALLOW, nil
+	case specs.ActErrno:
+		errno := uint32(unix.EPERM)
+		if errnoRet != nil {
+			errno = uint32(*errnoRet)
+		}
+		return unix.SECCOMP_RET_ERRNO | (errno & unix.SECCOMP_RET_DATA), nil
+	case specs.ActKill, specs.ActKillThread:
+		return unix.SECCOMP_RET_KILL_THREAD, nil
+	case specs.ActKillProcess:
+		return unix.SECCOMP_RET_KILL_PROCESS, nil
+	case specs.ActTrap:
+		return unix.SECCOMP_RET_TRAP, nil
+	case specs.ActLog:
+		return unix.SECCOMP_RET_LOG, nil
+	default:
+		return 0, errors.Errorf("unsupported action %s", action)
+	}
+}
+
+// Syscalls of x32 ABI share the audit arch of x86_64 but are never matched by the
+// rules, deny them even if the default action allows.
+func x32Action(defaultAction uint32) uint32 {
+	if defaultAction&unix.SECCOMP_RET_ACTION_FULL == unix.SECCOMP_RET_ERRNO {
+		return defaultAction
+	}
+	return unix.SECCOMP_RET_KILL_PROCESS
+}
+
+// Compile the profile into a classic BPF program. Only syscall names are matched,
+// rules with argument conditions are rejected rather than silently relaxed.
+func compileSeccomp(profile *specs.LinuxSeccomp) ([]bpf.RawInstruction, error) {
+	if syscallNumbers == nil {
+		return nil, errors.New("seccomp is not supported on this architecture")
+	}
+
+	defaultAction, err := seccompAction(profile.DefaultAction, profile.DefaultErrnoRet)
+	if err != nil {
+		return nil, errors.Wrap(err, "default action")
+	}
+
+	program := []bpf.Instruction{
+		bpf.LoadAbsolute{Off: seccompDataArch, Size: 4},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: auditArch, SkipTrue: 1},
+		bpf.RetConstant{Val: unix.SECCOMP_RET_KILL_PROCESS},
+		bpf.LoadAbsolute{Off: seccompDataNr, Size: 4},
+		bpf.JumpIf{Cond: bpf.JumpGreaterOrEqual, Val: x32SyscallBit, SkipFalse: 1},
+		bpf.RetConstant{Val: x32Action(defaultAction)},
+	}
+
+	seen := make(map[uint32]bool)
+	for _, rule := range profile.Syscalls {
+		if len(rule.Args) > 0 {
+			return nil, errors.Errorf("argument conditions of syscalls %v are not supported", rule.Names)
+		}
+		action, err := seccompAction(rule.Action, rule.ErrnoRet)
+		if err != nil {
+			return nil, errors.Wrapf(err, "syscalls %v", rule.Names)
+		}
+		for _, name := range rule.Names {
+			nr, ok := syscallNumbers[name]
+			if !ok {
+				// Profiles are usually shared by architectures.
+				continue
+			}
+			// The first matching rule wins.
+			if seen[nr] {
+				continue
+			}
+			seen[nr] = true
+			program = append(program,
+				bpf.JumpIf{Cond: bpf.JumpEqual, Val: nr, SkipFalse: 1},
+				bpf.RetConstant{Val: action},
+			)
+		}
+	}
+	program = append(program, bpf.RetConstant{Val: defaultAction})
+
+	return bpf.Assemble(program)
+}
@@ -0,0 +1,107 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package launcher
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+// The BPF VM loads data in big endian.
+func seccompData(nr, arch uint32) []byte {
+	data := make([]byte, 64)
+	binary.BigEndian.PutUint32(data[seccompDataNr:], nr)
+	binary.BigEndian.PutUint32(data[seccompDataArch:], arch)
+	return data
+}
+
+func TestCompileSeccomp(t *testing.T) {
+	profile := `{
+		"defaultAction": "SCMP_ACT_ERRNO",
+		"defaultErrnoRet": 38,
+		"syscalls": [
+			{"names": ["read", "write", "execve", "not_a_syscall"], "action": "SCMP_ACT_ALLOW"},
+			{"names": ["ptrace"], "action": "SCMP_ACT_KILL_PROCESS"},
+			{"names": ["write"], "action": "SCMP_ACT_LOG"}
+		]
+	}`
+	path := filepath.Join(t.TempDir(), "seccomp.json")
+	require.NoError(t, os.WriteFile(path, []byte(profile), 0644))
+
+	raw, err := loadSeccompProfile(path)
+	require.NoError(t, err)
+	program, ok := bpf.Disassemble(raw)
+	require.True(t, ok)
+	vm, err := bpf.NewVM(program)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		nr     uint32
+		arch   uint32
+		action uint32
+	}{
+		{unix.SYS_READ, auditArch, unix.SECCOMP_RET_ALLOW},
+		{unix.SYS_WRITE, auditArch, unix.SECCOMP_RET_ALLOW},
+		{unix.SYS_EXECVE, auditArch, unix.SECCOMP_RET_ALLOW},
+		{unix.SYS_PTRACE, auditArch, unix.SECCOMP_RET_KILL_PROCESS},
+		{unix.SYS_MOUNT, auditArch, unix.SECCOMP_RET_ERRNO | 38},
+		{unix.SYS_READ | x32SyscallBit, auditArch, unix.SECCOMP_RET_ERRNO | 38},
+		{unix.SYS_READ, 0x40000003, unix.SECCOMP_RET_KILL_PROCESS},
+	} {
+		action, err := vm.Run(seccompData(c.nr, c.arch))
+		require.NoError(t, err)
+		require.Equal(t, c.action, uint32(action), "syscall %d arch %x", c.nr, c.arch)
+	}
+}
+
+func TestCompileSeccompX32(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seccomp.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"defaultAction": "SCMP_ACT_ALLOW",
+		"syscalls": [{"names": ["ptrace"], "action": "SCMP_ACT_ERRNO"}]}`), 0644))
+
+	raw, err := loadSeccompProfile(path)
+	require.NoError(t, err)
+	program, ok := bpf.Disassemble(raw)
+	require.True(t, ok)
+	vm, err := bpf.NewVM(program)
+	require.NoError(t, err)
+
+	action, err := vm.Run(seccompData(unix.SYS_READ, auditArch))
+	require.NoError(t, err)
+	require.Equal(t, uint32(unix.SECCOMP_RET_ALLOW), uint32(action))
+
+	// x32 syscalls are denied even if the default action allows.
+	action, err = vm.Run(seccompData(unix.SYS_PTRACE|x32SyscallBit, auditArch))
+	require.NoError(t, err)
+	require.Equal(t, uint32(unix.SECCOMP_RET_KILL_PROCESS), uint32(action))
+}
+
+func TestCompileSeccompUnsupported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seccomp.json")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"defaultAction": "SCMP_ACT_ALLOW",
+		"syscalls": [{"names": ["personality"], "action": "SCMP_ACT_ALLOW", "args": [{"index": 0, "value": 0, "op": "SCMP_CMP_EQ"}]}]}`), 0644))
+	_, err := loadSeccompProfile(path)
+	require.ErrorContains(t, err, "argument conditions")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"defaultAction": "SCMP_ACT_NOTIFY"}`), 0644))
+	_, err = loadSeccompProfile(path)
+	require.ErrorContains(t, err, "unsupported action")
+
+	cfg := Config{SeccompProfile: path}
+	require.Error(t, cfg.Validate())
+}
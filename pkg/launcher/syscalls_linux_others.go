@@ -0,0 +1,15 @@
+//go:build linux && !amd64 && !arm64
+// +build linux,!amd64,!arm64
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package launcher
+
+// Seccomp profiles are not supported on the other architectures yet.
+const auditArch = 0
+
+var syscallNumbers map[string]uint32
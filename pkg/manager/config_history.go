@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package manager
+
+import (
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config/daemonconfig"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/store"
+)
+
+// Operations changing configurations of daemons and RAFS instances.
+const (
+	ConfigOpStart    = "start"
+	ConfigOpMount    = "mount"
+	ConfigOpUmount   = "umount"
+	ConfigOpDestroy  = "destroy"
+	ConfigOpUpgrade  = "upgrade"
+	ConfigOpFailover = "failover"
+	ConfigOpRestart  = "restart"
+)
+
+const (
+	// Records of the configurations no longer in effect are dropped after this long,
+	// so that of the destroyed daemons is kept for a while after incidents.
+	configHistoryRetention     = 7 * 24 * time.Hour
+	configHistoryPruneInterval = time.Hour
+	// Records are written to the database in batches, off the mounting path.
+	configRecordQueueSize = 1024
+)
+
+// RecordConfig persists the configuration rendered for a daemon, or for the RAFS
+// instance `snapshotID` hosted by it, into the configuration history. Failing to
+// record doesn't fail the operation rendering the configuration.
+func (m *Manager) RecordConfig(d *daemon.Daemon, snapshotID, operation string, cfg daemonconfig.DaemonConfig) {
+	content, err := daemonconfig.DumpRedactedConfig(cfg)
+	if err != nil {
+		log.L.WithError(err).Warnf("Failed to serialize configuration of daemon %s", d.ID())
+		return
+	}
+
+	m.addConfigRecord(d.ID(), snapshotID, operation, content)
+}
+
+// RetireConfig records that the configuration of a daemon, or of the RAFS instance
+// `snapshotID` hosted by it, is no longer in effect.
+func (m *Manager) RetireConfig(d *daemon.Daemon, snapshotID, operation string) {
+	m.addConfigRecord(d.ID(), snapshotID, operation, nil)
+}
+
+func (m *Manager) addConfigRecord(daemonID, snapshotID, operation string, content []byte) {
+	m.configRecords <- &store.ConfigRecord{
+		DaemonID:   daemonID,
+		SnapshotID: snapshotID,
+		Operation:  operation,
+		Timestamp:  time.Now().UTC(),
+		Config:     content,
+	}
+}
+
+// Write the queued configuration records and prune the history periodically.
+func (m *Manager) runConfigHistory() {
+	ticker := time.NewTicker(configHistoryPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case r := <-m.configRecords:
+			records := []*store.ConfigRecord{r}
+		drain:
+			for len(records) < configRecordQueueSize {
+				select {
+				case r := <-m.configRecords:
+					records = append(records, r)
+				default:
+					break drain
+				}
+			}
+			if err := m.store.AddConfigRecords(records); err != nil {
+				log.L.WithError(err).Warnf("Failed to record %d daemon configurations", len(records))
+			}
+		case <-ticker.C:
+			if err := m.store.PruneConfigHistory(time.Now().Add(-configHistoryRetention)); err != nil {
+				log.L.WithError(err).Warn("Failed to prune configuration history")
+			}
+		}
+	}
+}
+
+// ConfigHistory returns the configurations rendered for a daemon, oldest first.
+// If `at` is not zero, only the configurations in effect at that time are
+// returned, i.e. the latest one of the daemon and of each RAFS instance unless
+// it's retired.
+func (m *Manager) ConfigHistory(daemonID string, at time.Time) ([]store.ConfigRecord, error) {
+	records, err := m.store.ListConfigRecords(daemonID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "list configuration history of daemon %s", daemonID)
+	}
+	if at.IsZero() {
+		return records, nil
+	}
+
+	latest := map[string]int{}
+	for i, r := range records {
+		if r.Timestamp.After(at) {
+			break
+		}
+		latest[r.SnapshotID] = i
+	}
+
+	effective := make([]store.ConfigRecord, 0, len(latest))
+	for i, r := range records {
+		if idx, ok := latest[r.SnapshotID]; ok && idx == i && !r.Retired() {
+			effective = append(effective, r)
+		}
+	}
+
+	return effective, nil
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/command"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/events"
 	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
 	metrics "github.com/containerd/nydus-snapshotter/pkg/metrics/tool"
 	"github.com/containerd/nydus-snapshotter/pkg/prefetch"
@@ -41,7 +42,20 @@ func (m *Manager) StartDaemon(d *daemon.Daemon) error {
 		return errors.Wrapf(err, "create command for daemon %s", d.ID())
 	}
 
-	if err := cmd.Start(); err != nil {
+	// Nydusd forked in a mount namespace lives in it, so do the mounts it performs.
+	start := cmd.Start
+	if m.MountNamespaces != nil {
+		ns := d.MountNamespace()
+		if ns == nil {
+			if ns, err = m.MountNamespaces.Get(); err != nil {
+				return errors.Wrapf(err, "get mount namespace for daemon %s", d.ID())
+			}
+			d.SetMountNamespace(ns)
+		}
+		start = func() error { return ns.Do(cmd.Start) }
+	}
+
+	if err := start(); err != nil {
 		return err
 	}
 
@@ -87,6 +101,7 @@ func (m *Manager) StartDaemon(d *daemon.Daemon) error {
 		if err := daemon.WaitUntilSocketExisted(d.GetAPISock(), d.States.ProcessID); err != nil {
 			// FIXME: Should clean the daemon record in DB if the nydusd fails starting
 			log.L.Errorf("Nydusd %s probably not started", d.ID())
+			m.FallBackIOEngine(d)
 			return
 		}
 
@@ -97,10 +112,18 @@ func (m *Manager) StartDaemon(d *daemon.Daemon) error {
 
 		if err := d.WaitUntilState(types.DaemonStateRunning); err != nil {
 			log.L.WithError(err).Errorf("daemon %s is not managed to reach RUNNING state", d.ID())
+			m.FallBackIOEngine(d)
+			return
+		}
+
+		// Daemons restarted are not waited for by mounting instances.
+		if err := d.ExposeMount(); err != nil {
+			log.L.WithError(err).Errorf("expose mount of daemon %s", d.ID())
 			return
 		}
 
 		collector.NewDaemonEventCollector(types.DaemonStateRunning).Collect()
+		events.Bus.Publish(events.DaemonStarted, d.ID(), "")
 
 		if m.CgroupMgr != nil {
 			if err := m.CgroupMgr.AddProc(d.States.ProcessID); err != nil {
@@ -110,7 +133,7 @@ func (m *Manager) StartDaemon(d *daemon.Daemon) error {
 		}
 
 		d.Lock()
-		collector.NewDaemonInfoCollector(&d.Version, 1).Collect()
+		collector.NewDaemonInfoCollector(&d.Version, d.IOEngine(), 1).Collect()
 		d.Unlock()
 
 		d.SendStates()
@@ -214,7 +237,10 @@ func (m *Manager) BuildDaemonCommand(d *daemon.Daemon, bin string, upgrade bool)
 
 	log.L.Infof("nydusd command: %s %s", nydusdPath, strings.Join(args, " "))
 
-	cmd := exec.Command(nydusdPath, args...)
+	cmd, err := m.Launcher.Command(nydusdPath, args...)
+	if err != nil {
+		return nil, err
+	}
 
 	// nydusd standard output and standard error rather than its logs are
 	// always redirected to snapshotter's respectively
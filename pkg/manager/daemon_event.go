@@ -14,6 +14,7 @@ import (
 	"github.com/containerd/nydus-snapshotter/config"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+	"github.com/containerd/nydus-snapshotter/pkg/events"
 	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
 	"github.com/pkg/errors"
 )
@@ -39,6 +40,7 @@ func (m *Manager) handleDaemonDeathEvent() {
 	// TODO: ratelimit for daemon recovery operations?
 	for ev := range m.LivenessNotifier {
 		log.L.Warnf("Daemon %s died! socket path %s", ev.daemonID, ev.path)
+		events.Bus.Publish(events.DaemonDied, ev.daemonID, "")
 
 		d := m.GetByDaemonID(ev.daemonID)
 		if d == nil {
@@ -47,7 +49,7 @@ func (m *Manager) handleDaemonDeathEvent() {
 		}
 
 		d.Lock()
-		collector.NewDaemonInfoCollector(&d.Version, -1).Collect()
+		collector.NewDaemonInfoCollector(&d.Version, d.IOEngine(), -1).Collect()
 		d.Unlock()
 
 		d.ResetState()
@@ -62,6 +64,26 @@ func (m *Manager) handleDaemonDeathEvent() {
 	}
 }
 
+// RestartAbortedDaemon restarts the daemon whose FUSE connection is aborted while
+// it's still alive. The aborted FUSE session can't be taken over, so the daemon
+// is restarted regardless of the recover policy. Only mounts of the instances
+// made afterwards are served by the restarted daemon, overlays of running
+// containers still refer to the aborted mount until the containers restart.
+func (m *Manager) RestartAbortedDaemon(d *daemon.Daemon) {
+	log.L.Warnf("Restart daemon %s of aborted FUSE connection", d.ID())
+
+	// Don't let the liveness monitor recover the daemon as well.
+	if err := m.UnsubscribeDaemonEvent(d); err != nil {
+		log.L.Warnf("fail to unsubscribe daemon %s, %v", d.ID(), err)
+	}
+	if err := d.Terminate(); err != nil {
+		log.L.WithError(err).Warnf("Failed to terminate daemon %s", d.ID())
+	}
+	d.ResetState()
+
+	go m.doDaemonRestart(d)
+}
+
 func (m *Manager) doDaemonFailover(d *daemon.Daemon) {
 	if err := d.Wait(); err != nil {
 		log.L.Warnf("fail to wait for daemon, %v", err)
@@ -94,6 +116,7 @@ func (m *Manager) doDaemonFailover(d *daemon.Daemon) {
 		log.L.Errorf("fail to takeover, %s", err)
 		return
 	}
+	m.RecordConfig(d, "", ConfigOpFailover, d.Config)
 
 	if err := d.Start(); err != nil {
 		log.L.Errorf("fail to start service, %s", err)
@@ -116,6 +139,7 @@ func (m *Manager) doDaemonRestart(d *daemon.Daemon) {
 		log.L.Errorf("fails to start daemon %s when recovering", d.ID())
 		return
 	}
+	m.RecordConfig(d, "", ConfigOpRestart, d.Config)
 
 	// Mount rafs instance by http API
 	instances := d.RafsCache.List()
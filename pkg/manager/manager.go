@@ -13,6 +13,7 @@ import (
 	"path"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 
 	"github.com/containerd/log"
 	"github.com/pkg/errors"
@@ -23,7 +24,11 @@ import (
 	"github.com/containerd/nydus-snapshotter/pkg/daemon"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/events"
+	"github.com/containerd/nydus-snapshotter/pkg/launcher"
 	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/tool"
+	"github.com/containerd/nydus-snapshotter/pkg/mountns"
 	"github.com/containerd/nydus-snapshotter/pkg/rafs"
 	"github.com/containerd/nydus-snapshotter/pkg/store"
 	"github.com/containerd/nydus-snapshotter/pkg/supervisor"
@@ -49,6 +54,14 @@ type Manager struct {
 	NydusdBinaryPath string
 	RecoverPolicy    config.DaemonRecoverPolicy
 	SupervisorSet    *supervisor.SupervisorsSet
+	// How to spawn nydusd processes
+	Launcher launcher.Config
+	// Nil if nydusd daemons live in the mount namespace of the snapshotter.
+	MountNamespaces *mountns.Pool
+	// Configuration records waiting to be written to `store`.
+	configRecords chan *store.ConfigRecord
+	// IO engine of nydusd daemons created from now on.
+	ioEngine atomic.Value
 }
 
 type Opt struct {
@@ -60,6 +73,11 @@ type Opt struct {
 	NydusdBinaryPath string
 	RecoverPolicy    config.DaemonRecoverPolicy
 	RootDir          string // Nydus-snapshotter work directory
+	SupervisorDir    string // Where the supervisor sockets reside, defaults to `supervisor` under RootDir
+	Launcher         launcher.Config
+	MountNamespaces  *mountns.Pool
+	// IO engine of nydusd, already checked against the node and nydusd.
+	IOEngine string
 }
 
 func NewManager(opt Opt) (*Manager, error) {
@@ -75,7 +93,11 @@ func NewManager(opt Opt) (*Manager, error) {
 
 	var supervisorSet *supervisor.SupervisorsSet
 	if opt.RecoverPolicy == config.RecoverPolicyFailover {
-		supervisorSet, err = supervisor.NewSupervisorSet(filepath.Join(opt.RootDir, "supervisor"))
+		supervisorDir := opt.SupervisorDir
+		if supervisorDir == "" {
+			supervisorDir = filepath.Join(opt.RootDir, "supervisor")
+		}
+		supervisorSet, err = supervisor.NewSupervisorSet(supervisorDir)
 		if err != nil {
 			return nil, errors.Wrap(err, "create supervisor set")
 		}
@@ -92,17 +114,58 @@ func NewManager(opt Opt) (*Manager, error) {
 		SupervisorSet:    supervisorSet,
 		DaemonConfig:     opt.DaemonConfig,
 		CgroupMgr:        opt.CgroupMgr,
+		Launcher:         opt.Launcher,
 		FsDriver:         opt.FsDriver,
+		MountNamespaces:  opt.MountNamespaces,
+		configRecords:    make(chan *store.ConfigRecord, configRecordQueueSize),
+	}
+
+	ioEngine := opt.IOEngine
+	if ioEngine == "" {
+		ioEngine = config.IOEngineSync
 	}
+	mgr.ioEngine.Store(ioEngine)
 
 	// FIXME: How to get error if monitor goroutine terminates with error?
 	// TODO: Shutdown monitor immediately after snapshotter receive Exit signal
 	mgr.monitor.Run()
 	go mgr.handleDaemonDeathEvent()
+	go mgr.runConfigHistory()
 
 	return mgr, nil
 }
 
+// IOEngine tells the IO engine of nydusd daemons created from now on.
+func (m *Manager) IOEngine() string {
+	return m.ioEngine.Load().(string)
+}
+
+// FallBackIOEngine falls back to sync IO for the daemons created afterwards, after
+// daemon `d` fails to start or mount with its IO engine. Nydusd may fail with
+// io_uring though the node supports it, e.g. being denied by the seccomp profile.
+func (m *Manager) FallBackIOEngine(d *daemon.Daemon) {
+	engine := d.IOEngine()
+	if engine == config.IOEngineSync {
+		return
+	}
+	if m.ioEngine.CompareAndSwap(engine, config.IOEngineSync) {
+		log.L.Warnf("Daemon %s failed with IO engine %s, fall back to %s",
+			d.ID(), engine, config.IOEngineSync)
+	}
+
+	// Instances mounted afterwards by a running shared daemon perform sync IO.
+	if d.IsSharedDaemon() && d.State() == types.DaemonStateRunning {
+		d.Lock()
+		collector.NewDaemonInfoCollector(&d.Version, engine, -1).Collect()
+		d.States.IOEngine = config.IOEngineSync
+		collector.NewDaemonInfoCollector(&d.Version, config.IOEngineSync, 1).Collect()
+		d.Unlock()
+		if err := m.UpdateDaemon(d); err != nil {
+			log.L.WithError(err).Warnf("Failed to update IO engine of daemon %s", d.ID())
+		}
+	}
+}
+
 func (m *Manager) Lock() {
 	m.mu.Lock()
 }
@@ -146,6 +209,10 @@ func (m *Manager) AddRafsInstance(r *rafs.Rafs) error {
 	return m.store.AddRafsInstance(r)
 }
 
+func (m *Manager) UpdateRafsInstance(r *rafs.Rafs) error {
+	return m.store.UpdateRafsInstance(r)
+}
+
 func (m *Manager) RemoveRafsInstance(snapshotID string) error {
 	return m.store.DeleteRafsInstance(snapshotID)
 }
@@ -250,6 +317,12 @@ func (m *Manager) DestroyDaemon(d *daemon.Daemon) error {
 	}
 
 	defer m.cleanUpDaemonResources(d)
+	defer events.Bus.Publish(events.DaemonDestroyed, d.ID(), "")
+
+	for _, r := range d.RafsCache.List() {
+		m.RetireConfig(d, r.SnapshotID, ConfigOpDestroy)
+	}
+	m.RetireConfig(d, "", ConfigOpDestroy)
 
 	if err := d.UmountRafsInstances(); err != nil {
 		log.L.Errorf("Failed to detach all fs instances from daemon %s, %s", d.ID(), err)
@@ -274,9 +347,13 @@ func (m *Manager) DestroyDaemon(d *daemon.Daemon) error {
 		log.L.Warnf("Failed to wait for daemon, %v", err)
 	}
 
+	if ns := d.ReleaseMountNamespace(); ns != nil && m.MountNamespaces != nil {
+		m.MountNamespaces.Put(ns)
+	}
+
 	collector.NewDaemonEventCollector(types.DaemonStateDestroyed).Collect()
 	d.Lock()
-	collector.NewDaemonInfoCollector(&d.Version, -1).Collect()
+	collector.NewDaemonInfoCollector(&d.Version, d.IOEngine(), -1).Collect()
 	d.Unlock()
 
 	return nil
@@ -285,7 +362,7 @@ func (m *Manager) DestroyDaemon(d *daemon.Daemon) error {
 func (m *Manager) cleanUpDaemonResources(d *daemon.Daemon) {
 	// TODO: use recycle bin to stage directories/files to be deleted.
 	resource := []string{d.States.ConfigDir, d.States.LogDir}
-	if !d.IsSharedDaemon() {
+	if !d.IsSharedDaemon() || d.IsPodDaemon() {
 		socketDir := path.Dir(d.GetAPISock())
 		resource = append(resource, socketDir)
 	}
@@ -331,21 +408,16 @@ func (m *Manager) recoverDaemons(ctx context.Context,
 			d.Config = cfg
 		}
 
-		state, err := d.GetState()
-		if err != nil {
-			log.L.Warnf("Daemon %s died somehow. Clean up its vestige!, %s", d.ID(), err)
+		// Querying the daemon is deferred to the first operation on it.
+		if !daemonAlive(d) {
+			log.L.Warnf("Daemon %s died somehow. Clean up its vestige!", d.ID())
 			(*recoveringDaemons)[d.ID()] = d
-			//nolint:nilerr
-			return nil
-		}
-
-		if state != types.DaemonStateRunning {
-			log.L.Warnf("daemon %s is not running: %s", d.ID(), state)
 			return nil
 		}
 
 		// FIXME: Should put the a daemon back file system shared damon field.
-		log.L.Infof("found RUNNING daemon %s during reconnecting", d.ID())
+		log.L.Infof("found alive daemon %s during reconnecting", d.ID())
+		d.MarkUnverified()
 		(*liveDaemons)[d.ID()] = d
 
 		if m.CgroupMgr != nil {
@@ -353,9 +425,17 @@ func (m *Manager) recoverDaemons(ctx context.Context,
 				return errors.Wrapf(err, "add daemon %s to cgroup failed", d.ID())
 			}
 		}
-		d.Lock()
-		collector.NewDaemonInfoCollector(&d.Version, 1).Collect()
-		d.Unlock()
+
+		// Take over the mount namespace of the daemon to perform mounts in it.
+		if m.MountNamespaces != nil {
+			if isolated, err := mountns.Isolated(d.Pid()); err == nil && isolated {
+				ns, err := mountns.FromProcess(d.Pid())
+				if err != nil {
+					return errors.Wrapf(err, "enter mount namespace of daemon %s", d.ID())
+				}
+				d.SetMountNamespace(ns)
+			}
+		}
 
 		go func() {
 			if err := daemon.WaitUntilSocketExisted(d.GetAPISock(), d.Pid()); err != nil {
@@ -363,7 +443,7 @@ func (m *Manager) recoverDaemons(ctx context.Context,
 				return
 			}
 
-			if err = m.SubscribeDaemonEvent(d); err != nil {
+			if err := m.SubscribeDaemonEvent(d); err != nil {
 				log.L.Errorf("Nydusd %s probably not started", d.ID())
 				return
 			}
@@ -379,3 +459,17 @@ func (m *Manager) recoverDaemons(ctx context.Context,
 
 	return nil
 }
+
+// Tell whether the daemon process is still alive with its API socket created,
+// without dialing the socket.
+func daemonAlive(d *daemon.Daemon) bool {
+	if d.Pid() <= 0 {
+		return false
+	}
+	if zombie, err := tool.IsZombieProcess(d.Pid()); err != nil || zombie {
+		return false
+	}
+
+	st, err := os.Stat(d.GetAPISock())
+	return err == nil && st.Mode()&os.ModeSocket != 0
+}
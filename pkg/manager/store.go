@@ -9,6 +9,7 @@ package manager
 
 import (
 	"context"
+	"time"
 
 	"github.com/containerd/nydus-snapshotter/pkg/daemon"
 	"github.com/containerd/nydus-snapshotter/pkg/rafs"
@@ -25,10 +26,15 @@ type Store interface {
 	CleanupDaemons(ctx context.Context) error
 
 	AddRafsInstance(r *rafs.Rafs) error
+	UpdateRafsInstance(r *rafs.Rafs) error
 	DeleteRafsInstance(snapshotID string) error
 	WalkRafsInstances(ctx context.Context, cb func(*rafs.Rafs) error) error
 
 	NextInstanceSeq() (uint64, error)
+
+	AddConfigRecords(records []*store.ConfigRecord) error
+	PruneConfigHistory(before time.Time) error
+	ListConfigRecords(daemonID string) ([]store.ConfigRecord, error)
 }
 
 var _ Store = &store.DaemonRafsStore{}
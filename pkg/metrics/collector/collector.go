@@ -41,8 +41,8 @@ func NewInflightMetricsVecCollector(hungIOInterval time.Duration) *InflightMetri
 	}
 }
 
-func NewDaemonInfoCollector(version *types.BuildTimeInfo, value float64) *DaemonInfoCollector {
-	return &DaemonInfoCollector{version, value}
+func NewDaemonInfoCollector(version *types.BuildTimeInfo, ioEngine string, value float64) *DaemonInfoCollector {
+	return &DaemonInfoCollector{version, ioEngine, value}
 }
 
 func NewSnapshotterMetricsCollector(ctx context.Context, cacheDir string, pid int) (*SnapshotterMetricsCollector, error) {
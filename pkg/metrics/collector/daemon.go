@@ -17,8 +17,9 @@ type DaemonEventCollector struct {
 }
 
 type DaemonInfoCollector struct {
-	Version *types.BuildTimeInfo
-	value   float64
+	Version  *types.BuildTimeInfo
+	IOEngine string
+	value    float64
 }
 
 type DaemonResourceCollector struct {
@@ -36,6 +37,7 @@ func (d *DaemonInfoCollector) Collect() {
 		return
 	}
 	data.NydusdCount.WithLabelValues(d.Version.PackageVer).Add(d.value)
+	data.NydusdIOEngineCount.WithLabelValues(d.IOEngine).Add(d.value)
 }
 
 func (d *DaemonResourceCollector) Collect() {
@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package collector
+
+import (
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+type DiskFullCollector struct {
+	full bool
+}
+
+func NewDiskFullCollector(full bool) *DiskFullCollector {
+	return &DiskFullCollector{full: full}
+}
+
+func (c *DiskFullCollector) Collect() {
+	if c.full {
+		data.DiskFull.Set(1)
+		data.DiskFullCount.Inc()
+	} else {
+		data.DiskFull.Set(0)
+	}
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package collector
+
+import (
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+// FuseConnectionState is the state of the FUSE connection of a daemon.
+type FuseConnectionState struct {
+	DaemonID string
+	State    string
+	Waiting  int
+}
+
+type FuseConnectionCollector struct {
+	conns []FuseConnectionState
+}
+
+type FuseConnectionAbortCollector struct{}
+
+func NewFuseConnectionCollector(conns []FuseConnectionState) *FuseConnectionCollector {
+	return &FuseConnectionCollector{conns: conns}
+}
+
+func NewFuseConnectionAbortCollector() *FuseConnectionAbortCollector {
+	return &FuseConnectionAbortCollector{}
+}
+
+func (c *FuseConnectionCollector) Collect() {
+	data.FuseConnectionCount.Reset()
+	data.FuseConnectionWaiting.Reset()
+	for _, conn := range c.conns {
+		data.FuseConnectionCount.WithLabelValues(conn.State).Inc()
+		data.FuseConnectionWaiting.WithLabelValues(conn.DaemonID).Set(float64(conn.Waiting))
+	}
+}
+
+func (c *FuseConnectionAbortCollector) Collect() {
+	data.FuseConnectionAbortCount.Inc()
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package collector
+
+import (
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+type MountCheckCollector struct {
+	Missing int
+	Stale   int
+}
+
+type MountHealCollector struct {
+	Succeeded bool
+}
+
+func NewMountCheckCollector(missing, stale int) *MountCheckCollector {
+	return &MountCheckCollector{Missing: missing, Stale: stale}
+}
+
+func NewMountHealCollector(succeeded bool) *MountHealCollector {
+	return &MountHealCollector{Succeeded: succeeded}
+}
+
+func (m *MountCheckCollector) Collect() {
+	data.MountDivergenceCount.WithLabelValues("missing").Set(float64(m.Missing))
+	data.MountDivergenceCount.WithLabelValues("stale").Set(float64(m.Stale))
+}
+
+func (m *MountHealCollector) Collect() {
+	result := "failure"
+	if m.Succeeded {
+		result = "success"
+	}
+	data.MountHealCount.WithLabelValues(result).Inc()
+}
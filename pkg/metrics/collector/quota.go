@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package collector
+
+import (
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+type ImageCacheCollector struct {
+	image   string
+	usage   int64
+	evicted int
+}
+
+func NewImageCacheCollector(image string, usage int64, evicted int) *ImageCacheCollector {
+	return &ImageCacheCollector{image: image, usage: usage, evicted: evicted}
+}
+
+func (c *ImageCacheCollector) Collect() {
+	data.ImageCacheUsage.WithLabelValues(c.image).Set(float64(c.usage))
+	if c.evicted > 0 {
+		data.CacheEvictedCount.WithLabelValues(c.image).Add(float64(c.evicted))
+	}
+}
@@ -0,0 +1,30 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package collector
+
+import (
+	"time"
+
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+type InstanceReadyCollector struct {
+	mount     time.Duration
+	firstRead time.Duration
+}
+
+// NewInstanceReadyCollector collects the time taken to mount a RAFS instance
+// since its snapshot was prepared, and to serve the first read since mounted.
+func NewInstanceReadyCollector(mount, firstRead time.Duration) *InstanceReadyCollector {
+	return &InstanceReadyCollector{mount: mount, firstRead: firstRead}
+}
+
+func (c *InstanceReadyCollector) Collect() {
+	data.InstanceReadyElapsedHists.WithLabelValues("mount").Observe(float64(c.mount.Milliseconds()))
+	data.InstanceReadyElapsedHists.WithLabelValues("first_read").Observe(float64(c.firstRead.Milliseconds()))
+	data.InstanceReadyElapsedHists.WithLabelValues("total").Observe(float64((c.mount + c.firstRead).Milliseconds()))
+}
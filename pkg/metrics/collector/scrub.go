@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package collector
+
+import (
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+type CacheScrubCollector struct {
+	bytes       int64
+	corrupted   bool
+	invalidated bool
+}
+
+func NewCacheScrubCollector(bytes int64, corrupted, invalidated bool) *CacheScrubCollector {
+	return &CacheScrubCollector{bytes: bytes, corrupted: corrupted, invalidated: invalidated}
+}
+
+func (c *CacheScrubCollector) Collect() {
+	data.CacheScrubBytes.Add(float64(c.bytes))
+	if c.corrupted {
+		data.CacheCorruptedCount.Inc()
+	}
+	if c.invalidated {
+		data.CacheInvalidatedCount.Inc()
+	}
+}
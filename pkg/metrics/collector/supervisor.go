@@ -0,0 +1,50 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package collector
+
+import (
+	"time"
+
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+type SupervisorOperation string
+
+const (
+	// Receive states from nydusd and keep them in supervisor.
+	SupervisorOperationSave SupervisorOperation = "SAVE"
+	// Send the kept states to a new nydusd.
+	SupervisorOperationRestore SupervisorOperation = "RESTORE"
+)
+
+type SupervisorStatesCollector struct {
+	DaemonID  string
+	Operation SupervisorOperation
+	Elapsed   time.Duration
+	Size      int
+	Failed    bool
+}
+
+func (s *SupervisorStatesCollector) Collect() {
+	labels := []string{s.DaemonID, string(s.Operation)}
+	if s.Failed {
+		data.SupervisorStatesFailures.WithLabelValues(labels...).Inc()
+		return
+	}
+
+	data.SupervisorStatesElapsedHists.WithLabelValues(labels...).Observe(float64(s.Elapsed.Milliseconds()))
+	data.SupervisorStatesSize.WithLabelValues(labels...).Set(float64(s.Size))
+}
+
+// Drop the per daemon metrics once the supervisor is destroyed along with its daemon.
+func DeleteSupervisorMetrics(daemonID string) {
+	for _, op := range []SupervisorOperation{SupervisorOperationSave, SupervisorOperationRestore} {
+		data.SupervisorStatesElapsedHists.DeleteLabelValues(daemonID, string(op))
+		data.SupervisorStatesSize.DeleteLabelValues(daemonID, string(op))
+		data.SupervisorStatesFailures.DeleteLabelValues(daemonID, string(op))
+	}
+}
@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package collector
+
+import (
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+type UmountEvent string
+
+const (
+	UmountEventDone  UmountEvent = "DONE"
+	UmountEventRetry UmountEvent = "RETRY"
+	UmountEventDead  UmountEvent = "DEAD"
+)
+
+type UmountEventCollector struct {
+	event UmountEvent
+}
+
+type UmountQueueCollector struct {
+	Pending     int
+	DeadLetters int
+}
+
+func NewUmountEventCollector(ev UmountEvent) *UmountEventCollector {
+	return &UmountEventCollector{event: ev}
+}
+
+func (u *UmountEventCollector) Collect() {
+	data.UmountEventCount.WithLabelValues(string(u.event)).Inc()
+}
+
+func (u *UmountQueueCollector) Collect() {
+	data.UmountQueueLength.Set(float64(u.Pending))
+	data.UmountDeadLetters.Set(float64(u.DeadLetters))
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package collector
+
+import (
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
+)
+
+type VolumeEvent string
+
+const (
+	VolumeEventMount     VolumeEvent = "MOUNT"
+	VolumeEventUmount    VolumeEvent = "UMOUNT"
+	VolumeEventPublish   VolumeEvent = "PUBLISH"
+	VolumeEventUnpublish VolumeEvent = "UNPUBLISH"
+	VolumeEventFailure   VolumeEvent = "FAILURE"
+)
+
+type VolumeEventCollector struct {
+	event VolumeEvent
+}
+
+type VolumeCountCollector struct {
+	Volumes int
+	Targets int
+}
+
+func NewVolumeEventCollector(ev VolumeEvent) *VolumeEventCollector {
+	return &VolumeEventCollector{event: ev}
+}
+
+func (v *VolumeEventCollector) Collect() {
+	data.VolumeEventCount.WithLabelValues(string(v.event)).Inc()
+}
+
+func (v *VolumeCountCollector) Collect() {
+	data.VolumeCount.Set(float64(v.Volumes))
+	data.VolumeTargetCount.Set(float64(v.Targets))
+}
@@ -14,6 +14,7 @@ import (
 var (
 	nydusdEventLabel   = "nydusd_event"
 	nydusdVersionLabel = "version"
+	ioEngineLabel      = "io_engine"
 	daemonIDLabel      = "daemon_id"
 )
 
@@ -32,6 +33,13 @@ var (
 		},
 		[]string{nydusdVersionLabel},
 	)
+	NydusdIOEngineCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "nydusd_io_engine_counts",
+			Help: "The counts of nydus daemon running with each IO engine.",
+		},
+		[]string{ioEngineLabel},
+	)
 	NydusdRSS = ttl.NewGaugeVecWithTTL(
 		prometheus.GaugeOpts{
 			Name: "nydusd_rss_kilobytes",
@@ -0,0 +1,27 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	DiskFull = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "snapshotter_disk_full",
+			Help: "Whether the disk of snapshotter is full and preparing snapshots is refused.",
+		},
+	)
+
+	DiskFullCount = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "snapshotter_disk_full_counts",
+			Help: "The counts of the disk of snapshotter becoming full.",
+		},
+	)
+)
@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	fuseConnectionStateLabel = "state"
+)
+
+var (
+	FuseConnectionCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "snapshotter_fuse_connection_counts",
+			Help: "The counts of FUSE connections of nydusd mounts in each state.",
+		},
+		[]string{fuseConnectionStateLabel},
+	)
+
+	FuseConnectionWaiting = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "snapshotter_fuse_connection_waiting_requests",
+			Help: "The number of FUSE requests waiting for replies of nydusd.",
+		},
+		[]string{daemonIDLabel},
+	)
+
+	FuseConnectionAbortCount = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "snapshotter_fuse_connection_abort_counts",
+			Help: "The counts of FUSE connections of nydusd mounts found aborted.",
+		},
+	)
+)
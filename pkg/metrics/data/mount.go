@@ -0,0 +1,34 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mountDivergenceLabel = "divergence"
+	mountHealResultLabel = "result"
+)
+
+var (
+	MountDivergenceCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "snapshotter_mount_divergence_counts",
+			Help: "The counts of mounts missing from or left in the mount table compared with the records.",
+		},
+		[]string{mountDivergenceLabel},
+	)
+
+	MountHealCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snapshotter_mount_heal_counts",
+			Help: "The counts of missing mounts mounted again for running containers.",
+		},
+		[]string{mountHealResultLabel},
+	)
+)
@@ -0,0 +1,29 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	ImageCacheUsage = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "snapshotter_image_cache_usage_bytes",
+			Help: "Disk usage of blob caches per image, which may exceed the quota while the image is mounted.",
+		},
+		[]string{imageRefLabel},
+	)
+
+	CacheEvictedCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snapshotter_cache_evicted_counts",
+			Help: "The counts of blob caches evicted to enforce the per image cache quota.",
+		},
+		[]string{imageRefLabel},
+	)
+)
@@ -0,0 +1,28 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	readyDurationBuckets = []float64{10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+	readyPhaseLabel      = "phase"
+)
+
+var (
+	InstanceReadyElapsedHists = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "snapshotter_instance_ready_elapsed_milliseconds",
+			Help: "The elapsed time from preparing a snapshot to its RAFS instance serving the first read. " +
+				"Phase mount is until the instance is mounted, first_read from then on and total for both.",
+			Buckets: readyDurationBuckets,
+		},
+		[]string{readyPhaseLabel},
+	)
+)
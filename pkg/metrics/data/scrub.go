@@ -0,0 +1,34 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	CacheScrubBytes = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "snapshotter_cache_scrub_bytes",
+			Help: "The bytes of blob caches read back by the background scrubber.",
+		},
+	)
+
+	CacheCorruptedCount = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "snapshotter_cache_corrupted_counts",
+			Help: "The counts of corrupted blob caches found by the background scrubber.",
+		},
+	)
+
+	CacheInvalidatedCount = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "snapshotter_cache_invalidated_counts",
+			Help: "The counts of blob caches whose corrupted chunks are invalidated to be fetched again.",
+		},
+	)
+)
@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	supervisorOperationLabel = "operation"
+)
+
+var (
+	SupervisorStatesElapsedHists = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "snapshotter_supervisor_states_elapsed_milliseconds",
+			Help:    "The elapsed time for supervisor to save or restore nydusd states.",
+			Buckets: defaultDurationBuckets,
+		},
+		[]string{daemonIDLabel, supervisorOperationLabel},
+	)
+
+	SupervisorStatesSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "snapshotter_supervisor_states_bytes",
+			Help: "Size of the nydusd states last saved or restored by supervisor.",
+		},
+		[]string{daemonIDLabel, supervisorOperationLabel},
+	)
+
+	SupervisorStatesFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snapshotter_supervisor_states_failure_counts",
+			Help: "The counts of failures for supervisor to save or restore nydusd states.",
+		},
+		[]string{daemonIDLabel, supervisorOperationLabel},
+	)
+)
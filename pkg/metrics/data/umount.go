@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	umountEventLabel = "umount_event"
+)
+
+var (
+	UmountQueueLength = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "snapshotter_umount_queue_length",
+			Help: "The counts of removed snapshots waiting to be umounted and cleaned up.",
+		},
+	)
+
+	UmountEventCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snapshotter_umount_event_counts",
+			Help: "The events of umounting and cleaning up removed snapshots in background.",
+		},
+		[]string{umountEventLabel},
+	)
+
+	UmountDeadLetters = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "snapshotter_umount_dead_letter_counts",
+			Help: "The counts of removed snapshots failed to be cleaned up after all retries.",
+		},
+	)
+)
@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package data
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	volumeEventLabel = "volume_event"
+)
+
+var (
+	VolumeEventCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "snapshotter_volume_event_counts",
+			Help: "The lifetime events of image volumes.",
+		},
+		[]string{volumeEventLabel},
+	)
+
+	VolumeCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "snapshotter_volume_counts",
+			Help: "The counts of image volumes mounted outside of container rootfs.",
+		},
+	)
+
+	VolumeTargetCount = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "snapshotter_volume_target_counts",
+			Help: "The counts of host paths image volumes are published to.",
+		},
+	)
+)
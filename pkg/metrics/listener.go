@@ -13,6 +13,7 @@ import (
 	"net/http"
 
 	"github.com/containerd/log"
+	"github.com/containerd/nydus-snapshotter/pkg/endpoint"
 	"github.com/containerd/nydus-snapshotter/pkg/metrics/registry"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -28,8 +29,9 @@ func trapClosedConnErr(err error) error {
 	return err
 }
 
-// NewListener creates a new TCP listener bound to the given address.
-func NewMetricsHTTPListenerServer(addr string) error {
+// NewListener creates a new TCP listener bound to the given address, which is
+// secured by TLS and token authentication if configured.
+func NewMetricsHTTPListenerServer(addr string, security *endpoint.Security) error {
 	if addr == "" {
 		return fmt.Errorf("the address for metrics HTTP server is invalid")
 	}
@@ -38,13 +40,13 @@ func NewMetricsHTTPListenerServer(addr string) error {
 		ErrorHandling: promhttp.HTTPErrorOnError,
 	}))
 
-	l, err := net.Listen("tcp", addr)
+	l, err := security.Listen(addr)
 	if err != nil {
 		return errors.Wrapf(err, "metrics server listener, addr=%s", addr)
 	}
 
 	go func() {
-		if err := http.Serve(l, nil); trapClosedConnErr(err) != nil {
+		if err := http.Serve(l, security.Handler(http.DefaultServeMux)); trapClosedConnErr(err) != nil {
 			log.L.Errorf("Metrics server fails to listen or serve %s: %v", addr, err)
 		}
 	}()
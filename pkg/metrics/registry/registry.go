@@ -23,6 +23,7 @@ func init() {
 		data.TotalHungIO,
 		data.NydusdEventCount,
 		data.NydusdCount,
+		data.NydusdIOEngineCount,
 		data.NydusdRSS,
 		data.SnapshotEventElapsedHists,
 		data.CacheUsage,
@@ -33,6 +34,28 @@ func init() {
 		data.Fds,
 		data.RunTime,
 		data.Thread,
+		data.VolumeEventCount,
+		data.VolumeCount,
+		data.VolumeTargetCount,
+		data.SupervisorStatesElapsedHists,
+		data.SupervisorStatesSize,
+		data.SupervisorStatesFailures,
+		data.UmountQueueLength,
+		data.UmountEventCount,
+		data.UmountDeadLetters,
+		data.MountDivergenceCount,
+		data.MountHealCount,
+		data.CacheScrubBytes,
+		data.CacheCorruptedCount,
+		data.CacheInvalidatedCount,
+		data.ImageCacheUsage,
+		data.CacheEvictedCount,
+		data.DiskFull,
+		data.DiskFullCount,
+		data.InstanceReadyElapsedHists,
+		data.FuseConnectionCount,
+		data.FuseConnectionWaiting,
+		data.FuseConnectionAbortCount,
 	)
 
 	for _, m := range data.MetricHists {
@@ -93,7 +93,7 @@ func (s *Server) CollectFsMetrics(ctx context.Context) {
 		daemons := pm.ListDaemons()
 		for _, d := range daemons {
 			// Skip daemons that are not serving
-			if d.State() != types.DaemonStateRunning {
+			if d.State() != types.DaemonStateRunning && !d.Unverified() {
 				continue
 			}
 
@@ -138,7 +138,7 @@ func (s *Server) CollectInflightMetrics(ctx context.Context) {
 		for _, d := range daemons {
 
 			// Only count for daemon that is serving
-			if d.State() != types.DaemonStateRunning {
+			if d.State() != types.DaemonStateRunning && !d.Unverified() {
 				continue
 			}
 
@@ -0,0 +1,330 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package migrate
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// Nydusd marks chunks ready in the chunk map after writing them into the blob
+// cache, see pkg/cache.
+const chunkMapFileSuffix = ".chunk_map"
+
+// Copy a directory tree preserving modes, owners, timestamps, extended attributes,
+// hardlinks and holes. Overlay layers keep whiteouts as device nodes and opaque
+// directories as extended attributes.
+type copier struct {
+	from, to string
+	// Relative paths not to copy
+	skip   func(rel string) bool
+	dryRun bool
+
+	// Relative paths of the copied files and directories, parents first.
+	copied []string
+	files  int
+	bytes  int64
+	// Copied files of multiple links, to link their other paths to.
+	links map[fileID]string
+}
+
+type fileID struct {
+	dev, ino uint64
+}
+
+func (c *copier) copyTree(ctx context.Context) error {
+	var dirs, files []string
+	err := filepath.WalkDir(c.from, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(c.from, p)
+		if err != nil {
+			return err
+		}
+		if c.skip != nil && c.skip(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case d.IsDir():
+			dirs = append(dirs, rel)
+		case d.Type().IsRegular(), d.Type()&(os.ModeSymlink|os.ModeDevice|os.ModeNamedPipe) != 0:
+			files = append(files, rel)
+		default:
+			// Dead sockets are of no use in the new root.
+			log.G(ctx).Debugf("Skip special file %s", p)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "walk %s", c.from)
+	}
+
+	// Copy the chunk maps before the blob caches, so that no chunk is marked
+	// ready in the copied chunk map while missing in the copied blob cache if
+	// nydusd keeps writing the cache meanwhile.
+	sort.SliceStable(files, func(i, j int) bool {
+		return strings.HasSuffix(files[i], chunkMapFileSuffix) && !strings.HasSuffix(files[j], chunkMapFileSuffix)
+	})
+
+	for _, rel := range dirs {
+		if err := c.copyDir(rel); err != nil {
+			return err
+		}
+	}
+	for _, rel := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := c.copyFile(rel); err != nil {
+			return err
+		}
+	}
+	if c.dryRun {
+		return nil
+	}
+	// Directory timestamps are changed by creating their entries.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := c.copyMeta(dirs[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *copier) copyDir(rel string) error {
+	c.copied = append(c.copied, rel)
+	if c.dryRun {
+		return nil
+	}
+
+	info, err := os.Stat(filepath.Join(c.from, rel))
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(c.to, rel)
+	if err := os.MkdirAll(dst, info.Mode().Perm()); err != nil {
+		return errors.Wrapf(err, "create directory %s", dst)
+	}
+
+	return nil
+}
+
+func (c *copier) copyFile(rel string) error {
+	src, dst := filepath.Join(c.from, rel), filepath.Join(c.to, rel)
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	c.copied = append(c.copied, rel)
+	c.files++
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if ok && st.Nlink > 1 && !info.IsDir() {
+		id := fileID{dev: uint64(st.Dev), ino: st.Ino}
+		if first, ok := c.links[id]; ok {
+			if c.dryRun {
+				return nil
+			}
+			if err := os.Link(filepath.Join(c.to, first), dst); err != nil {
+				return errors.Wrapf(err, "link %s", dst)
+			}
+			return nil
+		}
+		if c.links == nil {
+			c.links = map[fileID]string{}
+		}
+		c.links[id] = rel
+	}
+
+	if c.dryRun {
+		c.bytes += info.Size()
+		return nil
+	}
+
+	if ok && info.Mode()&(os.ModeDevice|os.ModeNamedPipe) != 0 {
+		if err := unix.Mknod(dst, st.Mode, int(st.Rdev)); err != nil {
+			return errors.Wrapf(err, "create node %s", dst)
+		}
+		return c.copyMeta(rel)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if filepath.IsAbs(target) && isUnder(target, c.from) {
+			target = filepath.Join(c.to, strings.TrimPrefix(target, c.from))
+		}
+		if err := os.Symlink(target, dst); err != nil {
+			return errors.Wrapf(err, "create symlink %s", dst)
+		}
+		return c.copyMeta(rel)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return errors.Wrapf(err, "create %s", dst)
+	}
+	defer out.Close()
+
+	n, err := copySparse(out, in, info.Size())
+	if err != nil {
+		return errors.Wrapf(err, "copy %s to %s", src, dst)
+	}
+	c.bytes += n
+
+	return c.copyMeta(rel)
+}
+
+// Copy the data of a file but the holes, blob caches are sparse files.
+func copySparse(dst, src *os.File, size int64) (int64, error) {
+	var copied, off int64
+	for off < size {
+		data, err := unix.Seek(int(src.Fd()), off, unix.SEEK_DATA)
+		if err != nil {
+			if errors.Is(err, syscall.ENXIO) {
+				// No data after the offset.
+				break
+			}
+			if errors.Is(err, syscall.EINVAL) {
+				// Holes are not supported by the filesystem.
+				return io.Copy(dst, io.NewSectionReader(src, 0, size))
+			}
+			return copied, err
+		}
+		hole, err := unix.Seek(int(src.Fd()), data, unix.SEEK_HOLE)
+		if err != nil {
+			return copied, err
+		}
+		if hole > size {
+			hole = size
+		}
+
+		n, err := io.Copy(io.NewOffsetWriter(dst, data), io.NewSectionReader(src, data, hole-data))
+		copied += n
+		if err != nil {
+			return copied, err
+		}
+		off = hole
+	}
+
+	return copied, dst.Truncate(size)
+}
+
+func (c *copier) copyMeta(rel string) error {
+	src, dst := filepath.Join(c.from, rel), filepath.Join(c.to, rel)
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	if err := os.Lchown(dst, int(st.Uid), int(st.Gid)); err != nil {
+		return errors.Wrapf(err, "change owner of %s", dst)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		if err := os.Chmod(dst, info.Mode()); err != nil {
+			return errors.Wrapf(err, "change mode of %s", dst)
+		}
+	}
+	// Changing the owner drops capabilities, so extended attributes come after.
+	if err := copyXattrs(src, dst); err != nil {
+		return err
+	}
+	times := []unix.Timespec{unix.Timespec(st.Atim), unix.Timespec(st.Mtim)}
+	if err := unix.UtimesNanoAt(unix.AT_FDCWD, dst, times, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return errors.Wrapf(err, "change timestamps of %s", dst)
+	}
+
+	return nil
+}
+
+func copyXattrs(src, dst string) error {
+	size, err := unix.Llistxattr(src, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil
+		}
+		return errors.Wrapf(err, "list extended attributes of %s", src)
+	}
+	if size == 0 {
+		return nil
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(src, buf); err != nil {
+		return errors.Wrapf(err, "list extended attributes of %s", src)
+	}
+
+	for _, name := range strings.Split(strings.TrimRight(string(buf[:size]), "\x00"), "\x00") {
+		size, err := unix.Lgetxattr(src, name, nil)
+		if err != nil {
+			return errors.Wrapf(err, "get extended attribute %s of %s", name, src)
+		}
+		value := make([]byte, size)
+		if size, err = unix.Lgetxattr(src, name, value); err != nil {
+			return errors.Wrapf(err, "get extended attribute %s of %s", name, src)
+		}
+		if err := unix.Lsetxattr(dst, name, value[:size], 0); err != nil {
+			return errors.Wrapf(err, "set extended attribute %s of %s", name, dst)
+		}
+	}
+
+	return nil
+}
+
+// Remove the copied files and the directories left empty from the source, but
+// the source itself.
+func (c *copier) removeCopied() error {
+	for i := len(c.copied) - 1; i >= 0; i-- {
+		if c.copied[i] == "." {
+			continue
+		}
+		p := filepath.Join(c.from, c.copied[i])
+		info, err := os.Lstat(p)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			// Directories holding pinned paths are kept.
+			if entries, err := os.ReadDir(p); err != nil || len(entries) > 0 {
+				continue
+			}
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "remove %s", p)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,529 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package migrate moves the snapshotter root directory to another path, e.g. on
+// a new disk, while nydusd daemons and containers keep running.
+//
+// The migration is staged. Migrate copies everything not in use into the new
+// root directory and bind mounts the paths still in use, like the mountpoints
+// of daemons and the snapshots of running containers, from the old one. The
+// persisted records and daemon configurations are rewritten to the new root, so
+// the snapshotter restarted on it recovers the daemons through the bind mounts,
+// and daemons failed over or started afterwards run entirely on the new root.
+// Release later moves the paths no longer in use and drops their bind mounts,
+// until nothing is left in the old root directory. The bind mounts don't survive
+// reboots, RestoreBinds establishes them again when the snapshotter starts, so
+// the old root directory must stay available until everything is released.
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/moby/sys/mountinfo"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/store"
+)
+
+const (
+	// Bind mounts not released yet, in the new root directory.
+	journalFile = "migration.json"
+	// The database of the snapshotter, locked while it's running.
+	databaseFile = "nydus.db"
+	configDir    = "config"
+)
+
+type Opt struct {
+	From string
+	To   string
+	// Remove the copied files from the old root directory to release the disk
+	// space. Files still opened by daemons are released once they exit.
+	RemoveSource bool
+	// Only plan the migration without changing anything.
+	DryRun bool
+}
+
+// Bind is a path still in use in the old root directory, bind mounted into the
+// new root directory.
+type Bind struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// Why the path is in use
+	Reason string `json:"reason"`
+}
+
+type Report struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	CopiedFiles int    `json:"copied_files"`
+	CopiedBytes int64  `json:"copied_bytes"`
+	// Rewritten daemon and RAFS instance records
+	Records  int    `json:"records"`
+	Binds    []Bind `json:"binds"`
+	Released []Bind `json:"released,omitempty"`
+}
+
+// List all mounts to find out the paths in use in the old root directory.
+var listMounts = func() ([]*mountinfo.Info, error) {
+	return mountinfo.GetMounts(nil)
+}
+
+// Whether a daemon is still listening on the socket.
+var socketAlive = func(p string) bool {
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return false
+	}
+	defer unix.Close(fd)
+	return unix.Connect(fd, &unix.SockaddrUnix{Name: p}) == nil
+}
+
+func isUnder(p, dir string) bool {
+	return p == dir || strings.HasPrefix(p, dir+string(filepath.Separator))
+}
+
+// Paths are pinned at the granularity of the second level of the root directory,
+// like `snapshots/<id>`, `mnt/<id>` or `socket/<id>`.
+func pinUnit(rel string) string {
+	parts := strings.SplitN(rel, string(filepath.Separator), 3)
+	if len(parts) > 2 {
+		parts = parts[:2]
+	}
+	return filepath.Join(parts...)
+}
+
+// Find the paths in use in root directory `from`, indexed by paths relative to
+// it: mountpoints, directories referenced by overlay mounts and live sockets.
+// Mountpoints in `binds`, bind mounted from elsewhere, are neither pinned nor
+// walked.
+func pinnedPaths(from string, mounts []*mountinfo.Info, binds map[string]bool) (map[string]string, error) {
+	pins := map[string]string{}
+	pin := func(p, reason string) {
+		if p == from || !isUnder(p, from) {
+			return
+		}
+		rel, err := filepath.Rel(from, p)
+		if err != nil {
+			return
+		}
+		if unit := pinUnit(rel); pins[unit] == "" {
+			pins[unit] = reason
+		}
+	}
+
+	for _, m := range mounts {
+		if !binds[m.Mountpoint] {
+			pin(m.Mountpoint, "mountpoint of "+m.FSType)
+		}
+		for _, opt := range strings.Split(m.VFSOptions, ",") {
+			k, v, ok := strings.Cut(opt, "=")
+			if !ok || (k != "lowerdir" && k != "upperdir" && k != "workdir") {
+				continue
+			}
+			for _, dir := range strings.Split(v, ":") {
+				pin(dir, "referenced by overlay "+m.Mountpoint)
+			}
+		}
+	}
+
+	err := filepath.WalkDir(from, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if binds[p] {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Don't descend into mounts, which are pinned already.
+		if d.IsDir() && p != from {
+			if rel, _ := filepath.Rel(from, p); pins[pinUnit(rel)] != "" {
+				return filepath.SkipDir
+			}
+		}
+		if d.Type()&os.ModeSocket != 0 && socketAlive(p) {
+			pin(p, "live socket")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "walk %s", from)
+	}
+
+	// Pins nested in pinned directories are covered by them.
+	for rel := range pins {
+		for parent := filepath.Dir(rel); parent != "."; parent = filepath.Dir(parent) {
+			if _, ok := pins[parent]; ok {
+				delete(pins, rel)
+				break
+			}
+		}
+	}
+
+	return pins, nil
+}
+
+func currentPins(from string) (map[string]string, error) {
+	mounts, err := listMounts()
+	if err != nil {
+		return nil, errors.Wrap(err, "list mounts")
+	}
+	return pinnedPaths(from, mounts, nil)
+}
+
+// Find the bind mounted paths in use through either the old or the new root
+// directory, containers started after the migration refer to the new one.
+func bindPins(report *Report) (map[string]string, error) {
+	mounts, err := listMounts()
+	if err != nil {
+		return nil, errors.Wrap(err, "list mounts")
+	}
+
+	pins, err := pinnedPaths(report.From, mounts, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The bind mounts themselves don't pin their targets, and sockets in them
+	// are found in the old root directory.
+	targets := map[string]bool{}
+	for _, b := range report.Binds {
+		targets[b.Target] = true
+	}
+	newPins, err := pinnedPaths(report.To, mounts, targets)
+	if err != nil {
+		return nil, err
+	}
+	for rel, reason := range newPins {
+		if pins[rel] == "" {
+			pins[rel] = reason
+		}
+	}
+
+	return pins, nil
+}
+
+// The snapshotter locks its database exclusively while running.
+func ensureSnapshotterStopped(root string) error {
+	p := filepath.Join(root, databaseFile)
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		return nil
+	}
+
+	db, err := bolt.Open(p, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return errors.Wrapf(err, "open %s, stop the snapshotter before migrating", p)
+	}
+	return db.Close()
+}
+
+func validate(opt *Opt) error {
+	if opt.From == "" || opt.To == "" {
+		return errors.Wrap(errdefs.ErrInvalidArgument, "empty root directory")
+	}
+	from, err := filepath.Abs(opt.From)
+	if err != nil {
+		return err
+	}
+	to, err := filepath.Abs(opt.To)
+	if err != nil {
+		return err
+	}
+	if isUnder(to, from) || isUnder(from, to) {
+		return errors.Wrapf(errdefs.ErrInvalidArgument, "root directories %s and %s overlap", from, to)
+	}
+	opt.From, opt.To = from, to
+
+	entries, err := os.ReadDir(to)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "read %s", to)
+	}
+	if len(entries) > 0 {
+		return errors.Wrapf(errdefs.ErrAlreadyExists, "new root directory %s is not empty", to)
+	}
+
+	return nil
+}
+
+// Migrate the root directory of a stopped snapshotter, daemons may keep running.
+func Migrate(ctx context.Context, opt Opt) (*Report, error) {
+	if err := validate(&opt); err != nil {
+		return nil, err
+	}
+	if err := ensureSnapshotterStopped(opt.From); err != nil {
+		return nil, err
+	}
+
+	pins, err := currentPins(opt.From)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{From: opt.From, To: opt.To, Binds: []Bind{}}
+	for rel, reason := range pins {
+		report.Binds = append(report.Binds, Bind{
+			Source: filepath.Join(opt.From, rel),
+			Target: filepath.Join(opt.To, rel),
+			Reason: reason,
+		})
+	}
+	sort.Slice(report.Binds, func(i, j int) bool {
+		return report.Binds[i].Source < report.Binds[j].Source
+	})
+
+	skip := func(rel string) bool {
+		_, ok := pins[rel]
+		return ok
+	}
+	c := copier{from: opt.From, to: opt.To, skip: skip, dryRun: opt.DryRun}
+	if err := c.copyTree(ctx); err != nil {
+		return nil, err
+	}
+	report.CopiedFiles, report.CopiedBytes = c.files, c.bytes
+
+	if opt.DryRun {
+		return report, nil
+	}
+
+	for _, b := range report.Binds {
+		if err := bindMount(b); err != nil {
+			return nil, err
+		}
+		log.G(ctx).Infof("Bind mounted %s in use to %s", b.Source, b.Target)
+	}
+
+	if report.Records, err = relocateRecords(ctx, opt.From, opt.To); err != nil {
+		return nil, err
+	}
+	if err := relocateConfigs(opt.From, opt.To, report.Binds); err != nil {
+		return nil, err
+	}
+	if err := writeJournal(opt.To, report); err != nil {
+		return nil, err
+	}
+
+	if opt.RemoveSource {
+		if err := c.removeCopied(); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// Release moves the paths no longer in use from the old root directory into the
+// new one and drops their bind mounts. Paths in use through either directory are
+// kept bind mounted. It may be run repeatedly along with the
+// snapshotter running on the new root directory.
+func Release(ctx context.Context, to string) (*Report, error) {
+	report, err := readJournal(to)
+	if err != nil {
+		return nil, err
+	}
+
+	pins, err := bindPins(report)
+	if err != nil {
+		return nil, err
+	}
+
+	binds := []Bind{}
+	for _, b := range report.Binds {
+		rel, err := filepath.Rel(report.From, b.Source)
+		if err != nil {
+			return nil, err
+		}
+		if reason, ok := pins[rel]; ok {
+			log.G(ctx).Infof("Path %s is still in use, %s", b.Source, reason)
+			binds = append(binds, b)
+			continue
+		}
+
+		if err := unix.Unmount(b.Target, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) {
+			return nil, errors.Wrapf(err, "umount %s", b.Target)
+		}
+		c := copier{from: b.Source, to: b.Target}
+		if err := c.copyTree(ctx); err != nil {
+			return nil, err
+		}
+		if err := os.RemoveAll(b.Source); err != nil {
+			return nil, errors.Wrapf(err, "remove %s", b.Source)
+		}
+		report.CopiedFiles += c.files
+		report.CopiedBytes += c.bytes
+		report.Released = append(report.Released, b)
+		log.G(ctx).Infof("Released %s into %s", b.Source, b.Target)
+	}
+	report.Binds = binds
+
+	if len(binds) == 0 {
+		if err := os.Remove(filepath.Join(to, journalFile)); err != nil {
+			return nil, errors.Wrap(err, "remove migration journal")
+		}
+		return report, nil
+	}
+
+	return report, writeJournal(to, report)
+}
+
+// RestoreBinds bind mounts again the paths in use recorded by the ongoing migration
+// into the new root directory, e.g. after reboot. Nothing is done if no migration
+// is in progress.
+func RestoreBinds(ctx context.Context, to string) error {
+	report, err := readJournal(to)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	mounts, err := listMounts()
+	if err != nil {
+		return errors.Wrap(err, "list mounts")
+	}
+	mounted := map[string]bool{}
+	for _, m := range mounts {
+		mounted[m.Mountpoint] = true
+	}
+
+	for _, b := range report.Binds {
+		if mounted[b.Target] {
+			continue
+		}
+		if err := bindMount(b); err != nil {
+			return errors.Wrapf(err, "restore bind mount of migration from %s, is it still available", report.From)
+		}
+		log.G(ctx).Infof("Bind mounted %s in use to %s again", b.Source, b.Target)
+	}
+
+	return nil
+}
+
+func bindMount(b Bind) error {
+	info, err := os.Lstat(b.Source)
+	if err != nil {
+		return errors.Wrapf(err, "stat %s", b.Source)
+	}
+
+	if info.IsDir() {
+		if err := os.MkdirAll(b.Target, info.Mode().Perm()); err != nil {
+			return errors.Wrapf(err, "create directory %s", b.Target)
+		}
+	} else {
+		// Non-directory mount targets, e.g. of sockets, must be files.
+		if err := os.MkdirAll(filepath.Dir(b.Target), 0700); err != nil {
+			return errors.Wrapf(err, "create directory %s", filepath.Dir(b.Target))
+		}
+		f, err := os.OpenFile(b.Target, os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return errors.Wrapf(err, "create %s", b.Target)
+		}
+		f.Close()
+	}
+
+	if err := unix.Mount(b.Source, b.Target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return errors.Wrapf(err, "bind mount %s to %s", b.Source, b.Target)
+	}
+
+	return nil
+}
+
+func relocateRecords(ctx context.Context, from, to string) (int, error) {
+	if _, err := os.Stat(filepath.Join(to, databaseFile)); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	db, err := store.NewDatabase(to)
+	if err != nil {
+		return 0, errors.Wrapf(err, "open database in %s", to)
+	}
+	defer db.Close()
+
+	return db.RelocateRoot(ctx, from, to)
+}
+
+// Daemon configurations refer to files in the root directory, like the cache
+// directory and the bootstraps. Configurations in bind mounted directories are
+// still used by the daemons in the old root directory, so they're untouched.
+func relocateConfigs(from, to string, binds []Bind) error {
+	dir := filepath.Join(to, configDir)
+	replacer := strings.NewReplacer(`"`+from+`/`, `"`+to+`/`, `"`+from+`"`, `"`+to+`"`)
+
+	err := filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, b := range binds {
+			if isUnder(p, b.Target) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if d.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		relocated := replacer.Replace(string(content))
+		if relocated == string(content) {
+			return nil
+		}
+		return os.WriteFile(p, []byte(relocated), 0600)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "relocate daemon configurations in %s", dir)
+	}
+
+	return nil
+}
+
+func writeJournal(to string, report *Report) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal migration journal")
+	}
+	if err := os.WriteFile(filepath.Join(to, journalFile), content, 0600); err != nil {
+		return errors.Wrap(err, "write migration journal")
+	}
+	return nil
+}
+
+func readJournal(to string) (*Report, error) {
+	content, err := os.ReadFile(filepath.Join(to, journalFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrapf(errdefs.ErrNotFound, "no migration in progress in %s", to)
+		}
+		return nil, errors.Wrap(err, "read migration journal")
+	}
+
+	var report Report
+	if err := json.Unmarshal(content, &report); err != nil {
+		return nil, errors.Wrap(err, "unmarshal migration journal")
+	}
+	report.Released = nil
+
+	return &report, nil
+}
@@ -0,0 +1,215 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package migrate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moby/sys/mountinfo"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+	"github.com/containerd/nydus-snapshotter/pkg/store"
+)
+
+func TestPinnedPaths(t *testing.T) {
+	from := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(from, "snapshots", "1", "fs"), 0755))
+
+	mounts := []*mountinfo.Info{
+		{Mountpoint: filepath.Join(from, "mnt"), FSType: "fuse.nydusd"},
+		{Mountpoint: filepath.Join(from, "snapshots", "2", "mnt"), FSType: "erofs"},
+		{Mountpoint: "/run/containerd/rootfs", FSType: "overlay",
+			VFSOptions: "lowerdir=" + filepath.Join(from, "mnt", "d1") + ":" + filepath.Join(from, "snapshots", "1", "fs") +
+				",upperdir=" + filepath.Join(from, "snapshots", "3", "fs") + ",workdir=" + filepath.Join(from, "snapshots", "3", "work")},
+		{Mountpoint: "/other", FSType: "ext4"},
+	}
+
+	pins, err := pinnedPaths(from, mounts, nil)
+	require.NoError(t, err)
+	require.Len(t, pins, 4)
+	require.Contains(t, pins, "mnt")
+	require.Contains(t, pins, filepath.Join("snapshots", "1"))
+	require.Contains(t, pins, filepath.Join("snapshots", "2"))
+	require.Contains(t, pins, filepath.Join("snapshots", "3"))
+}
+
+func TestBindPins(t *testing.T) {
+	from, to := t.TempDir(), t.TempDir()
+	report := &Report{From: from, To: to, Binds: []Bind{
+		{Source: filepath.Join(from, "snapshots", "4"), Target: filepath.Join(to, "snapshots", "4")},
+		{Source: filepath.Join(from, "snapshots", "5"), Target: filepath.Join(to, "snapshots", "5")},
+	}}
+	listMounts = func() ([]*mountinfo.Info, error) {
+		return []*mountinfo.Info{
+			{Mountpoint: filepath.Join(to, "snapshots", "4"), FSType: "ext4"},
+			{Mountpoint: filepath.Join(to, "snapshots", "5"), FSType: "ext4"},
+			// A container started after the migration
+			{Mountpoint: "/run/containerd/rootfs", FSType: "overlay",
+				VFSOptions: "upperdir=" + filepath.Join(to, "snapshots", "5", "fs")},
+		}, nil
+	}
+	defer func() { listMounts = func() ([]*mountinfo.Info, error) { return mountinfo.GetMounts(nil) } }()
+
+	pins, err := bindPins(report)
+	require.NoError(t, err)
+	require.Len(t, pins, 1)
+	require.Contains(t, pins, filepath.Join("snapshots", "5"))
+}
+
+func TestCopyTree(t *testing.T) {
+	from, to := t.TempDir(), t.TempDir()
+	layer := filepath.Join(from, "fs")
+	require.NoError(t, os.MkdirAll(filepath.Join(layer, "opaque"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(layer, "file"), []byte("data"), 0644))
+	require.NoError(t, os.Link(filepath.Join(layer, "file"), filepath.Join(layer, "link")))
+	require.NoError(t, unix.Mkfifo(filepath.Join(layer, "fifo"), 0600))
+	whiteout := unix.Mknod(filepath.Join(layer, "whiteout"), unix.S_IFCHR, 0) == nil
+	xattr := unix.Setxattr(filepath.Join(layer, "opaque"), "user.overlay.opaque", []byte("y"), 0) == nil
+
+	c := copier{from: from, to: to}
+	require.NoError(t, c.copyTree(context.TODO()))
+
+	var file, link unix.Stat_t
+	require.NoError(t, unix.Stat(filepath.Join(to, "fs", "file"), &file))
+	require.NoError(t, unix.Stat(filepath.Join(to, "fs", "link"), &link))
+	require.Equal(t, file.Ino, link.Ino)
+	require.Equal(t, int64(4), c.bytes)
+
+	info, err := os.Lstat(filepath.Join(to, "fs", "fifo"))
+	require.NoError(t, err)
+	require.NotZero(t, info.Mode()&os.ModeNamedPipe)
+	if whiteout {
+		info, err := os.Lstat(filepath.Join(to, "fs", "whiteout"))
+		require.NoError(t, err)
+		require.NotZero(t, info.Mode()&os.ModeCharDevice)
+	}
+	if xattr {
+		value := make([]byte, 1)
+		_, err := unix.Getxattr(filepath.Join(to, "fs", "opaque"), "user.overlay.opaque", value)
+		require.NoError(t, err)
+		require.Equal(t, "y", string(value))
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	from, to := t.TempDir(), filepath.Join(t.TempDir(), "root")
+	listMounts = func() ([]*mountinfo.Info, error) { return nil, nil }
+	ctx := context.TODO()
+
+	db, err := store.NewDatabase(from)
+	require.NoError(t, err)
+	d := daemon.Daemon{States: daemon.ConfigState{
+		ID:         "d1",
+		APISocket:  filepath.Join(from, "socket", "d1", "api.sock"),
+		Mountpoint: "/elsewhere/d1",
+		ConfigDir:  filepath.Join(from, "config", "d1"),
+	}}
+	require.NoError(t, db.SaveDaemon(ctx, &d))
+	require.NoError(t, db.AddRafsInstance(ctx, &rafs.Rafs{SnapshotID: "1", DaemonID: "d1",
+		SnapshotDir: filepath.Join(from, "snapshots", "1")}))
+	require.NoError(t, db.Close())
+
+	configFile := filepath.Join(from, "config", "d1", "config.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(configFile), 0755))
+	require.NoError(t, os.WriteFile(configFile, []byte(`{"work_dir":"`+from+`/cache","other":"`+from+`x"}`), 0600))
+
+	// A sparse blob cache
+	cacheFile := filepath.Join(from, "cache", "blob.blob.data")
+	require.NoError(t, os.MkdirAll(filepath.Dir(cacheFile), 0755))
+	f, err := os.Create(cacheFile)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte("data"), 1<<20)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, os.Symlink(cacheFile, filepath.Join(from, "cache", "link")))
+
+	report, err := Migrate(ctx, Opt{From: from, To: to, DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 4, report.CopiedFiles)
+	_, err = os.Stat(to)
+	require.True(t, os.IsNotExist(err))
+
+	report, err = Migrate(ctx, Opt{From: from, To: to, RemoveSource: true})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Records)
+	require.Empty(t, report.Binds)
+
+	content, err := os.ReadFile(filepath.Join(to, "cache", "blob.blob.data"))
+	require.NoError(t, err)
+	require.Len(t, content, 1<<20+4)
+	require.Equal(t, "data", string(content[1<<20:]))
+	link, err := os.Readlink(filepath.Join(to, "cache", "link"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(to, "cache", "blob.blob.data"), link)
+
+	content, err = os.ReadFile(filepath.Join(to, "config", "d1", "config.json"))
+	require.NoError(t, err)
+	require.Equal(t, `{"work_dir":"`+to+`/cache","other":"`+from+`x"}`, string(content))
+
+	db, err = store.NewDatabase(to)
+	require.NoError(t, err)
+	err = db.WalkDaemons(ctx, func(s *daemon.ConfigState) error {
+		require.Equal(t, filepath.Join(to, "socket", "d1", "api.sock"), s.APISocket)
+		require.Equal(t, "/elsewhere/d1", s.Mountpoint)
+		return nil
+	})
+	require.NoError(t, err)
+	err = db.WalkRafsInstances(ctx, func(r *rafs.Rafs) error {
+		require.Equal(t, filepath.Join(to, "snapshots", "1"), r.SnapshotDir)
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	// The copied files are removed from the old root
+	entries, err := os.ReadDir(from)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// Nothing left to release
+	_, err = Release(ctx, to)
+	require.NoError(t, err)
+	_, err = Release(ctx, to)
+	require.True(t, errdefs.IsNotFound(err))
+
+	// The new root directory must be empty
+	_, err = Migrate(ctx, Opt{From: t.TempDir(), To: to})
+	require.True(t, errdefs.IsAlreadyExists(err))
+}
+
+func TestRestoreBinds(t *testing.T) {
+	from, to := t.TempDir(), t.TempDir()
+	ctx := context.TODO()
+
+	// No migration in progress
+	require.NoError(t, RestoreBinds(ctx, to))
+
+	report := &Report{From: from, To: to, Binds: []Bind{
+		{Source: filepath.Join(from, "snapshots", "4"), Target: filepath.Join(to, "snapshots", "4")},
+	}}
+	require.NoError(t, writeJournal(to, report))
+
+	// Still bind mounted
+	listMounts = func() ([]*mountinfo.Info, error) {
+		return []*mountinfo.Info{{Mountpoint: filepath.Join(to, "snapshots", "4"), FSType: "ext4"}}, nil
+	}
+	require.NoError(t, RestoreBinds(ctx, to))
+
+	// Gone after reboot, while the old root directory is unavailable
+	listMounts = func() ([]*mountinfo.Info, error) { return nil, nil }
+	require.Error(t, RestoreBinds(ctx, to))
+}
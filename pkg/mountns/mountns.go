@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package mountns holds mount namespaces private to the snapshotter, in which
+// nydusd performs FUSE mounts and the snapshotter mounts EROFS. Clones of the
+// mounts are attached to the host for containerd, so stray host processes only
+// ever keep the clones busy, which are detached lazily on removal.
+package mountns
+
+import (
+	"sync"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+)
+
+// Namespace is served by an OS thread entered into it for its whole lifetime,
+// processes forked from the thread live in the namespace as well.
+type Namespace struct {
+	reqs      chan func()
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newNamespace() *Namespace {
+	return &Namespace{
+		reqs: make(chan func()),
+		done: make(chan struct{}),
+	}
+}
+
+func (ns *Namespace) serve() {
+	for {
+		select {
+		case fn := <-ns.reqs:
+			fn()
+		case <-ns.done:
+			return
+		}
+	}
+}
+
+// Do runs `fn` in the mount namespace.
+func (ns *Namespace) Do(fn func() error) error {
+	errCh := make(chan error, 1)
+	select {
+	case ns.reqs <- func() { errCh <- fn() }:
+	case <-ns.done:
+		return errors.New("mount namespace is closed")
+	}
+
+	return <-errCh
+}
+
+// Close releases the thread serving the namespace. The namespace is gone
+// along with its mounts once no process lives in it.
+func (ns *Namespace) Close() {
+	ns.closeOnce.Do(func() { close(ns.done) })
+}
+
+// Pool keeps mount namespaces created in advance to be handed out to nydusd
+// daemons, and reuses those returned after cleaning up their mounts.
+type Pool struct {
+	mu   sync.Mutex
+	size int
+	// Mounts under the root directory are cleaned up before reuse.
+	root string
+	free []*Namespace
+}
+
+func NewPool(size int, root string) (*Pool, error) {
+	p := &Pool{size: size, root: root}
+	for i := 0; i < size; i++ {
+		ns, err := New()
+		if err != nil {
+			p.Close()
+			return nil, errors.Wrap(err, "create mount namespace")
+		}
+		p.free = append(p.free, ns)
+	}
+
+	return p, nil
+}
+
+// Get a mount namespace from the pool, a new one is created if the pool is
+// drained.
+func (p *Pool) Get() (*Namespace, error) {
+	p.mu.Lock()
+	if n := len(p.free); n > 0 {
+		ns := p.free[n-1]
+		p.free = p.free[:n-1]
+		p.mu.Unlock()
+		return ns, nil
+	}
+	p.mu.Unlock()
+
+	return New()
+}
+
+// Put a mount namespace no longer used back to the pool.
+func (p *Pool) Put(ns *Namespace) {
+	if err := ns.cleanup(p.root); err != nil {
+		log.L.WithError(err).Warn("Failed to clean up mount namespace, discard it")
+		ns.Close()
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.free) >= p.size {
+		ns.Close()
+		return
+	}
+	p.free = append(p.free, ns)
+}
+
+// Close the idle mount namespaces in the pool.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ns := range p.free {
+		ns.Close()
+	}
+	p.free = nil
+}
@@ -0,0 +1,164 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package mountns
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+
+	"github.com/moby/sys/mountinfo"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+func start(enter func() error) (*Namespace, error) {
+	ns := newNamespace()
+	errCh := make(chan error, 1)
+	run := func() {
+		if err := enter(); err != nil {
+			errCh <- err
+			return
+		}
+		errCh <- nil
+		ns.serve()
+	}
+	go func() {
+		// Never unlock the thread, so it's terminated rather than reused by
+		// other goroutines once the namespace is closed.
+		runtime.LockOSThread()
+		if unix.Gettid() != unix.Getpid() {
+			run()
+			return
+		}
+		// The main thread is never terminated and tells the namespaces of the
+		// process, hop to another thread while holding it.
+		locked := make(chan struct{})
+		go func() {
+			runtime.LockOSThread()
+			close(locked)
+			run()
+		}()
+		<-locked
+		runtime.UnlockOSThread()
+	}()
+
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+
+	return ns, nil
+}
+
+// New creates a mount namespace. Host mounts propagate into the namespace,
+// but not the other way round.
+func New() (*Namespace, error) {
+	return start(func() error {
+		if err := unix.Unshare(unix.CLONE_FS | unix.CLONE_NEWNS); err != nil {
+			return errors.Wrap(err, "unshare mount namespace")
+		}
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_SLAVE, ""); err != nil {
+			return errors.Wrap(err, "make mounts slave")
+		}
+		return nil
+	})
+}
+
+// FromProcess enters the mount namespace of process `pid`, e.g. to take over
+// the namespace of a nydusd daemon after the snapshotter restarts.
+func FromProcess(pid int) (*Namespace, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/ns/mnt", pid))
+	if err != nil {
+		return nil, errors.Wrapf(err, "open mount namespace of process %d", pid)
+	}
+	defer f.Close()
+
+	return start(func() error {
+		// Threads sharing file system attributes with others can't switch mount namespace.
+		if err := unix.Unshare(unix.CLONE_FS); err != nil {
+			return errors.Wrap(err, "unshare file system attributes")
+		}
+		if err := unix.Setns(int(f.Fd()), unix.CLONE_NEWNS); err != nil {
+			return errors.Wrapf(err, "enter mount namespace of process %d", pid)
+		}
+		return nil
+	})
+}
+
+// Isolated tells whether process `pid` lives in a mount namespace other than
+// the snapshotter's.
+func Isolated(pid int) (bool, error) {
+	var self, other unix.Stat_t
+	if err := unix.Stat("/proc/self/ns/mnt", &self); err != nil {
+		return false, err
+	}
+	if err := unix.Stat(fmt.Sprintf("/proc/%d/ns/mnt", pid), &other); err != nil {
+		return false, err
+	}
+
+	return self.Dev != other.Dev || self.Ino != other.Ino, nil
+}
+
+// Expose attaches a clone of the mount at `source` in the namespace to
+// `target` in the mount namespace of the snapshotter.
+func (ns *Namespace) Expose(source, target string) error {
+	var fd int
+	if err := ns.Do(func() (err error) {
+		fd, err = unix.OpenTree(unix.AT_FDCWD, source, unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC|unix.AT_RECURSIVE)
+		return err
+	}); err != nil {
+		return errors.Wrapf(err, "clone mount %s", source)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.MoveMount(fd, "", unix.AT_FDCWD, target, unix.MOVE_MOUNT_F_EMPTY_PATH); err != nil {
+		return errors.Wrapf(err, "attach mount to %s", target)
+	}
+
+	return nil
+}
+
+// Detach the exposed clone of a mount. It's detached lazily as host processes
+// may still keep it busy, which doesn't hold the mount in the namespace.
+func Detach(target string) error {
+	if err := unix.Unmount(target, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.ENOENT) {
+		return errors.Wrapf(err, "detach mount %s", target)
+	}
+	return nil
+}
+
+// Umount the mounts under `root` left in the namespace.
+func (ns *Namespace) cleanup(root string) error {
+	return ns.Do(func() error {
+		// `/proc/self` refers to the main thread living in the host namespace.
+		f, err := os.Open("/proc/thread-self/mountinfo")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		mounts, err := mountinfo.GetMountsFromReader(f, mountinfo.PrefixFilter(root))
+		if err != nil {
+			return errors.Wrap(err, "get mounts")
+		}
+		// Umount nested mounts first.
+		sort.Slice(mounts, func(i, j int) bool {
+			return len(mounts[i].Mountpoint) > len(mounts[j].Mountpoint)
+		})
+		for _, m := range mounts {
+			if err := unix.Unmount(m.Mountpoint, unix.MNT_DETACH); err != nil && !errors.Is(err, unix.EINVAL) {
+				return errors.Wrapf(err, "umount %s", m.Mountpoint)
+			}
+		}
+
+		return nil
+	})
+}
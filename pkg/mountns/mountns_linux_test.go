@@ -0,0 +1,101 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package mountns
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/moby/sys/mountinfo"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestNamespace(t *testing.T) {
+	pool, err := NewPool(1, t.TempDir())
+	if err != nil {
+		t.Skipf("mount namespace is not supported: %v", err)
+	}
+	defer pool.Close()
+
+	ns, err := pool.Get()
+	require.NoError(t, err)
+	mnt := filepath.Join(pool.root, "mnt")
+	require.NoError(t, os.Mkdir(mnt, 0755))
+
+	// The mount is invisible to the host until exposed.
+	require.NoError(t, ns.Do(func() error {
+		return unix.Mount("tmpfs", mnt, "tmpfs", 0, "")
+	}))
+	require.NoError(t, ns.Do(func() error {
+		return os.WriteFile(filepath.Join(mnt, "file"), []byte("data"), 0644)
+	}))
+	_, err = os.Stat(filepath.Join(mnt, "file"))
+	require.True(t, os.IsNotExist(err))
+
+	if err := ns.Expose(mnt, mnt); err != nil {
+		t.Skipf("open_tree is not supported: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(mnt, "file"))
+	require.NoError(t, err)
+	require.Equal(t, "data", string(content))
+
+	// The mount in the namespace is kept after the clone is detached.
+	require.NoError(t, Detach(mnt))
+	mounted, err := mountinfo.Mounted(mnt)
+	require.NoError(t, err)
+	require.False(t, mounted)
+	require.NoError(t, ns.Do(func() error {
+		_, err := os.Stat(filepath.Join(mnt, "file"))
+		return err
+	}))
+
+	// Mounts are cleaned up when returned to the pool.
+	pool.Put(ns)
+	require.Len(t, pool.free, 1)
+	require.NoError(t, ns.Do(func() error {
+		_, err := os.Stat(filepath.Join(mnt, "file"))
+		require.True(t, os.IsNotExist(err))
+		return nil
+	}))
+
+	isolated, err := Isolated(os.Getpid())
+	require.NoError(t, err)
+	require.False(t, isolated)
+
+	// Processes forked in the namespace live in it.
+	cmd := exec.Command("sleep", "10")
+	require.NoError(t, ns.Do(cmd.Start))
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	isolated, err = Isolated(cmd.Process.Pid)
+	require.NoError(t, err)
+	require.True(t, isolated)
+	other, err := FromProcess(cmd.Process.Pid)
+	require.NoError(t, err)
+	defer other.Close()
+	require.NoError(t, other.Do(func() error {
+		if err := unix.Mount("tmpfs", mnt, "tmpfs", 0, ""); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(mnt, "other"), []byte("data"), 0644)
+	}))
+	require.NoError(t, ns.Do(func() error {
+		_, err := os.Stat(filepath.Join(mnt, "other"))
+		return err
+	}))
+
+	pool.Close()
+	require.Error(t, ns.Do(func() error { return nil }))
+}
@@ -0,0 +1,40 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package mountns
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+func New() (*Namespace, error) {
+	return nil, errors.Wrap(errdefs.ErrNotImplemented, "create mount namespace")
+}
+
+func FromProcess(_ int) (*Namespace, error) {
+	return nil, errors.Wrap(errdefs.ErrNotImplemented, "enter mount namespace")
+}
+
+func Isolated(_ int) (bool, error) {
+	return false, nil
+}
+
+func (ns *Namespace) Expose(_, _ string) error {
+	return errors.Wrap(errdefs.ErrNotImplemented, "expose mount")
+}
+
+func Detach(_ string) error {
+	return nil
+}
+
+func (ns *Namespace) cleanup(_ string) error {
+	return nil
+}
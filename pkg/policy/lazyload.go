@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package policy decides which images are allowed to be lazily loaded. Images denied
+// lazy loading are fully downloaded before their containers start, so that they
+// don't depend on the network at runtime.
+package policy
+
+import (
+	"path"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+// A pattern ending with `/**` matches all the repositories under the prefix.
+const recursiveSuffix = "/**"
+
+type LazyLoadingPolicy struct {
+	allowedImages     []string
+	deniedImages      []string
+	allowedRegistries []string
+	deniedRegistries  []string
+}
+
+func validatePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(strings.TrimSuffix(p, recursiveSuffix), ""); err != nil {
+			return errors.Wrapf(errdefs.ErrInvalidArgument, "pattern %q: %s", p, err)
+		}
+	}
+	return nil
+}
+
+func NewLazyLoadingPolicy(cfg config.LazyLoadingConfig) (*LazyLoadingPolicy, error) {
+	for _, patterns := range [][]string{cfg.AllowedImages, cfg.DeniedImages, cfg.AllowedRegistries, cfg.DeniedRegistries} {
+		if err := validatePatterns(patterns); err != nil {
+			return nil, err
+		}
+	}
+
+	return &LazyLoadingPolicy{
+		allowedImages:     cfg.AllowedImages,
+		deniedImages:      cfg.DeniedImages,
+		allowedRegistries: cfg.AllowedRegistries,
+		deniedRegistries:  cfg.DeniedRegistries,
+	}, nil
+}
+
+func matchImage(pattern, name, ref string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, recursiveSuffix); ok {
+		return strings.HasPrefix(name, prefix+"/")
+	}
+	// The pattern may or may not carry a tag or digest.
+	for _, s := range []string{name, ref} {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegistry(pattern, domain string) bool {
+	ok, _ := path.Match(pattern, domain)
+	return ok
+}
+
+func (p *LazyLoadingPolicy) empty() bool {
+	return len(p.allowedImages) == 0 && len(p.deniedImages) == 0 &&
+		len(p.allowedRegistries) == 0 && len(p.deniedRegistries) == 0
+}
+
+// Allowed tells whether the image can be lazily loaded and why. Denying rules take
+// precedence over allowing ones. When no allowing rule is configured, all the
+// images not denied are allowed, otherwise an image must match one of them.
+// Images with unknown or invalid references are denied once any rule is configured.
+func (p *LazyLoadingPolicy) Allowed(imageRef string) (bool, string) {
+	if p == nil || p.empty() {
+		return true, ""
+	}
+	if imageRef == "" {
+		return false, "image reference is unknown"
+	}
+
+	named, err := reference.ParseDockerRef(imageRef)
+	if err != nil {
+		return false, "invalid image reference: " + err.Error()
+	}
+	name := named.Name()
+	ref := named.String()
+	domain := reference.Domain(named)
+
+	for _, pattern := range p.deniedRegistries {
+		if matchRegistry(pattern, domain) {
+			return false, "registry matches denied pattern " + pattern
+		}
+	}
+	for _, pattern := range p.deniedImages {
+		if matchImage(pattern, name, ref) {
+			return false, "image matches denied pattern " + pattern
+		}
+	}
+
+	if len(p.allowedImages) == 0 && len(p.allowedRegistries) == 0 {
+		return true, ""
+	}
+
+	for _, pattern := range p.allowedRegistries {
+		if matchRegistry(pattern, domain) {
+			return true, "registry matches allowed pattern " + pattern
+		}
+	}
+	for _, pattern := range p.allowedImages {
+		if matchImage(pattern, name, ref) {
+			return true, "image matches allowed pattern " + pattern
+		}
+	}
+
+	return false, "no allowed pattern matches"
+}
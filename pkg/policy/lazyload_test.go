@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+)
+
+func TestLazyLoadingPolicy(t *testing.T) {
+	var p *LazyLoadingPolicy
+	allowed, _ := p.Allowed("docker.io/library/nginx:latest")
+	assert.True(t, allowed)
+
+	_, err := NewLazyLoadingPolicy(config.LazyLoadingConfig{DeniedImages: []string{"docker.io/[library"}})
+	require.Error(t, err)
+
+	p, err = NewLazyLoadingPolicy(config.LazyLoadingConfig{})
+	require.NoError(t, err)
+	allowed, _ = p.Allowed("nginx")
+	assert.True(t, allowed)
+	allowed, _ = p.Allowed("")
+	assert.True(t, allowed)
+
+	p, err = NewLazyLoadingPolicy(config.LazyLoadingConfig{
+		DeniedImages:     []string{"registry.example.com/security/**", "docker.io/library/busybox:1.*"},
+		DeniedRegistries: []string{"*.internal"},
+	})
+	require.NoError(t, err)
+
+	for ref, expected := range map[string]bool{
+		"":               false,
+		"INVALID:ref":    false,
+		"nginx":          true,
+		"busybox:latest": true,
+		"busybox:1.36":   false,
+		"registry.example.com/security/scanner:v1": false,
+		"registry.example.com/security/a/b@sha256:0123456789012345678901234567890123456789012345678901234567890123": false,
+		"registry.example.com/app:v1":   true,
+		"registry.corp.internal/app:v1": false,
+	} {
+		allowed, reason := p.Allowed(ref)
+		assert.Equal(t, expected, allowed, "%s: %s", ref, reason)
+	}
+
+	p, err = NewLazyLoadingPolicy(config.LazyLoadingConfig{
+		AllowedImages:     []string{"docker.io/library/*"},
+		AllowedRegistries: []string{"ghcr.io"},
+		DeniedImages:      []string{"docker.io/library/redis"},
+	})
+	require.NoError(t, err)
+
+	for ref, expected := range map[string]bool{
+		"nginx:latest":                true,
+		"redis:7":                     false,
+		"docker.io/someone/app:v1":    false,
+		"ghcr.io/someone/app:v1":      true,
+		"registry.example.com/app:v1": false,
+	} {
+		allowed, reason := p.Allowed(ref)
+		assert.Equal(t, expected, allowed, "%s: %s", ref, reason)
+	}
+}
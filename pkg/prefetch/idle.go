@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package prefetch
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Cumulative usage counters of the node.
+type nodeUsage struct {
+	cpuTotal uint64
+	cpuIdle  uint64
+	rxBytes  uint64
+	at       time.Time
+}
+
+// Read the CPU time from /proc/stat and received bytes of network interfaces
+// other than loopback from /proc/net/dev.
+var readNodeUsage = func() (*nodeUsage, error) {
+	u := &nodeUsage{at: time.Now()}
+
+	stat, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	line, _, _ := strings.Cut(string(stat), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return nil, errors.Errorf("unexpected cpu line %q", line)
+	}
+	for i, f := range fields[1:] {
+		v, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse cpu line %q", line)
+		}
+		u.cpuTotal += v
+		// idle and iowait
+		if i == 3 || i == 4 {
+			u.cpuIdle += v
+		}
+	}
+
+	f, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) == "lo" {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) == 0 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			u.rxBytes += v
+		}
+	}
+
+	return u, scanner.Err()
+}
+
+// CPU usage in percentage and network receive rate in bytes per second between
+// two samples.
+func (u *nodeUsage) since(prev *nodeUsage) (float64, float64) {
+	var cpu, rx float64
+	if total := u.cpuTotal - prev.cpuTotal; total > 0 {
+		cpu = 100 * float64(total-(u.cpuIdle-prev.cpuIdle)) / float64(total)
+	}
+	if elapsed := u.at.Sub(prev.at).Seconds(); elapsed > 0 {
+		rx = float64(u.rxBytes-prev.rxBytes) / elapsed
+	}
+	return cpu, rx
+}
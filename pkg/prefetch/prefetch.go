@@ -16,6 +16,8 @@ import (
 type prefetchInfo struct {
 	prefetchMap   map[string]string
 	prefetchMutex sync.Mutex
+	// Prefetch lists are kept but not handed out while paused
+	paused bool
 }
 
 var Pm prefetchInfo
@@ -46,6 +48,9 @@ func (p *prefetchInfo) GetPrefetchInfo(image string) string {
 	p.prefetchMutex.Lock()
 	defer p.prefetchMutex.Unlock()
 
+	if p.paused {
+		return ""
+	}
 	if prefetchfiles, ok := p.prefetchMap[image]; ok {
 		return prefetchfiles
 	}
@@ -58,3 +63,18 @@ func (p *prefetchInfo) DeleteFromPrefetchMap(image string) {
 
 	delete(p.prefetchMap, image)
 }
+
+// Pause or resume prefetching, e.g. when the disk is full.
+func (p *prefetchInfo) SetPaused(paused bool) {
+	p.prefetchMutex.Lock()
+	defer p.prefetchMutex.Unlock()
+
+	p.paused = paused
+}
+
+func (p *prefetchInfo) Paused() bool {
+	p.prefetchMutex.Lock()
+	defer p.prefetchMutex.Unlock()
+
+	return p.paused
+}
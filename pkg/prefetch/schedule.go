@@ -0,0 +1,361 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package prefetch
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+// Priority classes of full image prefetch.
+const (
+	// Prefetched right away when mounted.
+	PriorityCritical = "critical"
+	// Prefetched in time windows or while the node is idle.
+	PriorityNormal = "normal"
+	// Prefetched in time windows while the node is idle.
+	PriorityLow = "low"
+)
+
+var priorityOrder = map[string]int{PriorityNormal: 0, PriorityLow: 1}
+
+// Window is a daily time window in local time, which wraps around midnight if
+// it ends before it starts.
+type Window struct {
+	start, end time.Duration
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, errors.Wrapf(errdefs.ErrInvalidArgument, "invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ParseWindow parses windows like "22:00-06:00".
+func ParseWindow(s string) (Window, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return Window{}, errors.Wrapf(errdefs.ErrInvalidArgument, "invalid time window %q", s)
+	}
+	var w Window
+	var err error
+	if w.start, err = parseClock(start); err != nil {
+		return Window{}, err
+	}
+	if w.end, err = parseClock(end); err != nil {
+		return Window{}, err
+	}
+	return w, nil
+}
+
+func (w Window) contains(t time.Time) bool {
+	clock := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if w.start <= w.end {
+		return clock >= w.start && clock < w.end
+	}
+	return clock >= w.start || clock < w.end
+}
+
+type ScheduleOpt struct {
+	Windows []Window
+	// The node is idle when its CPU usage in percentage is below the threshold,
+	// and its network receive rate in bytes per second is below the threshold.
+	// Zero disables the condition.
+	IdleCPUPercent  float64
+	IdleNetworkRate float64
+	Interval        time.Duration
+}
+
+type task struct {
+	snapshotID string
+	mountpoint string
+	priority   string
+	enqueued   time.Time
+}
+
+// Scheduler defers full image prefetch of RAFS instances to time windows or
+// while the node is idle, so warming caches doesn't compete with latency
+// critical traffic. Deferred instances are prefetched by reading all of their
+// files through the mountpoints, one instance at a time.
+type Scheduler struct {
+	opt ScheduleOpt
+
+	mu    sync.Mutex
+	queue []*task
+	// Idle state of the node of the last sample
+	idle bool
+	prev *nodeUsage
+	// Snapshot being prefetched and how to stop it
+	running string
+	cancel  context.CancelFunc
+}
+
+func NewScheduler(opt ScheduleOpt) *Scheduler {
+	return &Scheduler{opt: opt}
+}
+
+func (s *Scheduler) idleConfigured() bool {
+	return s.opt.IdleCPUPercent > 0 || s.opt.IdleNetworkRate > 0
+}
+
+// Whether instances of the priority class may be prefetched now.
+func (s *Scheduler) open(priority string, now time.Time) bool {
+	if priority == PriorityCritical {
+		return true
+	}
+
+	inWindow := false
+	for _, w := range s.opt.Windows {
+		if w.contains(now) {
+			inWindow = true
+			break
+		}
+	}
+	s.mu.Lock()
+	idle := s.idle
+	s.mu.Unlock()
+
+	if priority == PriorityLow {
+		return (len(s.opt.Windows) == 0 || inWindow) && (!s.idleConfigured() || idle)
+	}
+	return inWindow || (s.idleConfigured() && idle)
+}
+
+// Priority class of full image prefetch of an instance.
+func priority(labels map[string]string) string {
+	switch p := labels[label.NydusPrefetchPriority]; p {
+	case PriorityCritical, PriorityLow:
+		return p
+	default:
+		return PriorityNormal
+	}
+}
+
+// Defer tells whether full image prefetch requested by the labels should be
+// deferred rather than performed by nydusd right after mounting.
+func (s *Scheduler) Defer(labels map[string]string) bool {
+	if s == nil || labels[label.NydusPrefetchAll] != "true" {
+		return false
+	}
+	return !s.open(priority(labels), time.Now())
+}
+
+// Enqueue an instance whose full image prefetch is deferred.
+func (s *Scheduler) Enqueue(snapshotID, mountpoint string, labels map[string]string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queue = append(s.queue, &task{
+		snapshotID: snapshotID,
+		mountpoint: mountpoint,
+		priority:   priority(labels),
+		enqueued:   time.Now(),
+	})
+	log.L.Infof("Defer prefetching snapshot %s of priority %s", snapshotID, priority(labels))
+}
+
+// Remove an instance from the queue, e.g. when it's umounted, and stop
+// prefetching it.
+func (s *Scheduler) Remove(snapshotID string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.queue {
+		if t.snapshotID == snapshotID {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			break
+		}
+	}
+	if s.running == snapshotID && s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// Pending lists the snapshots whose prefetch is deferred, in the order they're
+// going to be prefetched.
+func (s *Scheduler) Pending() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sortQueue()
+	ids := make([]string, 0, len(s.queue))
+	for _, t := range s.queue {
+		ids = append(ids, t.snapshotID)
+	}
+	return ids
+}
+
+// Higher priority first, and first come first served within a class.
+func (s *Scheduler) sortQueue() {
+	sort.SliceStable(s.queue, func(i, j int) bool {
+		pi, pj := priorityOrder[s.queue[i].priority], priorityOrder[s.queue[j].priority]
+		if pi != pj {
+			return pi < pj
+		}
+		return s.queue[i].enqueued.Before(s.queue[j].enqueued)
+	})
+}
+
+func (s *Scheduler) sample(ctx context.Context) {
+	if !s.idleConfigured() {
+		return
+	}
+	u, err := readNodeUsage()
+	if err != nil {
+		log.G(ctx).WithError(err).Warn("Failed to read node usage")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.prev != nil {
+		cpu, rx := u.since(s.prev)
+		s.idle = (s.opt.IdleCPUPercent <= 0 || cpu < s.opt.IdleCPUPercent) &&
+			(s.opt.IdleNetworkRate <= 0 || rx < s.opt.IdleNetworkRate)
+	}
+	s.prev = u
+}
+
+// Pop the first task allowed to run now.
+func (s *Scheduler) next(now time.Time) *task {
+	s.mu.Lock()
+	s.sortQueue()
+	queue := append([]*task(nil), s.queue...)
+	s.mu.Unlock()
+
+	for _, t := range queue {
+		if !s.open(t.priority, now) {
+			continue
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, q := range s.queue {
+			if q == t {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				return t
+			}
+		}
+		return nil
+	}
+
+	return nil
+}
+
+// Prefetch an instance until it's done, or it's no longer allowed, e.g. the
+// window closes, in which case it's queued again and false is returned.
+func (s *Scheduler) run(ctx context.Context, t *task) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s.mu.Lock()
+	s.running, s.cancel = t.snapshotID, cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running, s.cancel = "", nil
+		s.mu.Unlock()
+	}()
+
+	start := time.Now()
+	log.G(ctx).Infof("Start deferred prefetch of snapshot %s", t.snapshotID)
+	n, err := warm(ctx, t.mountpoint, func() bool {
+		return s.open(t.priority, time.Now())
+	})
+	switch {
+	case err == nil:
+		log.G(ctx).Infof("Prefetched %d bytes of snapshot %s in %s", n, t.snapshotID, time.Since(start))
+	case errors.Is(err, errPaused):
+		log.G(ctx).Infof("Pause prefetch of snapshot %s after %d bytes", t.snapshotID, n)
+		s.mu.Lock()
+		s.queue = append(s.queue, t)
+		s.mu.Unlock()
+		return false
+	case errors.Is(err, context.Canceled):
+		log.G(ctx).Infof("Stop prefetch of snapshot %s", t.snapshotID)
+	default:
+		log.G(ctx).WithError(err).Warnf("Failed to prefetch snapshot %s", t.snapshotID)
+	}
+	return true
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opt.Interval)
+	defer ticker.Stop()
+
+	s.sample(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sample(ctx)
+			for !Pm.Paused() {
+				t := s.next(time.Now())
+				if t == nil || !s.run(ctx, t) {
+					break
+				}
+			}
+		}
+	}
+}
+
+var errPaused = errors.New("prefetch is not allowed now")
+
+// Read all the files under the directory to have their data fetched into cache,
+// checking whether it may go on between files.
+func warm(ctx context.Context, dir string, allowed func() bool) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if !allowed() || Pm.Paused() {
+			return errPaused
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err := io.Copy(io.Discard, f)
+		total += n
+		return err
+	})
+
+	return total, err
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package prefetch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+func at(clock string) time.Time {
+	t, _ := time.ParseInLocation("15:04", clock, time.Local)
+	return t
+}
+
+func TestParseWindow(t *testing.T) {
+	w, err := ParseWindow("09:00-17:30")
+	require.NoError(t, err)
+	require.True(t, w.contains(at("09:00")))
+	require.True(t, w.contains(at("17:29")))
+	require.False(t, w.contains(at("17:30")))
+	require.False(t, w.contains(at("08:59")))
+
+	w, err = ParseWindow(" 22:00 - 06:00 ")
+	require.NoError(t, err)
+	require.True(t, w.contains(at("23:00")))
+	require.True(t, w.contains(at("00:30")))
+	require.False(t, w.contains(at("06:00")))
+	require.False(t, w.contains(at("12:00")))
+
+	for _, s := range []string{"", "22:00", "22:00-", "25:00-06:00", "night"} {
+		_, err := ParseWindow(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestSchedulerOpen(t *testing.T) {
+	night, err := ParseWindow("22:00-06:00")
+	require.NoError(t, err)
+
+	// Only windows
+	s := NewScheduler(ScheduleOpt{Windows: []Window{night}})
+	require.True(t, s.open(PriorityCritical, at("12:00")))
+	require.False(t, s.open(PriorityNormal, at("12:00")))
+	require.False(t, s.open(PriorityLow, at("12:00")))
+	require.True(t, s.open(PriorityNormal, at("23:00")))
+	require.True(t, s.open(PriorityLow, at("23:00")))
+
+	// Windows and idle conditions
+	s = NewScheduler(ScheduleOpt{Windows: []Window{night}, IdleCPUPercent: 30})
+	require.False(t, s.open(PriorityNormal, at("12:00")))
+	require.True(t, s.open(PriorityNormal, at("23:00")))
+	require.False(t, s.open(PriorityLow, at("23:00")))
+	s.idle = true
+	require.True(t, s.open(PriorityNormal, at("12:00")))
+	require.False(t, s.open(PriorityLow, at("12:00")))
+	require.True(t, s.open(PriorityLow, at("23:00")))
+
+	// Only idle conditions
+	s = NewScheduler(ScheduleOpt{IdleNetworkRate: 1 << 20})
+	require.False(t, s.open(PriorityLow, at("12:00")))
+	s.idle = true
+	require.True(t, s.open(PriorityLow, at("12:00")))
+}
+
+func TestSchedulerDefer(t *testing.T) {
+	var nilScheduler *Scheduler
+	require.False(t, nilScheduler.Defer(map[string]string{label.NydusPrefetchAll: "true"}))
+	nilScheduler.Enqueue("1", "/mnt", nil)
+	nilScheduler.Remove("1")
+	require.Empty(t, nilScheduler.Pending())
+
+	s := NewScheduler(ScheduleOpt{IdleCPUPercent: 30})
+	require.False(t, s.Defer(map[string]string{}))
+	require.True(t, s.Defer(map[string]string{label.NydusPrefetchAll: "true"}))
+	require.True(t, s.Defer(map[string]string{label.NydusPrefetchAll: "true", label.NydusPrefetchPriority: "unknown"}))
+	require.False(t, s.Defer(map[string]string{label.NydusPrefetchAll: "true", label.NydusPrefetchPriority: PriorityCritical}))
+	s.idle = true
+	require.False(t, s.Defer(map[string]string{label.NydusPrefetchAll: "true"}))
+}
+
+func TestSchedulerQueue(t *testing.T) {
+	s := NewScheduler(ScheduleOpt{IdleCPUPercent: 30})
+	s.Enqueue("1", "/mnt/1", map[string]string{label.NydusPrefetchPriority: PriorityLow})
+	s.Enqueue("2", "/mnt/2", nil)
+	s.Enqueue("3", "/mnt/3", map[string]string{label.NydusPrefetchPriority: PriorityLow})
+	s.Enqueue("4", "/mnt/4", map[string]string{label.NydusPrefetchPriority: PriorityNormal})
+	require.Equal(t, []string{"2", "4", "1", "3"}, s.Pending())
+
+	require.Nil(t, s.next(time.Now()))
+	s.idle = true
+	require.Equal(t, "2", s.next(time.Now()).snapshotID)
+
+	s.Remove("4")
+	require.Equal(t, []string{"1", "3"}, s.Pending())
+}
+
+func TestSchedulerSample(t *testing.T) {
+	usages := []*nodeUsage{
+		{cpuTotal: 1000, cpuIdle: 500, rxBytes: 0, at: time.Unix(0, 0)},
+		{cpuTotal: 2000, cpuIdle: 1400, rxBytes: 1 << 20, at: time.Unix(1, 0)},
+		{cpuTotal: 3000, cpuIdle: 2400, rxBytes: 4 << 20, at: time.Unix(2, 0)},
+	}
+	orig := readNodeUsage
+	defer func() { readNodeUsage = orig }()
+	readNodeUsage = func() (*nodeUsage, error) {
+		u := usages[0]
+		usages = usages[1:]
+		return u, nil
+	}
+
+	s := NewScheduler(ScheduleOpt{IdleCPUPercent: 30, IdleNetworkRate: 2 << 20})
+	s.sample(context.Background())
+	require.False(t, s.idle)
+	// 10% CPU and 1MiB/s
+	s.sample(context.Background())
+	require.True(t, s.idle)
+	// 0% CPU but 3MiB/s
+	s.sample(context.Background())
+	require.False(t, s.idle)
+}
+
+func TestWarm(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a/b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a/b/c"), make([]byte, 4096), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "d"), make([]byte, 100), 0644))
+	require.NoError(t, os.Symlink("d", filepath.Join(dir, "e")))
+
+	n, err := warm(context.Background(), dir, func() bool { return true })
+	require.NoError(t, err)
+	require.Equal(t, int64(4196), n)
+
+	_, err = warm(context.Background(), dir, func() bool { return false })
+	require.ErrorIs(t, err, errPaused)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = warm(ctx, dir, func() bool { return true })
+	require.ErrorIs(t, err, context.Canceled)
+}
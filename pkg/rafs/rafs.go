@@ -122,7 +122,16 @@ type Rafs struct {
 	Annotations map[string]string
 }
 
-func NewRafs(snapshotID, imageID, fsDriver string) (*Rafs, error) {
+// Place the instance's working directory somewhere other than the snapshot
+// directory, e.g. for instances not backed by a containerd snapshot.
+func WithSnapshotDir(dir string) NewRafsOpt {
+	return func(r *Rafs) error {
+		r.SnapshotDir = dir
+		return nil
+	}
+}
+
+func NewRafs(snapshotID, imageID, fsDriver string, opts ...NewRafsOpt) (*Rafs, error) {
 	snapshotDir := path.Join(config.GetSnapshotsRootDir(), snapshotID)
 	rafs := &Rafs{
 		FsDriver:    fsDriver,
@@ -132,7 +141,13 @@ func NewRafs(snapshotID, imageID, fsDriver string) (*Rafs, error) {
 		Annotations: make(map[string]string),
 	}
 
-	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+	for _, o := range opts {
+		if err := o(rafs); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(rafs.SnapshotDir, 0755); err != nil {
 		return nil, err
 	}
 
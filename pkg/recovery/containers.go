@@ -0,0 +1,207 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package recovery
+
+import (
+	"context"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/core/mount"
+	"github.com/containerd/containerd/v2/pkg/namespaces"
+	"github.com/containerd/errdefs"
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+)
+
+// RunningSnapshots asks containerd for the running containers and returns IDs of
+// the snapshots under the snapshot root their rootfs is assembled from.
+func RunningSnapshots(ctx context.Context, address, snapshotRoot string) (map[string]bool, error) {
+	c, err := client.New(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "connect to containerd %s", address)
+	}
+	defer c.Close()
+
+	nss, err := c.NamespaceService().List(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list namespaces")
+	}
+
+	snapshots := make(map[string]bool)
+	for _, ns := range nss {
+		ctx := namespaces.WithNamespace(ctx, ns)
+		containers, err := c.Containers(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list containers in namespace %s", ns)
+		}
+
+		for _, container := range containers {
+			task, err := container.Task(ctx, nil)
+			if err != nil {
+				if !errdefs.IsNotFound(err) {
+					log.L.WithError(err).Debugf("get task of container %s", container.ID())
+				}
+				continue
+			}
+			status, err := task.Status(ctx)
+			if err != nil || status.Status != client.Running {
+				continue
+			}
+
+			info, err := container.Info(ctx)
+			if err != nil || info.Snapshotter == "" || info.SnapshotKey == "" {
+				continue
+			}
+			mounts, err := c.SnapshotService(info.Snapshotter).Mounts(ctx, info.SnapshotKey)
+			if err != nil {
+				log.L.WithError(err).Debugf("get mounts of container %s", container.ID())
+				continue
+			}
+			for _, id := range snapshotIDsInMounts(mounts, snapshotRoot) {
+				snapshots[id] = true
+			}
+		}
+	}
+
+	return snapshots, nil
+}
+
+// Find snapshots referred by paths like `<snapshot root>/<id>/fs` in the mounts.
+func snapshotIDsInMounts(mounts []mount.Mount, snapshotRoot string) []string {
+	pattern := regexp.MustCompile(regexp.QuoteMeta(filepath.Clean(snapshotRoot)+"/") + `(\d+)(/|$)`)
+
+	ids := []string{}
+	for _, m := range mounts {
+		for _, s := range append([]string{m.Source}, m.Options...) {
+			for _, match := range pattern.FindAllStringSubmatch(s, -1) {
+				ids = append(ids, match[1])
+			}
+		}
+	}
+
+	return ids
+}
+
+// Sandboxes asks containerd for IDs of the pod sandboxes in all namespaces.
+func Sandboxes(ctx context.Context, address string) (map[string]bool, error) {
+	c, err := client.New(address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "connect to containerd %s", address)
+	}
+	defer c.Close()
+
+	nss, err := c.NamespaceService().List(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "list namespaces")
+	}
+
+	sandboxes := make(map[string]bool)
+	for _, ns := range nss {
+		ctx := namespaces.WithNamespace(ctx, ns)
+		list, err := c.SandboxStore().List(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "list sandboxes in namespace %s", ns)
+		}
+		for _, s := range list {
+			sandboxes[s.ID] = true
+		}
+	}
+
+	return sandboxes, nil
+}
+
+// SandboxResolver finds sandboxes of containers by their active snapshots through
+// one containerd connection. A container never moves to another sandbox, so the
+// sandboxes found are cached until the snapshots are forgotten.
+type SandboxResolver struct {
+	address string
+
+	mu        sync.Mutex
+	client    *client.Client
+	sandboxes map[string]string
+}
+
+func NewSandboxResolver(address string) *SandboxResolver {
+	return &SandboxResolver{address: address, sandboxes: make(map[string]string)}
+}
+
+func (r *SandboxResolver) connect() (*client.Client, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.client == nil {
+		c, err := client.New(r.address)
+		if err != nil {
+			return nil, errors.Wrapf(err, "connect to containerd %s", r.address)
+		}
+		r.client = c
+	}
+	return r.client, nil
+}
+
+// ContainerSandbox asks containerd for the sandbox of the container whose rootfs is
+// the active snapshot. The key is the one snapshotters see, containerd prefixes keys
+// given by clients with `<namespace>/<id>/`. Returns empty if the container belongs
+// to no sandbox, or errdefs.ErrNotFound if no container uses the snapshot yet.
+func (r *SandboxResolver) ContainerSandbox(ctx context.Context, key string) (string, error) {
+	r.mu.Lock()
+	sandboxID, ok := r.sandboxes[key]
+	r.mu.Unlock()
+	if ok {
+		return sandboxID, nil
+	}
+
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 {
+		return "", errors.Wrapf(errdefs.ErrNotFound, "snapshot %s is not prepared through containerd", key)
+	}
+	ns, snapshotKey := parts[0], parts[2]
+
+	c, err := r.connect()
+	if err != nil {
+		return "", err
+	}
+
+	ctx = namespaces.WithNamespace(ctx, ns)
+	containers, err := c.ContainerService().List(ctx)
+	if err != nil {
+		return "", errors.Wrapf(err, "list containers in namespace %s", ns)
+	}
+	for _, container := range containers {
+		if container.SnapshotKey == snapshotKey {
+			r.mu.Lock()
+			r.sandboxes[key] = container.SandboxID
+			r.mu.Unlock()
+			return container.SandboxID, nil
+		}
+	}
+
+	return "", errors.Wrapf(errdefs.ErrNotFound, "no container uses snapshot %s", key)
+}
+
+// Forget drops the cached sandbox of the active snapshot once it is removed.
+func (r *SandboxResolver) Forget(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sandboxes, key)
+}
+
+func (r *SandboxResolver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.client == nil {
+		return nil
+	}
+	err := r.client.Close()
+	r.client = nil
+	return err
+}
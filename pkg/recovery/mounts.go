@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package recovery
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/moby/sys/mountinfo"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+	"github.com/containerd/nydus-snapshotter/pkg/store"
+)
+
+// FUSE and EROFS mounts on the mountpoints of the snapshotter under the root
+// directory, which are made by nydusd or the snapshotter.
+var listNydusMounts = func(rootDir string) ([]*mountinfo.Info, error) {
+	return mountinfo.GetMounts(func(info *mountinfo.Info) (bool, bool) {
+		fsType := info.FSType == "erofs" || info.FSType == "fuse" || strings.HasPrefix(info.FSType, "fuse.")
+		return !fsType || !snapshotterMountpoint(rootDir, info.Mountpoint), false
+	})
+}
+
+// Tell if the mountpoint is `mnt` or `snapshots/<id>/mnt` under the root directory,
+// or beneath them. Other mounts under the root directory, e.g. volume targets and
+// bind mounts pinning migrated paths, are not made by nydusd or the snapshotter.
+func snapshotterMountpoint(rootDir, mountpoint string) bool {
+	rel, err := filepath.Rel(rootDir, mountpoint)
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	switch {
+	case parts[0] == "mnt":
+		return true
+	case len(parts) >= 3 && parts[0] == "snapshots" && parts[2] == "mnt":
+		return true
+	default:
+		return false
+	}
+}
+
+type MountCheckOpt struct {
+	Database *store.Database
+	RootDir  string
+	Interval time.Duration
+	// Remount the missing mounts of snapshots used by running containers.
+	AutoHeal bool
+	// Returns IDs of the snapshots used by running containers.
+	RunningSnapshots func(ctx context.Context) (map[string]bool, error)
+	Remount          func(ctx context.Context, snapshotID string) error
+}
+
+// MountCheckReport summarizes how the mount table diverges from the daemon and RAFS
+// instance records.
+type MountCheckReport struct {
+	// Expected mountpoints not found in the mount table.
+	Missing []string `json:"missing"`
+	// Mountpoints of the snapshotter no record accounts for.
+	Stale []string `json:"stale"`
+	// Missing mountpoints mounted again.
+	Healed []string `json:"healed"`
+	Errors []string `json:"errors"`
+}
+
+func (r *MountCheckReport) addError(err error) {
+	log.L.WithError(err).Warn("check mounts")
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// MountChecker periodically compares the mount table with the records in database,
+// which diverge when mounts are umounted manually or left behind.
+type MountChecker struct {
+	opt MountCheckOpt
+}
+
+func NewMountChecker(opt MountCheckOpt) *MountChecker {
+	return &MountChecker{opt: opt}
+}
+
+func (c *MountChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.opt.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.Check(ctx); err != nil {
+				log.L.WithError(err).Warn("Failed to check mounts")
+			}
+		}
+	}
+}
+
+type expectedMount struct {
+	// Only EROFS mounts of RAFS instances can be mounted again without nydusd,
+	// FUSE mounts are gone along with their FUSE sessions.
+	snapshotID string
+}
+
+func (c *MountChecker) Check(ctx context.Context) (*MountCheckReport, error) {
+	report := &MountCheckReport{}
+
+	expected := make(map[string]expectedMount)
+	if err := c.opt.Database.WalkDaemons(ctx, func(s *daemon.ConfigState) error {
+		if s.FsDriver == config.FsDriverFusedev && s.Mountpoint != "" {
+			expected[filepath.Clean(s.Mountpoint)] = expectedMount{}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "walk daemon records")
+	}
+	if err := c.opt.Database.WalkRafsInstances(ctx, func(r *rafs.Rafs) error {
+		if r.GetFsDriver() == config.FsDriverFscache && r.GetMountpoint() != "" {
+			expected[filepath.Clean(r.GetMountpoint())] = expectedMount{snapshotID: r.SnapshotID}
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "walk instance records")
+	}
+
+	mounts, err := listNydusMounts(c.opt.RootDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "get mounts")
+	}
+
+	mounted := make(map[string]bool)
+	for _, m := range mounts {
+		mounted[m.Mountpoint] = true
+		if _, ok := expected[m.Mountpoint]; !ok {
+			report.Stale = append(report.Stale, m.Mountpoint)
+		}
+	}
+
+	missing := make(map[string]expectedMount)
+	for mountpoint, m := range expected {
+		if !mounted[mountpoint] {
+			report.Missing = append(report.Missing, mountpoint)
+			missing[mountpoint] = m
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Stale)
+
+	if c.opt.AutoHeal && len(missing) > 0 {
+		c.heal(ctx, report, missing)
+	}
+
+	collector.NewMountCheckCollector(len(report.Missing)-len(report.Healed), len(report.Stale)).Collect()
+
+	if len(report.Missing) > 0 || len(report.Stale) > 0 {
+		log.L.Warnf("Mount table diverges from records: %d missing %v, %d stale %v, %d healed",
+			len(report.Missing), report.Missing, len(report.Stale), report.Stale, len(report.Healed))
+	}
+
+	return report, nil
+}
+
+func (c *MountChecker) heal(ctx context.Context, report *MountCheckReport, missing map[string]expectedMount) {
+	running, err := c.opt.RunningSnapshots(ctx)
+	if err != nil {
+		report.addError(errors.Wrap(err, "list snapshots used by running containers"))
+		return
+	}
+
+	for mountpoint, m := range missing {
+		if m.snapshotID == "" || !running[m.snapshotID] {
+			continue
+		}
+		log.L.Infof("Mounting again snapshot %s at %s used by running containers", m.snapshotID, mountpoint)
+		if err := c.opt.Remount(ctx, m.snapshotID); err != nil {
+			collector.NewMountHealCollector(false).Collect()
+			report.addError(errors.Wrapf(err, "mount again snapshot %s", m.snapshotID))
+			continue
+		}
+		collector.NewMountHealCollector(true).Collect()
+		report.Healed = append(report.Healed, mountpoint)
+	}
+	sort.Strings(report.Healed)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package recovery
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/mount"
+	"github.com/moby/sys/mountinfo"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+	"github.com/containerd/nydus-snapshotter/pkg/store"
+)
+
+func TestMountCheck(t *testing.T) {
+	rootDir := t.TempDir()
+	db, err := store.NewDatabase(rootDir)
+	require.Nil(t, err)
+
+	ctx := context.TODO()
+	fuseMnt := filepath.Join(rootDir, "mnt")
+	erofsMnt := func(id string) string {
+		return filepath.Join(rootDir, "snapshots", id, "mnt")
+	}
+	d1 := daemon.Daemon{States: daemon.ConfigState{ID: "d1", FsDriver: config.FsDriverFusedev, Mountpoint: fuseMnt}}
+	require.Nil(t, db.SaveDaemon(ctx, &d1))
+	for _, id := range []string{"1", "2", "3"} {
+		require.Nil(t, db.AddRafsInstance(ctx, &rafs.Rafs{SnapshotID: id, DaemonID: "d2",
+			FsDriver: config.FsDriverFscache, Mountpoint: erofsMnt(id)}))
+	}
+
+	oldListNydusMounts := listNydusMounts
+	listNydusMounts = func(string) ([]*mountinfo.Info, error) {
+		return []*mountinfo.Info{
+			{Mountpoint: fuseMnt, FSType: "fuse.nydusd"},
+			{Mountpoint: erofsMnt("1"), FSType: "erofs"},
+			{Mountpoint: erofsMnt("4"), FSType: "erofs"},
+		}, nil
+	}
+	defer func() {
+		listNydusMounts = oldListNydusMounts
+	}()
+
+	remounted := []string{}
+	checker := NewMountChecker(MountCheckOpt{
+		Database: db,
+		RootDir:  rootDir,
+		AutoHeal: true,
+		RunningSnapshots: func(context.Context) (map[string]bool, error) {
+			return map[string]bool{"1": true, "2": true}, nil
+		},
+		Remount: func(_ context.Context, id string) error {
+			remounted = append(remounted, id)
+			return nil
+		},
+	})
+
+	report, err := checker.Check(ctx)
+	require.Nil(t, err)
+	require.Equal(t, []string{erofsMnt("2"), erofsMnt("3")}, report.Missing)
+	require.Equal(t, []string{erofsMnt("4")}, report.Stale)
+	// Snapshot 3 is not used by any running container.
+	require.Equal(t, []string{erofsMnt("2")}, report.Healed)
+	require.Equal(t, []string{"2"}, remounted)
+}
+
+func TestSnapshotIDsInMounts(t *testing.T) {
+	root := "/var/lib/nydus/snapshots"
+	mounts := []mount.Mount{
+		{
+			Type:   "overlay",
+			Source: "overlay",
+			Options: []string{
+				"workdir=" + root + "/12/work",
+				"upperdir=" + root + "/12/fs",
+				"lowerdir=" + root + "/10/mnt:" + root + "/9/fs:/other/snapshots/8/fs",
+			},
+		},
+		{Type: "bind", Source: root + "/7", Options: []string{"ro"}},
+	}
+
+	require.Equal(t, []string{"12", "12", "10", "9", "7"}, snapshotIDsInMounts(mounts, root))
+}
+
+func TestSnapshotterMountpoint(t *testing.T) {
+	rootDir := "/var/lib/nydus"
+	require.True(t, snapshotterMountpoint(rootDir, "/var/lib/nydus/mnt"))
+	require.True(t, snapshotterMountpoint(rootDir, "/var/lib/nydus/mnt/1"))
+	require.True(t, snapshotterMountpoint(rootDir, "/var/lib/nydus/snapshots/1/mnt"))
+	require.False(t, snapshotterMountpoint(rootDir, "/var/lib/nydus/snapshots/1/fs"))
+	require.False(t, snapshotterMountpoint(rootDir, "/var/lib/nydus/volumes/data"))
+	require.False(t, snapshotterMountpoint(rootDir, "/var/lib/nydus"))
+	require.False(t, snapshotterMountpoint(rootDir, "/var/lib/mnt"))
+}
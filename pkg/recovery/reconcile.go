@@ -0,0 +1,307 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+	"github.com/containerd/nydus-snapshotter/pkg/store"
+)
+
+const (
+	reportFileName = "recovery-report.json"
+	// How long to wait for an orphan nydusd to exit before killing it.
+	terminateTimeout = 3 * time.Second
+)
+
+var procRoot = "/proc"
+
+type Opt struct {
+	Database   *store.Database
+	RootDir    string
+	SocketRoot string
+}
+
+// Report summarizes the divergences found and repaired by a reconciliation pass.
+type Report struct {
+	StartedAt time.Time `json:"started_at"`
+	Duration  string    `json:"duration"`
+	// Daemon records whose nydusd process is gone, they are restarted by the
+	// managers according to the recover policy.
+	DeadDaemons []string `json:"dead_daemons"`
+	// Running nydusd processes that no daemon record accounts for, they are terminated.
+	OrphanProcesses []int `json:"orphan_processes"`
+	// FUSE or EROFS mounts on mountpoints of the snapshotter that no record accounts
+	// for, they are umounted.
+	StaleMounts []string `json:"stale_mounts"`
+	// RAFS instance records whose daemon record is gone, they are deleted.
+	OrphanInstances []string `json:"orphan_instances"`
+	// API socket directories of daemons without records, they are removed.
+	StaleSockets []string `json:"stale_sockets"`
+	Errors       []string `json:"errors"`
+}
+
+func (r *Report) Repaired() int {
+	return len(r.OrphanProcesses) + len(r.StaleMounts) + len(r.OrphanInstances) + len(r.StaleSockets)
+}
+
+func (r *Report) addError(err error) {
+	log.L.WithError(err).Warn("reconcile")
+	r.Errors = append(r.Errors, err.Error())
+}
+
+type nydusdProcess struct {
+	pid     int
+	apiSock string
+}
+
+// Reconcile cross-checks the daemon and RAFS instance records in the database with
+// the nydusd processes alive and the mounts left on the host, repairs the divergences
+// and saves the report in the root directory. It must run before the managers
+// recover daemons from the database.
+func Reconcile(ctx context.Context, opt Opt) (*Report, error) {
+	report := &Report{StartedAt: time.Now()}
+
+	daemons := make(map[string]daemon.ConfigState)
+	if err := opt.Database.WalkDaemons(ctx, func(s *daemon.ConfigState) error {
+		daemons[s.ID] = *s
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "walk daemon records")
+	}
+
+	instances := make(map[string]rafs.Rafs)
+	if err := opt.Database.WalkRafsInstances(ctx, func(r *rafs.Rafs) error {
+		instances[r.SnapshotID] = *r
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "walk instance records")
+	}
+
+	processes, err := listNydusdProcesses(opt.SocketRoot)
+	if err != nil {
+		report.addError(errors.Wrap(err, "list nydusd processes"))
+	}
+
+	reconcileProcesses(report, daemons, processes)
+	reconcileInstances(ctx, report, opt.Database, daemons, instances)
+	reconcileMounts(report, opt.RootDir, daemons, instances)
+	reconcileSockets(report, opt.SocketRoot, daemons)
+
+	report.Duration = time.Since(report.StartedAt).String()
+
+	log.L.Infof("Reconciled states in %s: %d dead daemons, %d orphan processes, %d stale mounts, %d orphan instances, %d stale sockets, %d errors",
+		report.Duration, len(report.DeadDaemons), len(report.OrphanProcesses), len(report.StaleMounts),
+		len(report.OrphanInstances), len(report.StaleSockets), len(report.Errors))
+
+	if err := saveReport(filepath.Join(opt.RootDir, reportFileName), report); err != nil {
+		log.L.WithError(err).Warn("save recovery report")
+	}
+
+	return report, nil
+}
+
+func daemonBacked(fsDriver string) bool {
+	return fsDriver == config.FsDriverFscache || fsDriver == config.FsDriverFusedev
+}
+
+func reconcileProcesses(report *Report, daemons map[string]daemon.ConfigState, processes []nydusdProcess) {
+	sockets := make(map[string]int)
+	for _, p := range processes {
+		sockets[p.apiSock] = p.pid
+	}
+
+	alive := make(map[int]bool)
+	for _, s := range daemons {
+		if !daemonBacked(s.FsDriver) {
+			continue
+		}
+		// Trust the API socket rather than the recorded pid, which may be outdated.
+		if pid, ok := sockets[s.APISocket]; ok {
+			alive[pid] = true
+			continue
+		}
+		report.DeadDaemons = append(report.DeadDaemons, s.ID)
+	}
+	sort.Strings(report.DeadDaemons)
+
+	for _, p := range processes {
+		if alive[p.pid] {
+			continue
+		}
+		log.L.Warnf("Terminating orphan nydusd process %d serving %s", p.pid, p.apiSock)
+		if err := terminateProcess(p.pid); err != nil {
+			report.addError(errors.Wrapf(err, "terminate orphan nydusd %d", p.pid))
+			continue
+		}
+		report.OrphanProcesses = append(report.OrphanProcesses, p.pid)
+	}
+}
+
+func reconcileInstances(ctx context.Context, report *Report, db *store.Database,
+	daemons map[string]daemon.ConfigState, instances map[string]rafs.Rafs) {
+	for id, r := range instances {
+		if !daemonBacked(r.GetFsDriver()) {
+			continue
+		}
+		if _, ok := daemons[r.DaemonID]; ok {
+			continue
+		}
+		log.L.Warnf("Deleting instance %s record whose daemon %s is gone", id, r.DaemonID)
+		if err := db.DeleteRafsInstance(ctx, id); err != nil {
+			report.addError(errors.Wrapf(err, "delete orphan instance %s", id))
+			continue
+		}
+		delete(instances, id)
+		report.OrphanInstances = append(report.OrphanInstances, id)
+	}
+	sort.Strings(report.OrphanInstances)
+}
+
+func reconcileMounts(report *Report, rootDir string, daemons map[string]daemon.ConfigState, instances map[string]rafs.Rafs) {
+	known := make(map[string]bool)
+	for _, s := range daemons {
+		if s.Mountpoint != "" {
+			known[filepath.Clean(s.Mountpoint)] = true
+		}
+	}
+	for _, r := range instances {
+		if r.Mountpoint != "" {
+			known[filepath.Clean(r.Mountpoint)] = true
+		}
+	}
+
+	mounts, err := listNydusMounts(rootDir)
+	if err != nil {
+		report.addError(errors.Wrap(err, "get mounts"))
+		return
+	}
+
+	// Umount nested mounts first
+	sort.Slice(mounts, func(i, j int) bool {
+		return len(mounts[i].Mountpoint) > len(mounts[j].Mountpoint)
+	})
+
+	for _, m := range mounts {
+		if known[m.Mountpoint] {
+			continue
+		}
+		log.L.Warnf("Umounting stale %s mount %s", m.FSType, m.Mountpoint)
+		if err := unix.Unmount(m.Mountpoint, unix.MNT_DETACH); err != nil {
+			report.addError(errors.Wrapf(err, "umount stale mount %s", m.Mountpoint))
+			continue
+		}
+		report.StaleMounts = append(report.StaleMounts, m.Mountpoint)
+	}
+}
+
+func reconcileSockets(report *Report, socketRoot string, daemons map[string]daemon.ConfigState) {
+	dirs, err := os.ReadDir(socketRoot)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			report.addError(errors.Wrapf(err, "read socket root %s", socketRoot))
+		}
+		return
+	}
+
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		if _, ok := daemons[d.Name()]; ok {
+			continue
+		}
+		dir := filepath.Join(socketRoot, d.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			report.addError(errors.Wrapf(err, "remove stale socket directory %s", dir))
+			continue
+		}
+		report.StaleSockets = append(report.StaleSockets, dir)
+	}
+}
+
+// List nydusd processes whose API socket is under the socket root, in other words
+// started by snapshotters sharing the same root directory.
+func listNydusdProcesses(socketRoot string) ([]nydusdProcess, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	processes := []nydusdProcess{}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		// The process might have exited.
+		cmdline, err := os.ReadFile(filepath.Join(procRoot, e.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		args := strings.Split(string(bytes.TrimRight(cmdline, "\x00")), "\x00")
+		if len(args) == 0 || !strings.Contains(filepath.Base(args[0]), "nydusd") {
+			continue
+		}
+		for i := 1; i < len(args)-1; i++ {
+			if args[i] == "--apisock" && strings.HasPrefix(args[i+1], socketRoot+"/") {
+				processes = append(processes, nydusdProcess{pid: pid, apiSock: args[i+1]})
+				break
+			}
+		}
+	}
+
+	return processes, nil
+}
+
+func terminateProcess(pid int) error {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+		return err
+	}
+
+	deadline := time.Now().Add(terminateTimeout)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+
+	return nil
+}
+
+func saveReport(path string, report *Report) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal report")
+	}
+
+	return os.WriteFile(path, content, 0644)
+}
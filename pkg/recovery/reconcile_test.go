@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package recovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+	"github.com/containerd/nydus-snapshotter/pkg/store"
+)
+
+func writeCmdline(t *testing.T, root, pid string, args ...string) {
+	dir := filepath.Join(root, pid)
+	require.Nil(t, os.MkdirAll(dir, 0755))
+	cmdline := strings.Join(args, "\x00") + "\x00"
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline), 0644))
+}
+
+func TestListNydusdProcesses(t *testing.T) {
+	fakeProc := t.TempDir()
+	oldProcRoot := procRoot
+	procRoot = fakeProc
+	defer func() {
+		procRoot = oldProcRoot
+	}()
+
+	socketRoot := "/var/lib/containerd-nydus/socket"
+	writeCmdline(t, fakeProc, "100", "/usr/bin/nydusd", "fuse", "--apisock", socketRoot+"/d1/api.sock")
+	writeCmdline(t, fakeProc, "101", "/usr/bin/nydusd", "--apisock", "/other/root/d2/api.sock")
+	writeCmdline(t, fakeProc, "102", "/usr/bin/containerd", "--apisock", socketRoot+"/d3/api.sock")
+	writeCmdline(t, fakeProc, "self", "/usr/bin/nydusd", "--apisock", socketRoot+"/d4/api.sock")
+
+	processes, err := listNydusdProcesses(socketRoot)
+	require.Nil(t, err)
+	require.Equal(t, []nydusdProcess{{pid: 100, apiSock: socketRoot + "/d1/api.sock"}}, processes)
+}
+
+func TestReconcileRecords(t *testing.T) {
+	rootDir := t.TempDir()
+	db, err := store.NewDatabase(rootDir)
+	require.Nil(t, err)
+
+	ctx := context.TODO()
+	d1 := daemon.Daemon{States: daemon.ConfigState{ID: "d1", FsDriver: config.FsDriverFusedev,
+		APISocket: filepath.Join(rootDir, "socket", "d1", "api.sock")}}
+	require.Nil(t, db.SaveDaemon(ctx, &d1))
+	require.Nil(t, db.AddRafsInstance(ctx, &rafs.Rafs{SnapshotID: "1", DaemonID: "d1", FsDriver: config.FsDriverFusedev}))
+	require.Nil(t, db.AddRafsInstance(ctx, &rafs.Rafs{SnapshotID: "2", DaemonID: "d2", FsDriver: config.FsDriverFusedev}))
+	require.Nil(t, db.AddRafsInstance(ctx, &rafs.Rafs{SnapshotID: "3", FsDriver: config.FsDriverBlockdev}))
+
+	socketRoot := filepath.Join(rootDir, "socket")
+	require.Nil(t, os.MkdirAll(filepath.Join(socketRoot, "d1"), 0755))
+	require.Nil(t, os.MkdirAll(filepath.Join(socketRoot, "d2"), 0755))
+
+	report := &Report{}
+	daemons := map[string]daemon.ConfigState{"d1": d1.States}
+	instances := make(map[string]rafs.Rafs)
+	require.Nil(t, db.WalkRafsInstances(ctx, func(r *rafs.Rafs) error {
+		instances[r.SnapshotID] = *r
+		return nil
+	}))
+
+	reconcileProcesses(report, daemons, nil)
+	require.Equal(t, []string{"d1"}, report.DeadDaemons)
+
+	reconcileInstances(ctx, report, db, daemons, instances)
+	require.Equal(t, []string{"2"}, report.OrphanInstances)
+	require.Equal(t, 2, len(instances))
+
+	reconcileSockets(report, socketRoot, daemons)
+	require.Equal(t, []string{filepath.Join(socketRoot, "d2")}, report.StaleSockets)
+	_, err = os.Stat(filepath.Join(socketRoot, "d1"))
+	require.Nil(t, err)
+
+	require.Equal(t, 2, report.Repaired())
+	require.Empty(t, report.Errors)
+}
+
+func TestShutdownMarker(t *testing.T) {
+	rootDir := t.TempDir()
+	db, err := store.NewDatabase(rootDir)
+	require.Nil(t, err)
+
+	m := NewShutdownMarker(rootDir, db)
+	unclean, err := m.Mark()
+	require.Nil(t, err)
+	require.False(t, unclean)
+	require.FileExists(t, filepath.Join(rootDir, pidFileName))
+
+	// Crashed without releasing the marker
+	unclean, err = m.Mark()
+	require.Nil(t, err)
+	require.True(t, unclean)
+
+	require.Nil(t, m.Release())
+	require.NoFileExists(t, filepath.Join(rootDir, pidFileName))
+
+	unclean, err = m.Mark()
+	require.Nil(t, err)
+	require.False(t, unclean)
+}
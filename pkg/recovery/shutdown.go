@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package recovery detects an unclean shutdown of the previous snapshotter run and
+// reconciles the persisted states with what is actually left on the host.
+package recovery
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/log"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/pkg/store"
+)
+
+const pidFileName = "nydus-snapshotter.pid"
+
+// ShutdownMarker leaves a pid file in the root directory and a dirty flag in the
+// database while the snapshotter is running. Both are removed on graceful shutdown,
+// so finding either of them on start means the previous run exited uncleanly.
+type ShutdownMarker struct {
+	pidFile string
+	db      *store.Database
+}
+
+func NewShutdownMarker(rootDir string, db *store.Database) *ShutdownMarker {
+	return &ShutdownMarker{
+		pidFile: filepath.Join(rootDir, pidFileName),
+		db:      db,
+	}
+}
+
+// Mark records the current run and returns whether the previous run exited uncleanly.
+func (m *ShutdownMarker) Mark() (bool, error) {
+	unclean := false
+
+	content, err := os.ReadFile(m.pidFile)
+	if err == nil {
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(content)))
+		log.L.Warnf("Found pid file %s left by snapshotter process %d", m.pidFile, pid)
+		unclean = true
+	} else if !os.IsNotExist(err) {
+		return false, errors.Wrapf(err, "read pid file %s", m.pidFile)
+	}
+
+	dirty, err := m.db.MarkDirty()
+	if err != nil {
+		return false, err
+	}
+	if dirty {
+		log.L.Warnf("Database was not marked clean by the previous snapshotter")
+		unclean = true
+	}
+
+	if err := os.WriteFile(m.pidFile, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+		return false, errors.Wrapf(err, "write pid file %s", m.pidFile)
+	}
+
+	return unclean, nil
+}
+
+// Release marks the current run as shut down cleanly.
+func (m *ShutdownMarker) Release() error {
+	if err := m.db.MarkClean(); err != nil {
+		return errors.Wrap(err, "mark database clean")
+	}
+
+	if err := os.Remove(m.pidFile); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "remove pid file %s", m.pidFile)
+	}
+
+	return nil
+}
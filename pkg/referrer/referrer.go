@@ -13,7 +13,11 @@ import (
 	"io"
 	"os"
 
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/log"
+
 	"github.com/containerd/nydus-snapshotter/pkg/auth"
+	"github.com/containerd/nydus-snapshotter/pkg/converter"
 	"github.com/containerd/nydus-snapshotter/pkg/label"
 	"github.com/containerd/nydus-snapshotter/pkg/remote"
 
@@ -27,6 +31,9 @@ import (
 const maxManifestIndexSize = 0x800000
 const metadataNameInLayer = "image/image.boot"
 
+// Limit the referrers to check, as each costs a request to registry.
+const maxReferrerCandidates = 8
+
 type referrer struct {
 	remote *remote.Remote
 }
@@ -37,6 +44,48 @@ func newReferrer(keyChain *auth.PassKeyChain, insecure bool) *referrer {
 	}
 }
 
+// Candidates of referrers to check, ordered by preference. Referrer artifacts
+// with the nydus artifact type come first, followed by other image manifests
+// which may be nydus images, like those converted with `WithReferrer`. The
+// later a referrer is listed, the more recently it is supposed to be pushed.
+func referrerCandidates(manifests []ocispec.Descriptor) []ocispec.Descriptor {
+	var nydus, others []ocispec.Descriptor
+	for i := len(manifests) - 1; i >= 0; i-- {
+		desc := manifests[i]
+		switch {
+		case desc.ArtifactType == converter.ManifestArtifactTypeNydus:
+			nydus = append(nydus, desc)
+		case desc.MediaType == ocispec.MediaTypeImageManifest || desc.MediaType == images.MediaTypeDockerSchema2Manifest:
+			others = append(others, desc)
+		}
+	}
+
+	candidates := append(nydus, others...)
+	if len(candidates) > maxReferrerCandidates {
+		candidates = candidates[:maxReferrerCandidates]
+	}
+
+	return candidates
+}
+
+// nydusMetaLayer returns the nydus metadata layer of a referrer manifest
+// associated with the OCI manifest `subject`.
+func nydusMetaLayer(manifest *ocispec.Manifest, subject digest.Digest) (*ocispec.Descriptor, error) {
+	// Registries falling back to the tag schema may list unrelated manifests.
+	if manifest.Subject != nil && manifest.Subject.Digest != subject {
+		return nil, fmt.Errorf("manifest refers to subject %s", manifest.Subject.Digest)
+	}
+	if len(manifest.Layers) < 1 {
+		return nil, fmt.Errorf("invalid manifest")
+	}
+	metaLayer := manifest.Layers[len(manifest.Layers)-1]
+	if !label.IsNydusMetaLayer(metaLayer.Annotations) {
+		return nil, fmt.Errorf("invalid nydus manifest")
+	}
+
+	return &metaLayer, nil
+}
+
 // checkReferrer fetches the referrers and parses out the nydus
 // image by specified manifest digest.
 // it's using distribution list referrers API.
@@ -48,7 +97,8 @@ func (r *referrer) checkReferrer(ctx context.Context, ref string, manifestDigest
 			return nil, errors.Wrap(err, "get fetcher")
 		}
 
-		// Fetch image referrers from remote registry.
+		// Fetch image referrers from remote registry. Don't filter them by
+		// artifact type to also find nydus images converted out-of-band.
 		rc, _, err := fetcher.(remotes.ReferrersFetcher).FetchReferrers(ctx, manifestDigest)
 		if err != nil {
 			return nil, errors.Wrap(err, "fetch referrers")
@@ -64,35 +114,39 @@ func (r *referrer) checkReferrer(ctx context.Context, ref string, manifestDigest
 		if err := json.Unmarshal(bytes, &index); err != nil {
 			return nil, errors.Wrap(err, "unmarshal referrers index")
 		}
-		if len(index.Manifests) == 0 {
+		candidates := referrerCandidates(index.Manifests)
+		if len(candidates) == 0 {
 			return nil, fmt.Errorf("empty referrer list")
 		}
 
-		// Prefer to fetch the last manifest and check if it is a nydus image.
-		// TODO: should we search by matching ArtifactType?
-		rc, err = fetcher.Fetch(ctx, index.Manifests[0])
-		if err != nil {
-			return nil, errors.Wrap(err, "fetch referrers")
+		fetchMetaLayer := func(desc ocispec.Descriptor) (*ocispec.Descriptor, error) {
+			rc, err := fetcher.Fetch(ctx, desc)
+			if err != nil {
+				return nil, errors.Wrap(err, "fetch manifest")
+			}
+			defer rc.Close()
+
+			var manifest ocispec.Manifest
+			bytes, err := io.ReadAll(io.LimitReader(rc, maxManifestIndexSize))
+			if err != nil {
+				return nil, errors.Wrap(err, "read manifest")
+			}
+			if err := json.Unmarshal(bytes, &manifest); err != nil {
+				return nil, errors.Wrap(err, "unmarshal manifest")
+			}
+
+			return nydusMetaLayer(&manifest, manifestDigest)
 		}
-		defer rc.Close()
 
-		var manifest ocispec.Manifest
-		bytes, err = io.ReadAll(rc)
-		if err != nil {
-			return nil, errors.Wrap(err, "read manifest")
-		}
-		if err := json.Unmarshal(bytes, &manifest); err != nil {
-			return nil, errors.Wrap(err, "unmarshal manifest")
-		}
-		if len(manifest.Layers) < 1 {
-			return nil, fmt.Errorf("invalid manifest")
-		}
-		metaLayer := manifest.Layers[len(manifest.Layers)-1]
-		if !label.IsNydusMetaLayer(metaLayer.Annotations) {
-			return nil, fmt.Errorf("invalid nydus manifest")
+		for _, desc := range candidates {
+			metaLayer, err := fetchMetaLayer(desc)
+			if err == nil {
+				return metaLayer, nil
+			}
+			log.G(ctx).WithError(err).Debugf("referrer %s of %s is not nydus image", desc.Digest, manifestDigest)
 		}
 
-		return &metaLayer, nil
+		return nil, fmt.Errorf("no nydus image in %d referrers", len(index.Manifests))
 	}
 
 	desc, err := handle()
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package referrer
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/pkg/converter"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+func TestReferrerCandidates(t *testing.T) {
+	manifests := []ocispec.Descriptor{
+		{MediaType: ocispec.MediaTypeImageManifest, Digest: "sha256:1", ArtifactType: converter.ManifestArtifactTypeNydus},
+		{MediaType: ocispec.MediaTypeImageManifest, Digest: "sha256:2", ArtifactType: "application/vnd.dev.cosign.artifact.sig.v1+json"},
+		{MediaType: ocispec.MediaTypeImageIndex, Digest: "sha256:3"},
+		{MediaType: ocispec.MediaTypeImageManifest, Digest: "sha256:4", ArtifactType: converter.ManifestArtifactTypeNydus},
+	}
+
+	var digests []digest.Digest
+	for _, desc := range referrerCandidates(manifests) {
+		digests = append(digests, desc.Digest)
+	}
+	require.Equal(t, []digest.Digest{"sha256:4", "sha256:1", "sha256:2"}, digests)
+
+	for i := 0; i < maxReferrerCandidates; i++ {
+		manifests = append(manifests, ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest})
+	}
+	require.Len(t, referrerCandidates(manifests), maxReferrerCandidates)
+	require.Empty(t, referrerCandidates(nil))
+}
+
+func TestNydusMetaLayer(t *testing.T) {
+	subject := digest.FromString("oci")
+	meta := ocispec.Descriptor{Digest: "sha256:meta", Annotations: map[string]string{label.NydusMetaLayer: "true"}}
+	manifest := ocispec.Manifest{
+		Subject: &ocispec.Descriptor{Digest: subject},
+		Layers:  []ocispec.Descriptor{{Digest: "sha256:blob"}, meta},
+	}
+
+	desc, err := nydusMetaLayer(&manifest, subject)
+	require.NoError(t, err)
+	require.Equal(t, meta.Digest, desc.Digest)
+
+	// Referring to another image
+	_, err = nydusMetaLayer(&manifest, digest.FromString("other"))
+	require.Error(t, err)
+
+	// Not a nydus image
+	manifest.Subject = nil
+	manifest.Layers = manifest.Layers[:1]
+	_, err = nydusMetaLayer(&manifest, subject)
+	require.Error(t, err)
+}
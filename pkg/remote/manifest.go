@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/pkg/converter"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/remote/remotes"
+)
+
+// Follow containerd's limit on manifest size.
+const maxManifestSize = 0x800000
+
+// FetchManifest fetches the image manifest, the one matching the host platform
+// is picked if desc refers to an image index. The nydus manifest is preferred in
+// an index merging OCI and nydus manifests.
+func FetchManifest(ctx context.Context, fetcher remotes.Fetcher, desc ocispec.Descriptor) (*ocispec.Manifest, error) {
+	rc, err := fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return nil, errors.Wrapf(err, "fetch %s", desc.Digest)
+	}
+	defer rc.Close()
+
+	bytes, err := io.ReadAll(io.LimitReader(rc, maxManifestSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "read %s", desc.Digest)
+	}
+
+	switch desc.MediaType {
+	case images.MediaTypeDockerSchema2ManifestList, ocispec.MediaTypeImageIndex:
+		var index ocispec.Index
+		if err := json.Unmarshal(bytes, &index); err != nil {
+			return nil, errors.Wrap(err, "unmarshal image index")
+		}
+		m, ok := pickManifest(index.Manifests, platforms.Default())
+		if !ok {
+			return nil, errors.Wrapf(errdefs.ErrNotFound, "no manifest for platform %s", platforms.DefaultString())
+		}
+		return FetchManifest(ctx, fetcher, m)
+	default:
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(bytes, &manifest); err != nil {
+			return nil, errors.Wrap(err, "unmarshal image manifest")
+		}
+		return &manifest, nil
+	}
+}
+
+// Pick the manifest matching the platform, `platforms.Match` ignores OS features so
+// nydus manifests marked by "nydus.remoteimage.v1" are looked for first.
+func pickManifest(manifests []ocispec.Descriptor, matcher platforms.Matcher) (ocispec.Descriptor, bool) {
+	isNydus := func(m ocispec.Descriptor) bool {
+		return m.Platform != nil && slices.Contains(m.Platform.OSFeatures, converter.ManifestOSFeatureNydus)
+	}
+	matches := func(m ocispec.Descriptor) bool {
+		return m.Platform == nil || matcher.Match(*m.Platform)
+	}
+
+	for _, m := range manifests {
+		if isNydus(m) && matches(m) {
+			return m, true
+		}
+	}
+	for _, m := range manifests {
+		if matches(m) {
+			return m, true
+		}
+	}
+	return ocispec.Descriptor{}, false
+}
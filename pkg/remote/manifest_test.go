@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package remote
+
+import (
+	"testing"
+
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/containerd/nydus-snapshotter/pkg/converter"
+)
+
+func TestPickManifest(t *testing.T) {
+	matcher := platforms.Only(ocispec.Platform{OS: "linux", Architecture: "amd64"})
+	oci := ocispec.Descriptor{Digest: "sha256:oci", Platform: &ocispec.Platform{OS: "linux", Architecture: "amd64"}}
+	nydus := ocispec.Descriptor{Digest: "sha256:nydus", Platform: &ocispec.Platform{
+		OS: "linux", Architecture: "amd64", OSFeatures: []string{converter.ManifestOSFeatureNydus}}}
+	nydusArm := ocispec.Descriptor{Digest: "sha256:nydus-arm", Platform: &ocispec.Platform{
+		OS: "linux", Architecture: "arm64", OSFeatures: []string{converter.ManifestOSFeatureNydus}}}
+
+	m, ok := pickManifest([]ocispec.Descriptor{oci, nydusArm, nydus}, matcher)
+	require.True(t, ok)
+	require.Equal(t, nydus.Digest, m.Digest)
+
+	m, ok = pickManifest([]ocispec.Descriptor{nydusArm, oci}, matcher)
+	require.True(t, ok)
+	require.Equal(t, oci.Digest, m.Digest)
+
+	_, ok = pickManifest([]ocispec.Descriptor{nydusArm}, matcher)
+	require.False(t, ok)
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+// ConfigRecord is a version of configuration rendered for a daemon or a RAFS
+// instance hosted by it, with secrets stripped.
+type ConfigRecord struct {
+	Seq      uint64 `json:"seq"`
+	DaemonID string `json:"daemon_id"`
+	// Empty for the configuration of a shared daemon itself.
+	SnapshotID string    `json:"snapshot_id,omitempty"`
+	Operation  string    `json:"operation"`
+	Timestamp  time.Time `json:"timestamp"`
+	// Empty if the configuration is no longer in effect, e.g. the instance is
+	// umounted or the daemon is destroyed.
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// Retired tells if the configuration is no longer in effect since the record.
+func (r *ConfigRecord) Retired() bool {
+	return len(r.Config) == 0
+}
+
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// AddConfigRecords appends configuration records to the history of their daemons.
+func (db *Database) AddConfigRecords(_ context.Context, records []*ConfigRecord) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		history := getConfigHistoryBucket(tx)
+		for _, r := range records {
+			bucket, err := history.CreateBucketIfNotExists([]byte(r.DaemonID))
+			if err != nil {
+				return errors.Wrapf(err, "bucket of daemon %s", r.DaemonID)
+			}
+
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			r.Seq = seq
+
+			value, err := json.Marshal(r)
+			if err != nil {
+				return errors.Wrapf(err, "marshal config record of daemon %s", r.DaemonID)
+			}
+			if err := bucket.Put(sequenceKey(seq), value); err != nil {
+				return errors.Wrapf(err, "put config record of daemon %s", r.DaemonID)
+			}
+		}
+
+		return nil
+	})
+}
+
+// PruneConfigHistory drops the configuration records older than `before`, except
+// the configurations still in effect, i.e. the latest record of a daemon or of
+// a RAFS instance which is not retired.
+func (db *Database) PruneConfigHistory(_ context.Context, before time.Time) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		history := getConfigHistoryBucket(tx)
+
+		var ids [][]byte
+		if err := history.ForEachBucket(func(id []byte) error {
+			ids = append(ids, append([]byte{}, id...))
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			bucket := history.Bucket(id)
+			stale, total, err := staleConfigRecords(bucket, before)
+			if err != nil {
+				return errors.Wrapf(err, "config history of daemon %s", id)
+			}
+			if len(stale) == total {
+				if err := history.DeleteBucket(id); err != nil {
+					return errors.Wrapf(err, "delete config history of daemon %s", id)
+				}
+				continue
+			}
+			for _, k := range stale {
+				if err := bucket.Delete(k); err != nil {
+					return errors.Wrapf(err, "prune config record of daemon %s", id)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Returns keys of the stale records and the number of all records.
+func staleConfigRecords(bucket *bolt.Bucket, before time.Time) ([][]byte, int, error) {
+	var keys [][]byte
+	// The latest record of each instance, keyed by snapshot ID.
+	latest := map[string]int{}
+	var records []ConfigRecord
+	if err := bucket.ForEach(func(k, value []byte) error {
+		var r ConfigRecord
+		if err := json.Unmarshal(value, &r); err != nil {
+			return errors.Wrap(err, "unmarshal config record")
+		}
+		latest[r.SnapshotID] = len(records)
+		keys = append(keys, append([]byte{}, k...))
+		records = append(records, r)
+		return nil
+	}); err != nil {
+		return nil, 0, err
+	}
+
+	var stale [][]byte
+	for i, r := range records {
+		if !r.Timestamp.Before(before) {
+			continue
+		}
+		if latest[r.SnapshotID] == i && !r.Retired() {
+			continue
+		}
+		stale = append(stale, keys[i])
+	}
+
+	return stale, len(records), nil
+}
+
+// ListConfigRecords returns the configuration history of a daemon, oldest first.
+func (db *Database) ListConfigRecords(_ context.Context, daemonID string) ([]ConfigRecord, error) {
+	var records []ConfigRecord
+	err := db.db.View(func(tx *bolt.Tx) error {
+		bucket := getConfigHistoryBucket(tx).Bucket([]byte(daemonID))
+		if bucket == nil {
+			return errdefs.ErrNotFound
+		}
+
+		return bucket.ForEach(func(_, value []byte) error {
+			var r ConfigRecord
+			if err := json.Unmarshal(value, &r); err != nil {
+				return errors.Wrapf(err, "unmarshal config record of daemon %s", daemonID)
+			}
+			records = append(records, r)
+			return nil
+		})
+	})
+
+	return records, err
+}
@@ -9,6 +9,7 @@ package store
 
 import (
 	"context"
+	"time"
 
 	"github.com/containerd/nydus-snapshotter/pkg/daemon"
 	"github.com/containerd/nydus-snapshotter/pkg/rafs"
@@ -51,6 +52,10 @@ func (s *DaemonRafsStore) AddRafsInstance(r *rafs.Rafs) error {
 	return s.db.AddRafsInstance(context.TODO(), r)
 }
 
+func (s *DaemonRafsStore) UpdateRafsInstance(r *rafs.Rafs) error {
+	return s.db.UpdateRafsInstance(context.TODO(), r)
+}
+
 func (s *DaemonRafsStore) DeleteRafsInstance(snapshotID string) error {
 	return s.db.DeleteRafsInstance(context.TODO(), snapshotID)
 }
@@ -62,3 +67,15 @@ func (s *DaemonRafsStore) WalkRafsInstances(ctx context.Context, cb func(*rafs.R
 func (s *DaemonRafsStore) NextInstanceSeq() (uint64, error) {
 	return s.db.NextInstanceSeq()
 }
+
+func (s *DaemonRafsStore) AddConfigRecords(records []*ConfigRecord) error {
+	return s.db.AddConfigRecords(context.TODO(), records)
+}
+
+func (s *DaemonRafsStore) PruneConfigHistory(before time.Time) error {
+	return s.db.PruneConfigHistory(context.TODO(), before)
+}
+
+func (s *DaemonRafsStore) ListConfigRecords(daemonID string) ([]ConfigRecord, error) {
+	return s.db.ListConfigRecords(context.TODO(), daemonID)
+}
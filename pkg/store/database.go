@@ -32,6 +32,9 @@ const (
 //	- v1:
 //		- daemons
 //		- instances
+//		- config_history
+//			- <daemon id>
+//		- dirty
 
 var (
 	v1RootBucket = []byte("v1")
@@ -42,6 +45,10 @@ var (
 	// RAFS filesystem instances.
 	// A RAFS filesystem may have associated daemon or not.
 	instancesBucket = []byte("instances")
+	// Rendered configurations of daemons and RAFS instances, one bucket per daemon.
+	configHistoryBucket = []byte("config_history")
+	// Set when snapshotter starts and cleared when it shuts down gracefully.
+	dirtyKey = []byte("dirty")
 )
 
 // Database keeps infos that need to survive among snapshotter restart
@@ -87,6 +94,11 @@ func getInstancesBucket(tx *bolt.Tx) *bolt.Bucket {
 	return bucket.Bucket(instancesBucket)
 }
 
+func getConfigHistoryBucket(tx *bolt.Tx) *bolt.Bucket {
+	bucket := tx.Bucket(v1RootBucket)
+	return bucket.Bucket(configHistoryBucket)
+}
+
 func updateObject(bucket *bolt.Bucket, key string, obj interface{}) error {
 	keyBytes := []byte(key)
 
@@ -163,6 +175,10 @@ func (db *Database) initDatabase() error {
 			return errors.Wrapf(err, "bucket %s", instancesBucket)
 		}
 
+		if _, err := bk.CreateBucketIfNotExists(configHistoryBucket); err != nil {
+			return errors.Wrapf(err, "bucket %s", configHistoryBucket)
+		}
+
 		if val := bk.Get(versionKey); val == nil {
 			version = "v1.0"
 		} else {
@@ -199,6 +215,29 @@ func (db *Database) Close() error {
 	return nil
 }
 
+// MarkDirty marks the database as being used by a running snapshotter and
+// returns whether the previous user did not shut down cleanly.
+func (db *Database) MarkDirty() (bool, error) {
+	var dirty bool
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(v1RootBucket)
+		dirty = bk.Get(dirtyKey) != nil
+		return bk.Put(dirtyKey, []byte(time.Now().Format(time.RFC3339)))
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "mark database dirty")
+	}
+
+	return dirty, nil
+}
+
+// MarkClean clears the dirty flag on graceful shutdown.
+func (db *Database) MarkClean() error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(v1RootBucket).Delete(dirtyKey)
+	})
+}
+
 func (db *Database) SaveDaemon(_ context.Context, d *daemon.Daemon) error {
 	return db.db.Update(func(tx *bolt.Tx) error {
 		bucket := getDaemonsBucket(tx)
@@ -287,6 +326,19 @@ func (db *Database) AddRafsInstance(_ context.Context, instance *rafs.Rafs) erro
 	})
 }
 
+func (db *Database) UpdateRafsInstance(_ context.Context, instance *rafs.Rafs) error {
+	return db.db.Update(func(tx *bolt.Tx) error {
+		bucket := getInstancesBucket(tx)
+
+		var existing rafs.Rafs
+		if err := getObject(bucket, instance.SnapshotID, &existing); err != nil {
+			return err
+		}
+
+		return updateObject(bucket, instance.SnapshotID, instance)
+	})
+}
+
 func (db *Database) DeleteRafsInstance(_ context.Context, snapshotID string) error {
 	return db.db.Update(func(tx *bolt.Tx) error {
 		bucket := getInstancesBucket(tx)
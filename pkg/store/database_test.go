@@ -2,11 +2,15 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -67,6 +71,125 @@ func Test_daemon(t *testing.T) {
 	require.Equal(t, len(ids2), 0)
 }
 
+func Test_rafsInstance(t *testing.T) {
+	rootDir := "testdata/instance"
+	err := os.MkdirAll(rootDir, 0755)
+	require.Nil(t, err)
+	defer func() {
+		_ = os.RemoveAll(rootDir)
+	}()
+
+	db, err := NewDatabase(rootDir)
+	require.Nil(t, err)
+
+	ctx := context.TODO()
+	r := rafs.Rafs{SnapshotID: "volume-1", Annotations: map[string]string{}}
+	// Updating a non-existing instance should fail
+	err = db.UpdateRafsInstance(ctx, &r)
+	require.Error(t, err)
+
+	err = db.AddRafsInstance(ctx, &r)
+	require.Nil(t, err)
+
+	r.Annotations["targets"] = "[\"/mnt/a\"]"
+	err = db.UpdateRafsInstance(ctx, &r)
+	require.Nil(t, err)
+
+	instances := make([]*rafs.Rafs, 0)
+	err = db.WalkRafsInstances(ctx, func(r *rafs.Rafs) error {
+		instances = append(instances, r)
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(instances))
+	require.Equal(t, "[\"/mnt/a\"]", instances[0].Annotations["targets"])
+
+	err = db.DeleteRafsInstance(ctx, "volume-1")
+	require.Nil(t, err)
+}
+
+func TestDirtyFlag(t *testing.T) {
+	rootDir := "testdata/dirty"
+	err := os.MkdirAll(rootDir, 0755)
+	require.Nil(t, err)
+	defer func() {
+		_ = os.RemoveAll(rootDir)
+	}()
+
+	db, err := NewDatabase(rootDir)
+	require.Nil(t, err)
+
+	dirty, err := db.MarkDirty()
+	require.Nil(t, err)
+	require.False(t, dirty)
+
+	// Not cleared by the previous user
+	dirty, err = db.MarkDirty()
+	require.Nil(t, err)
+	require.True(t, dirty)
+
+	require.Nil(t, db.MarkClean())
+	dirty, err = db.MarkDirty()
+	require.Nil(t, err)
+	require.False(t, dirty)
+}
+
+func TestConfigHistory(t *testing.T) {
+	rootDir := "testdata/config_history"
+	err := os.MkdirAll(rootDir, 0755)
+	require.Nil(t, err)
+	defer func() {
+		_ = os.RemoveAll(rootDir)
+	}()
+
+	db, err := NewDatabase(rootDir)
+	require.Nil(t, err)
+
+	ctx := context.TODO()
+	_, err = db.ListConfigRecords(ctx, "d1")
+	require.True(t, errdefs.IsNotFound(err))
+
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	record := func(daemonID, snapshotID, op string, ts time.Time, config string) *ConfigRecord {
+		r := &ConfigRecord{DaemonID: daemonID, SnapshotID: snapshotID, Operation: op, Timestamp: ts}
+		if config != "" {
+			r.Config = json.RawMessage(config)
+		}
+		return r
+	}
+	err = db.AddConfigRecords(ctx, []*ConfigRecord{
+		record("d1", "", "start", old, `{"id":0}`),
+		record("d1", "1", "mount", old, `{"id":1}`),
+		record("d1", "1", "mount", old, `{"id":2}`),
+		record("d1", "2", "mount", old, `{"id":3}`),
+		record("d1", "2", "umount", old, ""),
+		record("d1", "3", "mount", now, `{"id":4}`),
+		record("destroyed", "", "start", old, `{}`),
+		record("destroyed", "", "destroy", old, ""),
+	})
+	require.Nil(t, err)
+
+	records, err := db.ListConfigRecords(ctx, "d1")
+	require.Nil(t, err)
+	require.Len(t, records, 6)
+	require.Equal(t, uint64(1), records[0].Seq)
+	require.True(t, records[4].Retired())
+
+	// Configurations in effect are kept however old they are.
+	require.Nil(t, db.PruneConfigHistory(ctx, now.Add(-time.Hour)))
+	records, err = db.ListConfigRecords(ctx, "d1")
+	require.Nil(t, err)
+	require.Len(t, records, 3)
+	require.JSONEq(t, `{"id":0}`, string(records[0].Config))
+	require.JSONEq(t, `{"id":2}`, string(records[1].Config))
+	require.Equal(t, "3", records[2].SnapshotID)
+
+	// History of destroyed daemons is dropped once out of retention.
+	_, err = db.ListConfigRecords(ctx, "destroyed")
+	require.True(t, errdefs.IsNotFound(err))
+}
+
 func TestLegacyRecordsMultipleDaemonModes(t *testing.T) {
 	src, _ := os.Open("testdata/nydus_multiple_compat.db")
 
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/containerd/nydus-snapshotter/pkg/daemon"
+	"github.com/containerd/nydus-snapshotter/pkg/rafs"
+)
+
+// Relocate a path residing in root `from` into root `to`.
+func relocatePath(p, from, to string) (string, bool) {
+	if p != from && !strings.HasPrefix(p, from+string(filepath.Separator)) {
+		return p, false
+	}
+	return to + strings.TrimPrefix(p, from), true
+}
+
+// RelocateRoot rewrites the paths of daemon and RAFS instance records residing
+// in root directory `from` into root directory `to`, when the snapshotter root
+// directory is moved. Returns the number of records rewritten.
+func (db *Database) RelocateRoot(_ context.Context, from, to string) (int, error) {
+	from, to = filepath.Clean(from), filepath.Clean(to)
+
+	var count int
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		// Buckets must not be modified while iterating them.
+		daemonStates := map[string]*daemon.ConfigState{}
+		daemons := getDaemonsBucket(tx)
+		err := daemons.ForEach(func(key, value []byte) error {
+			var s daemon.ConfigState
+			if err := json.Unmarshal(value, &s); err != nil {
+				return errors.Wrapf(err, "unmarshal daemon %s", key)
+			}
+
+			changed := false
+			for _, p := range []*string{&s.APISocket, &s.LogDir, &s.Mountpoint, &s.SupervisorPath, &s.ConfigDir} {
+				var ok bool
+				if *p, ok = relocatePath(*p, from, to); ok {
+					changed = true
+				}
+			}
+			if changed {
+				daemonStates[string(key)] = &s
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for key, s := range daemonStates {
+			if err := updateObject(daemons, key, s); err != nil {
+				return err
+			}
+		}
+
+		rafsInstances := map[string]*rafs.Rafs{}
+		instances := getInstancesBucket(tx)
+		err = instances.ForEach(func(key, value []byte) error {
+			var r rafs.Rafs
+			if err := json.Unmarshal(value, &r); err != nil {
+				return errors.Wrapf(err, "unmarshal instance %s", key)
+			}
+
+			var ok1, ok2 bool
+			r.SnapshotDir, ok1 = relocatePath(r.SnapshotDir, from, to)
+			r.Mountpoint, ok2 = relocatePath(r.Mountpoint, from, to)
+			if ok1 || ok2 {
+				rafsInstances[string(key)] = &r
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for key, r := range rafsInstances {
+			if err := updateObject(instances, key, r); err != nil {
+				return err
+			}
+		}
+
+		count = len(daemonStates) + len(rafsInstances)
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "relocate records from %s to %s", from, to)
+	}
+
+	return count, nil
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/containerd/log"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
 	"github.com/pkg/errors"
 
 	"golang.org/x/net/context"
@@ -104,6 +105,19 @@ func (su *Supervisor) load() ([]byte, int, error) {
 	return data, su.fd, nil
 }
 
+// Report how long transferring the states took and how large they are, since
+// the hot upgrade and failover are blocked on them.
+func (su *Supervisor) collectMetrics(op collector.SupervisorOperation, start time.Time, size int, err error) {
+	c := collector.SupervisorStatesCollector{
+		DaemonID:  su.id,
+		Operation: op,
+		Elapsed:   time.Since(start),
+		Size:      size,
+		Failed:    err != nil,
+	}
+	c.Collect()
+}
+
 func recv(uc *net.UnixConn) ([]byte, int, error) {
 	data := make([]byte, 0)
 	oob := make([]byte, 0)
@@ -195,9 +209,15 @@ func (su *Supervisor) waitStatesTimeout(to time.Duration) (func() error, error)
 		return nil, errors.Wrapf(err, "listen on socket %s", su.path)
 	}
 
-	receiver := func() error {
+	receiver := func() (err error) {
 		defer listener.Close()
 
+		start := time.Now()
+		var data []byte
+		defer func() {
+			su.collectMetrics(collector.SupervisorOperationSave, start, len(data), err)
+		}()
+
 		// After the listener is closed, Accept() wakes up
 		conn, err := listener.Accept()
 		if err != nil {
@@ -205,11 +225,13 @@ func (su *Supervisor) waitStatesTimeout(to time.Duration) (func() error, error)
 		}
 		defer conn.Close()
 
-		data, fd, err := recv(conn.(*net.UnixConn))
+		start = time.Now()
+		var fd int
+		data, fd, err = recv(conn.(*net.UnixConn))
 		if err != nil {
 			return err
 		}
-		log.L.Infof("Supervisor %s receives states. data %d", su.id, len(data))
+		log.L.Infof("Supervisor %s receives states in %s. data %d", su.id, time.Since(start), len(data))
 
 		su.save(data, fd)
 
@@ -261,25 +283,33 @@ func (su *Supervisor) SendStatesTimeout(to time.Duration) error {
 		return errors.Wrap(err, "listen on socket")
 	}
 
-	sender := func() error {
+	sender := func() (err error) {
 		defer listener.Close()
 
+		start := time.Now()
+		var data []byte
+		defer func() {
+			su.collectMetrics(collector.SupervisorOperationRestore, start, len(data), err)
+		}()
+
 		conn, err := listener.Accept()
 		if err != nil {
 			return errors.Wrapf(err, "Listener is closed")
 		}
 		defer conn.Close()
 
+		start = time.Now()
 		// FIXME: It's possible that sending states happens before storing state to the storage.
-		data, fd, err := su.load()
+		var fd int
+		data, fd, err = su.load()
 		if err != nil {
 			return errors.Wrapf(err, "load resources for %s", su.id)
 		}
-		if err := send(conn.(*net.UnixConn), data, fd); err != nil {
+		if err = send(conn.(*net.UnixConn), data, fd); err != nil {
 			return err
 		}
 
-		log.L.Infof("Supervisor %s sends states. data %d", su.id, len(data))
+		log.L.Infof("Supervisor %s sends states in %s. data %d", su.id, time.Since(start), len(data))
 
 		return nil
 	}
@@ -403,6 +433,7 @@ func (ss *SupervisorsSet) DestroySupervisor(id string) error {
 	}
 
 	delete(ss.set, id)
+	collector.DeleteSupervisorMetrics(id)
 
 	supervisor.mu.Lock()
 	defer supervisor.mu.Unlock()
@@ -14,7 +14,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/data"
 )
 
 func TestSupervisor(t *testing.T) {
@@ -64,6 +68,9 @@ func TestSupervisor(t *testing.T) {
 	err = su1.FetchDaemonStates(nydusdSendFd)
 	assert.NoError(t, err)
 
+	saved := data.SupervisorStatesSize.WithLabelValues("su1", string(collector.SupervisorOperationSave))
+	assert.Equal(t, float64(len(sentData)), testutil.ToFloat64(saved))
+
 	nydusdTakeover := func() {
 		err = su1.SendStatesTimeout(0)
 		assert.Nil(t, err)
@@ -106,4 +113,7 @@ func TestSupervisorTimeout(t *testing.T) {
 
 	_, err = net.DialUnix("unix", nil, addr)
 	assert.NotNil(t, err, "%v", err)
+
+	failures := data.SupervisorStatesFailures.WithLabelValues("su1", string(collector.SupervisorOperationRestore))
+	assert.Equal(t, float64(1), testutil.ToFloat64(failures))
 }
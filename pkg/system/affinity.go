@@ -0,0 +1,22 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package system
+
+import (
+	"net/http"
+)
+
+// Warm caches of images on the node, for scheduler extenders to place pods by
+// cache affinity
+const endpointCacheAffinity string = "/api/v1/cache/affinity"
+
+// GET /api/v1/cache/affinity
+func (sc *Controller) describeCacheAffinity() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, sc.fs.CacheAffinity(r.Context()))
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package system
+
+import (
+	"encoding/json"
+	"net/http"
+
+	snpkg "github.com/containerd/containerd/v2/pkg/snapshotters"
+	"github.com/containerd/log"
+
+	"github.com/containerd/nydus-snapshotter/pkg/filesystem"
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+	"github.com/containerd/nydus-snapshotter/pkg/policy"
+)
+
+// Tell how a snapshot would be prepared without side effects.
+const endpointDryRunPrepare string = "/api/v1/snapshots/dry_run"
+
+// POST /api/v1/snapshots/dry_run
+// body: {"ref": "docker.io/library/busybox:nydus", "sandbox_id": "...", "labels": {...}}
+type dryRunPrepareRequest struct {
+	Ref string `json:"ref"`
+	// Sandbox of the container in pod daemon mode
+	SandboxID string            `json:"sandbox_id"`
+	Labels    map[string]string `json:"labels"`
+}
+
+// Judge lazy loading of images in dry run Prepare by the policy the snapshotter follows.
+func WithLazyLoadingPolicy(p *policy.LazyLoadingPolicy) ControllerOpt {
+	return func(sc *Controller) {
+		sc.lazyLoadingPolicy = p
+	}
+}
+
+func (sc *Controller) dryRunPrepare() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req dryRunPrepareRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.L.Errorf("request %v, decode error %s", r, err)
+			m := newErrorMessage(err.Error())
+			http.Error(w, m.encode(), http.StatusBadRequest)
+			return
+		}
+
+		labels := make(map[string]string, len(req.Labels)+2)
+		for k, v := range req.Labels {
+			labels[k] = v
+		}
+		if req.Ref != "" {
+			labels[snpkg.TargetRefLabel] = req.Ref
+			labels[label.CRIImageRef] = req.Ref
+		}
+
+		allowed, reason := sc.lazyLoadingPolicy.Allowed(labels[label.CRIImageRef])
+		if !allowed {
+			labels[label.NydusPrefetchAll] = "true"
+		}
+
+		plan := sc.fs.PlanMount(filesystem.WithSandboxID(r.Context(), req.SandboxID), labels)
+		plan.LazyLoading = allowed
+		plan.LazyLoadingReason = reason
+
+		jsonResponse(w, plan)
+	}
+}
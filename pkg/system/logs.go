@@ -0,0 +1,317 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package system
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/containerd/log"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/internal/logging"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+const (
+	// Stream the log of the snapshotter
+	endpointLogs string = "/api/v1/logs"
+	// Stream the log of a daemon
+	endpointDaemonLogs string = "/api/v1/daemons/{id}/logs"
+)
+
+// How often a followed log file is checked for new lines and rotation.
+var logPollInterval = 500 * time.Millisecond
+
+var (
+	// time="2024-01-02T15:04:05.000000000Z" level=info msg="..."
+	snapshotterLogLevel = regexp.MustCompile(`\blevel=([a-z]+)`)
+	// [2024-01-02 15:04:05.000000 +00:00] INFO [src/bin/nydusd/main.rs:100] ...
+	nydusdLogLevel = regexp.MustCompile(`^\[[^\]]*\]\s+([A-Za-z]+)\b`)
+)
+
+// Filter lines of snapshotter and nydusd logs by level and RAFS instance. Lines
+// without a level, like backtraces, go with the line before them.
+type logFilter struct {
+	level    logrus.Level
+	instance *regexp.Regexp
+	// Whether the last line with a level is taken
+	taken bool
+}
+
+func newLogFilter(level, instance string) (*logFilter, error) {
+	f := &logFilter{level: logrus.TraceLevel, taken: true}
+	if level != "" {
+		lvl, err := logrus.ParseLevel(level)
+		if err != nil {
+			return nil, errors.Wrapf(errdefs.ErrInvalidArgument, "invalid log level %q", level)
+		}
+		f.level = lvl
+		f.taken = false
+	}
+	if instance != "" {
+		// The snapshot ID as a whole word or path component, not a part of
+		// numbers like timestamps.
+		f.instance = regexp.MustCompile(`(^|[\s/"'=])` + regexp.QuoteMeta(instance) + `($|[\s/"',)\]])`)
+		f.taken = false
+	}
+	return f, nil
+}
+
+func lineLevel(line string) (logrus.Level, bool) {
+	m := snapshotterLogLevel.FindStringSubmatch(line)
+	if m == nil {
+		m = nydusdLogLevel.FindStringSubmatch(line)
+	}
+	if m == nil {
+		return 0, false
+	}
+	lvl, err := logrus.ParseLevel(m[1])
+	if err != nil {
+		return 0, false
+	}
+	return lvl, true
+}
+
+func (f *logFilter) match(line string) bool {
+	if lvl, ok := lineLevel(line); ok {
+		f.taken = lvl <= f.level && (f.instance == nil || f.instance.MatchString(line))
+	}
+	return f.taken
+}
+
+type logQuery struct {
+	follow bool
+	// Start from the last lines, all lines if negative
+	tail   int
+	filter *logFilter
+}
+
+// ?follow=true&tail=100&level=warn&instance=<snapshot id>
+func parseLogQuery(r *http.Request) (*logQuery, error) {
+	values := r.URL.Query()
+	q := &logQuery{tail: -1}
+
+	var err error
+	if v := values.Get("follow"); v != "" {
+		if q.follow, err = strconv.ParseBool(v); err != nil {
+			return nil, errors.Wrapf(errdefs.ErrInvalidArgument, "invalid follow %q", v)
+		}
+	}
+	if v := values.Get("tail"); v != "" {
+		if q.tail, err = strconv.Atoi(v); err != nil {
+			return nil, errors.Wrapf(errdefs.ErrInvalidArgument, "invalid tail %q", v)
+		}
+	}
+	if q.filter, err = newLogFilter(values.Get("level"), values.Get("instance")); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// Offset of the last n lines of the file, the beginning of the file if n is
+// negative or the file has fewer lines.
+func tailOffset(f *os.File, n int) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	if n < 0 {
+		return 0, nil
+	}
+	if n == 0 {
+		return size, nil
+	}
+
+	buf := make([]byte, 32*1024)
+	count := 0
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := len(chunk) - 1; i >= 0; i-- {
+			// The newline ending the file doesn't start a line.
+			if chunk[i] != '\n' || start+int64(i) == size-1 {
+				continue
+			}
+			if count++; count == n {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+
+	return 0, nil
+}
+
+// Write the filtered lines of the log file, and the lines appended later if
+// following it until the context is done. The file is opened again once it's
+// rotated, or read from the beginning again once it's truncated.
+func streamLog(ctx context.Context, w io.Writer, flush func(), path string, q *logQuery) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+
+	offset, err := tailOffset(f, q.tail)
+	if err != nil {
+		return errors.Wrapf(err, "find tail of %s", path)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(f)
+	// Incomplete line at the end of the file
+	var partial string
+	rotated := false
+	for {
+		line, err := reader.ReadString('\n')
+		if err == nil {
+			line, partial = partial+line, ""
+			if q.filter.match(line) {
+				if _, err := io.WriteString(w, line); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err != io.EOF {
+			return errors.Wrapf(err, "read %s", path)
+		}
+		partial += line
+		flush()
+
+		if rotated {
+			// The rotated file is read to the end, go on with the new one.
+			newFile, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			f.Close()
+			f, rotated = newFile, false
+			reader.Reset(f)
+			if partial != "" && q.filter.match(partial) {
+				if _, err := io.WriteString(w, partial+"\n"); err != nil {
+					return err
+				}
+			}
+			partial = ""
+			continue
+		}
+
+		if !q.follow {
+			if partial != "" && q.filter.match(partial) {
+				_, err := io.WriteString(w, partial+"\n")
+				return err
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logPollInterval):
+		}
+
+		// The file may be missing for a while during rotation.
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		current, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if !os.SameFile(info, current) {
+			rotated = true
+			continue
+		}
+		if offset, err := f.Seek(0, io.SeekCurrent); err == nil && info.Size() < offset {
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			reader.Reset(f)
+			partial = ""
+		}
+	}
+}
+
+// Respond with the log file as plain text, flushed line by line when following.
+func (sc *Controller) respondLog(w http.ResponseWriter, r *http.Request, path string) {
+	q, err := parseLogQuery(r)
+	if err != nil {
+		m := newErrorMessage(err.Error())
+		http.Error(w, m.encode(), errorStatusCode(err))
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			err = errors.Wrapf(errdefs.ErrNotFound, "log file %s", path)
+		}
+		m := newErrorMessage(err.Error())
+		http.Error(w, m.encode(), errorStatusCode(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	if err := streamLog(r.Context(), w, flush, path, q); err != nil {
+		log.L.WithError(err).Debugf("stop streaming log %s", path)
+	}
+}
+
+// GET /api/v1/logs?follow=true&tail=100&level=warn&instance=<snapshot id>
+// Lines are counted by tail before filtered by level and instance.
+func (sc *Controller) streamLogs() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.GetLogToStdout() {
+			m := newErrorMessage("snapshotter logs to stdout")
+			http.Error(w, m.encode(), http.StatusNotFound)
+			return
+		}
+		sc.respondLog(w, r, logging.LogFile(config.GetLogDir()))
+	}
+}
+
+// GET /api/v1/daemons/{id}/logs?follow=true&tail=100&level=warn&instance=<snapshot id>
+func (sc *Controller) streamDaemonLogs() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		for _, ma := range sc.managers {
+			if d := ma.GetByDaemonID(id); d != nil {
+				sc.respondLog(w, r, d.LogFile())
+				return
+			}
+		}
+
+		m := newErrorMessage(errors.Wrapf(errdefs.ErrNotFound, "daemon %s", id).Error())
+		http.Error(w, m.encode(), http.StatusNotFound)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package system
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testLog = `time="2024-01-02T10:19:17Z" level=info msg="Prepare snapshot 10"
+time="2024-01-02T10:19:18Z" level=debug msg="Mount instance" snapshot=10
+time="2024-01-02T10:19:19Z" level=warning msg="Failed to get daemon 11 metrics"
+[2024-01-02 10:19:20.000000 +00:00] ERROR [src/fusedev.rs:10] failed to mount /10
+stack backtrace:
+   0: nydusd::main
+[2024-01-02 10:19:21.000000 +00:00] INFO [src/main.rs:20] fetched blob of /100
+`
+
+func TestLogFilter(t *testing.T) {
+	filter := func(level, instance string) string {
+		f, err := newLogFilter(level, instance)
+		require.NoError(t, err)
+		var taken []string
+		for _, line := range strings.SplitAfter(testLog, "\n") {
+			if line != "" && f.match(line) {
+				taken = append(taken, line)
+			}
+		}
+		return strings.Join(taken, "")
+	}
+
+	require.Equal(t, testLog, filter("", ""))
+
+	lines := strings.SplitAfter(testLog, "\n")
+	require.Equal(t, lines[2]+lines[3]+lines[4]+lines[5], filter("warn", ""))
+	require.Equal(t, lines[3]+lines[4]+lines[5], filter("error", ""))
+	require.Equal(t, lines[0]+lines[1]+lines[3]+lines[4]+lines[5], filter("", "10"))
+	require.Equal(t, lines[0]+lines[3]+lines[4]+lines[5], filter("info", "10"))
+	require.Equal(t, lines[6], filter("", "100"))
+
+	_, err := newLogFilter("verbose", "")
+	require.Error(t, err)
+}
+
+func TestTailOffset(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "test.log")
+	require.NoError(t, os.WriteFile(p, []byte("a\nbb\nccc\n"), 0644))
+	f, err := os.Open(p)
+	require.NoError(t, err)
+	defer f.Close()
+
+	for n, expected := range map[int]int64{-1: 0, 0: 9, 1: 5, 2: 2, 3: 0, 10: 0} {
+		offset, err := tailOffset(f, n)
+		require.NoError(t, err)
+		require.Equal(t, expected, offset, n)
+	}
+}
+
+// Writer safe to read while a stream writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestStreamLog(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "test.log")
+	require.NoError(t, os.WriteFile(p, []byte(testLog+"incomplete"), 0644))
+	noop := func() {}
+
+	filter, err := newLogFilter("", "")
+	require.NoError(t, err)
+	var out bytes.Buffer
+	require.NoError(t, streamLog(context.Background(), &out, noop, p, &logQuery{tail: 2, filter: filter}))
+	require.Equal(t, "[2024-01-02 10:19:21.000000 +00:00] INFO [src/main.rs:20] fetched blob of /100\nincomplete\n", out.String())
+
+	require.Error(t, streamLog(context.Background(), &out, noop, filepath.Join(t.TempDir(), "missing.log"), &logQuery{filter: filter}))
+}
+
+func TestStreamLogFollow(t *testing.T) {
+	interval := logPollInterval
+	logPollInterval = 10 * time.Millisecond
+	defer func() { logPollInterval = interval }()
+
+	p := filepath.Join(t.TempDir(), "test.log")
+	require.NoError(t, os.WriteFile(p, []byte("line 1\n"), 0644))
+
+	filter, err := newLogFilter("", "")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &syncBuffer{}
+	done := make(chan error)
+	go func() {
+		done <- streamLog(ctx, out, func() {}, p, &logQuery{follow: true, tail: -1, filter: filter})
+	}()
+
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("line 2\nline")
+	require.NoError(t, err)
+	time.Sleep(5 * logPollInterval)
+	_, err = f.WriteString(" 3\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.Eventually(t, func() bool {
+		return out.String() == "line 1\nline 2\nline 3\n"
+	}, 5*time.Second, logPollInterval)
+
+	// Rotate the log
+	require.NoError(t, os.Rename(p, p+".1"))
+	require.NoError(t, os.WriteFile(p, []byte("line 4\n"), 0644))
+	require.Eventually(t, func() bool {
+		return out.String() == "line 1\nline 2\nline 3\nline 4\n"
+	}, 5*time.Second, logPollInterval)
+
+	// Truncate the log
+	require.NoError(t, os.WriteFile(p, []byte("5\n"), 0644))
+	require.Eventually(t, func() bool {
+		return out.String() == "line 1\nline 2\nline 3\nline 4\n5\n"
+	}, 5*time.Second, logPollInterval)
+
+	cancel()
+	require.NoError(t, <-done)
+}
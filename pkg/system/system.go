@@ -23,14 +23,22 @@ import (
 	"github.com/containerd/log"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/containerd/nydus-snapshotter/config"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon"
 	"github.com/containerd/nydus-snapshotter/pkg/daemon/types"
+	"github.com/containerd/nydus-snapshotter/pkg/endpoint"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/events"
 	"github.com/containerd/nydus-snapshotter/pkg/filesystem"
 	"github.com/containerd/nydus-snapshotter/pkg/manager"
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/registry"
 	metrics "github.com/containerd/nydus-snapshotter/pkg/metrics/tool"
+	"github.com/containerd/nydus-snapshotter/pkg/policy"
 	"github.com/containerd/nydus-snapshotter/pkg/prefetch"
+	"github.com/containerd/nydus-snapshotter/pkg/store"
+	"github.com/containerd/nydus-snapshotter/pkg/umount"
 )
 
 const (
@@ -44,6 +52,14 @@ const (
 	endpointPrefetch       string = "/api/v1/prefetch"
 	// Provide backend information
 	endpointGetBackend string = "/api/v1/daemons/{id}/backend"
+	// Snapshotter metrics in Prometheus text format
+	endpointMetrics string = "/api/v1/metrics"
+	// Stream lifecycle events of daemons and instances as JSON lines
+	endpointEvents string = "/api/v1/events"
+	// Read-ahead windows of workload classes
+	endpointReadAhead string = "/api/v1/readahead"
+	// Configurations rendered for a daemon and its RAFS instances
+	endpointConfigHistory string = "/api/v1/daemons/{id}/config_history"
 )
 
 const defaultErrorCode string = "Unknown"
@@ -62,6 +78,21 @@ type Controller struct {
 	// httpSever *http.Server
 	addr   *net.UnixAddr
 	router *mux.Router
+	// Listen on TCP address rather than unix domain socket if not empty.
+	tcpAddr  string
+	security *endpoint.Security
+	// Policy of lazy loading images, nil allows all.
+	lazyLoadingPolicy *policy.LazyLoadingPolicy
+	umountQueue       *umount.Queue
+}
+
+type ControllerOpt func(*Controller)
+
+// Secure the controller with TLS and token authentication when it listens on TCP.
+func WithSecurity(security *endpoint.Security) ControllerOpt {
+	return func(sc *Controller) {
+		sc.security = security
+	}
 }
 
 type upgradeRequest struct {
@@ -114,6 +145,12 @@ type daemonInfo struct {
 	StartupCPUUtilization float64 `json:"startup_cpu_utilization"`
 	MemoryRSS             float64 `json:"memory_rss_kb"`
 	ReadData              float32 `json:"read_data_kb"`
+	// Reconnected on recovery but not queried yet
+	Unverified bool `json:"unverified"`
+	// The disk is full
+	Degraded bool `json:"degraded"`
+	// How nydusd performs backend and cache IO
+	IOEngine string `json:"io_engine"`
 
 	Instances map[string]rafsInstanceInfo `json:"instances"`
 }
@@ -125,7 +162,28 @@ type rafsInstanceInfo struct {
 	ImageID     string `json:"image_id"`
 }
 
-func NewSystemController(fs *filesystem.Filesystem, managers []*manager.Manager, sock string) (*Controller, error) {
+func NewSystemController(fs *filesystem.Filesystem, managers []*manager.Manager, sock string, opts ...ControllerOpt) (*Controller, error) {
+	if config.IsTCPAddress(sock) {
+		sc := Controller{
+			fs:       fs,
+			managers: managers,
+			router:   mux.NewRouter(),
+			tcpAddr:  config.TrimTCPAddress(sock),
+		}
+		for _, o := range opts {
+			o(&sc)
+		}
+		// Anyone reaching the address could upgrade daemons or mount volumes.
+		if !sc.security.Secured() {
+			return nil, errors.Wrapf(errdefs.ErrInvalidArgument,
+				"system controller on TCP address %s requires TLS or token authentication", sc.tcpAddr)
+		}
+
+		sc.registerRouter()
+
+		return &sc, nil
+	}
+
 	if err := os.MkdirAll(filepath.Dir(sock), os.ModePerm); err != nil {
 		return nil, err
 	}
@@ -147,6 +205,9 @@ func NewSystemController(fs *filesystem.Filesystem, managers []*manager.Manager,
 		addr:     addr,
 		router:   mux.NewRouter(),
 	}
+	for _, o := range opts {
+		o(&sc)
+	}
 
 	sc.registerRouter()
 
@@ -154,6 +215,20 @@ func NewSystemController(fs *filesystem.Filesystem, managers []*manager.Manager,
 }
 
 func (sc *Controller) Run() error {
+	if sc.tcpAddr != "" {
+		log.L.Infof("Start system controller API server on tcp %s", sc.tcpAddr)
+		listener, err := sc.security.Listen(sc.tcpAddr)
+		if err != nil {
+			return errors.Wrapf(err, "listen to address %s", sc.tcpAddr)
+		}
+
+		if err := http.Serve(listener, sc.security.Handler(sc.router)); err != nil {
+			return errors.Wrapf(err, "system management serving")
+		}
+
+		return nil
+	}
+
 	log.L.Infof("Start system controller API server on %s", sc.addr)
 	listener, err := net.ListenUnix("unix", sc.addr)
 	if err != nil {
@@ -174,6 +249,20 @@ func (sc *Controller) registerRouter() {
 	sc.router.HandleFunc(endpointDaemonRecords, sc.getDaemonRecords()).Methods(http.MethodGet)
 	sc.router.HandleFunc(endpointPrefetch, sc.setPrefetchConfiguration()).Methods(http.MethodPut)
 	sc.router.HandleFunc(endpointGetBackend, sc.getBackend()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointConfigHistory, sc.getConfigHistory()).Methods(http.MethodGet)
+	sc.router.Handle(endpointMetrics, promhttp.HandlerFor(registry.Registry, promhttp.HandlerOpts{})).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointEvents, sc.streamEvents()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointLogs, sc.streamLogs()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointDaemonLogs, sc.streamDaemonLogs()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointReadAhead, sc.describeReadAhead()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointReadAhead, sc.setReadAhead()).Methods(http.MethodPut)
+	sc.router.HandleFunc(endpointVolumes, sc.describeVolumes()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointVolumes, sc.mountVolume()).Methods(http.MethodPost)
+	sc.router.HandleFunc(endpointVolume, sc.describeVolume()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointVolume, sc.umountVolume()).Methods(http.MethodDelete)
+	sc.router.HandleFunc(endpointDryRunPrepare, sc.dryRunPrepare()).Methods(http.MethodPost)
+	sc.router.HandleFunc(endpointCacheAffinity, sc.describeCacheAffinity()).Methods(http.MethodGet)
+	sc.router.HandleFunc(endpointSnapshotsCleanup, sc.describeSnapshotsCleanup()).Methods(http.MethodGet)
 }
 
 func (sc *Controller) getBackend() func(w http.ResponseWriter, r *http.Request) {
@@ -216,20 +305,120 @@ func (sc *Controller) getBackend() func(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// GET /api/v1/daemons/{id}/config_history?at=2024-01-02T15:04:05Z
+// History of a destroyed daemon is still retrievable until it expires. With `at`,
+// only the configurations in effect at that time are returned.
+func (sc *Controller) getConfigHistory() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+
+		var at time.Time
+		if v := r.URL.Query().Get("at"); v != "" {
+			var err error
+			if at, err = time.Parse(time.RFC3339, v); err != nil {
+				m := newErrorMessage(err.Error())
+				http.Error(w, m.encode(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		err := errdefs.ErrNotFound
+		for _, ma := range sc.managers {
+			var records []store.ConfigRecord
+			records, err = ma.ConfigHistory(id, at)
+			if err == nil {
+				jsonResponse(w, records)
+				return
+			}
+			if !errdefs.IsNotFound(err) {
+				break
+			}
+		}
+
+		log.L.WithError(err).Errorf("get configuration history of daemon %s", id)
+		m := newErrorMessage(err.Error())
+		http.Error(w, m.encode(), errorStatusCode(err))
+	}
+}
+
 func (sc *Controller) setPrefetchConfiguration() func(w http.ResponseWriter, r *http.Request) {
-	return func(_ http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
 			log.L.Errorf("Failed to read prefetch list: %v", err)
+			m := newErrorMessage(err.Error())
+			http.Error(w, m.encode(), http.StatusBadRequest)
 			return
 		}
 		if err = prefetch.Pm.SetPrefetchFiles(body); err != nil {
 			log.L.Errorf("Failed to parse request body: %v", err)
+			m := newErrorMessage(err.Error())
+			http.Error(w, m.encode(), http.StatusBadRequest)
 			return
 		}
 	}
 }
 
+// GET /api/v1/readahead
+func (sc *Controller) describeReadAhead() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		jsonResponse(w, sc.fs.ReadAheadWindows())
+	}
+}
+
+// PUT /api/v1/readahead
+// body: {"class": "database", "amplify_io": 131072, "merging_size": 131072}
+// The window applies to RAFS instances mounted afterwards.
+type readAheadRequest struct {
+	Class string `json:"class"`
+	config.ReadAheadWindow
+}
+
+func (sc *Controller) setReadAhead() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req readAheadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.L.Errorf("request %v, decode error %s", r, err)
+			m := newErrorMessage(err.Error())
+			http.Error(w, m.encode(), http.StatusBadRequest)
+			return
+		}
+
+		if err := sc.fs.SetReadAheadWindow(req.Class, req.ReadAheadWindow); err != nil {
+			log.L.WithError(err).Errorf("set read-ahead window of workload class %s", req.Class)
+			m := newErrorMessage(err.Error())
+			http.Error(w, m.encode(), errorStatusCode(err))
+			return
+		}
+	}
+}
+
+// GET /api/v1/events
+// Events published after the request are written as JSON lines until the client disconnects.
+func (sc *Controller) streamEvents() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ch := events.Bus.Subscribe(r.Context())
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		encoder := json.NewEncoder(w)
+		for ev := range ch {
+			if err := encoder.Encode(&ev); err != nil {
+				log.L.WithError(err).Debug("stop streaming events")
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
 func (sc *Controller) describeDaemons() func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, _ *http.Request) {
 		info := make([]daemonInfo, 0, 10)
@@ -253,12 +442,16 @@ func (sc *Controller) describeDaemons() func(w http.ResponseWriter, r *http.Requ
 					log.L.Warnf("Failed to get daemon %s RSS memory", d.ID())
 				}
 
+				// Listing daemons doesn't verify them.
 				var readData float32
-				fsMetrics, err := d.GetFsMetrics("")
-				if err != nil {
-					log.L.Warnf("Failed to get file system metrics")
-				} else {
-					readData = float32(fsMetrics.DataRead) / 1024
+				unverified := d.Unverified()
+				if !unverified {
+					fsMetrics, err := d.GetFsMetrics("")
+					if err != nil {
+						log.L.Warnf("Failed to get file system metrics")
+					} else {
+						readData = float32(fsMetrics.DataRead) / 1024
+					}
 				}
 
 				i := daemonInfo{
@@ -270,6 +463,9 @@ func (sc *Controller) describeDaemons() func(w http.ResponseWriter, r *http.Requ
 					StartupCPUUtilization: d.StartupCPUUtilization,
 					MemoryRSS:             memRSS,
 					ReadData:              readData,
+					Unverified:            unverified,
+					Degraded:              d.Degraded(),
+					IOEngine:              d.IOEngine(),
 				}
 
 				info = append(info, i)
@@ -359,7 +555,7 @@ func (sc *Controller) upgradeDaemons() func(w http.ResponseWriter, r *http.Reque
 
 // Provide minimal parameters since most of it can be recovered by nydusd states.
 // Create a new daemon in Manger to take over the service.
-func (sc *Controller) upgradeNydusDaemon(d *daemon.Daemon, c upgradeRequest, manager *manager.Manager) error {
+func (sc *Controller) upgradeNydusDaemon(d *daemon.Daemon, c upgradeRequest, ma *manager.Manager) error {
 	log.L.Infof("Upgrading nydusd %s, request %v", d.ID(), c)
 
 	fs := sc.fs
@@ -379,12 +575,12 @@ func (sc *Controller) upgradeNydusDaemon(d *daemon.Daemon, c upgradeRequest, man
 	upgradingSocket := path.Join(path.Dir(d.GetAPISock()), next)
 	newDaemon.States.APISocket = upgradingSocket
 
-	cmd, err := manager.BuildDaemonCommand(&newDaemon, c.NydusdPath, true)
+	cmd, err := ma.BuildDaemonCommand(&newDaemon, c.NydusdPath, true)
 	if err != nil {
 		return err
 	}
 
-	su := manager.SupervisorSet.GetSupervisor(d.ID())
+	su := ma.SupervisorSet.GetSupervisor(d.ID())
 	if err := su.SendStatesTimeout(time.Second * 10); err != nil {
 		return errors.Wrap(err, "Send states")
 	}
@@ -392,6 +588,7 @@ func (sc *Controller) upgradeNydusDaemon(d *daemon.Daemon, c upgradeRequest, man
 	if err := cmd.Start(); err != nil {
 		return errors.Wrap(err, "start process")
 	}
+	newDaemon.States.ProcessID = cmd.Process.Pid
 
 	if err := newDaemon.WaitUntilState(types.DaemonStateInit); err != nil {
 		return errors.Wrap(err, "wait until init state")
@@ -405,7 +602,7 @@ func (sc *Controller) upgradeNydusDaemon(d *daemon.Daemon, c upgradeRequest, man
 		return errors.Wrap(err, "wait unit ready state")
 	}
 
-	if err := manager.UnsubscribeDaemonEvent(d); err != nil {
+	if err := ma.UnsubscribeDaemonEvent(d); err != nil {
 		return errors.Wrap(err, "unsubscribe daemon event")
 	}
 
@@ -420,16 +617,19 @@ func (sc *Controller) upgradeNydusDaemon(d *daemon.Daemon, c upgradeRequest, man
 		return errors.Wrap(err, "start file system service")
 	}
 
-	if err := manager.SubscribeDaemonEvent(&newDaemon); err != nil {
+	if err := ma.SubscribeDaemonEvent(&newDaemon); err != nil {
 		return &json.InvalidUnmarshalError{}
 	}
 
 	log.L.Infof("Started service of upgraded daemon on socket %s", newDaemon.GetAPISock())
 
-	if err := manager.UpdateDaemonLocked(&newDaemon); err != nil {
+	if err := ma.UpdateDaemonLocked(&newDaemon); err != nil {
 		return err
 	}
 
+	// The upgraded daemon takes over the configuration of the older one.
+	ma.RecordConfig(&newDaemon, "", manager.ConfigOpUpgrade, d.Config)
+
 	log.L.Infof("Upgraded daemon success on socket %s", newDaemon.GetAPISock())
 
 	return nil
@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package system
+
+import (
+	"net/http"
+
+	"github.com/containerd/nydus-snapshotter/pkg/umount"
+)
+
+// Snapshot directories waiting to be umounted and removed in background, and the
+// ones given up after all retries which are left on disk for inspection.
+const endpointSnapshotsCleanup string = "/api/v1/snapshots/cleanup"
+
+type cleanupInfo struct {
+	Pending     []string            `json:"pending"`
+	DeadLetters []umount.DeadLetter `json:"dead_letters"`
+}
+
+// Describe the background cleanup of removed snapshots by the queue.
+func WithUmountQueue(q *umount.Queue) ControllerOpt {
+	return func(sc *Controller) {
+		sc.umountQueue = q
+	}
+}
+
+// GET /api/v1/snapshots/cleanup
+func (sc *Controller) describeSnapshotsCleanup() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		info := cleanupInfo{Pending: []string{}, DeadLetters: []umount.DeadLetter{}}
+		if sc.umountQueue != nil {
+			info.Pending = sc.umountQueue.Pending()
+			info.DeadLetters = sc.umountQueue.DeadLetters()
+		}
+		jsonResponse(w, info)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package system
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/containerd/log"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+const (
+	// Mount nydus images as read-only volumes outside of container rootfs, e.g. for CSI drivers.
+	endpointVolumes string = "/api/v1/volumes"
+	endpointVolume  string = "/api/v1/volumes/{id}"
+)
+
+// POST /api/v1/volumes
+// body: {"id": "dataset-1", "image": "docker.io/library/dataset:nydus", "target": "/path/to/publish"}
+type mountVolumeRequest struct {
+	ID     string            `json:"id"`
+	Image  string            `json:"image"`
+	Target string            `json:"target"`
+	Labels map[string]string `json:"labels"`
+}
+
+func errorStatusCode(err error) int {
+	switch {
+	case errors.Is(err, errdefs.ErrInvalidArgument):
+		return http.StatusBadRequest
+	case errdefs.IsNotFound(err):
+		return http.StatusNotFound
+	case errdefs.IsAlreadyExists(err):
+		return http.StatusConflict
+	case errors.Is(err, errdefs.ErrNotImplemented):
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (sc *Controller) mountVolume() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req mountVolumeRequest
+		var err error
+		var statusCode int
+
+		defer func() {
+			if err != nil {
+				m := newErrorMessage(err.Error())
+				http.Error(w, m.encode(), statusCode)
+			}
+		}()
+
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.L.Errorf("request %v, decode error %s", r, err)
+			statusCode = http.StatusBadRequest
+			return
+		}
+
+		// The volume outlives the request, so don't bind it to the request context.
+		v, err := sc.fs.MountVolume(context.Background(), req.ID, req.Image, req.Target, req.Labels)
+		if err != nil {
+			log.L.WithError(err).Errorf("mount volume %s", req.ID)
+			statusCode = errorStatusCode(err)
+			return
+		}
+
+		jsonResponse(w, v)
+	}
+}
+
+// DELETE /api/v1/volumes/{id}?target=/path/to/publish
+// Without target, the volume is unpublished from all of its targets.
+func (sc *Controller) umountVolume() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["id"]
+		target := r.URL.Query().Get("target")
+
+		if err := sc.fs.UmountVolume(context.Background(), id, target); err != nil {
+			log.L.WithError(err).Errorf("umount volume %s", id)
+			m := newErrorMessage(err.Error())
+			http.Error(w, m.encode(), errorStatusCode(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (sc *Controller) describeVolumes() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		jsonResponse(w, sc.fs.ListVolumes())
+	}
+}
+
+func (sc *Controller) describeVolume() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v, err := sc.fs.GetVolume(mux.Vars(r)["id"])
+		if err != nil {
+			m := newErrorMessage(err.Error())
+			http.Error(w, m.encode(), errorStatusCode(err))
+			return
+		}
+
+		jsonResponse(w, v)
+	}
+}
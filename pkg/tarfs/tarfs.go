@@ -54,6 +54,9 @@ const (
 	TarfsImageBootstrapName = "image.boot"
 	TarfsLayerDiskName      = "layer.disk"
 	TarfsImageDiskName      = "image.disk"
+	// Overlayfs fails to mount images with too many lower directories, limited by the
+	// kernel stack depth and page sized mount options. Same as docker overlay2.
+	DefaultMaxLowerLayers = 128
 )
 
 type Manager struct {
@@ -65,6 +68,7 @@ type Manager struct {
 	insecure             bool
 	validateDiffID       bool // whether to validate digest for uncompressed content
 	checkTarfsHint       bool // whether to rely on tarfs hint annotation
+	maxLowerLayers       int  // OCI images with more layers use tarfs even without hint
 	maxConcurrentProcess int64
 	processLimiterCache  *lru.Cache // cache image ref and concurrent limiter for blob processes
 	tarfsHintCache       *lru.Cache // cache oci image ref and tarfs hint annotation
@@ -84,7 +88,11 @@ type snapshotStatus struct {
 	cancel          context.CancelFunc
 }
 
-func NewManager(insecure, checkTarfsHint bool, cacheDirPath, nydusImagePath string, maxConcurrentProcess int64) *Manager {
+func NewManager(insecure, checkTarfsHint bool, cacheDirPath, nydusImagePath string, maxConcurrentProcess int64, maxLowerLayers int) *Manager {
+	if maxLowerLayers <= 0 {
+		maxLowerLayers = DefaultMaxLowerLayers
+	}
+
 	return &Manager{
 		snapshotMap:          map[string]*snapshotStatus{},
 		cacheDirPath:         cacheDirPath,
@@ -92,6 +100,7 @@ func NewManager(insecure, checkTarfsHint bool, cacheDirPath, nydusImagePath stri
 		insecure:             insecure,
 		validateDiffID:       true,
 		checkTarfsHint:       checkTarfsHint,
+		maxLowerLayers:       maxLowerLayers,
 		maxConcurrentProcess: maxConcurrentProcess,
 		tarfsHintCache:       lru.New(50),
 		processLimiterCache:  lru.New(50),
@@ -114,7 +123,7 @@ func (t *Manager) fetchImageInfo(ctx context.Context, remote *remote.Remote, ref
 
 	if t.checkTarfsHint {
 		// cache ref & tarfs hint annotation
-		t.tarfsHintCache.Add(ref, label.HasTarfsHint(manifest.Annotations))
+		t.tarfsHintCache.Add(ref, t.useTarfs(ref, &manifest))
 	}
 	if t.validateDiffID {
 		// cache OCI blob digest & diff id
@@ -126,6 +135,22 @@ func (t *Manager) fetchImageInfo(ctx context.Context, remote *remote.Remote, ref
 	return nil
 }
 
+// Only consulted when tarfs hint is checked, otherwise all OCI images use tarfs.
+// Besides OCI images with tarfs hint, ones with more layers than overlayfs can stack
+// use tarfs as well, so their layers are merged and mounted as one EROFS lower
+// directory. Nydus images never need it, their meta layer is a merged bootstrap.
+func (t *Manager) useTarfs(ref string, manifest *ocispec.Manifest) bool {
+	if label.HasTarfsHint(manifest.Annotations) {
+		return true
+	}
+	if len(manifest.Layers) > t.maxLowerLayers {
+		log.L.Infof("Image %s has %d layers exceeding overlayfs limit %d, use tarfs for it",
+			ref, len(manifest.Layers), t.maxLowerLayers)
+		return true
+	}
+	return false
+}
+
 func (t *Manager) fetchImageManifest(ctx context.Context, remote *remote.Remote, ref string, manifestDigest digest.Digest) (ocispec.Manifest, error) {
 	rc, desc, err := t.getBlobStream(ctx, remote, ref, manifestDigest)
 	if err != nil {
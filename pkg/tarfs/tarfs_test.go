@@ -0,0 +1,32 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package tarfs
+
+import (
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/containerd/nydus-snapshotter/pkg/label"
+)
+
+func TestUseTarfs(t *testing.T) {
+	mgr := NewManager(false, true, t.TempDir(), "nydus-image", 0, 0)
+	assert.Equal(t, DefaultMaxLowerLayers, mgr.maxLowerLayers)
+
+	mgr = NewManager(false, true, t.TempDir(), "nydus-image", 0, 2)
+
+	manifest := ocispec.Manifest{Layers: make([]ocispec.Descriptor, 2)}
+	assert.False(t, mgr.useTarfs("docker.io/library/busybox:latest", &manifest))
+
+	manifest.Annotations = map[string]string{label.TarfsHint: "true"}
+	assert.True(t, mgr.useTarfs("docker.io/library/busybox:latest", &manifest))
+
+	manifest = ocispec.Manifest{Layers: make([]ocispec.Descriptor, 3)}
+	assert.True(t, mgr.useTarfs("docker.io/library/busybox:latest", &manifest))
+}
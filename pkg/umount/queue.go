@@ -0,0 +1,280 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+// Package umount umounts and cleans up removed snapshots in background, so that
+// containerd is not blocked by slow or transiently failing umounts.
+package umount
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/containerd/log"
+
+	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+)
+
+const (
+	defaultMaxAttempts = 5
+	defaultBackoff     = time.Second
+	defaultMaxBackoff  = 30 * time.Second
+)
+
+// Func does the work of a job, errors are retried.
+type Func func(ctx context.Context) error
+
+// DeadLetter records a job that still failed after all attempts.
+type DeadLetter struct {
+	ID       string    `json:"id"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type job struct {
+	id       string
+	fn       Func
+	attempts int
+}
+
+// Queue runs jobs one by one in a background worker. A failed job is retried with
+// exponential backoff and moved to the dead letters after the maximum attempts,
+// which are kept for inspection until the job is added again.
+type Queue struct {
+	mu sync.Mutex
+	// Jobs queued, running or waiting for retry, indexed by ID.
+	pending map[string]*job
+	ready   []*job
+	dead    map[string]DeadLetter
+
+	notify chan struct{}
+	stop   chan struct{}
+	once   sync.Once
+	wg     sync.WaitGroup
+
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+type Opt func(q *Queue)
+
+func WithMaxAttempts(n int) Opt {
+	return func(q *Queue) {
+		q.maxAttempts = n
+	}
+}
+
+func WithBackoff(backoff, maxBackoff time.Duration) Opt {
+	return func(q *Queue) {
+		q.backoff = backoff
+		q.maxBackoff = maxBackoff
+	}
+}
+
+func NewQueue(opts ...Opt) *Queue {
+	q := &Queue{
+		pending:     make(map[string]*job),
+		dead:        make(map[string]DeadLetter),
+		notify:      make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		maxAttempts: defaultMaxAttempts,
+		backoff:     defaultBackoff,
+		maxBackoff:  defaultMaxBackoff,
+	}
+
+	for _, o := range opts {
+		o(q)
+	}
+
+	if q.maxAttempts < 1 {
+		q.maxAttempts = 1
+	}
+
+	return q
+}
+
+// Start the background worker, it exits when the queue is stopped.
+func (q *Queue) Start(ctx context.Context) {
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		for {
+			select {
+			case <-q.stop:
+				return
+			case <-q.notify:
+			}
+
+			for {
+				j := q.pop()
+				if j == nil {
+					break
+				}
+				q.run(ctx, j)
+				select {
+				case <-q.stop:
+					return
+				default:
+				}
+			}
+		}
+	}()
+}
+
+// Stop the background worker and wait for the running job to finish. Jobs not done
+// yet are dropped.
+func (q *Queue) Stop() {
+	q.once.Do(func() {
+		close(q.stop)
+	})
+	q.wg.Wait()
+}
+
+// Add a job unless a job of the same ID is pending. Adding a job clears its
+// dead letter, if any.
+func (q *Queue) Add(id string, fn Func) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.pending[id]; ok {
+		return false
+	}
+	delete(q.dead, id)
+
+	j := &job{id: id, fn: fn}
+	q.pending[id] = j
+	q.pushLocked(j)
+	q.collectLocked()
+
+	return true
+}
+
+// Pending returns IDs of jobs not done yet.
+func (q *Queue) Pending() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := make([]string, 0, len(q.pending))
+	for id := range q.pending {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+func (q *Queue) DeadLetters() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	letters := make([]DeadLetter, 0, len(q.dead))
+	for _, l := range q.dead {
+		letters = append(letters, l)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].ID < letters[j].ID
+	})
+
+	return letters
+}
+
+// Drain waits until all pending jobs are done or moved to the dead letters.
+func (q *Queue) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		q.mu.Lock()
+		n := len(q.pending)
+		q.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *Queue) pop() *job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.ready) == 0 {
+		return nil
+	}
+	j := q.ready[0]
+	q.ready = q.ready[1:]
+
+	return j
+}
+
+func (q *Queue) pushLocked(j *job) {
+	q.ready = append(q.ready, j)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) run(ctx context.Context, j *job) {
+	j.attempts++
+	final := j.attempts >= q.maxAttempts
+	err := j.fn(ctx)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch {
+	case err == nil:
+		delete(q.pending, j.id)
+		collector.NewUmountEventCollector(collector.UmountEventDone).Collect()
+	case final:
+		log.L.WithError(err).Errorf("Give up cleaning up %s after %d attempts", j.id, j.attempts)
+		delete(q.pending, j.id)
+		q.dead[j.id] = DeadLetter{
+			ID:       j.id,
+			Attempts: j.attempts,
+			Error:    err.Error(),
+			FailedAt: time.Now(),
+		}
+		collector.NewUmountEventCollector(collector.UmountEventDead).Collect()
+	default:
+		delay := q.delay(j.attempts)
+		log.L.WithError(err).Warnf("Failed to clean up %s, retry in %s", j.id, delay)
+		collector.NewUmountEventCollector(collector.UmountEventRetry).Collect()
+		time.AfterFunc(delay, func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.pushLocked(j)
+		})
+	}
+
+	q.collectLocked()
+}
+
+func (q *Queue) delay(attempts int) time.Duration {
+	delay := q.backoff
+	for i := 1; i < attempts && delay < q.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > q.maxBackoff {
+		delay = q.maxBackoff
+	}
+
+	return delay
+}
+
+func (q *Queue) collectLocked() {
+	c := collector.UmountQueueCollector{Pending: len(q.pending), DeadLetters: len(q.dead)}
+	c.Collect()
+}
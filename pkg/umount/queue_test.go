@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package umount
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueRetry(t *testing.T) {
+	q := NewQueue(WithMaxAttempts(3), WithBackoff(time.Millisecond, 5*time.Millisecond))
+	q.Start(context.Background())
+	defer q.Stop()
+
+	var mu sync.Mutex
+	attempts := 0
+	require.True(t, q.Add("busy", func(_ context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts < 2 {
+			return syscall.EBUSY
+		}
+		return nil
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, q.Drain(ctx))
+	require.Equal(t, 2, attempts)
+	require.Empty(t, q.DeadLetters())
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	q := NewQueue(WithMaxAttempts(3), WithBackoff(time.Millisecond, 5*time.Millisecond))
+	q.Start(context.Background())
+	defer q.Stop()
+
+	attempts := 0
+	fn := func(_ context.Context) error {
+		attempts++
+		return syscall.EBUSY
+	}
+	require.True(t, q.Add("busy", fn))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, q.Drain(ctx))
+	require.Equal(t, 3, attempts)
+
+	letters := q.DeadLetters()
+	require.Len(t, letters, 1)
+	require.Equal(t, "busy", letters[0].ID)
+	require.Equal(t, 3, letters[0].Attempts)
+	require.Contains(t, letters[0].Error, "busy")
+
+	// Adding the job again clears its dead letter.
+	require.True(t, q.Add("busy", func(_ context.Context) error { return nil }))
+	require.NoError(t, q.Drain(ctx))
+	require.Empty(t, q.DeadLetters())
+}
+
+func TestQueueDeduplicate(t *testing.T) {
+	q := NewQueue()
+
+	require.True(t, q.Add("a", func(_ context.Context) error { return nil }))
+	require.False(t, q.Add("a", func(_ context.Context) error { return nil }))
+	require.Equal(t, []string{"a"}, q.Pending())
+
+	q.Start(context.Background())
+	defer q.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, q.Drain(ctx))
+	require.Empty(t, q.Pending())
+}
+
+func TestQueueDelay(t *testing.T) {
+	q := NewQueue(WithBackoff(time.Second, 5*time.Second))
+	require.Equal(t, time.Second, q.delay(1))
+	require.Equal(t, 2*time.Second, q.delay(2))
+	require.Equal(t, 4*time.Second, q.delay(3))
+	require.Equal(t, 5*time.Second, q.delay(4))
+	require.Equal(t, 5*time.Second, q.delay(10))
+}
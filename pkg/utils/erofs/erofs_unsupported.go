@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package erofs
+
+import (
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+func Mount(_, _, _ string) error {
+	return errdefs.ErrNotImplemented
+}
+
+func Umount(_ string) error {
+	return errdefs.ErrNotImplemented
+}
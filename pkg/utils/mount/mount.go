@@ -10,7 +10,6 @@ package mount
 import (
 	"os"
 	"path/filepath"
-	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
@@ -35,8 +34,7 @@ func (m *Mounter) Umount(target string) error {
 		return err
 	}
 
-	// return syscall.Unmount(target, syscall.MNT_FORCE)
-	return syscall.Unmount(target, 0)
+	return unmount(target)
 }
 
 func NormalizePath(path string) (realPath string, err error) {
@@ -74,7 +72,7 @@ func IsMountpoint(path string) (bool, error) {
 	}
 
 	// If the directory has a different device as parent, then it is a mountpoint.
-	if stat.Sys().(*syscall.Stat_t).Dev != parentStat.Sys().(*syscall.Stat_t).Dev {
+	if deviceID(stat) != deviceID(parentStat) {
 		return true, nil
 	}
 
@@ -0,0 +1,24 @@
+//go:build linux
+// +build linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package mount
+
+import (
+	"os"
+	"syscall"
+)
+
+func unmount(target string) error {
+	// return syscall.Unmount(target, syscall.MNT_FORCE)
+	return syscall.Unmount(target, 0)
+}
+
+func deviceID(info os.FileInfo) uint64 {
+	return info.Sys().(*syscall.Stat_t).Dev
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package mount
+
+import (
+	"os"
+
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+func unmount(_ string) error {
+	return errdefs.ErrNotImplemented
+}
+
+// Nothing is mounted by the snapshotter on unsupported platforms.
+func deviceID(_ os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (c) 2024. Nydus Developers. All rights reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package sysinfo
+
+import (
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+)
+
+func GetTotalMemoryBytes() (int, error) {
+	return 0, errdefs.ErrNotImplemented
+}
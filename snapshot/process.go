@@ -8,16 +8,23 @@ package snapshot
 
 import (
 	"context"
+	"maps"
 	"path"
+	"strings"
 
+	"github.com/opencontainers/go-digest"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/containerd/containerd/v2/core/mount"
+	"github.com/containerd/containerd/v2/core/snapshots"
 	"github.com/containerd/containerd/v2/core/snapshots/storage"
 	snpkg "github.com/containerd/containerd/v2/pkg/snapshotters"
 	"github.com/containerd/nydus-snapshotter/config"
+	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
+	"github.com/containerd/nydus-snapshotter/pkg/filesystem"
 	"github.com/containerd/nydus-snapshotter/pkg/label"
+	"github.com/containerd/nydus-snapshotter/pkg/prefetch"
 	"github.com/containerd/nydus-snapshotter/pkg/snapshot"
 )
 
@@ -41,22 +48,21 @@ func chooseProcessor(ctx context.Context, logger *logrus.Entry,
 
 	remoteHandler := func(id string, labels map[string]string) func() (bool, []mount.Mount, error) {
 		return func() (bool, []mount.Mount, error) {
-			logger.Debugf("Prepare remote snapshot %s", id)
-			if err := sn.fs.Mount(ctx, id, labels, &s); err != nil {
+			if err := sn.mountInstance(ctx, logger, key, id, "", labels, &s); err != nil {
 				return false, nil, err
 			}
-
-			// Let Prepare operation show the rootfs content.
-			if err := sn.fs.WaitUntilReady(id); err != nil {
-				return false, nil, err
-			}
-
-			logger.Infof("Nydus remote snapshot %s is ready", id)
 			mounts, err := sn.mountRemote(ctx, labels, s, id, key)
 			return false, mounts, err
 		}
 	}
 
+	// Handler to mount the RAFS instance once containerd asks for mounts of the
+	// container snapshot, when the container and its pod sandbox are known.
+	deferredHandler := func() (bool, []mount.Mount, error) {
+		logger.Infof("Defer mounting Nydus snapshot %s until its sandbox is known", key)
+		return false, nil, nil
+	}
+
 	proxyHandler := func() (bool, []mount.Mount, error) {
 		mounts, err := sn.mountProxy(ctx, s)
 		return false, mounts, err
@@ -82,6 +88,9 @@ func chooseProcessor(ctx context.Context, logger *logrus.Entry,
 		case label.IsNydusDataLayer(labels):
 			logger.Debugf("found nydus data layer")
 			handler = skipHandler
+		case !sn.lazyLoadingAllowed(logger, labels):
+			// Let containerd download and unpack the whole layer.
+			handler = defaultHandler
 		case sn.fs.CheckReferrer(ctx, labels):
 			logger.Debugf("found referenced nydus manifest")
 			handler = skipHandler
@@ -137,12 +146,16 @@ func chooseProcessor(ctx context.Context, logger *logrus.Entry,
 		if handler == nil {
 			if id, info, err := sn.findMetaLayer(ctx, key); err == nil {
 				logger.Infof("Prepare active Nydus snapshot %s", key)
-				handler = remoteHandler(id, info.Labels)
+				if sn.podSandboxes != nil {
+					handler = deferredHandler
+				} else {
+					handler = remoteHandler(id, info.Labels)
+				}
 			}
 		}
 
 		if handler == nil && sn.fs.ReferrerDetectEnabled() {
-			if id, info, err := sn.findReferrerLayer(ctx, key); err == nil {
+			if id, info, err := sn.findReferrerLayer(ctx, key); err == nil && sn.lazyLoadingAllowed(logger, info.Labels) {
 				logger.Infof("Found referenced nydus manifest for image: %s", info.Labels[snpkg.TargetRefLabel])
 				metaPath := path.Join(sn.snapshotDir(id), "fs", "image.boot")
 				if err := sn.fs.TryFetchMetadata(ctx, info.Labels, metaPath); err != nil {
@@ -181,3 +194,72 @@ func chooseProcessor(ctx context.Context, logger *logrus.Entry,
 
 	return handler, target, err
 }
+
+// Collect IDs of the data blobs of a nydus image from the data layers under the snapshot.
+func imageBlobIDs(ctx context.Context, ms *storage.MetaStore, key string) ([]string, error) {
+	blobs := []string{}
+	_, _, err := snapshot.IterateParentSnapshots(ctx, ms, key, func(_ string, info snapshots.Info) bool {
+		if label.IsNydusDataLayer(info.Labels) {
+			if d, err := digest.Parse(info.Labels[label.CRILayerDigest]); err == nil {
+				blobs = append(blobs, d.Encoded())
+			}
+		}
+		return false
+	})
+	if err != nil && !errdefs.IsNotFound(err) {
+		return nil, err
+	}
+	return blobs, nil
+}
+
+// Mount the RAFS instance of snapshot `id` for the active snapshot `key`, and wait
+// until it is ready. In pod daemon mode, the instance is the one of the sandbox,
+// which is empty if the container belongs to no sandbox.
+func (sn *snapshotter) mountInstance(ctx context.Context, logger *logrus.Entry, key, id, sandboxID string,
+	labels map[string]string, s *storage.Snapshot) error {
+	logger.Debugf("Prepare remote snapshot %s", id)
+	ctx = filesystem.WithSandboxID(ctx, sandboxID)
+	lazyLoading := true
+	if label.IsNydusMetaLayer(labels) {
+		blobs, err := imageBlobIDs(ctx, sn.ms, key)
+		if err != nil {
+			return errors.Wrapf(err, "collect blobs of snapshot %s", id)
+		}
+		labels = maps.Clone(labels)
+		labels[label.NydusImageBlobIDs] = strings.Join(blobs, ",")
+
+		if lazyLoading = sn.lazyLoadingAllowed(logger, labels); !lazyLoading {
+			// Nydus image layers can't be unpacked by containerd, let nydusd
+			// download all of them instead.
+			labels[label.NydusPrefetchAll] = "true"
+			labels[label.NydusPrefetchPriority] = prefetch.PriorityCritical
+		}
+	}
+	if err := sn.fs.Mount(ctx, id, labels, s); err != nil {
+		return err
+	}
+
+	instanceID := filesystem.PodInstanceID(sandboxID, id)
+	// Let Prepare operation show the rootfs content.
+	if err := sn.fs.WaitUntilReady(instanceID); err != nil {
+		return err
+	}
+	// Images denied lazy loading must not depend on the network once started.
+	if !lazyLoading {
+		if err := sn.fs.WaitUntilFullyCached(ctx, instanceID); err != nil {
+			return errors.Wrapf(err, "fetch image of snapshot %s", id)
+		}
+	}
+
+	logger.Infof("Nydus remote snapshot %s is ready", id)
+	return nil
+}
+
+func (sn *snapshotter) lazyLoadingAllowed(logger *logrus.Entry, labels map[string]string) bool {
+	ref := labels[label.CRIImageRef]
+	allowed, reason := sn.lazyLoadingPolicy.Allowed(ref)
+	if !allowed {
+		logger.Infof("Lazy loading of image %s is denied, %s", ref, reason)
+	}
+	return allowed
+}
@@ -12,9 +12,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/containerd/containerd/v2/core/mount"
 	"github.com/containerd/containerd/v2/core/snapshots"
@@ -27,21 +30,32 @@ import (
 	"github.com/containerd/nydus-snapshotter/pkg/rafs"
 
 	"github.com/containerd/nydus-snapshotter/pkg/cache"
+	"github.com/containerd/nydus-snapshotter/pkg/capability"
 	"github.com/containerd/nydus-snapshotter/pkg/cgroup"
 	v2 "github.com/containerd/nydus-snapshotter/pkg/cgroup/v2"
+	"github.com/containerd/nydus-snapshotter/pkg/diskspace"
+	"github.com/containerd/nydus-snapshotter/pkg/endpoint"
 	"github.com/containerd/nydus-snapshotter/pkg/errdefs"
 	mgr "github.com/containerd/nydus-snapshotter/pkg/manager"
 	"github.com/containerd/nydus-snapshotter/pkg/metrics"
 	"github.com/containerd/nydus-snapshotter/pkg/metrics/collector"
+	"github.com/containerd/nydus-snapshotter/pkg/mountns"
+	"github.com/containerd/nydus-snapshotter/pkg/policy"
 	"github.com/containerd/nydus-snapshotter/pkg/pprof"
+	"github.com/containerd/nydus-snapshotter/pkg/prefetch"
+	"github.com/containerd/nydus-snapshotter/pkg/recovery"
 	"github.com/containerd/nydus-snapshotter/pkg/referrer"
 	"github.com/containerd/nydus-snapshotter/pkg/system"
 	"github.com/containerd/nydus-snapshotter/pkg/tarfs"
 
 	"github.com/containerd/nydus-snapshotter/pkg/store"
+	"github.com/containerd/nydus-snapshotter/pkg/umount"
+	"github.com/containerd/nydus-snapshotter/pkg/utils/parser"
 
 	"github.com/containerd/nydus-snapshotter/pkg/filesystem"
+	"github.com/containerd/nydus-snapshotter/pkg/fuseconn"
 	"github.com/containerd/nydus-snapshotter/pkg/label"
+	"github.com/containerd/nydus-snapshotter/pkg/launcher"
 	"github.com/containerd/nydus-snapshotter/pkg/signature"
 	"github.com/containerd/nydus-snapshotter/pkg/snapshot"
 )
@@ -59,6 +73,19 @@ type snapshotter struct {
 	enableKataVolume     bool
 	syncRemove           bool
 	cleanupOnClose       bool
+	shutdownMarker       *recovery.ShutdownMarker
+	lazyLoadingPolicy    *policy.LazyLoadingPolicy
+	umountQueue          *umount.Queue
+	// Nil if disk pressure isn't handled
+	diskMonitor *diskspace.Monitor
+	// Finds the sandbox of the container using an active snapshot, nil unless
+	// RAFS instances are served by pod daemons.
+	podSandboxes *recovery.SandboxResolver
+	// Deduplicate mounting RAFS instances for sandboxes, keyed by instance ID
+	podMounts singleflight.Group
+	// OCI images stacking more layers than this on overlayfs may exceed the kernel
+	// limit, only tarfs merges their layers.
+	maxLowerLayers int
 }
 
 func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapshots.Snapshotter, error) {
@@ -67,11 +94,34 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		return nil, errors.Wrap(err, "initialize image verifier")
 	}
 
+	lazyLoadingPolicy, err := policy.NewLazyLoadingPolicy(cfg.LazyLoadingConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "initialize lazy loading policy")
+	}
+
 	db, err := store.NewDatabase(cfg.Root)
 	if err != nil {
 		return nil, errors.Wrap(err, "create database")
 	}
 
+	// Reconcile the persisted states with the host before any daemon is recovered
+	// if the previous snapshotter did not shut down cleanly.
+	shutdownMarker := recovery.NewShutdownMarker(cfg.Root, db)
+	unclean, err := shutdownMarker.Mark()
+	if err != nil {
+		return nil, errors.Wrap(err, "detect unclean shutdown")
+	}
+	if unclean {
+		log.L.Warnf("nydus-snapshotter was not shut down cleanly, reconciling states")
+		if _, err := recovery.Reconcile(ctx, recovery.Opt{
+			Database:   db,
+			RootDir:    cfg.Root,
+			SocketRoot: config.GetSocketRoot(),
+		}); err != nil {
+			return nil, errors.Wrap(err, "reconcile states")
+		}
+	}
+
 	rp, err := config.ParseRecoverPolicy(cfg.DaemonConfig.RecoverPolicy)
 	if err != nil {
 		return nil, errors.Wrap(err, "parse recover policy")
@@ -94,10 +144,25 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		}
 	}
 
+	nydusdLauncher := launcher.Config{
+		Env:             cfg.DaemonConfig.Env,
+		SeccompProfile:  cfg.DaemonConfig.SeccompProfile,
+		NoNewPrivileges: cfg.DaemonConfig.NoNewPrivileges,
+		AppArmorProfile: cfg.DaemonConfig.AppArmorProfile,
+	}
+	if err := nydusdLauncher.Validate(); err != nil {
+		return nil, errors.Wrap(err, "validate nydusd confinement")
+	}
+
 	var skipSSLVerify bool
 	var daemonConfig *daemonconfig.DaemonConfig
 	fsDriver := config.GetFsDriver()
 	if fsDriver == config.FsDriverFscache || fsDriver == config.FsDriverFusedev {
+		if cfg.DaemonConfig.MigrateNydusdConfig {
+			if err := daemonconfig.MigrateTemplate(cfg.DaemonConfig.NydusdConfigPath); err != nil {
+				log.L.WithError(err).Warnf("Failed to migrate nydusd configuration template in place")
+			}
+		}
 		config, err := daemonconfig.NewDaemonConfig(config.GetFsDriver(), cfg.DaemonConfig.NydusdConfigPath)
 		if err != nil {
 			return nil, errors.Wrap(err, "load daemon configuration")
@@ -109,6 +174,23 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		skipSSLVerify = config.GetSkipSSLVerify()
 	}
 
+	ioEngine := config.IOEngineSync
+	if daemonConfig != nil {
+		ioEngine = capability.Detect().NydusdIOEngine(cfg.DaemonConfig.NydusdPath, cfg.DaemonConfig.IOEngine)
+		if ioEngine != cfg.DaemonConfig.IOEngine {
+			log.L.Warnf("IO engine %s is unavailable on the node or nydusd, nydusd falls back to %s",
+				cfg.DaemonConfig.IOEngine, ioEngine)
+		}
+	}
+
+	var mountNamespaces *mountns.Pool
+	if size := cfg.DaemonConfig.MountNamespacePoolSize; size > 0 {
+		mountNamespaces, err = mountns.NewPool(size, cfg.Root)
+		if err != nil {
+			return nil, errors.Wrap(err, "create mount namespace pool")
+		}
+	}
+
 	fsManagers := []*mgr.Manager{}
 	if cfg.Experimental.TarfsConfig.EnableTarfs {
 		blockdevManager, err := mgr.NewManager(mgr.Opt{
@@ -117,6 +199,8 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 			CacheDir:         cfg.CacheManagerConfig.CacheDir,
 			RootDir:          cfg.Root,
 			RecoverPolicy:    rp,
+			SupervisorDir:    cfg.DaemonConfig.SupervisorDir,
+			Launcher:         nydusdLauncher,
 			FsDriver:         config.FsDriverBlockdev,
 			DaemonConfig:     nil,
 			CgroupMgr:        cgroupMgr,
@@ -134,9 +218,13 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 			CacheDir:         cfg.CacheManagerConfig.CacheDir,
 			RootDir:          cfg.Root,
 			RecoverPolicy:    rp,
+			SupervisorDir:    cfg.DaemonConfig.SupervisorDir,
+			Launcher:         nydusdLauncher,
 			FsDriver:         config.FsDriverFscache,
 			DaemonConfig:     daemonConfig,
 			CgroupMgr:        cgroupMgr,
+			MountNamespaces:  mountNamespaces,
+			IOEngine:         ioEngine,
 		})
 		if err != nil {
 			return nil, errors.Wrap(err, "create fscache manager")
@@ -151,9 +239,13 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 			CacheDir:         cfg.CacheManagerConfig.CacheDir,
 			RootDir:          cfg.Root,
 			RecoverPolicy:    rp,
+			SupervisorDir:    cfg.DaemonConfig.SupervisorDir,
+			Launcher:         nydusdLauncher,
 			FsDriver:         config.FsDriverFusedev,
 			DaemonConfig:     daemonConfig,
 			CgroupMgr:        cgroupMgr,
+			MountNamespaces:  mountNamespaces,
+			IOEngine:         ioEngine,
 		})
 		if err != nil {
 			return nil, errors.Wrap(err, "create fusedev manager")
@@ -168,6 +260,8 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 			CacheDir:         cfg.CacheManagerConfig.CacheDir,
 			RootDir:          cfg.Root,
 			RecoverPolicy:    rp,
+			SupervisorDir:    cfg.DaemonConfig.SupervisorDir,
+			Launcher:         nydusdLauncher,
 			FsDriver:         config.FsDriverProxy,
 			DaemonConfig:     nil,
 			CgroupMgr:        cgroupMgr,
@@ -188,7 +282,11 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 
 	// Start to collect metrics.
 	if cfg.MetricsConfig.Address != "" {
-		if err := metrics.NewMetricsHTTPListenerServer(cfg.MetricsConfig.Address); err != nil {
+		security, err := endpoint.NewSecurity(cfg.MetricsConfig.TLS, filepath.Join(cfg.Root, "certs", "metrics"), cfg.MetricsConfig.Address)
+		if err != nil {
+			return nil, errors.Wrap(err, "secure metrics HTTP server")
+		}
+		if err := metrics.NewMetricsHTTPListenerServer(cfg.MetricsConfig.Address, security); err != nil {
 			return nil, errors.Wrap(err, "start metrics HTTP server")
 		}
 		go func() {
@@ -206,6 +304,32 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		filesystem.WithVerifier(verifier),
 		filesystem.WithRootMountpoint(config.GetRootMountpoint()),
 		filesystem.WithEnableStargz(cfg.Experimental.EnableStargz),
+		filesystem.WithEnforceDigestValidate(cfg.DaemonConfig.EnforceDigestValidate),
+		filesystem.WithReadAhead(cfg.ReadAheadConfig),
+	}
+
+	var prefetchScheduler *prefetch.Scheduler
+	if scheduleCfg := cfg.PrefetchScheduleConfig; scheduleCfg.Enable {
+		opt := prefetch.ScheduleOpt{IdleCPUPercent: scheduleCfg.IdleCPUPercent}
+		for _, w := range scheduleCfg.Windows {
+			window, err := prefetch.ParseWindow(w)
+			if err != nil {
+				return nil, errors.Wrap(err, "parse prefetch schedule window")
+			}
+			opt.Windows = append(opt.Windows, window)
+		}
+		if scheduleCfg.IdleNetworkRate != "" {
+			rate, err := parser.MemoryConfigToBytes(scheduleCfg.IdleNetworkRate, 0)
+			if err != nil || rate < 0 {
+				return nil, errors.Errorf("invalid idle network rate %q", scheduleCfg.IdleNetworkRate)
+			}
+			opt.IdleNetworkRate = float64(rate)
+		}
+		if opt.Interval, err = time.ParseDuration(scheduleCfg.CheckInterval); err != nil || opt.Interval <= 0 {
+			return nil, errors.Errorf("invalid prefetch schedule check interval %q", scheduleCfg.CheckInterval)
+		}
+		prefetchScheduler = prefetch.NewScheduler(opt)
+		opts = append(opts, filesystem.WithPrefetchScheduler(prefetchScheduler))
 	}
 
 	cacheConfig := &cfg.CacheManagerConfig
@@ -220,6 +344,36 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 	}
 	opts = append(opts, filesystem.WithCacheManager(cacheMgr))
 
+	if !cacheConfig.Disable && cacheConfig.ScrubPeriod != "" {
+		period, err := time.ParseDuration(cacheConfig.ScrubPeriod)
+		if err != nil || period <= 0 {
+			return nil, errors.Errorf("invalid cache scrub period %q", cacheConfig.ScrubPeriod)
+		}
+		scrubber := cache.NewScrubber(cache.ScrubOpt{
+			CacheDir: cacheConfig.CacheDir,
+			Period:   period,
+			Rate:     cacheConfig.ScrubRate,
+			Bootstraps: func() []string {
+				var bootstraps []string
+				for _, r := range rafs.RafsGlobalCache.List() {
+					if bootstrap, err := r.BootstrapFile(); err == nil {
+						bootstraps = append(bootstraps, bootstrap)
+					}
+				}
+				return bootstraps
+			},
+		})
+		go scrubber.Run(ctx)
+	}
+
+	if cacheConfig.ImageQuota != "" {
+		quota, err := filesystem.ParseCacheQuota(cacheConfig.ImageQuota)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse image cache quota")
+		}
+		opts = append(opts, filesystem.WithCacheQuota(quota))
+	}
+
 	if cfg.Experimental.EnableReferrerDetect {
 		referrerMgr := referrer.NewManager(skipSSLVerify)
 		opts = append(opts, filesystem.WithReferrerManager(referrerMgr))
@@ -228,7 +382,7 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 	if cfg.Experimental.TarfsConfig.EnableTarfs {
 		tarfsMgr := tarfs.NewManager(skipSSLVerify, cfg.Experimental.TarfsConfig.TarfsHint,
 			cacheConfig.CacheDir, cfg.DaemonConfig.NydusImagePath,
-			int64(cfg.Experimental.TarfsConfig.MaxConcurrentProc))
+			int64(cfg.Experimental.TarfsConfig.MaxConcurrentProc), cfg.Experimental.TarfsConfig.MaxLowerLayers)
 		opts = append(opts, filesystem.WithTarfsManager(tarfsMgr))
 	}
 
@@ -237,8 +391,22 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		return nil, errors.Wrap(err, "initialize filesystem thin layer")
 	}
 
+	umountQueue := umount.NewQueue()
+
 	if config.IsSystemControllerEnabled() {
-		systemController, err := system.NewSystemController(nydusFs, fsManagers, config.SystemControllerAddress())
+		controllerOpts := []system.ControllerOpt{
+			system.WithLazyLoadingPolicy(lazyLoadingPolicy),
+			system.WithUmountQueue(umountQueue),
+		}
+		if address := config.SystemControllerAddress(); config.IsTCPAddress(address) {
+			security, err := endpoint.NewSecurity(cfg.SystemControllerConfig.TLS,
+				filepath.Join(cfg.Root, "certs", "system"), config.TrimTCPAddress(address))
+			if err != nil {
+				return nil, errors.Wrap(err, "secure system controller")
+			}
+			controllerOpts = append(controllerOpts, system.WithSecurity(security))
+		}
+		systemController, err := system.NewSystemController(nydusFs, fsManagers, config.SystemControllerAddress(), controllerOpts...)
 		if err != nil {
 			return nil, errors.Wrap(err, "create system controller")
 		}
@@ -284,6 +452,123 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		syncRemove = true
 	}
 
+	if checkCfg := cfg.MountCheckConfig; checkCfg.Enable {
+		interval, err := time.ParseDuration(checkCfg.Interval)
+		if err != nil || interval <= 0 {
+			return nil, errors.Errorf("invalid mount check interval %q", checkCfg.Interval)
+		}
+		snapshotRoot := filepath.Join(cfg.Root, "snapshots")
+		checker := recovery.NewMountChecker(recovery.MountCheckOpt{
+			Database: db,
+			RootDir:  cfg.Root,
+			Interval: interval,
+			AutoHeal: checkCfg.AutoHeal,
+			RunningSnapshots: func(ctx context.Context) (map[string]bool, error) {
+				return recovery.RunningSnapshots(ctx, checkCfg.ContainerdAddress, snapshotRoot)
+			},
+			Remount: nydusFs.Remount,
+		})
+		go checker.Run(ctx)
+	}
+
+	if checkCfg := cfg.FuseConnCheckConfig; checkCfg.Enable && config.GetFsDriver() == config.FsDriverFusedev {
+		interval, err := time.ParseDuration(checkCfg.Interval)
+		if err != nil || interval <= 0 {
+			return nil, errors.Errorf("invalid FUSE connection check interval %q", checkCfg.Interval)
+		}
+		var fusedevManager *mgr.Manager
+		for _, m := range fsManagers {
+			if m.FsDriver == config.FsDriverFusedev {
+				fusedevManager = m
+			}
+		}
+		watcher := fuseconn.NewWatcher(fuseconn.Opt{
+			Interval: interval,
+			Targets: func() []fuseconn.Target {
+				var targets []fuseconn.Target
+				for _, d := range fusedevManager.ListDaemons() {
+					if d.HostMountpoint() == "" {
+						continue
+					}
+					t := fuseconn.Target{DaemonID: d.ID(), Mountpoint: d.HostMountpoint()}
+					for _, r := range d.RafsCache.List() {
+						t.Instances = append(t.Instances, r.SnapshotID)
+					}
+					targets = append(targets, t)
+				}
+				return targets
+			},
+			OnAborted: func(_ context.Context, daemonID string) {
+				d := fusedevManager.GetByDaemonID(daemonID)
+				// Dead daemons are recovered by the liveness monitor.
+				if !checkCfg.AutoRecover || d == nil {
+					return
+				}
+				if _, err := d.GetState(); err != nil {
+					return
+				}
+				fusedevManager.RestartAbortedDaemon(d)
+			},
+		})
+		go watcher.Run(ctx)
+	}
+
+	if !cacheConfig.Disable && config.GetFsDriver() == config.FsDriverFusedev {
+		interval, err := time.ParseDuration(cacheConfig.QuotaCheckInterval)
+		if err != nil || interval <= 0 {
+			return nil, errors.Errorf("invalid cache quota check interval %q", cacheConfig.QuotaCheckInterval)
+		}
+		go nydusFs.RunCacheQuotaEnforcer(ctx, interval, func(ctx context.Context) ([]cache.ImageCache, error) {
+			return imageCaches(ctx, ms)
+		})
+	}
+
+	var podSandboxes *recovery.SandboxResolver
+	if config.GetDaemonMode() == config.DaemonModePod && config.GetFsDriver() == config.FsDriverFusedev {
+		podCfg := cfg.PodDaemonConfig
+		interval, err := time.ParseDuration(podCfg.ReapInterval)
+		if err != nil || interval <= 0 {
+			return nil, errors.Errorf("invalid pod daemon reap interval %q", podCfg.ReapInterval)
+		}
+		go nydusFs.RunPodDaemonReaper(ctx, interval, func(ctx context.Context) (map[string]bool, error) {
+			return recovery.Sandboxes(ctx, podCfg.ContainerdAddress)
+		})
+		podSandboxes = recovery.NewSandboxResolver(podCfg.ContainerdAddress)
+	}
+
+	var diskMonitor *diskspace.Monitor
+	if diskCfg := cfg.DiskPressureConfig; diskCfg.Enable {
+		minFree, err := parser.MemoryConfigToBytes(diskCfg.MinFreeSpace, 0)
+		if err != nil || minFree < 0 {
+			return nil, errors.Errorf("invalid minimum free disk space %q", diskCfg.MinFreeSpace)
+		}
+		interval, err := time.ParseDuration(diskCfg.CheckInterval)
+		if err != nil || interval <= 0 {
+			return nil, errors.Errorf("invalid disk pressure check interval %q", diskCfg.CheckInterval)
+		}
+		diskMonitor = diskspace.NewMonitor(diskspace.Opt{
+			Dirs:         []string{cacheConfig.CacheDir, filepath.Join(cfg.Root, "snapshots")},
+			MinFreeBytes: uint64(minFree),
+			Interval:     interval,
+			OnFull: func(ctx context.Context) {
+				nydusFs.EnterDiskPressure(ctx, diskCfg.EvictUnusedCaches)
+			},
+			OnRecovered: nydusFs.LeaveDiskPressure,
+		})
+		go diskMonitor.Run(ctx)
+	}
+
+	if prefetchScheduler != nil {
+		go prefetchScheduler.Run(ctx)
+	}
+
+	umountQueue.Start(context.Background())
+
+	maxLowerLayers := cfg.Experimental.TarfsConfig.MaxLowerLayers
+	if maxLowerLayers <= 0 {
+		maxLowerLayers = tarfs.DefaultMaxLowerLayers
+	}
+
 	return &snapshotter{
 		root:                 cfg.Root,
 		nydusdPath:           cfg.DaemonConfig.NydusdPath,
@@ -295,6 +580,12 @@ func NewSnapshotter(ctx context.Context, cfg *config.SnapshotterConfig) (snapsho
 		nydusOverlayFSPath:   cfg.SnapshotsConfig.NydusOverlayFSPath,
 		enableKataVolume:     cfg.SnapshotsConfig.EnableKataVolume,
 		cleanupOnClose:       cfg.CleanupOnClose,
+		shutdownMarker:       shutdownMarker,
+		diskMonitor:          diskMonitor,
+		lazyLoadingPolicy:    lazyLoadingPolicy,
+		umountQueue:          umountQueue,
+		podSandboxes:         podSandboxes,
+		maxLowerLayers:       maxLowerLayers,
 	}, nil
 }
 
@@ -312,9 +603,7 @@ func (o *snapshotter) Cleanup(ctx context.Context) error {
 	log.L.Infof("[Cleanup] orphan directories %v", cleanup)
 
 	for _, dir := range cleanup {
-		if err := o.cleanupSnapshotDirectory(ctx, dir); err != nil {
-			log.L.WithError(err).Warnf("failed to remove directory %s", dir)
-		}
+		o.enqueueCleanup(dir)
 	}
 	return nil
 }
@@ -404,7 +693,14 @@ func (o *snapshotter) Mounts(ctx context.Context, key string) ([]mount.Mount, er
 		if info.Parent != "" {
 			pKey := info.Parent
 			if pID, pInfo, _, err := snapshot.GetSnapshotInfo(ctx, o.ms, pKey); err == nil {
-				if label.IsNydusMetaLayer(pInfo.Labels) {
+				if label.IsNydusMetaLayer(pInfo.Labels) && o.podSandboxes != nil {
+					instanceID, err := o.mountPodInstance(ctx, key, pID, pInfo.Labels)
+					if err != nil {
+						return nil, errors.Wrapf(err, "mounts: mount snapshot %s", pID)
+					}
+					needRemoteMounts = true
+					metaSnapshotID = instanceID
+				} else if label.IsNydusMetaLayer(pInfo.Labels) {
 					if err = o.fs.WaitUntilReady(pID); err != nil {
 						return nil, errors.Wrapf(err, "mounts: snapshot %s is not ready, err: %v", pID, err)
 					}
@@ -446,8 +742,41 @@ func (o *snapshotter) Mounts(ctx context.Context, key string) ([]mount.Mount, er
 	return o.mountNative(ctx, info.Labels, *snap)
 }
 
+// Mount the RAFS instance serving the nydus image for the sandbox of the container
+// using the active snapshot, and return the instance ID. Containers of no sandbox,
+// or not known by containerd, are served by instances of their own daemons.
+func (o *snapshotter) mountPodInstance(ctx context.Context, key, id string, labels map[string]string) (string, error) {
+	sandboxID, err := o.podSandboxes.ContainerSandbox(ctx, key)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return "", errors.Wrapf(err, "find sandbox of snapshot %s", key)
+	}
+	instanceID := filesystem.PodInstanceID(sandboxID, id)
+
+	// Containers of the same sandbox share the mounting of its instance, while
+	// other sandboxes don't wait for it.
+	_, err, _ = o.podMounts.Do(instanceID, func() (interface{}, error) {
+		err := o.fs.WaitUntilReady(instanceID)
+		if err == nil || !errors.Is(err, errdefs.ErrNotFound) {
+			return nil, err
+		}
+
+		s, err := snapshot.GetSnapshot(ctx, o.ms, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get snapshot %s", key)
+		}
+		logger := log.L.WithField("key", key).WithField("sandbox", sandboxID)
+		return nil, o.mountInstance(ctx, logger, key, id, sandboxID, labels, s)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return instanceID, nil
+}
+
 func (o *snapshotter) Prepare(ctx context.Context, key, parent string, opts ...snapshots.Opt) ([]mount.Mount, error) {
 	log.L.Infof("[Prepare] snapshot with key %s parent %s", key, parent)
+	ctx = filesystem.WithPrepareStart(ctx, time.Now())
 
 	if timer := collector.NewSnapshotMetricsTimer(collector.SnapshotMethodPrepare); timer != nil {
 		defer timer.ObserveDuration()
@@ -455,9 +784,13 @@ func (o *snapshotter) Prepare(ctx context.Context, key, parent string, opts ...s
 
 	logger := log.L.WithField("key", key).WithField("parent", parent)
 
+	if o.diskMonitor != nil && o.diskMonitor.Full() {
+		return nil, errors.Wrapf(errdefs.ErrDiskFull, "prepare snapshot %s", key)
+	}
+
 	info, s, err := o.createSnapshot(ctx, snapshots.KindActive, key, parent, opts)
 	if err != nil {
-		return nil, err
+		return nil, o.checkDiskFull(ctx, err)
 	}
 
 	logger.Debugf("[Prepare] snapshot with labels %v", info.Labels)
@@ -468,6 +801,7 @@ func (o *snapshotter) Prepare(ctx context.Context, key, parent string, opts ...s
 	}
 
 	needCommit, mounts, err := processor()
+	err = o.checkDiskFull(ctx, err)
 
 	if needCommit {
 		err := o.Commit(ctx, target, key, append(opts, snapshots.WithLabels(info.Labels))...)
@@ -635,6 +969,9 @@ func (o *snapshotter) Remove(ctx context.Context, key string) error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to remove key %s", key)
 	}
+	if o.podSandboxes != nil {
+		o.podSandboxes.Forget(key)
+	}
 
 	if o.syncRemove {
 		var removals []string
@@ -674,6 +1011,65 @@ func (o *snapshotter) Walk(ctx context.Context, fn snapshots.WalkFunc, fs ...str
 	return storage.WalkInfo(ctx, fn, fs...)
 }
 
+// Images of the nydus meta layers in the snapshot store with the blobs they consist
+// of, whether their snapshots are mounted or not.
+func imageCaches(ctx context.Context, ms *storage.MetaStore) ([]cache.ImageCache, error) {
+	var metas []snapshots.Info
+	err := func() error {
+		ctx, t, err := ms.TransactionContext(ctx, false)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := t.Rollback(); err != nil {
+				log.L.WithError(err).Warn("Rollback transaction")
+			}
+		}()
+		return storage.WalkInfo(ctx, func(_ context.Context, info snapshots.Info) error {
+			if info.Kind == snapshots.KindCommitted && label.IsNydusMetaLayer(info.Labels) {
+				metas = append(metas, info)
+			}
+			return nil
+		})
+	}()
+	if err != nil {
+		return nil, errors.Wrap(err, "walk snapshots")
+	}
+
+	images := map[string]*cache.ImageCache{}
+	for _, info := range metas {
+		ref, ok := info.Labels[snpkg.TargetRefLabel]
+		if !ok {
+			continue
+		}
+		img, ok := images[ref]
+		if !ok {
+			img = &cache.ImageCache{Image: ref}
+			images[ref] = img
+		}
+		if v, ok := info.Labels[label.NydusCacheQuota]; ok {
+			if quota, err := filesystem.ParseCacheQuota(v); err == nil {
+				img.Quota = quota
+			}
+		}
+		blobs, err := imageBlobIDs(ctx, ms, info.Name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "collect blobs of snapshot %s", info.Name)
+		}
+		img.Blobs = append(img.Blobs, blobs...)
+	}
+
+	caches := make([]cache.ImageCache, 0, len(images))
+	for _, img := range images {
+		caches = append(caches, *img)
+	}
+	sort.Slice(caches, func(i, j int) bool {
+		return caches[i].Image < caches[j].Image
+	})
+
+	return caches, nil
+}
+
 func (o *snapshotter) Close() error {
 	log.L.Info("[Close] shutdown snapshotter")
 
@@ -684,14 +1080,27 @@ func (o *snapshotter) Close() error {
 		}
 	}
 
+	// Directories not cleaned up yet are found again by the next Cleanup.
+	o.umountQueue.Stop()
+
 	o.fs.TryStopSharedDaemon()
 
+	if o.podSandboxes != nil {
+		if err := o.podSandboxes.Close(); err != nil {
+			log.L.Errorf("failed to close containerd connection, err %v", err)
+		}
+	}
+
 	if o.cgroupManager != nil {
 		if err := o.cgroupManager.Delete(); err != nil {
 			log.L.Errorf("failed to destroy cgroup, err %v", err)
 		}
 	}
 
+	if err := o.shutdownMarker.Release(); err != nil {
+		log.L.Errorf("failed to mark clean shutdown, err %v", err)
+	}
+
 	return o.ms.Close()
 }
 
@@ -961,6 +1370,12 @@ func (o *snapshotter) mountNative(ctx context.Context, labels map[string]string,
 		return bindMount(o.upperPath(s.ID), "ro"), nil
 	}
 
+	// Layers of OCI images are merged into one lower directory only by tarfs.
+	if len(s.ParentIDs) > o.maxLowerLayers {
+		log.G(ctx).Warnf("Snapshot %s stacks %d layers by overlayfs exceeding %d, the mount may fail, "+
+			"enable tarfs to merge them", s.ID, len(s.ParentIDs), o.maxLowerLayers)
+	}
+
 	parentPaths := make([]string, len(s.ParentIDs))
 	for i := range s.ParentIDs {
 		parentPaths[i] = o.upperPath(s.ParentIDs[i])
@@ -1041,11 +1456,28 @@ func (o *snapshotter) cleanupDirectories(ctx context.Context) ([]string, error)
 	return o.getCleanupDirectories(ctx)
 }
 
+// Umount and remove the snapshot directory in background, it is retried on failures
+// such as the mountpoint being busy with lingering file handles. The directory is
+// kept if umount never succeeds, see the dead letters of the queue.
+func (o *snapshotter) enqueueCleanup(dir string) {
+	o.umountQueue.Add(dir, func(ctx context.Context) error {
+		return o.removeSnapshotDirectory(ctx, dir, false)
+	})
+}
+
 func (o *snapshotter) cleanupSnapshotDirectory(ctx context.Context, dir string) error {
+	return o.removeSnapshotDirectory(ctx, dir, true)
+}
+
+// Umount failures are returned without removing the directory unless `force` is set.
+func (o *snapshotter) removeSnapshotDirectory(ctx context.Context, dir string, force bool) error {
 	// For example: cleanupSnapshotDirectory /var/lib/containerd/io.containerd.snapshotter.v1.nydus/snapshots/34" dir=/var/lib/containerd/io.containerd.snapshotter.v1.nydus/snapshots/34
 
 	snapshotID := filepath.Base(dir)
 	if err := o.fs.Umount(ctx, snapshotID); err != nil && !os.IsNotExist(err) {
+		if !force {
+			return errors.Wrapf(err, "umount snapshot %s", snapshotID)
+		}
 		log.G(ctx).WithError(err).WithField("dir", dir).Error("failed to unmount")
 	}
 
@@ -1062,6 +1494,14 @@ func (o *snapshotter) cleanupSnapshotDirectory(ctx context.Context, dir string)
 	return nil
 }
 
+// Report ENOSPC to the disk monitor, which is returned as the disk full error.
+func (o *snapshotter) checkDiskFull(ctx context.Context, err error) error {
+	if err != nil && o.diskMonitor != nil && o.diskMonitor.ReportError(ctx, err) {
+		return errors.Wrapf(errdefs.ErrDiskFull, "%s", err)
+	}
+	return err
+}
+
 func (o *snapshotter) snapshotRoot() string {
 	return filepath.Join(o.root, "snapshots")
 }